@@ -4,6 +4,8 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -12,16 +14,54 @@ type Config struct {
 	MeilisearchURL      string
 	MeilisearchAPIKey   string
 	ServerPort          string
+	TrustedProxies      []string // Proxy IPs or CIDRs whose X-Forwarded-For headers are believed; none when empty
 	DatabaseURL         string
 	DatabaseMaxConns    int32
 	ShopifyAPIKey       string
 	ShopifyAPISecret    string
 	ShopifyAppURL       string
 	ShopifyScopes       string
+	ShopifyBillingTest  bool // Create test charges that are never billed (development stores)
 	JWTSigningKey       string
 	EncryptionKey       string
+	EncryptionKeys      string // Keyring as "id:hex" pairs; ENCRYPTION_KEY joins it as key 1
+	EncryptionPrimaryID int    // Key ID new secrets are encrypted with; 0 selects the highest ID
+	EncryptionKeyFile   string // JSON keyring file used instead of ENCRYPTION_KEYS when set
+	EncryptionEnvelope  bool   // Encrypt each store's secrets with its own data key wrapped by the keyring
 	WebhookSharedSecret string
 	SessionAPIKey       string // Optional API key for session endpoints
+	AdminAPIKey         string // API key for operator endpoints; admin routes are disabled when empty
+	WebhookWorkers      int
+	KeyRotationOverlap  time.Duration // How long a rotated storefront key keeps working
+	AccessTokenTTL      time.Duration // Lifetime of v1 user access tokens
+	RefreshTokenTTL     time.Duration // Lifetime of v1 user refresh tokens; each refresh issues a new one
+	TokenCacheTTL       time.Duration // How long access token revocation lookups are cached per instance
+	PasswordResetTTL    time.Duration // Lifetime of password reset tokens
+	PasswordResetURL    string        // Dashboard page that accepts ?token= to reset a password
+	EmailVerifyTTL      time.Duration // Lifetime of email verification tokens
+	EmailVerifyURL      string        // Dashboard page that accepts ?token= to verify an email address
+	RequireEmailVerify  bool          // Block client creation until the user's email is verified
+	InviteTTL           time.Duration // Lifetime of client invitations
+	InviteURL           string        // Dashboard page that accepts ?token= to accept a client invitation
+	LoginMaxFailures    int           // Failed logins within LoginFailureWindow that lock an account
+	LoginMaxIPFailures  int           // Failed logins within LoginFailureWindow that lock out a client IP
+	LoginFailureWindow  time.Duration // Failed logins older than this are forgotten
+	LoginLockout        time.Duration // How long an account or IP stays locked
+	LoginUnlockURL      string        // Dashboard page that accepts ?token= to unlock a locked account
+	MFAIssuer           string        // Issuer shown by authenticator apps
+	MFAChallengeTTL     time.Duration // How long the second login step may take
+	OIDCIssuerURL       string        // OpenID Connect provider for single sign-on; SSO is disabled when empty
+	OIDCClientID        string
+	OIDCClientSecret    string        // Optional; public clients rely on PKCE alone
+	OIDCRedirectURL     string        // Dashboard page the provider redirects to with ?code= and ?state=
+	OIDCScopes          string        // Space-separated scopes requested from the provider
+	OIDCProvisionUsers  bool          // Create users on their first SSO login instead of rejecting them
+	OIDCStateTTL        time.Duration // How long a started SSO login stays valid
+	SMTPHost            string        // Outgoing mail server; mail is not delivered when empty
+	SMTPPort            int
+	SMTPUsername        string
+	SMTPPassword        string
+	SMTPFrom            string
 	QdrantURL           string
 	QdrantAPIKey        string
 }
@@ -37,16 +77,54 @@ func LoadConfig() *Config {
 		MeilisearchURL:      getEnv("MEILISEARCH_URL", ""),
 		MeilisearchAPIKey:   getEnv("MEILISEARCH_API_KEY", ""),
 		ServerPort:          getEnv("PORT", "8080"),
+		TrustedProxies:      getEnvAsList("TRUSTED_PROXIES"),
 		DatabaseURL:         getEnv("DATABASE_URL", ""),
 		DatabaseMaxConns:    getEnvAsInt32("DATABASE_MAX_CONNS", 10),
 		ShopifyAPIKey:       getEnv("SHOPIFY_API_KEY", ""),
 		ShopifyAPISecret:    getEnv("SHOPIFY_API_SECRET", ""),
 		ShopifyAppURL:       getEnv("SHOPIFY_APP_URL", ""),
-		ShopifyScopes:       getEnv("SHOPIFY_SCOPES", "read_products,write_products,read_product_listings,read_collection_listings,read_inventory,write_webhooks"),
+		ShopifyScopes:       getEnv("SHOPIFY_SCOPES", "read_products,write_products,read_product_listings,read_collection_listings,read_inventory,write_webhooks,read_translations,read_content"),
+		ShopifyBillingTest:  getEnvAsBool("SHOPIFY_BILLING_TEST", false),
 		JWTSigningKey:       getEnv("JWT_SIGNING_KEY", ""),
 		EncryptionKey:       getEnv("ENCRYPTION_KEY", ""),
+		EncryptionKeys:      getEnv("ENCRYPTION_KEYS", ""),
+		EncryptionPrimaryID: getEnvAsInt("ENCRYPTION_PRIMARY_KEY_ID", 0),
+		EncryptionKeyFile:   getEnv("ENCRYPTION_KEYRING_FILE", ""),
+		EncryptionEnvelope:  getEnvAsBool("ENCRYPTION_ENVELOPE", false),
 		WebhookSharedSecret: getEnv("SHOPIFY_WEBHOOK_SECRET", ""),
 		SessionAPIKey:       getEnv("SESSION_API_KEY", ""), // Optional
+		AdminAPIKey:         getEnv("ADMIN_API_KEY", ""),
+		WebhookWorkers:      getEnvAsInt("WEBHOOK_WORKERS", 4),
+		KeyRotationOverlap:  getEnvAsDuration("STOREFRONT_KEY_OVERLAP", 24*time.Hour),
+		AccessTokenTTL:      getEnvAsDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:     getEnvAsDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		TokenCacheTTL:       getEnvAsDuration("TOKEN_CACHE_TTL", 30*time.Second),
+		PasswordResetTTL:    getEnvAsDuration("PASSWORD_RESET_TTL", time.Hour),
+		PasswordResetURL:    getEnv("PASSWORD_RESET_URL", ""),
+		EmailVerifyTTL:      getEnvAsDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+		EmailVerifyURL:      getEnv("EMAIL_VERIFICATION_URL", ""),
+		RequireEmailVerify:  getEnvAsBool("REQUIRE_EMAIL_VERIFICATION", false),
+		InviteTTL:           getEnvAsDuration("CLIENT_INVITE_TTL", 7*24*time.Hour),
+		InviteURL:           getEnv("CLIENT_INVITE_URL", ""),
+		LoginMaxFailures:    getEnvAsInt("LOGIN_MAX_FAILURES", 10),
+		LoginMaxIPFailures:  getEnvAsInt("LOGIN_MAX_IP_FAILURES", 100),
+		LoginFailureWindow:  getEnvAsDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LoginLockout:        getEnvAsDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		LoginUnlockURL:      getEnv("LOGIN_UNLOCK_URL", ""),
+		MFAIssuer:           getEnv("MFA_ISSUER", "MGSearch"),
+		MFAChallengeTTL:     getEnvAsDuration("MFA_CHALLENGE_TTL", 5*time.Minute),
+		OIDCIssuerURL:       getEnv("OIDC_ISSUER_URL", ""),
+		OIDCClientID:        getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:    getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:     getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:          getEnv("OIDC_SCOPES", "openid email profile"),
+		OIDCProvisionUsers:  getEnvAsBool("OIDC_PROVISION_USERS", true),
+		OIDCStateTTL:        getEnvAsDuration("OIDC_STATE_TTL", 10*time.Minute),
+		SMTPHost:            getEnv("SMTP_HOST", ""),
+		SMTPPort:            getEnvAsInt("SMTP_PORT", 587),
+		SMTPUsername:        getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:        getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:            getEnv("SMTP_FROM", ""),
 		QdrantURL:           getEnv("QDRANT_CLUSTER_ENDPOINT", ""),
 		QdrantAPIKey:        getEnv("QDRANT_API_KEY", ""),
 	}
@@ -59,6 +137,17 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvAsList splits a comma-separated variable, dropping empty entries
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func getEnvAsInt32(key string, defaultValue int32) int32 {
 	if value := os.Getenv(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
@@ -67,3 +156,30 @@ func getEnvAsInt32(key string, defaultValue int32) int32 {
 	}
 	return defaultValue
 }
+
+func getEnvAsInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if intValue, err := strconv.Atoi(value); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
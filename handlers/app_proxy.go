@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mgsearch/models"
+	"mgsearch/repositories"
+	"mgsearch/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// appProxyMaxAge bounds how old a signed App Proxy request may be.
+	appProxyMaxAge = 5 * time.Minute
+
+	appProxyDefaultLimit     = 20
+	appProxyMaxLimit         = 50
+	appProxySuggestionsLimit = 5
+	appProxySimilarLimit     = 8
+	appProxyGroupLimit       = 5
+	appProxyGroupMaxLimit    = 20
+
+	// storefrontKeyHeader carries the store's public storefront key on direct storefront requests.
+	storefrontKeyHeader = "X-Storefront-Key"
+)
+
+// appProxySorts maps storefront sort options to Meilisearch sort expressions.
+var appProxySorts = map[string][]string{
+	"price_asc":  {"price_min:asc"},
+	"price_desc": {"price_max:desc"},
+	"newest":     {"published_at:desc"},
+}
+
+// liquidEscaper neutralises Liquid delimiters in rendered output: Shopify renders application/liquid
+// responses as theme code, so merchant data such as product titles must never be evaluated.
+var liquidEscaper = strings.NewReplacer("{", "&#123;", "}", "&#125;")
+
+var appProxyResultsTemplate = template.Must(template.New("results").Parse(`<div class="mgsearch-results" data-query="{{.Query}}" data-total="{{.Total}}">
+{{- range .Products}}
+  <a class="mgsearch-result" href="/products/{{.Handle}}">
+    {{- if .ImageURL}}<img class="mgsearch-result__image" src="{{.ImageURL}}" alt="{{.Title}}" loading="lazy">{{end -}}
+    <span class="mgsearch-result__title">{{.Title}}</span>
+    {{- if .Vendor}}<span class="mgsearch-result__vendor">{{.Vendor}}</span>{{end -}}
+    <span class="mgsearch-result__price">{{printf "%.2f" .PriceMin}}</span>
+  </a>
+{{- else}}
+  <p class="mgsearch-results__empty">No results</p>
+{{- end}}
+</div>
+`))
+
+// AppProxyHandler serves storefront search through Shopify's App Proxy, so themes can query the
+// store's index at /apps/mgsearch/* without exposing any key. The same endpoints are served under
+// /api/v1 for storefronts that call the API directly with the store's X-Storefront-Key.
+type AppProxyHandler struct {
+	shopify *services.ShopifyService
+	stores  *repositories.StoreRepository
+	limits  *services.PlanLimits
+	meili   *services.MeilisearchRegistry
+}
+
+func NewAppProxyHandler(shopify *services.ShopifyService, stores *repositories.StoreRepository, limits *services.PlanLimits, meili *services.MeilisearchRegistry) *AppProxyHandler {
+	return &AppProxyHandler{
+		shopify: shopify,
+		stores:  stores,
+		limits:  limits,
+		meili:   meili,
+	}
+}
+
+// Search handles GET /apps/mgsearch/search and GET /api/v1/search
+// Query: q, limit, offset, collection (handle), in_stock=true, sort (price_asc, price_desc, newest),
+// locale (searches the locale index when translations are indexed per locale),
+// format=liquid for theme markup instead of JSON.
+func (h *AppProxyHandler) Search(c *gin.Context) {
+	store, meili, ok := h.resolveStore(c, "")
+	if !ok {
+		return
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	request := models.SearchRequest{
+		"q":      query,
+		"limit":  queryInt(c, "limit", appProxyDefaultLimit, appProxyMaxLimit),
+		"offset": queryInt(c, "offset", 0, -1),
+	}
+
+	var filters []string
+	if collection := strings.TrimSpace(c.Query("collection")); collection != "" {
+		filters = append(filters, fmt.Sprintf("collections = %s", strconv.Quote(collection)))
+	}
+	if c.Query("in_stock") == "true" {
+		filters = append(filters, "in_stock = true")
+	}
+	if len(filters) > 0 {
+		request["filter"] = filters
+	}
+	if sort, ok := appProxySorts[c.Query("sort")]; ok {
+		request["sort"] = sort
+	}
+
+	response, err := meili.Search(store.SearchIndexUID(c.Query("locale")), &request)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed", "details": err.Error()})
+		return
+	}
+
+	h.respond(c, query, *response)
+}
+
+// GroupedSearch handles GET /apps/mgsearch/search/all and GET /api/v1/search/all
+// Query: q, limit (per type), types (comma-separated product, collection, page, article; all by
+// default), locale. Returns the top hits of each document type in one response, always as JSON.
+// Product results are keyed by the store's document type.
+func (h *AppProxyHandler) GroupedSearch(c *gin.Context) {
+	types := append([]string{models.DocumentTypeProduct}, models.ContentDocumentTypes...)
+	if raw := strings.TrimSpace(c.Query("types")); raw != "" {
+		allowed := map[string]bool{}
+		for _, documentType := range types {
+			allowed[documentType] = true
+		}
+		types = nil
+		for _, documentType := range strings.Split(raw, ",") {
+			documentType = strings.TrimSpace(documentType)
+			if !allowed[documentType] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported type", "details": documentType})
+				return
+			}
+			types = append(types, documentType)
+		}
+	}
+
+	store, meili, ok := h.resolveStore(c, "")
+	if !ok {
+		return
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	limit := queryInt(c, "limit", appProxyGroupLimit, appProxyGroupMaxLimit)
+
+	results := gin.H{}
+	for _, documentType := range types {
+		uid, key := store.ContentIndexUID(documentType), documentType
+		if documentType == models.DocumentTypeProduct {
+			uid, key = store.SearchIndexUID(c.Query("locale")), store.DocumentType()
+		}
+
+		request := models.SearchRequest{"q": query, "limit": limit}
+		response, err := meili.Search(uid, &request)
+		if err != nil {
+			// Content indexes only exist once the store's content has been synced
+			if services.IsIndexNotFound(err) {
+				results[key] = models.SearchResponse{"hits": []interface{}{}, "estimatedTotalHits": 0}
+				continue
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed", "details": err.Error()})
+			return
+		}
+		results[key] = *response
+	}
+
+	c.JSON(http.StatusOK, gin.H{"query": query, "results": results})
+}
+
+// Suggestions handles GET /apps/mgsearch/suggestions and GET /api/v1/suggestions
+// Returns a handful of lightweight product matches for search-as-you-type.
+func (h *AppProxyHandler) Suggestions(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+
+	store, meili, ok := h.resolveStore(c, models.FeatureSuggestions)
+	if !ok {
+		return
+	}
+
+	request := models.SearchRequest{
+		"q":                    query,
+		"limit":                queryInt(c, "limit", appProxySuggestionsLimit, appProxySuggestionsLimit),
+		"attributesToRetrieve": []string{"id", "title", "handle", "vendor", "price_min", "image_url"},
+	}
+
+	response, err := meili.Search(store.SearchIndexUID(c.Query("locale")), &request)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed", "details": err.Error()})
+		return
+	}
+
+	h.respond(c, query, *response)
+}
+
+// SimilarProducts handles GET /apps/mgsearch/products/:id/similar and GET /api/v1/products/:id/similar
+// Similar products share the product's type or one of its collections.
+func (h *AppProxyHandler) SimilarProducts(c *gin.Context) {
+	productID := c.Param("id")
+	if _, err := strconv.ParseInt(productID, 10, 64); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+
+	store, meili, ok := h.resolveStore(c, models.FeatureSimilarProducts)
+	if !ok {
+		return
+	}
+
+	document, err := meili.GetDocument(store.SearchIndexUID(c.Query("locale")), productID)
+	if err != nil {
+		if err.Error() == "document not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load product", "details": err.Error()})
+		return
+	}
+
+	product, err := decodeProductDocument(document)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode product", "details": err.Error()})
+		return
+	}
+
+	var related []string
+	if product.ProductType != "" {
+		related = append(related, fmt.Sprintf("product_type = %s", strconv.Quote(product.ProductType)))
+	}
+	if len(product.CollectionIDs) > 0 {
+		ids := make([]string, len(product.CollectionIDs))
+		for i, id := range product.CollectionIDs {
+			ids[i] = strconv.FormatInt(id, 10)
+		}
+		related = append(related, fmt.Sprintf("collection_ids IN [%s]", strings.Join(ids, ", ")))
+	}
+	if len(related) == 0 {
+		h.respond(c, "", models.SearchResponse{"hits": []interface{}{}, "estimatedTotalHits": 0})
+		return
+	}
+
+	// One extra hit is requested since the product itself matches its own filter
+	request := models.SearchRequest{
+		"q":      "",
+		"limit":  appProxySimilarLimit + 1,
+		"filter": []interface{}{related, "in_stock = true"},
+	}
+
+	response, err := meili.Search(store.SearchIndexUID(c.Query("locale")), &request)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed", "details": err.Error()})
+		return
+	}
+
+	hits, _ := (*response)["hits"].([]interface{})
+	similar := make([]interface{}, 0, len(hits))
+	for _, hit := range hits {
+		if fields, ok := hit.(map[string]interface{}); ok && fmt.Sprintf("%v", fields["id"]) == fmt.Sprintf("%v", document["id"]) {
+			continue
+		}
+		if len(similar) < appProxySimilarLimit {
+			similar = append(similar, hit)
+		}
+	}
+
+	h.respond(c, "", models.SearchResponse{"hits": similar, "estimatedTotalHits": len(similar)})
+}
+
+// resolveStore authenticates the storefront request, loads its store and enforces the store's
+// plan: the feature (if any) must be included and the request counts as a search against the
+// monthly allowance.
+func (h *AppProxyHandler) resolveStore(c *gin.Context, feature string) (*models.Store, *services.MeilisearchService, bool) {
+	var store *models.Store
+	var ok bool
+	if key := c.GetHeader(storefrontKeyHeader); key != "" {
+		store, ok = h.storeByKey(c, key)
+	} else {
+		store, ok = h.storeBySignature(c)
+	}
+	if !ok {
+		return nil, nil, false
+	}
+	if store.Status != "active" || store.IndexUID() == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "search not available for store"})
+		return nil, nil, false
+	}
+
+	if feature != "" && !store.Plan().HasFeature(feature) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "feature not available on current plan", "code": "PLAN_FEATURE_UNAVAILABLE"})
+		return nil, nil, false
+	}
+
+	if err := h.limits.CountSearch(c.Request.Context(), store); err != nil {
+		planLimitErrorResponse(c, err, "failed to record usage")
+		return nil, nil, false
+	}
+
+	meili, err := h.meili.ForStore(store)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to connect to search backend", "details": err.Error()})
+		return nil, nil, false
+	}
+
+	return store, meili, true
+}
+
+// storeBySignature verifies the App Proxy signature and loads the store named by the shop parameter.
+func (h *AppProxyHandler) storeBySignature(c *gin.Context) (*models.Store, bool) {
+	values := c.Request.URL.Query()
+	if !h.shopify.ValidateAppProxySignature(values) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
+		return nil, false
+	}
+
+	timestamp, err := strconv.ParseInt(values.Get("timestamp"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid timestamp"})
+		return nil, false
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age > appProxyMaxAge || age < -appProxyMaxAge {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "request expired"})
+		return nil, false
+	}
+
+	store, err := h.stores.GetByShopDomain(c.Request.Context(), strings.ToLower(values.Get("shop")))
+	if err != nil {
+		if err.Error() == "store not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "store not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load store", "details": err.Error()})
+		return nil, false
+	}
+	return store, true
+}
+
+// storeByKey loads the store a storefront key belongs to. A rotated key keeps working until its
+// overlap window closes.
+func (h *AppProxyHandler) storeByKey(c *gin.Context, key string) (*models.Store, bool) {
+	store, err := h.stores.GetByPublicAPIKey(c.Request.Context(), key)
+	if err != nil {
+		if err.Error() == "store not found" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid storefront key"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load store", "details": err.Error()})
+		return nil, false
+	}
+	return store, true
+}
+
+// respond writes the search response as JSON, or as Liquid markup when format=liquid.
+func (h *AppProxyHandler) respond(c *gin.Context, query string, response models.SearchResponse) {
+	if c.Query("format") != "liquid" {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	var products []models.ShopifyProductDocument
+	if hits, ok := response["hits"]; ok {
+		raw, err := json.Marshal(hits)
+		if err == nil {
+			err = json.Unmarshal(raw, &products)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render results", "details": err.Error()})
+			return
+		}
+	}
+
+	var buf bytes.Buffer
+	err := appProxyResultsTemplate.Execute(&buf, gin.H{
+		"Query":    query,
+		"Total":    response["estimatedTotalHits"],
+		"Products": products,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render results", "details": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/liquid; charset=utf-8", []byte(liquidEscaper.Replace(buf.String())))
+}
+
+func decodeProductDocument(document models.Document) (*models.ShopifyProductDocument, error) {
+	raw, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	var product models.ShopifyProductDocument
+	if err := json.Unmarshal(raw, &product); err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// queryInt reads a non-negative integer query parameter, capped at max when max is positive.
+func queryInt(c *gin.Context, name string, fallback, max int) int {
+	value, err := strconv.Atoi(c.Query(name))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	if max > 0 && value > max {
+		return max
+	}
+	return value
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mgsearch/models"
+	"mgsearch/repositories"
+	"mgsearch/services"
+	"mgsearch/testhelpers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func setupAppProxyTest(t *testing.T) (*gin.Engine, string, func()) {
+	ctx := context.Background()
+	cfg := testhelpers.TestConfig()
+
+	_, db, cleanup, err := testhelpers.SetupTestDatabase(ctx, cfg)
+	require.NoError(t, err)
+
+	storeRepo, _ := testhelpers.SetupTestRepositories(db)
+	meiliRegistry, err := services.NewMeilisearchRegistry(cfg, testhelpers.TestKeyProvider(cfg), services.NewMeilisearchService(cfg))
+	require.NoError(t, err)
+
+	store, err := storeRepo.CreateOrUpdate(ctx, &models.Store{
+		ID:                  primitive.NewObjectID(),
+		ShopDomain:          "proxy-test.myshopify.com",
+		ShopName:            "Proxy Test Store",
+		ProductIndexUID:     "products_proxy_test",
+		MeilisearchIndexUID: "products_proxy_test",
+		Status:              "active",
+		InstalledAt:         time.Now(),
+	})
+	require.NoError(t, err)
+
+	// The store's first key has been rotated and is still inside its overlap window
+	overlap := time.Now().Add(time.Hour)
+	require.NoError(t, storeRepo.RotateStorefrontKey(ctx, store.ID.Hex(), "", "sf_proxy_previous", nil, models.StoreKeyRotation{}))
+	require.NoError(t, storeRepo.RotateStorefrontKey(ctx, store.ID.Hex(), "sf_proxy_previous", "sf_proxy_current", &overlap, models.StoreKeyRotation{}))
+
+	// Another store's previous key whose overlap window has closed
+	expiredStore, err := storeRepo.CreateOrUpdate(ctx, &models.Store{
+		ID:                  primitive.NewObjectID(),
+		ShopDomain:          "proxy-expired.myshopify.com",
+		ShopName:            "Proxy Expired Store",
+		ProductIndexUID:     "products_proxy_expired",
+		MeilisearchIndexUID: "products_proxy_expired",
+		Status:              "active",
+		InstalledAt:         time.Now(),
+	})
+	require.NoError(t, err)
+	closed := time.Now().Add(-time.Minute)
+	require.NoError(t, storeRepo.RotateStorefrontKey(ctx, expiredStore.ID.Hex(), "", "sf_expired_previous", nil, models.StoreKeyRotation{}))
+	require.NoError(t, storeRepo.RotateStorefrontKey(ctx, expiredStore.ID.Hex(), "sf_expired_previous", "sf_expired_current", &closed, models.StoreKeyRotation{}))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handler := NewAppProxyHandler(services.NewShopifyService(cfg), storeRepo, services.NewPlanLimits(repositories.NewUsageRepository(db)), meiliRegistry)
+	router.GET("/apps/mgsearch/search", handler.Search)
+	router.GET("/apps/mgsearch/suggestions", handler.Suggestions)
+	router.GET("/apps/mgsearch/search/all", handler.GroupedSearch)
+	router.GET("/api/v1/suggestions", handler.Suggestions)
+
+	return router, cfg.ShopifyAPISecret, func() {
+		testhelpers.CleanupTestDatabase(ctx, db)
+		cleanup()
+	}
+}
+
+// signAppProxyQuery signs query parameters the way Shopify's App Proxy does.
+func signAppProxyQuery(secret string, values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var message strings.Builder
+	for _, key := range keys {
+		message.WriteString(key + "=" + strings.Join(values[key], ","))
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message.String()))
+	values.Set("signature", hex.EncodeToString(mac.Sum(nil)))
+	return values.Encode()
+}
+
+func TestAppProxyHandler_Verification(t *testing.T) {
+	router, secret, cleanup := setupAppProxyTest(t)
+	defer cleanup()
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name           string
+		path           string
+		query          func() string
+		expectedStatus int
+	}{
+		{
+			name: "missing signature",
+			path: "/apps/mgsearch/search",
+			query: func() string {
+				return url.Values{"shop": {"proxy-test.myshopify.com"}, "timestamp": {now}, "q": {"shirt"}}.Encode()
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered query",
+			path: "/apps/mgsearch/search",
+			query: func() string {
+				signed := signAppProxyQuery(secret, url.Values{"shop": {"proxy-test.myshopify.com"}, "timestamp": {now}, "q": {"shirt"}})
+				return strings.Replace(signed, "q=shirt", "q=pants", 1)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "expired request",
+			path: "/apps/mgsearch/search",
+			query: func() string {
+				return signAppProxyQuery(secret, url.Values{"shop": {"proxy-test.myshopify.com"}, "timestamp": {stale}, "q": {"shirt"}})
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "unknown shop",
+			path: "/apps/mgsearch/search",
+			query: func() string {
+				return signAppProxyQuery(secret, url.Values{"shop": {"unknown.myshopify.com"}, "timestamp": {now}, "q": {"shirt"}})
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "suggestions require a query",
+			path: "/apps/mgsearch/suggestions",
+			query: func() string {
+				return signAppProxyQuery(secret, url.Values{"shop": {"proxy-test.myshopify.com"}, "timestamp": {now}, "path_prefix": {"/apps/mgsearch"}})
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "grouped search rejects unknown types",
+			path: "/apps/mgsearch/search/all",
+			query: func() string {
+				return signAppProxyQuery(secret, url.Values{"shop": {"proxy-test.myshopify.com"}, "timestamp": {now}, "q": {"shirt"}, "types": {"product,recipe"}})
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "suggestions not included in the free plan",
+			path: "/apps/mgsearch/suggestions",
+			query: func() string {
+				return signAppProxyQuery(secret, url.Values{"shop": {"proxy-test.myshopify.com"}, "timestamp": {now}, "q": {"shi"}})
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path+"?"+tt.query(), nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestAppProxyHandler_StorefrontKey(t *testing.T) {
+	router, _, cleanup := setupAppProxyTest(t)
+	defer cleanup()
+
+	// Suggestions are not in the free plan, so an authenticated request stops at the plan check
+	tests := []struct {
+		name           string
+		key            string
+		expectedStatus int
+	}{
+		{name: "current key", key: "sf_proxy_current", expectedStatus: http.StatusForbidden},
+		{name: "previous key during the overlap window", key: "sf_proxy_previous", expectedStatus: http.StatusForbidden},
+		{name: "previous key after the overlap window", key: "sf_expired_previous", expectedStatus: http.StatusUnauthorized},
+		{name: "unknown key", key: "sf_unknown", expectedStatus: http.StatusUnauthorized},
+		{name: "missing key", key: "", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/suggestions?q=shi", nil)
+			if tt.key != "" {
+				req.Header.Set("X-Storefront-Key", tt.key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+		})
+	}
+}
@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"mgsearch/config"
+	"mgsearch/middleware"
 	"mgsearch/models"
 	"mgsearch/pkg/auth"
 	"mgsearch/pkg/security"
@@ -16,12 +19,13 @@ import (
 )
 
 type AuthHandler struct {
-	cfg           *config.Config
-	shopify       *services.ShopifyService
-	stores        *repositories.StoreRepository
-	meili         *services.MeilisearchService
-	encryptionKey []byte
-	sessionTTL    time.Duration
+	cfg        *config.Config
+	shopify    *services.ShopifyService
+	stores     *repositories.StoreRepository
+	sessions   *repositories.SessionRepository
+	meili      *services.MeilisearchRegistry
+	keys       security.KeyProvider
+	sessionTTL time.Duration
 }
 
 type beginAuthRequest struct {
@@ -40,6 +44,7 @@ type installStoreRequest struct {
 	ShopName          *string `json:"shop_name,omitempty"`
 	MeilisearchURL    *string `json:"meilisearch_url,omitempty"`
 	MeilisearchAPIKey *string `json:"meilisearch_api_key,omitempty"`
+	Scope             *string `json:"scope,omitempty"`
 }
 
 type exchangeTokenRequest struct {
@@ -52,19 +57,19 @@ type exchangeTokenResponse struct {
 	Scope       string `json:"scope"`
 }
 
-func NewAuthHandler(cfg *config.Config, shopify *services.ShopifyService, stores *repositories.StoreRepository, meili *services.MeilisearchService) (*AuthHandler, error) {
-	key, err := security.MustDecodeKey(cfg.EncryptionKey)
-	if err != nil {
-		return nil, err
+func NewAuthHandler(cfg *config.Config, keys security.KeyProvider, shopify *services.ShopifyService, stores *repositories.StoreRepository, sessions *repositories.SessionRepository, meili *services.MeilisearchRegistry) (*AuthHandler, error) {
+	if keys == nil {
+		return nil, errors.New("key provider is required")
 	}
 
 	return &AuthHandler{
-		cfg:           cfg,
-		shopify:       shopify,
-		stores:        stores,
-		meili:         meili,
-		encryptionKey: key,
-		sessionTTL:    24 * time.Hour,
+		cfg:        cfg,
+		shopify:    shopify,
+		stores:     stores,
+		sessions:   sessions,
+		meili:      meili,
+		keys:       keys,
+		sessionTTL: 24 * time.Hour,
 	}, nil
 }
 
@@ -130,104 +135,121 @@ func (h *AuthHandler) Callback(c *gin.Context) {
 		return
 	}
 
-	accessToken, err := h.shopify.ExchangeAccessToken(c.Request.Context(), shop, code)
+	accessToken, scope, err := h.shopify.ExchangeAccessToken(c.Request.Context(), shop, code)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "token exchange failed", "details": err.Error()})
 		return
 	}
 
-	encryptedToken, err := security.EncryptAESGCM(h.encryptionKey, []byte(accessToken))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "token encryption failed"})
+	dbStore, created, ok := h.saveStoreToken(c, storeInstall{
+		shop:          shop,
+		shopName:      shop,
+		accessToken:   accessToken,
+		grantedScopes: services.ParseScopes(scope),
+		meiliURL:      strings.TrimSpace(c.GetHeader("X-Meilisearch-Url")),
+		meiliKey:      strings.TrimSpace(c.GetHeader("X-Meilisearch-Api-Key")),
+	})
+	if !ok {
 		return
 	}
 
-	privateKey, err := security.GenerateAPIKey(32)
+	sessionToken, err := auth.GenerateSessionToken(dbStore.ID.Hex(), dbStore.ShopDomain, []byte(h.cfg.JWTSigningKey), h.sessionTTL)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate private key"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate session token"})
 		return
 	}
 
-	webhookSecret, err := security.GenerateAPIKey(32)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate webhook secret"})
-		return
+	message := "installation successful"
+	if !created {
+		message = "reauthorization successful"
 	}
+	c.JSON(http.StatusOK, gin.H{
+		"store":   dbStore.ToPublicView(),
+		"token":   sessionToken,
+		"message": message,
+	})
+}
 
-	meiliURL := strings.TrimSpace(c.GetHeader("X-Meilisearch-Url"))
-	if meiliURL == "" {
-		meiliURL = h.cfg.MeilisearchURL
-	}
-	if meiliURL == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "meilisearch url is required"})
+// ExchangeToken handles POST /api/auth/shopify/exchange
+// Exchanges OAuth code for access token (optional helper for frontend)
+func (h *AuthHandler) ExchangeToken(c *gin.Context) {
+	var req exchangeTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
 		return
 	}
 
-	meiliKey := strings.TrimSpace(c.GetHeader("X-Meilisearch-Api-Key"))
-	if meiliKey == "" {
-		meiliKey = h.cfg.MeilisearchAPIKey
+	shop := strings.ToLower(strings.TrimSpace(req.Shop))
+	if shop == "" || !strings.HasSuffix(shop, ".myshopify.com") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid shop domain"})
+		return
 	}
-	if meiliKey == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "meilisearch api key is required"})
+
+	if req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
 		return
 	}
 
-	encryptedMeiliKey, err := security.EncryptAESGCM(h.encryptionKey, []byte(meiliKey))
+	accessToken, scope, err := h.shopify.ExchangeAccessToken(c.Request.Context(), shop, req.Code)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to secure meilisearch api key"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token exchange failed", "details": err.Error()})
 		return
 	}
 
-	indexUID := buildProductIndexUID(shop)
-	docType := "product"
+	c.JSON(http.StatusOK, exchangeTokenResponse{
+		AccessToken: accessToken,
+		Scope:       scope,
+	})
+}
 
-	store := &models.Store{
-		ShopDomain:           shop,
-		ShopName:             shop,
-		EncryptedAccessToken: encryptedToken,
-		APIKeyPrivate:        privateKey,
-		ProductIndexUID:      indexUID,
-		MeilisearchIndexUID:  indexUID,
-		MeilisearchDocType:   docType,
-		MeilisearchURL:       meiliURL,
-		MeilisearchAPIKey:    encryptedMeiliKey,
-		PlanLevel:            "free",
-		Status:               "active",
-		WebhookSecret:        webhookSecret,
-		InstalledAt:          time.Now().UTC(),
-		SyncState: map[string]interface{}{
-			"status": "pending_initial_sync",
-		},
+// Reauthorize handles GET /api/stores/current/reauthorize
+// Returns the OAuth URL a store must visit to grant scopes it is missing. Query: redirect_uri (optional).
+func (h *AuthHandler) Reauthorize(c *gin.Context) {
+	shop, ok := middleware.GetShopDomain(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
 	}
 
-	dbStore, err := h.stores.CreateOrUpdate(c.Request.Context(), store)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to persist store", "details": err.Error()})
+	missing := middleware.GetMissingScopes(c)
+	if len(missing) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"needs_reauthorization": false,
+			"missing_scopes":        missing,
+		})
 		return
 	}
 
-	if err := h.meili.EnsureIndex(dbStore.IndexUID()); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to ensure search index", "details": err.Error()})
+	state, err := auth.GenerateStateToken(shop, []byte(h.cfg.JWTSigningKey), 15*time.Minute)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate state token"})
 		return
 	}
 
-	sessionToken, err := auth.GenerateSessionToken(dbStore.ID.Hex(), dbStore.ShopDomain, []byte(h.cfg.JWTSigningKey), h.sessionTTL)
+	redirectURI := strings.TrimRight(h.cfg.ShopifyAppURL, "/") + "/auth/callback"
+	if custom := c.Query("redirect_uri"); custom != "" {
+		redirectURI = custom
+	}
+
+	authURL, err := h.shopify.BuildInstallURL(shop, state, redirectURI)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate session token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build install url"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"store":   dbStore.ToPublicView(),
-		"token":   sessionToken,
-		"message": "installation successful",
+		"needs_reauthorization": true,
+		"missing_scopes":        missing,
+		"reauthorize_url":       authURL,
+		"state":                 state,
 	})
 }
 
-// ExchangeToken handles POST /api/auth/shopify/exchange
-// Exchanges OAuth code for access token (optional helper for frontend)
-func (h *AuthHandler) ExchangeToken(c *gin.Context) {
-	var req exchangeTokenRequest
+// InstallStore handles POST /api/auth/shopify/install
+// Receives OAuth data from frontend after frontend completes OAuth flow
+// Frontend sends access_token directly (already exchanged from code)
+func (h *AuthHandler) InstallStore(c *gin.Context) {
+	var req installStoreRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
 		return
@@ -239,113 +261,275 @@ func (h *AuthHandler) ExchangeToken(c *gin.Context) {
 		return
 	}
 
-	if req.Code == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+	if req.AccessToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "access_token is required"})
+		return
+	}
+
+	// Scopes unknown at install time are looked up from Shopify on first use
+	var grantedScopes []string
+	if req.Scope != nil {
+		grantedScopes = services.ParseScopes(*req.Scope)
+	}
+
+	// Handle Meilisearch configuration
+	meiliURL := strings.TrimSpace(c.GetHeader("X-Meilisearch-Url"))
+	if meiliURL == "" && req.MeilisearchURL != nil {
+		meiliURL = strings.TrimSpace(*req.MeilisearchURL)
+	}
+	meiliKey := strings.TrimSpace(c.GetHeader("X-Meilisearch-Api-Key"))
+	if meiliKey == "" && req.MeilisearchAPIKey != nil {
+		meiliKey = strings.TrimSpace(*req.MeilisearchAPIKey)
+	}
+
+	// Determine shop name
+	shopName := shop
+	if req.ShopName != nil && *req.ShopName != "" {
+		shopName = *req.ShopName
+	}
+
+	dbStore, ok := h.installStore(c, storeInstall{
+		shop:          shop,
+		shopName:      shopName,
+		accessToken:   req.AccessToken,
+		grantedScopes: grantedScopes,
+		meiliURL:      meiliURL,
+		meiliKey:      meiliKey,
+	})
+	if !ok {
 		return
 	}
 
-	accessToken, err := h.shopify.ExchangeAccessToken(c.Request.Context(), shop, req.Code)
+	// Generate session token for frontend
+	sessionToken, err := auth.GenerateSessionToken(dbStore.ID.Hex(), dbStore.ShopDomain, []byte(h.cfg.JWTSigningKey), h.sessionTTL)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "token exchange failed", "details": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate session token"})
 		return
 	}
 
-	// Get scope from the response if available (we'd need to update ExchangeAccessToken to return it)
-	// For now, just return the token
-	c.JSON(http.StatusOK, exchangeTokenResponse{
-		AccessToken: accessToken,
-		Scope:       h.cfg.ShopifyScopes,
+	c.JSON(http.StatusOK, gin.H{
+		"store":   dbStore.ToPublicView(),
+		"token":   sessionToken,
+		"message": "installation successful",
 	})
 }
 
-// InstallStore handles POST /api/auth/shopify/install
-// Receives OAuth data from frontend after frontend completes OAuth flow
-// Frontend sends access_token directly (already exchanged from code)
-func (h *AuthHandler) InstallStore(c *gin.Context) {
-	var req installStoreRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+// TokenExchange handles POST /api/auth/shopify/token-exchange
+// Embedded apps send their App Bridge session token. By default it is exchanged for an offline access
+// token which installs the store, or refreshes the token of an installed store. With
+// requested_token_type=online it is exchanged for an online access token of the staff member, which
+// is stored as their session of the installed store.
+func (h *AuthHandler) TokenExchange(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" || !strings.HasPrefix(strings.ToLower(authHeader), "bearer ") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
 		return
 	}
+	sessionToken := strings.TrimSpace(authHeader[7:])
 
-	shop := strings.ToLower(strings.TrimSpace(req.Shop))
-	if shop == "" || !strings.HasSuffix(shop, ".myshopify.com") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid shop domain"})
+	claims, err := auth.ParseShopifySessionToken(sessionToken, h.cfg.ShopifyAPIKey, h.cfg.ShopifyAPISecret)
+	if err != nil {
+		c.Header("X-Shopify-Retry-Invalid-Session-Request", "1")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid session token"})
 		return
 	}
+	shop := claims.ShopDomain()
 
-	if req.AccessToken == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "access_token is required"})
+	switch c.DefaultQuery("requested_token_type", "offline") {
+	case "offline":
+	case "online":
+		h.onlineTokenExchange(c, shop, sessionToken)
+		return
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid requested_token_type", "details": "must be online or offline"})
 		return
 	}
 
-	// Encrypt the access token
-	encryptedToken, err := security.EncryptAESGCM(h.encryptionKey, []byte(req.AccessToken))
+	result, err := h.shopify.ExchangeSessionToken(c.Request.Context(), shop, sessionToken, services.OfflineAccessToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "token encryption failed"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token exchange failed", "details": err.Error()})
 		return
 	}
 
-	privateKey, err := security.GenerateAPIKey(32)
+	dbStore, created, ok := h.saveStoreToken(c, storeInstall{
+		shop:          shop,
+		shopName:      shop,
+		accessToken:   result.AccessToken,
+		grantedScopes: services.ParseScopes(result.Scope),
+	})
+	if !ok {
+		return
+	}
+
+	message := "installation successful"
+	if !created {
+		message = "access token refreshed"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"store":   dbStore.ToPublicView(),
+		"scope":   result.Scope,
+		"message": message,
+	})
+}
+
+// onlineTokenExchange exchanges the session token for an online access token and stores it as the
+// session of the staff member it belongs to, under the shop_userID id Shopify's session storage
+// uses. The store keeps its offline token; online tokens expire with the staff member's session.
+func (h *AuthHandler) onlineTokenExchange(c *gin.Context, shop, sessionToken string) {
+	ctx := c.Request.Context()
+	if _, err := h.stores.GetByShopDomain(ctx, shop); err != nil {
+		if err.Error() == "store not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "store not installed", "details": "exchange an offline access token first"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load store", "details": err.Error()})
+		return
+	}
+
+	result, err := h.shopify.ExchangeSessionToken(ctx, shop, sessionToken, services.OnlineAccessToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate private key"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token exchange failed", "details": err.Error()})
+		return
+	}
+	user := result.AssociatedUser
+	if user == nil || user.ID == 0 {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "token exchange failed", "details": "online access token has no associated user"})
 		return
 	}
 
-	webhookSecret, err := security.GenerateAPIKey(32)
+	encryptedToken, err := encryptSessionAccessToken(ctx, h.keys, shop, result.AccessToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate webhook secret"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token encryption failed"})
+		return
+	}
+	session := &models.Session{
+		ID:            fmt.Sprintf("%s_%d", shop, user.ID),
+		Shop:          shop,
+		IsOnline:      true,
+		Scope:         result.Scope,
+		AccessToken:   encryptedToken,
+		UserID:        &user.ID,
+		FirstName:     &user.FirstName,
+		LastName:      &user.LastName,
+		Email:         &user.Email,
+		AccountOwner:  user.AccountOwner,
+		Locale:        &user.Locale,
+		Collaborator:  &user.Collaborator,
+		EmailVerified: &user.EmailVerified,
+	}
+	if result.ExpiresIn > 0 {
+		expires := time.Now().UTC().Add(time.Duration(result.ExpiresIn) * time.Second)
+		session.Expires = &expires
+	}
+	if err := h.sessions.CreateOrUpdate(ctx, session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to persist session", "details": err.Error()})
 		return
 	}
 
-	// Handle Meilisearch configuration
-	meiliURL := strings.TrimSpace(c.GetHeader("X-Meilisearch-Url"))
-	if meiliURL == "" && req.MeilisearchURL != nil {
-		meiliURL = strings.TrimSpace(*req.MeilisearchURL)
+	c.JSON(http.StatusOK, gin.H{
+		"session_id": session.ID,
+		"expires":    session.Expires,
+		"scope":      result.Scope,
+		"message":    "online access token stored",
+	})
+}
+
+// storeInstall is what a shop's installation provides. Empty Meilisearch settings fall back to the
+// configured instance.
+type storeInstall struct {
+	shop          string
+	shopName      string
+	accessToken   string
+	grantedScopes []string
+	meiliURL      string
+	meiliKey      string
+}
+
+// saveStoreToken stores the access token of an installed shop, or installs the shop. Re-authorization
+// only replaces the token and scopes; keys, webhook secret and search settings stay as they are. On
+// failure the error response is written and ok is false.
+func (h *AuthHandler) saveStoreToken(c *gin.Context, install storeInstall) (store *models.Store, created bool, ok bool) {
+	ctx := c.Request.Context()
+	existing, err := h.stores.GetByShopDomain(ctx, install.shop)
+	if err != nil {
+		if err.Error() != "store not found" {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load store", "details": err.Error()})
+			return nil, false, false
+		}
+		store, ok := h.installStore(c, install)
+		return store, true, ok
+	}
+
+	encryptedToken, err := h.keys.Encrypt(ctx, install.shop, []byte(install.accessToken))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token encryption failed"})
+		return nil, false, false
+	}
+	if err := h.stores.UpdateAccessToken(ctx, existing.ID.Hex(), encryptedToken, install.grantedScopes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to persist store", "details": err.Error()})
+		return nil, false, false
 	}
+	existing.GrantedScopes = install.grantedScopes
+	existing.Status = "active"
+	return existing, false, true
+}
+
+// installStore creates or replaces the shop's store with fresh keys and sets up its product index.
+// On failure the error response is written and ok is false.
+func (h *AuthHandler) installStore(c *gin.Context, install storeInstall) (*models.Store, bool) {
+	ctx := c.Request.Context()
+
+	meiliURL := install.meiliURL
 	if meiliURL == "" {
 		meiliURL = h.cfg.MeilisearchURL
 	}
 	if meiliURL == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "meilisearch url is required"})
-		return
-	}
-
-	meiliKey := strings.TrimSpace(c.GetHeader("X-Meilisearch-Api-Key"))
-	if meiliKey == "" && req.MeilisearchAPIKey != nil {
-		meiliKey = strings.TrimSpace(*req.MeilisearchAPIKey)
+		return nil, false
 	}
+	meiliKey := install.meiliKey
 	if meiliKey == "" {
 		meiliKey = h.cfg.MeilisearchAPIKey
 	}
 	if meiliKey == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "meilisearch api key is required"})
-		return
+		return nil, false
+	}
+
+	encryptedToken, err := h.keys.Encrypt(ctx, install.shop, []byte(install.accessToken))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token encryption failed"})
+		return nil, false
 	}
 
-	encryptedMeiliKey, err := security.EncryptAESGCM(h.encryptionKey, []byte(meiliKey))
+	encryptedMeiliKey, err := h.keys.Encrypt(ctx, install.shop, []byte(meiliKey))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to secure meilisearch api key"})
-		return
+		return nil, false
 	}
 
-	// Determine shop name
-	shopName := shop
-	if req.ShopName != nil && *req.ShopName != "" {
-		shopName = *req.ShopName
+	privateKey, err := security.GenerateAPIKey(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate private key"})
+		return nil, false
 	}
 
-	indexUID := buildProductIndexUID(shop)
-	docType := "product"
+	webhookSecret, err := security.GenerateAPIKey(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate webhook secret"})
+		return nil, false
+	}
 
+	indexUID := buildProductIndexUID(install.shop)
 	store := &models.Store{
-		ShopDomain:           shop,
-		ShopName:             shopName,
+		ShopDomain:           install.shop,
+		ShopName:             install.shopName,
 		EncryptedAccessToken: encryptedToken,
+		GrantedScopes:        install.grantedScopes,
 		APIKeyPrivate:        privateKey,
 		ProductIndexUID:      indexUID,
 		MeilisearchIndexUID:  indexUID,
-		MeilisearchDocType:   docType,
+		MeilisearchDocType:   "product",
 		MeilisearchURL:       meiliURL,
 		MeilisearchAPIKey:    encryptedMeiliKey,
 		PlanLevel:            "free",
@@ -357,30 +541,29 @@ func (h *AuthHandler) InstallStore(c *gin.Context) {
 		},
 	}
 
-	dbStore, err := h.stores.CreateOrUpdate(c.Request.Context(), store)
+	dbStore, err := h.stores.CreateOrUpdate(ctx, store)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to persist store", "details": err.Error()})
-		return
+		return nil, false
 	}
 
-	// Ensure the Meilisearch index exists
-	if err := h.meili.EnsureIndex(dbStore.IndexUID()); err != nil {
+	meili, err := h.meili.ForStore(dbStore)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to connect to search backend", "details": err.Error()})
+		return nil, false
+	}
+
+	if err := meili.EnsureIndex(dbStore.IndexUID()); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to ensure search index", "details": err.Error()})
-		return
+		return nil, false
 	}
 
-	// Generate session token for frontend
-	sessionToken, err := auth.GenerateSessionToken(dbStore.ID.Hex(), dbStore.ShopDomain, []byte(h.cfg.JWTSigningKey), h.sessionTTL)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate session token"})
-		return
+	if err := meili.ConfigureProductIndex(dbStore.IndexUID()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to configure search index", "details": err.Error()})
+		return nil, false
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"store":   dbStore.ToPublicView(),
-		"token":   sessionToken,
-		"message": "installation successful",
-	})
+	return dbStore, true
 }
 
 func buildProductIndexUID(shop string) string {
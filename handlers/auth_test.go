@@ -3,7 +3,9 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -21,15 +23,17 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func setupAuthTest(t *testing.T) (*gin.Engine, *repositories.StoreRepository, *services.ShopifyService, *services.MeilisearchService, func()) {
+func setupAuthTest(t *testing.T) (*gin.Engine, *repositories.StoreRepository, *repositories.SessionRepository, *services.ShopifyService, *services.MeilisearchService, func()) {
 	ctx := context.Background()
 	cfg := testhelpers.TestConfig()
 
 	_, db, cleanup, err := testhelpers.SetupTestDatabase(ctx, cfg)
 	require.NoError(t, err)
 
-	storeRepo, _ := testhelpers.SetupTestRepositories(db)
+	storeRepo, sessionRepo := testhelpers.SetupTestRepositories(db)
 	meiliService := services.NewMeilisearchService(cfg)
+	meiliRegistry, err := services.NewMeilisearchRegistry(cfg, testhelpers.TestKeyProvider(cfg), meiliService)
+	require.NoError(t, err)
 	shopifyService := services.NewShopifyService(cfg)
 
 	// Setup router directly to avoid import cycle
@@ -37,7 +41,7 @@ func setupAuthTest(t *testing.T) (*gin.Engine, *repositories.StoreRepository, *s
 	router := gin.New()
 	router.Use(middleware.CORSMiddleware())
 
-	authHandler, err := NewAuthHandler(cfg, shopifyService, storeRepo, meiliService)
+	authHandler, err := NewAuthHandler(cfg, testhelpers.TestKeyProvider(cfg), shopifyService, storeRepo, sessionRepo, meiliRegistry)
 	require.NoError(t, err)
 
 	api := router.Group("/api")
@@ -48,17 +52,18 @@ func setupAuthTest(t *testing.T) (*gin.Engine, *repositories.StoreRepository, *s
 			shopifyGroup.GET("/callback", authHandler.Callback)
 			shopifyGroup.POST("/exchange", authHandler.ExchangeToken)
 			shopifyGroup.POST("/install", authHandler.InstallStore)
+			shopifyGroup.POST("/token-exchange", authHandler.TokenExchange)
 		}
 	}
 
-	return router, storeRepo, shopifyService, meiliService, func() {
+	return router, storeRepo, sessionRepo, shopifyService, meiliService, func() {
 		testhelpers.CleanupTestDatabase(ctx, db)
 		cleanup()
 	}
 }
 
 func TestAuthHandler_Begin(t *testing.T) {
-	router, _, _, _, cleanup := setupAuthTest(t)
+	router, _, _, _, _, cleanup := setupAuthTest(t)
 	defer cleanup()
 
 	tests := []struct {
@@ -143,7 +148,7 @@ func TestAuthHandler_Begin(t *testing.T) {
 }
 
 func TestAuthHandler_InstallStore(t *testing.T) {
-	router, storeRepo, _, _, cleanup := setupAuthTest(t)
+	router, storeRepo, _, _, _, cleanup := setupAuthTest(t)
 	defer cleanup()
 
 	// Create a test store first to test update scenario
@@ -239,7 +244,7 @@ func TestAuthHandler_InstallStore(t *testing.T) {
 }
 
 func TestAuthHandler_ExchangeToken(t *testing.T) {
-	router, _, _, _, cleanup := setupAuthTest(t)
+	router, _, _, _, _, cleanup := setupAuthTest(t)
 	defer cleanup()
 
 	tests := []struct {
@@ -286,7 +291,7 @@ func TestAuthHandler_ExchangeToken(t *testing.T) {
 }
 
 func TestAuthHandler_Callback(t *testing.T) {
-	router, _, _, _, cleanup := setupAuthTest(t)
+	router, _, _, _, _, cleanup := setupAuthTest(t)
 	defer cleanup()
 
 	cfg := testhelpers.TestConfig()
@@ -334,3 +339,148 @@ func TestAuthHandler_Callback(t *testing.T) {
 	}
 }
 
+func TestAuthHandler_TokenExchange(t *testing.T) {
+	router, storeRepo, sessionRepo, shopifyService, _, cleanup := setupAuthTest(t)
+	defer cleanup()
+	ctx := context.Background()
+	cfg := testhelpers.TestConfig()
+	shop := "exchange-store.myshopify.com"
+
+	// Fake Shopify token endpoint; each exchange hands out the next access token
+	exchanges := 0
+	shopifyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "/admin/oauth/access_token", r.URL.Path)
+		exchanges++
+		switch body["requested_token_type"] {
+		case services.OfflineAccessToken:
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"access_token": fmt.Sprintf("shpat_%d", exchanges),
+				"scope":        "read_products,write_products",
+			})
+		case services.OnlineAccessToken:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token":          fmt.Sprintf("shpua_%d", exchanges),
+				"scope":                 "read_products,write_products",
+				"expires_in":            86399,
+				"associated_user_scope": "read_products",
+				"associated_user": map[string]interface{}{
+					"id":            42,
+					"first_name":    "Ada",
+					"email":         "ada@example.com",
+					"account_owner": true,
+				},
+			})
+		default:
+			t.Errorf("unexpected requested_token_type %q", body["requested_token_type"])
+		}
+	}))
+	defer shopifyServer.Close()
+	shopifyService.SetBaseURL(shopifyServer.URL)
+
+	exchangeType := func(token, tokenType string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		req := httptest.NewRequest("POST", "/api/auth/shopify/token-exchange?requested_token_type="+tokenType, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var result map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &result)
+		return w, result
+	}
+	exchange := func(token string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		return exchangeType(token, "offline")
+	}
+	accessToken := func(store *models.Store) string {
+		decrypted, err := testhelpers.TestKeyProvider(cfg).Decrypt(ctx, store.ShopDomain, store.EncryptedAccessToken)
+		require.NoError(t, err)
+		return string(decrypted)
+	}
+
+	t.Run("invalid session token", func(t *testing.T) {
+		w, _ := exchange("")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w, _ = exchange("not-a-session-token")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "1", w.Header().Get("X-Shopify-Retry-Invalid-Session-Request"))
+		assert.Zero(t, exchanges)
+	})
+
+	t.Run("invalid token type", func(t *testing.T) {
+		w, _ := exchangeType(testhelpers.ShopifySessionToken(cfg, shop), "forever")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Zero(t, exchanges)
+	})
+
+	t.Run("online token requires an installed store", func(t *testing.T) {
+		w, result := exchangeType(testhelpers.ShopifySessionToken(cfg, shop), "online")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "store not installed", result["error"])
+		assert.Zero(t, exchanges)
+	})
+
+	t.Run("installs a new store", func(t *testing.T) {
+		w, result := exchange(testhelpers.ShopifySessionToken(cfg, shop))
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		assert.Equal(t, "installation successful", result["message"])
+		assert.Equal(t, "read_products,write_products", result["scope"])
+
+		store, err := storeRepo.GetByShopDomain(ctx, shop)
+		require.NoError(t, err)
+		assert.Equal(t, "active", store.Status)
+		assert.Equal(t, []string{"read_products", "write_products"}, store.GrantedScopes)
+		assert.Equal(t, cfg.MeilisearchURL, store.MeilisearchURL)
+		assert.NotEmpty(t, store.APIKeyPrivate)
+		assert.NotEmpty(t, store.WebhookSecret)
+		assert.Equal(t, "shpat_1", accessToken(store))
+	})
+
+	t.Run("refreshes the token of an installed store", func(t *testing.T) {
+		before, err := storeRepo.GetByShopDomain(ctx, shop)
+		require.NoError(t, err)
+
+		w, result := exchange(testhelpers.ShopifySessionToken(cfg, shop))
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		assert.Equal(t, "access token refreshed", result["message"])
+
+		// Only the token changes; keys and secrets stay as they are
+		after, err := storeRepo.GetByShopDomain(ctx, shop)
+		require.NoError(t, err)
+		assert.Equal(t, before.ID, after.ID)
+		assert.Equal(t, before.APIKeyPrivate, after.APIKeyPrivate)
+		assert.Equal(t, before.WebhookSecret, after.WebhookSecret)
+		assert.Equal(t, "shpat_2", accessToken(after))
+	})
+
+	t.Run("stores an online token against the session", func(t *testing.T) {
+		w, result := exchangeType(testhelpers.ShopifySessionToken(cfg, shop), "online")
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		assert.Equal(t, shop+"_42", result["session_id"])
+		assert.Equal(t, "online access token stored", result["message"])
+
+		session, err := sessionRepo.GetByID(ctx, shop+"_42")
+		require.NoError(t, err)
+		assert.True(t, session.IsOnline)
+		assert.Equal(t, shop, session.Shop)
+		require.NotNil(t, session.UserID)
+		assert.Equal(t, int64(42), *session.UserID)
+		assert.Equal(t, "ada@example.com", *session.Email)
+		assert.True(t, session.AccountOwner)
+		require.NotNil(t, session.Expires)
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), *session.Expires, time.Minute)
+
+		ciphertext, err := hex.DecodeString(session.AccessToken)
+		require.NoError(t, err)
+		decrypted, err := testhelpers.TestKeyProvider(cfg).Decrypt(ctx, shop, ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, "shpua_3", string(decrypted))
+
+		// The store keeps its offline token
+		store, err := storeRepo.GetByShopDomain(ctx, shop)
+		require.NoError(t, err)
+		assert.Equal(t, "shpat_2", accessToken(store))
+	})
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"mgsearch/config"
+	"mgsearch/middleware"
+	"mgsearch/models"
+	"mgsearch/pkg/security"
+	"mgsearch/repositories"
+	"mgsearch/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BillingHandler struct {
+	cfg     *config.Config
+	shopify *services.ShopifyService
+	stores  *repositories.StoreRepository
+	usage   *repositories.UsageRepository
+	meili   *services.MeilisearchRegistry
+	keys    security.KeyProvider
+}
+
+type subscribeRequest struct {
+	Plan string `json:"plan" binding:"required"`
+}
+
+func NewBillingHandler(cfg *config.Config, keys security.KeyProvider, shopify *services.ShopifyService, stores *repositories.StoreRepository, usage *repositories.UsageRepository, meili *services.MeilisearchRegistry) (*BillingHandler, error) {
+	if keys == nil {
+		return nil, errors.New("key provider is required")
+	}
+
+	return &BillingHandler{
+		cfg:     cfg,
+		shopify: shopify,
+		stores:  stores,
+		usage:   usage,
+		meili:   meili,
+		keys:    keys,
+	}, nil
+}
+
+// GetBilling handles GET /api/stores/current/billing
+// Returns the store's plan, its subscription and any charge awaiting approval, current usage and
+// the available plans.
+func (h *BillingHandler) GetBilling(c *gin.Context) {
+	store, ok := h.currentStore(c)
+	if !ok {
+		return
+	}
+
+	usage, err := h.usage.GetCurrent(c.Request.Context(), store.ID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load usage", "details": err.Error()})
+		return
+	}
+
+	usageView := gin.H{
+		"period":   usage.Period,
+		"searches": usage.Searches,
+	}
+	if meili, err := h.meili.ForStore(store); err == nil {
+		if documents, err := meili.DocumentCount(store.IndexUID()); err == nil {
+			usageView["documents"] = documents
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"plan":                 store.Plan(),
+		"subscription":         store.Subscription,
+		"pending_subscription": store.PendingSubscription,
+		"usage":                usageView,
+		"plans":                models.Plans,
+	})
+}
+
+// Subscribe handles POST /api/stores/current/billing/subscribe
+// Paid plans return the Shopify confirmation URL the merchant must approve; the plan changes once
+// Shopify redirects back to Callback. Switching to the free plan cancels the current subscription.
+func (h *BillingHandler) Subscribe(c *gin.Context) {
+	store, ok := h.currentStore(c)
+	if !ok {
+		return
+	}
+
+	var req subscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	plan, ok := models.PlanByLevel(req.Plan)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown plan"})
+		return
+	}
+	if plan.Level == store.Plan().Level {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "store is already on this plan"})
+		return
+	}
+
+	accessToken, err := h.keys.Decrypt(c.Request.Context(), store.ShopDomain, store.EncryptedAccessToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decrypt access token"})
+		return
+	}
+
+	if plan.IsFree() {
+		if store.Subscription != nil && store.Subscription.Status == models.SubscriptionStatusActive {
+			if err := h.shopify.CancelSubscription(c.Request.Context(), store.ShopDomain, string(accessToken), store.Subscription.ID); err != nil {
+				c.JSON(http.StatusBadGateway, gin.H{"error": "failed to cancel subscription", "details": err.Error()})
+				return
+			}
+		}
+		if err := h.stores.UpdatePlan(c.Request.Context(), store.ID.Hex(), plan.Level, nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update plan", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"plan": plan})
+		return
+	}
+
+	returnURL := fmt.Sprintf("%s/api/billing/callback?shop=%s", strings.TrimRight(h.cfg.ShopifyAppURL, "/"), url.QueryEscape(store.ShopDomain))
+	confirmationURL, subscription, err := h.shopify.CreateRecurringCharge(c.Request.Context(), store.ShopDomain, string(accessToken), plan, returnURL, h.cfg.ShopifyBillingTest)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to create subscription", "details": err.Error()})
+		return
+	}
+
+	// The current plan and its subscription stay in effect until the merchant approves the charge
+	pending := &models.StoreSubscription{
+		ID:        subscription.ID,
+		PlanLevel: plan.Level,
+		Status:    subscription.Status,
+		Test:      subscription.Test,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := h.stores.UpdatePendingSubscription(c.Request.Context(), store.ID.Hex(), pending); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to persist subscription", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"confirmation_url": confirmationURL,
+		"subscription":     pending,
+	})
+}
+
+// Callback handles GET /api/billing/callback
+// Shopify redirects the merchant here after approving or declining a charge. The charge status is
+// read back from Shopify, so the query parameters alone cannot change a plan. Only an ACTIVE charge
+// replaces the store's subscription; a declined charge is dropped and the current plan is kept.
+func (h *BillingHandler) Callback(c *gin.Context) {
+	shop := strings.ToLower(strings.TrimSpace(c.Query("shop")))
+	chargeID := strings.TrimSpace(c.Query("charge_id"))
+	if shop == "" || chargeID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing required parameters"})
+		return
+	}
+
+	store, err := h.stores.GetByShopDomain(c.Request.Context(), shop)
+	if err != nil {
+		if err.Error() == "store not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "store not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load store", "details": err.Error()})
+		return
+	}
+
+	adminURL := fmt.Sprintf("https://%s/admin/apps/%s", shop, h.cfg.ShopifyAPIKey)
+	subscriptionID := services.AppSubscriptionGID(chargeID)
+	if store.PendingSubscription == nil || store.PendingSubscription.ID != subscriptionID {
+		// Revisiting the return URL of a charge that was already activated
+		if store.Subscription != nil && store.Subscription.ID == subscriptionID {
+			c.Redirect(http.StatusFound, adminURL)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown subscription"})
+		return
+	}
+
+	accessToken, err := h.keys.Decrypt(c.Request.Context(), store.ShopDomain, store.EncryptedAccessToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decrypt access token"})
+		return
+	}
+
+	subscription, err := h.shopify.GetSubscription(c.Request.Context(), shop, string(accessToken), subscriptionID)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to load subscription", "details": err.Error()})
+		return
+	}
+
+	record := *store.PendingSubscription
+	record.Status = subscription.Status
+	switch subscription.Status {
+	case models.SubscriptionStatusActive:
+		now := time.Now().UTC()
+		record.ActivatedAt = &now
+		err = h.stores.ActivateSubscription(c.Request.Context(), store.ID.Hex(), &record)
+	case models.SubscriptionStatusPending:
+		err = h.stores.UpdatePendingSubscription(c.Request.Context(), store.ID.Hex(), &record)
+	default:
+		err = h.stores.UpdatePendingSubscription(c.Request.Context(), store.ID.Hex(), nil)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update plan", "details": err.Error()})
+		return
+	}
+
+	// Back to the embedded app in the Shopify admin
+	c.Redirect(http.StatusFound, adminURL)
+}
+
+func (h *BillingHandler) currentStore(c *gin.Context) (*models.Store, bool) {
+	storeID, ok := middleware.GetStoreID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, false
+	}
+
+	store, err := h.stores.GetByID(c.Request.Context(), storeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "store not found", "details": err.Error()})
+		return nil, false
+	}
+	return store, true
+}
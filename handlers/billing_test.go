@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mgsearch/middleware"
+	"mgsearch/models"
+	"mgsearch/pkg/auth"
+	"mgsearch/repositories"
+	"mgsearch/services"
+	"mgsearch/testhelpers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeShopifyBilling answers the Billing API calls of the billing handler. Charges are created
+// pending; tests set the status Shopify reports for them afterwards.
+type fakeShopifyBilling struct {
+	mu        sync.Mutex
+	charges   int
+	statuses  map[string]string
+	cancelled []string
+}
+
+func (f *fakeShopifyBilling) setStatus(id, status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses[id] = status
+}
+
+func (f *fakeShopifyBilling) serveGraphQL(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var request struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&request)
+
+	subscription := func(id string) gin.H {
+		return gin.H{"id": id, "name": "plan", "status": f.statuses[id], "test": true}
+	}
+
+	var data gin.H
+	switch {
+	case strings.Contains(request.Query, "appSubscriptionCreate"):
+		f.charges++
+		id := fmt.Sprintf("gid://shopify/AppSubscription/%d", 1000+f.charges)
+		f.statuses[id] = models.SubscriptionStatusPending
+		data = gin.H{"appSubscriptionCreate": gin.H{
+			"confirmationUrl": "https://billing-test.myshopify.com/admin/charges/confirm",
+			"appSubscription": subscription(id),
+			"userErrors":      []interface{}{},
+		}}
+	case strings.Contains(request.Query, "appSubscriptionCancel"):
+		id, _ := request.Variables["id"].(string)
+		f.statuses[id] = models.SubscriptionStatusCancelled
+		f.cancelled = append(f.cancelled, id)
+		data = gin.H{"appSubscriptionCancel": gin.H{"appSubscription": subscription(id), "userErrors": []interface{}{}}}
+	default:
+		id, _ := request.Variables["id"].(string)
+		data = gin.H{"node": subscription(id)}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(gin.H{"data": data})
+}
+
+type billingTest struct {
+	router  *gin.Engine
+	stores  *repositories.StoreRepository
+	store   *models.Store
+	token   string
+	shopify *fakeShopifyBilling
+}
+
+func setupBillingTest(t *testing.T) *billingTest {
+	ctx := context.Background()
+	cfg := testhelpers.TestConfig()
+
+	_, db, cleanup, err := testhelpers.SetupTestDatabase(ctx, cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		testhelpers.CleanupTestDatabase(ctx, db)
+		cleanup()
+	})
+
+	test := &billingTest{
+		stores:  repositories.NewStoreRepository(db),
+		shopify: &fakeShopifyBilling{statuses: map[string]string{}},
+	}
+
+	admin := httptest.NewServer(http.HandlerFunc(test.shopify.serveGraphQL))
+	t.Cleanup(admin.Close)
+	shopify := services.NewShopifyService(cfg)
+	shopify.SetBaseURL(admin.URL)
+
+	keys := testhelpers.TestKeyProvider(cfg)
+	accessToken, err := keys.Encrypt(ctx, "billing-test.myshopify.com", []byte("shpat_billing_test"))
+	require.NoError(t, err)
+	test.store, err = test.stores.CreateOrUpdate(ctx, &models.Store{
+		ShopDomain:           "billing-test.myshopify.com",
+		ShopName:             "Billing Test Store",
+		EncryptedAccessToken: accessToken,
+		ProductIndexUID:      "products_billing_test",
+		MeilisearchIndexUID:  "products_billing_test",
+		InstalledAt:          time.Now().UTC(),
+	})
+	require.NoError(t, err)
+
+	test.token, err = auth.GenerateSessionToken(test.store.ID.Hex(), test.store.ShopDomain, []byte(cfg.JWTSigningKey), time.Hour)
+	require.NoError(t, err)
+
+	meiliRegistry, err := services.NewMeilisearchRegistry(cfg, keys, services.NewMeilisearchService(cfg))
+	require.NoError(t, err)
+	handler, err := NewBillingHandler(cfg, keys, shopify, test.stores, repositories.NewUsageRepository(db), meiliRegistry)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	test.router = gin.New()
+	test.router.GET("/api/billing/callback", handler.Callback)
+	storeGroup := test.router.Group("/api/stores", middleware.NewAuthMiddleware(cfg.JWTSigningKey).RequireStoreSession())
+	storeGroup.GET("/current/billing", handler.GetBilling)
+	storeGroup.POST("/current/billing/subscribe", handler.Subscribe)
+
+	return test
+}
+
+func (b *billingTest) subscribe(t *testing.T, plan string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest(http.MethodPost, "/api/stores/current/billing/subscribe", strings.NewReader(`{"plan":"`+plan+`"}`))
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	b.router.ServeHTTP(w, req)
+
+	var result map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &result)
+	return w, result
+}
+
+// subscribePending subscribes to plan and returns the ID of the charge awaiting approval.
+func (b *billingTest) subscribePending(t *testing.T, plan string) string {
+	w, result := b.subscribe(t, plan)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotEmpty(t, result["confirmation_url"])
+
+	subscription, _ := result["subscription"].(map[string]interface{})
+	id, _ := subscription["id"].(string)
+	require.NotEmpty(t, id)
+	return id
+}
+
+func (b *billingTest) callback(t *testing.T, subscriptionID string) *httptest.ResponseRecorder {
+	chargeID := strings.TrimPrefix(subscriptionID, "gid://shopify/AppSubscription/")
+	query := url.Values{"shop": {b.store.ShopDomain}, "charge_id": {chargeID}}
+	req := httptest.NewRequest(http.MethodGet, "/api/billing/callback?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	b.router.ServeHTTP(w, req)
+	return w
+}
+
+func (b *billingTest) reload(t *testing.T) *models.Store {
+	store, err := b.stores.GetByID(context.Background(), b.store.ID.Hex())
+	require.NoError(t, err)
+	return store
+}
+
+// activate puts the store on a paid plan through an approved charge.
+func (b *billingTest) activate(t *testing.T, plan string) string {
+	id := b.subscribePending(t, plan)
+	b.shopify.setStatus(id, models.SubscriptionStatusActive)
+	require.Equal(t, http.StatusFound, b.callback(t, id).Code)
+	return id
+}
+
+func TestBillingHandler_ApproveCharge(t *testing.T) {
+	test := setupBillingTest(t)
+
+	id := test.subscribePending(t, models.PlanPro)
+
+	// The pending charge must not replace the plan or its subscription
+	store := test.reload(t)
+	assert.Equal(t, models.PlanFree, store.PlanLevel)
+	assert.Nil(t, store.Subscription)
+	require.NotNil(t, store.PendingSubscription)
+	assert.Equal(t, id, store.PendingSubscription.ID)
+	assert.Equal(t, models.PlanPro, store.PendingSubscription.PlanLevel)
+
+	// Returning before approving keeps the charge pending
+	require.Equal(t, http.StatusFound, test.callback(t, id).Code)
+	store = test.reload(t)
+	assert.Equal(t, models.PlanFree, store.PlanLevel)
+	require.NotNil(t, store.PendingSubscription)
+
+	test.shopify.setStatus(id, models.SubscriptionStatusActive)
+	w := test.callback(t, id)
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	assert.Contains(t, w.Header().Get("Location"), "https://billing-test.myshopify.com/admin/apps/")
+
+	store = test.reload(t)
+	assert.Equal(t, models.PlanPro, store.PlanLevel)
+	require.NotNil(t, store.Subscription)
+	assert.Equal(t, id, store.Subscription.ID)
+	assert.Equal(t, models.SubscriptionStatusActive, store.Subscription.Status)
+	assert.NotNil(t, store.Subscription.ActivatedAt)
+	assert.Nil(t, store.PendingSubscription)
+
+	// Revisiting the return URL changes nothing
+	assert.Equal(t, http.StatusFound, test.callback(t, id).Code)
+	assert.Equal(t, models.PlanPro, test.reload(t).PlanLevel)
+
+	assert.Equal(t, http.StatusBadRequest, test.callback(t, "gid://shopify/AppSubscription/1").Code)
+}
+
+func TestBillingHandler_DeclineCharge(t *testing.T) {
+	test := setupBillingTest(t)
+	active := test.activate(t, models.PlanBasic)
+
+	pending := test.subscribePending(t, models.PlanBusiness)
+	test.shopify.setStatus(pending, models.SubscriptionStatusDeclined)
+	require.Equal(t, http.StatusFound, test.callback(t, pending).Code)
+
+	store := test.reload(t)
+	assert.Equal(t, models.PlanBasic, store.PlanLevel)
+	require.NotNil(t, store.Subscription)
+	assert.Equal(t, active, store.Subscription.ID)
+	assert.Equal(t, models.SubscriptionStatusActive, store.Subscription.Status)
+	assert.Nil(t, store.PendingSubscription)
+
+	// The declined charge can no longer be completed
+	test.shopify.setStatus(pending, models.SubscriptionStatusActive)
+	assert.Equal(t, http.StatusBadRequest, test.callback(t, pending).Code)
+	assert.Equal(t, models.PlanBasic, test.reload(t).PlanLevel)
+}
+
+func TestBillingHandler_CancelToFreePlan(t *testing.T) {
+	test := setupBillingTest(t)
+	active := test.activate(t, models.PlanPro)
+
+	w, result := test.subscribe(t, models.PlanFree)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	plan, _ := result["plan"].(map[string]interface{})
+	assert.Equal(t, models.PlanFree, plan["level"])
+
+	assert.Equal(t, []string{active}, test.shopify.cancelled)
+	store := test.reload(t)
+	assert.Equal(t, models.PlanFree, store.PlanLevel)
+	assert.Nil(t, store.Subscription)
+
+	w, _ = test.subscribe(t, models.PlanFree)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+
+	"mgsearch/middleware"
+	"mgsearch/models"
+	"mgsearch/repositories"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// requireClientRole loads the client named by the client_id URL parameter and checks that the
+// authenticated user holds at least role min on it. On failure the error response is written and ok
+// is false.
+func requireClientRole(c *gin.Context, clients *repositories.ClientRepository, min models.ClientRole) (client *models.Client, userID primitive.ObjectID, ok bool) {
+	userIDStr, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return nil, primitive.NilObjectID, false
+	}
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return nil, primitive.NilObjectID, false
+	}
+
+	clientID, err := primitive.ObjectIDFromHex(c.Param("client_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client ID"})
+		return nil, primitive.NilObjectID, false
+	}
+
+	client, err = clients.FindByID(c.Request.Context(), clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
+		return nil, primitive.NilObjectID, false
+	}
+
+	if !checkClientRole(c, client, userID, min) {
+		return nil, primitive.NilObjectID, false
+	}
+	return client, userID, true
+}
+
+// checkClientRole reports whether userID holds at least role min on client, writing a 403 response
+// when it does not. Clients that require two-factor authentication or single sign-on also reject
+// sessions started without it.
+func checkClientRole(c *gin.Context, client *models.Client, userID primitive.ObjectID, min models.ClientRole) bool {
+	role, ok := client.RoleOf(userID)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied to this client"})
+		return false
+	}
+	if !role.Includes(min) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient role", "details": "requires the " + string(min) + " role or higher"})
+		return false
+	}
+	if client.RequireMFA && !middleware.HasMFA(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "two-factor authentication required", "details": "enable two-factor authentication and sign in again to access this client"})
+		return false
+	}
+	if client.RequireSSO && !middleware.HasSSO(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "single sign-on required", "details": "sign in with single sign-on to access this client"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"mgsearch/middleware"
+	"mgsearch/models"
+	"mgsearch/pkg/auth"
+	"mgsearch/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateInviteRequest represents the invite member request
+type CreateInviteRequest struct {
+	Email string            `json:"email" binding:"required,email"`
+	Role  models.ClientRole `json:"role" binding:"required"`
+}
+
+// AcceptInviteRequest represents the accept invitation request of a signed in user
+type AcceptInviteRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// RegisterInviteRequest represents the accept invitation request of a new user
+type RegisterInviteRequest struct {
+	Token     string `json:"token" binding:"required"`
+	Password  string `json:"password" binding:"required,min=8"`
+	FirstName string `json:"first_name" binding:"required"`
+	LastName  string `json:"last_name" binding:"required"`
+}
+
+// CreateInvite handles POST /api/v1/clients/:client_id/invites. Admins invite members with any role
+// but owner, which only owners can grant. Inviting an address again revokes its earlier invitations.
+func (h *UserAuthHandler) CreateInvite(c *gin.Context) {
+	if h.cfg.InviteURL == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "invitations are not configured"})
+		return
+	}
+
+	client, actorID, ok := requireClientRole(c, h.clientRepo, models.ClientRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+	if !req.Role.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role", "details": "role must be owner, admin, developer or viewer"})
+		return
+	}
+	if req.Role == models.ClientRoleOwner && !checkClientRole(c, client, actorID, models.ClientRoleOwner) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if existing, err := h.userRepo.FindByEmail(ctx, email); err == nil {
+		if _, ok := client.RoleOf(existing.ID); ok {
+			c.JSON(http.StatusConflict, gin.H{"error": "user is already a member"})
+			return
+		}
+	}
+
+	inviter, err := h.userRepo.FindByID(ctx, actorID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	rawToken, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate invitation token"})
+		return
+	}
+
+	if err := h.invites.RevokePendingForEmail(ctx, client.ID, email, actorID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invitation", "details": err.Error()})
+		return
+	}
+	now := time.Now().UTC()
+	invite := &models.ClientInvite{
+		ClientID:  client.ID,
+		Email:     email,
+		Role:      req.Role,
+		TokenHash: tokenHash,
+		InvitedBy: actorID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(h.cfg.InviteTTL),
+	}
+	if err := h.invites.Create(ctx, invite); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invitation", "details": err.Error()})
+		return
+	}
+
+	// The invitation stays pending when delivery fails; inviting the address again sends a new link
+	if err := h.mailer.Send(ctx, inviteMail(invite, client, inviter, tokenLink(h.cfg.InviteURL, rawToken), h.cfg.InviteTTL)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send invitation email", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "invitation sent",
+		"invite":  invite.ToPublicView(now),
+	})
+}
+
+// ListInvites handles GET /api/v1/clients/:client_id/invites. Only pending invitations are listed
+// unless ?all=true is given.
+func (h *UserAuthHandler) ListInvites(c *gin.Context) {
+	client, _, ok := requireClientRole(c, h.clientRepo, models.ClientRoleViewer)
+	if !ok {
+		return
+	}
+
+	invites, err := h.invites.ListByClient(c.Request.Context(), client.ID, c.Query("all") != "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch invitations", "details": err.Error()})
+		return
+	}
+
+	now := time.Now().UTC()
+	views := make([]map[string]interface{}, len(invites))
+	for i, invite := range invites {
+		views[i] = invite.ToPublicView(now)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invites": views})
+}
+
+// RevokeInvite handles DELETE /api/v1/clients/:client_id/invites/:invite_id
+func (h *UserAuthHandler) RevokeInvite(c *gin.Context) {
+	client, actorID, ok := requireClientRole(c, h.clientRepo, models.ClientRoleAdmin)
+	if !ok {
+		return
+	}
+
+	inviteID, err := primitive.ObjectIDFromHex(c.Param("invite_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invite ID"})
+		return
+	}
+
+	if err := h.invites.Revoke(c.Request.Context(), client.ID, inviteID, actorID); err != nil {
+		if err.Error() == "invite not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "pending invitation not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke invitation", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "invitation revoked"})
+}
+
+// AcceptInvite handles POST /api/v1/auth/invites/accept. The signed in user joins the client if the
+// invitation was sent to their email address.
+func (h *UserAuthHandler) AcceptInvite(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var req AcceptInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	invite, client, ok := h.pendingInvite(c, req.Token)
+	if !ok {
+		return
+	}
+
+	user, err := h.userRepo.FindByID(ctx, userObjID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if user.Email != invite.Email {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invitation was sent to a different email address"})
+		return
+	}
+
+	if !h.joinClient(c, invite, user.ID) {
+		return
+	}
+
+	// The invitation link was mailed to this address, which proves the user owns it
+	if !user.EmailVerified {
+		if err := h.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email", "details": err.Error()})
+			return
+		}
+	}
+
+	client, err = h.clientRepo.FindByID(ctx, client.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch client", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "invitation accepted",
+		"client":  client.ToPublicView(),
+	})
+}
+
+// RegisterWithInvite handles POST /api/v1/auth/invites/register. It creates an account for the
+// invited email address, which counts as verified, joins the client and signs the user in.
+func (h *UserAuthHandler) RegisterWithInvite(c *gin.Context) {
+	var req RegisterInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	invite, client, ok := h.pendingInvite(c, req.Token)
+	if !ok {
+		return
+	}
+
+	if existingUser, _ := h.userRepo.FindByEmail(ctx, invite.Email); existingUser != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "email already registered", "details": "log in to accept the invitation"})
+		return
+	}
+
+	passwordHash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process password"})
+		return
+	}
+
+	// The user is created once the invitation is claimed, so a token cannot create two accounts
+	user := &models.User{
+		ID:            primitive.NewObjectID(),
+		Email:         invite.Email,
+		PasswordHash:  passwordHash,
+		FirstName:     req.FirstName,
+		LastName:      req.LastName,
+		ClientIDs:     []primitive.ObjectID{},
+		IsActive:      true,
+		EmailVerified: true,
+	}
+	if err := h.invites.Accept(ctx, invite.ID, user.ID); err != nil {
+		h.inviteError(c, err)
+		return
+	}
+
+	created, err := h.userRepo.Create(ctx, user)
+	if err != nil {
+		// Nothing was created, so the invitation stays usable
+		if reopenErr := h.invites.Reopen(ctx, invite.ID, user.ID); reopenErr != nil {
+			log.Printf("failed to reopen invitation %s: %v", invite.ID.Hex(), reopenErr)
+		}
+		if err.Error() == "email already exists" {
+			c.JSON(http.StatusConflict, gin.H{"error": "email already registered", "details": "log in to accept the invitation"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user", "details": err.Error()})
+		return
+	}
+	user = created
+
+	if err := h.addMember(ctx, invite, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to join client", "details": err.Error()})
+		return
+	}
+	user.ClientIDs = append(user.ClientIDs, client.ID)
+
+	tokens, err := h.startSession(c, user, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tokens.response(gin.H{
+		"message":   "invitation accepted",
+		"user":      user.ToPublicView(),
+		"client_id": client.ID.Hex(),
+	}))
+}
+
+// pendingInvite looks up the pending invitation of token and its client. On failure the error
+// response is written and ok is false.
+func (h *UserAuthHandler) pendingInvite(c *gin.Context, token string) (*models.ClientInvite, *models.Client, bool) {
+	ctx := c.Request.Context()
+	invite, err := h.invites.FindPendingByHash(ctx, auth.HashOpaqueToken(token))
+	if err != nil {
+		h.inviteError(c, err)
+		return nil, nil, false
+	}
+
+	client, err := h.clientRepo.FindByID(ctx, invite.ClientID)
+	if err != nil || !client.IsActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired invitation"})
+		return nil, nil, false
+	}
+	return invite, client, true
+}
+
+// joinClient claims the invitation for the user and adds them to its client
+func (h *UserAuthHandler) joinClient(c *gin.Context, invite *models.ClientInvite, userID primitive.ObjectID) bool {
+	ctx := c.Request.Context()
+	if err := h.invites.Accept(ctx, invite.ID, userID); err != nil {
+		h.inviteError(c, err)
+		return false
+	}
+	if err := h.addMember(ctx, invite, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to join client", "details": err.Error()})
+		return false
+	}
+	return true
+}
+
+// addMember adds the user to the invitation's client. Users who are already members keep their role.
+func (h *UserAuthHandler) addMember(ctx context.Context, invite *models.ClientInvite, userID primitive.ObjectID) error {
+	if err := h.clientRepo.AddMember(ctx, invite.ClientID, userID, invite.Role); err != nil && err.Error() != "user is already a member" {
+		return err
+	}
+	return h.userRepo.AddClientToUser(ctx, userID, invite.ClientID)
+}
+
+func (h *UserAuthHandler) inviteError(c *gin.Context, err error) {
+	if err.Error() == "invite not found" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired invitation"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify invitation", "details": err.Error()})
+}
+
+func inviteMail(invite *models.ClientInvite, client *models.Client, inviter *models.User, link string, ttl time.Duration) services.MailMessage {
+	return services.MailMessage{
+		To:      invite.Email,
+		Subject: fmt.Sprintf("You have been invited to %s", client.Name),
+		Body: fmt.Sprintf(`Hi,
+
+%s %s invited you to join %s as %s. Open the link below to accept the invitation:
+
+%s
+
+The link expires in %s and can only be used once. If you were not expecting this invitation, you
+can ignore this email.
+`, inviter.FirstName, inviter.LastName, client.Name, invite.Role, link, formatMailDuration(ttl)),
+	}
+}
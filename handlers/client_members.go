@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"net/http"
+
+	"mgsearch/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UpdateMemberRoleRequest represents the change member role request
+type UpdateMemberRoleRequest struct {
+	Role models.ClientRole `json:"role" binding:"required"`
+}
+
+// ListMembers handles GET /api/v1/clients/:client_id/members
+func (h *UserAuthHandler) ListMembers(c *gin.Context) {
+	client, _, ok := requireClientRole(c, h.clientRepo, models.ClientRoleViewer)
+	if !ok {
+		return
+	}
+
+	users, err := h.userRepo.FindByClientID(c.Request.Context(), client.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch members", "details": err.Error()})
+		return
+	}
+	usersByID := make(map[primitive.ObjectID]*models.User, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+
+	members := make([]gin.H, 0, len(client.Members))
+	for _, member := range client.Members {
+		view := gin.H{
+			"user_id":  member.UserID.Hex(),
+			"role":     member.Role,
+			"added_at": member.AddedAt,
+		}
+		if user, ok := usersByID[member.UserID]; ok {
+			view["email"] = user.Email
+			view["first_name"] = user.FirstName
+			view["last_name"] = user.LastName
+			view["mfa_enabled"] = user.MFAEnabled
+			view["sso_linked"] = user.SSOSubject != ""
+		}
+		members = append(members, view)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// UpdateMemberRole handles PUT /api/v1/clients/:client_id/members/:user_id. Admins manage the roles
+// of non-owners; granting or taking away the owner role requires an owner. The last owner cannot be
+// demoted.
+func (h *UserAuthHandler) UpdateMemberRole(c *gin.Context) {
+	client, actorID, ok := requireClientRole(c, h.clientRepo, models.ClientRoleAdmin)
+	if !ok {
+		return
+	}
+
+	memberID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var req UpdateMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+	if !req.Role.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role", "details": "role must be owner, admin, developer or viewer"})
+		return
+	}
+
+	currentRole, ok := client.RoleOf(memberID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+		return
+	}
+	if currentRole == models.ClientRoleOwner || req.Role == models.ClientRoleOwner {
+		if !checkClientRole(c, client, actorID, models.ClientRoleOwner) {
+			return
+		}
+	}
+
+	if err := h.clientRepo.UpdateMemberRole(c.Request.Context(), client.ID, memberID, req.Role); err != nil {
+		membershipErrorResponse(c, err, "failed to update member role")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "member role updated",
+		"member":  gin.H{"user_id": memberID.Hex(), "role": req.Role},
+	})
+}
+
+// RemoveMember handles DELETE /api/v1/clients/:client_id/members/:user_id. Admins remove non-owners;
+// removing an owner requires an owner. The last owner cannot be removed.
+func (h *UserAuthHandler) RemoveMember(c *gin.Context) {
+	client, actorID, ok := requireClientRole(c, h.clientRepo, models.ClientRoleAdmin)
+	if !ok {
+		return
+	}
+
+	memberID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	role, ok := client.RoleOf(memberID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+		return
+	}
+	if role == models.ClientRoleOwner && !checkClientRole(c, client, actorID, models.ClientRoleOwner) {
+		return
+	}
+
+	if !h.removeMembership(c, client.ID, memberID) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "member removed"})
+}
+
+// LeaveClient handles POST /api/v1/clients/:client_id/leave. The last owner cannot leave.
+func (h *UserAuthHandler) LeaveClient(c *gin.Context) {
+	client, userID, ok := requireClientRole(c, h.clientRepo, models.ClientRoleViewer)
+	if !ok {
+		return
+	}
+
+	if !h.removeMembership(c, client.ID, userID) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "left client"})
+}
+
+// removeMembership removes the user from the client and the client from the user
+func (h *UserAuthHandler) removeMembership(c *gin.Context, clientID, userID primitive.ObjectID) bool {
+	ctx := c.Request.Context()
+	if err := h.clientRepo.RemoveMember(ctx, clientID, userID); err != nil {
+		membershipErrorResponse(c, err, "failed to remove member")
+		return false
+	}
+	// Memberships of deleted users are removed all the same
+	if err := h.userRepo.RemoveClientFromUser(ctx, userID, clientID); err != nil && err.Error() != "user not found" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove member", "details": err.Error()})
+		return false
+	}
+	return true
+}
+
+// membershipErrorResponse writes the response for an error of a client membership update
+func membershipErrorResponse(c *gin.Context, err error, message string) {
+	switch err.Error() {
+	case "member not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+	case "client must keep at least one owner":
+		c.JSON(http.StatusConflict, gin.H{"error": "client must keep at least one owner"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message, "details": err.Error()})
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+
+	"mgsearch/middleware"
+	"mgsearch/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateClientSecurityRequest represents the client security settings request. Omitted settings
+// are left unchanged.
+type UpdateClientSecurityRequest struct {
+	RequireMFA *bool `json:"require_mfa"`
+	RequireSSO *bool `json:"require_sso"`
+}
+
+// UpdateClientSecurity handles PUT /api/v1/clients/:client_id/security. Each requirement locks out
+// members whose session was started without it, so only admins whose own session meets it can turn
+// it on.
+func (h *UserAuthHandler) UpdateClientSecurity(c *gin.Context) {
+	client, _, ok := requireClientRole(c, h.clientRepo, models.ClientRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req UpdateClientSecurityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+	if req.RequireMFA == nil && req.RequireSSO == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": "require_mfa or require_sso is required"})
+		return
+	}
+
+	if req.RequireMFA != nil && *req.RequireMFA && !middleware.HasMFA(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "two-factor authentication required", "details": "enable two-factor authentication and sign in again before requiring it"})
+		return
+	}
+	if req.RequireSSO != nil && *req.RequireSSO {
+		if h.oidc == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "single sign-on is not configured"})
+			return
+		}
+		if !middleware.HasSSO(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "single sign-on required", "details": "sign in with single sign-on before requiring it"})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	if req.RequireMFA != nil {
+		if err := h.clientRepo.SetRequireMFA(ctx, client.ID, *req.RequireMFA); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update client security", "details": err.Error()})
+			return
+		}
+		client.RequireMFA = *req.RequireMFA
+	}
+	if req.RequireSSO != nil {
+		if err := h.clientRepo.SetRequireSSO(ctx, client.ID, *req.RequireSSO); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update client security", "details": err.Error()})
+			return
+		}
+		client.RequireSSO = *req.RequireSSO
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "client security updated",
+		"client":  client.ToPublicView(),
+	})
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"mgsearch/workers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EncryptionHandler exposes operator commands for managing encryption keys.
+type EncryptionHandler struct {
+	reencryptor *workers.Reencryptor
+}
+
+func NewEncryptionHandler(reencryptor *workers.Reencryptor) *EncryptionHandler {
+	return &EncryptionHandler{reencryptor: reencryptor}
+}
+
+// Reencrypt handles POST /api/admin/encryption/reencrypt
+// Re-encrypts all stored secrets with the primary key. Pass dry_run=true to only count the secrets
+// that still use an older key.
+func (h *EncryptionHandler) Reencrypt(c *gin.Context) {
+	dryRun := false
+	if value := c.Query("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid dry_run", "details": err.Error()})
+			return
+		}
+		dryRun = parsed
+	}
+
+	result, err := h.reencryptor.Run(c.Request.Context(), dryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "re-encryption failed", "details": err.Error(), "result": result})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
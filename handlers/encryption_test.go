@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mgsearch/models"
+	"mgsearch/pkg/security"
+	"mgsearch/testhelpers"
+	"mgsearch/workers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestEncryptionHandler_Reencrypt(t *testing.T) {
+	ctx := context.Background()
+	cfg := testhelpers.TestConfig()
+
+	_, db, cleanup, err := testhelpers.SetupTestDatabase(ctx, cfg)
+	require.NoError(t, err)
+	defer func() {
+		testhelpers.CleanupTestDatabase(ctx, db)
+		cleanup()
+	}()
+	storeRepo, sessionRepo := testhelpers.SetupTestRepositories(db)
+
+	// Secrets written before the keyring existed, with ENCRYPTION_KEY alone
+	legacyKey, err := security.MustDecodeKey(cfg.EncryptionKey)
+	require.NoError(t, err)
+	encryptedToken, err := security.EncryptAESGCM(legacyKey, []byte("shpat_token"))
+	require.NoError(t, err)
+	encryptedMeiliKey, err := security.EncryptAESGCM(legacyKey, []byte("meili-key"))
+	require.NoError(t, err)
+	encryptedSessionToken, err := security.EncryptAESGCM(legacyKey, []byte("shpat_session"))
+	require.NoError(t, err)
+
+	store, err := storeRepo.CreateOrUpdate(ctx, &models.Store{
+		ID:                   primitive.NewObjectID(),
+		ShopDomain:           "reencrypt-test.myshopify.com",
+		EncryptedAccessToken: encryptedToken,
+		MeilisearchAPIKey:    encryptedMeiliKey,
+		InstalledAt:          time.Now(),
+	})
+	require.NoError(t, err)
+	require.NoError(t, sessionRepo.CreateOrUpdate(ctx, &models.Session{
+		ID:          "offline_reencrypt-test.myshopify.com",
+		Shop:        "reencrypt-test.myshopify.com",
+		AccessToken: hex.EncodeToString(encryptedSessionToken),
+	}))
+
+	// Rotate: add key 2 and make it the primary
+	cfg.EncryptionKeys = "2:" + strings.Repeat("ab", 32)
+	keys := testhelpers.TestKeyProvider(cfg)
+	reencryptor, err := workers.NewReencryptor(keys, storeRepo, sessionRepo)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/admin/encryption/reencrypt", NewEncryptionHandler(reencryptor).Reencrypt)
+
+	run := func(query string) workers.ReencryptResult {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/encryption/reencrypt"+query, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		var result workers.ReencryptResult
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		return result
+	}
+
+	dryRun := run("?dry_run=true")
+	assert.Equal(t, 3, dryRun.SecretsMigrated)
+	unchanged, err := storeRepo.GetByID(ctx, store.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, encryptedToken, unchanged.EncryptedAccessToken)
+
+	result := run("")
+	assert.Equal(t, 3, result.SecretsMigrated)
+	assert.Zero(t, result.SecretsFailed)
+
+	migrated, err := storeRepo.GetByID(ctx, store.ID.Hex())
+	require.NoError(t, err)
+	assert.True(t, keys.IsCurrent(ctx, store.ShopDomain, migrated.EncryptedAccessToken))
+	token, err := keys.Decrypt(ctx, store.ShopDomain, migrated.EncryptedAccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "shpat_token", string(token))
+
+	// A second run finds nothing left to migrate
+	again := run("")
+	assert.Zero(t, again.SecretsMigrated)
+	assert.Equal(t, 3, again.SecretsCurrent)
+}
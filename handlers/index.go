@@ -8,7 +8,6 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type IndexHandler struct {
@@ -27,12 +26,12 @@ func NewIndexHandler(clientRepo *repositories.ClientRepository, indexRepo *repos
 
 // CreateIndex creates a new index for a client
 func (h *IndexHandler) CreateIndex(c *gin.Context) {
-	clientIDParam := c.Param("client_id")
-	clientID, err := primitive.ObjectIDFromHex(clientIDParam)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+	// Verify client exists and the user may create indexes on it
+	client, _, ok := requireClientRole(c, h.clientRepo, models.ClientRoleDeveloper)
+	if !ok {
 		return
 	}
+	clientID := client.ID
 
 	var req models.CreateIndexRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -40,13 +39,6 @@ func (h *IndexHandler) CreateIndex(c *gin.Context) {
 		return
 	}
 
-	// Verify client exists
-	client, err := h.clientRepo.FindByID(c.Request.Context(), clientID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
-		return
-	}
-
 	// Check if index already exists in DB - REMOVED due to race condition
 	// We will rely on the unique constraint in the database
 	/*
@@ -94,21 +86,13 @@ func (h *IndexHandler) CreateIndex(c *gin.Context) {
 
 // GetClientIndexes returns all indexes for a client
 func (h *IndexHandler) GetClientIndexes(c *gin.Context) {
-	clientIDParam := c.Param("client_id")
-	clientID, err := primitive.ObjectIDFromHex(clientIDParam)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
-		return
-	}
-
-	// Verify client exists
-	_, err = h.clientRepo.FindByID(c.Request.Context(), clientID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+	// Verify client exists and the user is a member
+	client, _, ok := requireClientRole(c, h.clientRepo, models.ClientRoleViewer)
+	if !ok {
 		return
 	}
 
-	indexes, err := h.indexRepo.FindByClientID(c.Request.Context(), clientID)
+	indexes, err := h.indexRepo.FindByClientID(c.Request.Context(), client.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"mgsearch/models"
+	"mgsearch/repositories"
+	"mgsearch/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ClientIndexResolver maps the index name used in v1 client URLs onto the Meilisearch index UID and
+// the instance hosting it. Indexes registered for a linked Shopify store keep the store's UID and
+// live on the store's Meilisearch instance; every other index follows the client_name__index_name
+// convention on the default instance.
+type ClientIndexResolver struct {
+	indexes        *repositories.IndexRepository
+	stores         *repositories.StoreRepository
+	meili          *services.MeilisearchRegistry
+	defaultService *services.MeilisearchService
+}
+
+func NewClientIndexResolver(indexes *repositories.IndexRepository, stores *repositories.StoreRepository, meili *services.MeilisearchRegistry, defaultService *services.MeilisearchService) *ClientIndexResolver {
+	return &ClientIndexResolver{
+		indexes:        indexes,
+		stores:         stores,
+		meili:          meili,
+		defaultService: defaultService,
+	}
+}
+
+// Resolve returns the Meilisearch UID and service for the client's index, and the linked store
+// whose plan applies to it (nil for indexes that are not linked to a store).
+func (r *ClientIndexResolver) Resolve(ctx context.Context, clientIDHex, clientName, indexName string) (string, *services.MeilisearchService, *models.Store, error) {
+	fallback := clientName + "__" + indexName
+
+	clientID, err := primitive.ObjectIDFromHex(clientIDHex)
+	if err != nil {
+		return fallback, r.defaultService, nil, nil
+	}
+
+	index, err := r.indexes.FindByNameAndClientID(ctx, indexName, clientID)
+	if err != nil {
+		if err.Error() == "index not found" {
+			return fallback, r.defaultService, nil, nil
+		}
+		return "", nil, nil, err
+	}
+	if index.StoreID == nil {
+		return index.UID, r.defaultService, nil, nil
+	}
+
+	store, err := r.stores.GetByID(ctx, index.StoreID.Hex())
+	if err != nil {
+		return "", nil, nil, err
+	}
+	meili, err := r.meili.ForStore(store)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return index.UID, meili, store, nil
+}
+
+// resolveClientIndex resolves the index named in the request URL. Without a resolver the
+// client_name__index_name convention is used on the given service. It writes an error response and
+// returns false when resolution fails.
+func resolveClientIndex(c *gin.Context, resolver *ClientIndexResolver, service *services.MeilisearchService, clientName, indexName string) (string, *services.MeilisearchService, *models.Store, bool) {
+	if resolver == nil {
+		return clientName + "__" + indexName, service, nil, true
+	}
+
+	uid, meili, store, err := resolver.Resolve(c.Request.Context(), c.Param("client_id"), clientName, indexName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve index", "details": err.Error()})
+		return "", nil, nil, false
+	}
+	return uid, meili, store, true
+}
@@ -35,7 +35,7 @@ func setupIndexTest(t *testing.T) (*gin.Engine, *IndexHandler, *repositories.Cli
 	meiliService := services.NewMeilisearchService(cfg)
 
 	handler := NewIndexHandler(clientRepo, indexRepo, meiliService)
-	jwtMiddleware := middleware.NewJWTMiddleware(cfg.JWTSigningKey)
+	jwtMiddleware := middleware.NewJWTMiddleware(cfg.JWTSigningKey, nil)
 
 	// Create test user
 	testUser := &models.User{
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"mgsearch/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// planLimitErrorResponse writes the response for an error of a services.PlanLimits check
+func planLimitErrorResponse(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrSearchLimitReached):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "monthly search limit reached", "code": "PLAN_LIMIT_EXCEEDED"})
+	case errors.Is(err, services.ErrDocumentLimitReached):
+		c.JSON(http.StatusForbidden, gin.H{"error": "document limit of current plan reached", "code": "PLAN_LIMIT_EXCEEDED"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message, "details": err.Error()})
+	}
+}
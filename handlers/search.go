@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"fmt"
 	"mgsearch/models"
 	"mgsearch/repositories"
 	"mgsearch/services"
@@ -14,13 +15,17 @@ import (
 type SearchHandler struct {
 	meilisearchService *services.MeilisearchService
 	clientRepo         *repositories.ClientRepository
+	indexes            *ClientIndexResolver
+	limits             *services.PlanLimits
 }
 
 // NewSearchHandler creates a new search handler
-func NewSearchHandler(meilisearchService *services.MeilisearchService, clientRepo *repositories.ClientRepository) *SearchHandler {
+func NewSearchHandler(meilisearchService *services.MeilisearchService, clientRepo *repositories.ClientRepository, indexes *ClientIndexResolver, limits *services.PlanLimits) *SearchHandler {
 	return &SearchHandler{
 		meilisearchService: meilisearchService,
 		clientRepo:         clientRepo,
+		indexes:            indexes,
+		limits:             limits,
 	}
 }
 
@@ -55,22 +60,12 @@ func (h *SearchHandler) Search(c *gin.Context) {
 			return
 		}
 
-		// Verify that the user has access to this client (if using JWT)
+		// Verify that the user holds a sufficient role on this client (if using JWT)
 		if userID, ok := c.Get("user_id"); ok {
 			userIDStr, _ := userID.(string)
 			userIDObj, err := primitive.ObjectIDFromHex(userIDStr)
-			if err == nil {
-				hasAccess := false
-				for _, uid := range client.UserIDs {
-					if uid == userIDObj {
-						hasAccess = true
-						break
-					}
-				}
-				if !hasAccess {
-					c.JSON(http.StatusForbidden, gin.H{"error": "User does not have access to this client"})
-					return
-				}
+			if err == nil && !checkClientRole(c, client, userIDObj, models.ClientRoleViewer) {
+				return
 			}
 		}
 
@@ -87,9 +82,12 @@ func (h *SearchHandler) Search(c *gin.Context) {
 		return
 	}
 
-	// Construct the actual Meilisearch index UID
-	// Format: client_name__index_name
-	meiliIndexUID := clientName + "__" + indexName
+	// Resolve the actual Meilisearch index UID
+	// Format: client_name__index_name, or the store's UID for linked Shopify store indexes
+	meiliIndexUID, meili, store, ok := resolveClientIndex(c, h.indexes, h.meilisearchService, clientName, indexName)
+	if !ok {
+		return
+	}
 
 	// Parse request body as flexible JSON structure (supports nested JSON)
 	var searchRequest models.SearchRequest
@@ -101,8 +99,16 @@ func (h *SearchHandler) Search(c *gin.Context) {
 		return
 	}
 
+	// Searches of a linked store's index count against the store's plan
+	if store != nil {
+		if err := h.limits.CountSearch(c.Request.Context(), store); err != nil {
+			planLimitErrorResponse(c, err, "failed to record usage")
+			return
+		}
+	}
+
 	// Perform search (pass through any request body structure to Meilisearch)
-	searchResponse, err := h.meilisearchService.Search(meiliIndexUID, &searchRequest)
+	searchResponse, err := meili.Search(meiliIndexUID, &searchRequest)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "failed to perform search",
@@ -142,22 +148,12 @@ func (h *SearchHandler) IndexDocument(c *gin.Context) {
 			return
 		}
 
-		// Verify that the user has access to this client (if using JWT)
+		// Verify that the user holds a sufficient role on this client (if using JWT)
 		if userID, ok := c.Get("user_id"); ok {
 			userIDStr, _ := userID.(string)
 			userIDObj, err := primitive.ObjectIDFromHex(userIDStr)
-			if err == nil {
-				hasAccess := false
-				for _, uid := range client.UserIDs {
-					if uid == userIDObj {
-						hasAccess = true
-						break
-					}
-				}
-				if !hasAccess {
-					c.JSON(http.StatusForbidden, gin.H{"error": "User does not have access to this client"})
-					return
-				}
+			if err == nil && !checkClientRole(c, client, userIDObj, models.ClientRoleDeveloper) {
+				return
 			}
 		}
 
@@ -173,8 +169,11 @@ func (h *SearchHandler) IndexDocument(c *gin.Context) {
 		return
 	}
 
-	// Construct the actual Meilisearch index UID
-	meiliIndexUID := clientName + "__" + indexName
+	// Resolve the actual Meilisearch index UID
+	meiliIndexUID, meili, store, ok := resolveClientIndex(c, h.indexes, h.meilisearchService, clientName, indexName)
+	if !ok {
+		return
+	}
 
 	var document models.Document
 	if err := c.ShouldBindJSON(&document); err != nil {
@@ -192,7 +191,15 @@ func (h *SearchHandler) IndexDocument(c *gin.Context) {
 		return
 	}
 
-	indexResponse, err := h.meilisearchService.IndexDocument(meiliIndexUID, document)
+	// Documents added to a linked store's index count against the store's plan
+	if store != nil {
+		if err := h.limits.CheckDocuments(store, meili, meiliIndexUID, []string{fmt.Sprintf("%v", document["id"])}); err != nil {
+			planLimitErrorResponse(c, err, "failed to check document limit")
+			return
+		}
+	}
+
+	indexResponse, err := meili.IndexDocument(meiliIndexUID, document)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "failed to index document",
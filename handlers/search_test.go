@@ -18,7 +18,7 @@ func setupSearchTest(t *testing.T) (*gin.Engine, *services.MeilisearchService) {
 	cfg := testhelpers.TestConfig()
 	meiliService := services.NewMeilisearchService(cfg)
 
-	searchHandler := NewSearchHandler(meiliService)
+	searchHandler := NewSearchHandler(meiliService, nil, nil, nil)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
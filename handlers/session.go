@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
@@ -19,33 +20,36 @@ import (
 type SessionHandler struct {
 	repo          *repositories.SessionRepository
 	storeRepo     *repositories.StoreRepository
-	meiliService  *services.MeilisearchService
-	encryptionKey []byte
+	meiliService  *services.MeilisearchRegistry
+	keys          security.KeyProvider
 	cfg           *config.Config
 }
 
-func NewSessionHandler(repo *repositories.SessionRepository, storeRepo *repositories.StoreRepository, meiliService *services.MeilisearchService, cfg *config.Config) (*SessionHandler, error) {
-	// Decode encryption key from hex
-	key, err := security.MustDecodeKey(cfg.EncryptionKey)
-	if err != nil {
-		return nil, err
+func NewSessionHandler(repo *repositories.SessionRepository, storeRepo *repositories.StoreRepository, meiliService *services.MeilisearchRegistry, cfg *config.Config, keys security.KeyProvider) (*SessionHandler, error) {
+	if keys == nil {
+		return nil, errors.New("key provider is required")
 	}
 
 	return &SessionHandler{
 		repo:          repo,
 		storeRepo:     storeRepo,
 		meiliService:  meiliService,
-		encryptionKey: key,
+		keys:          keys,
 		cfg:           cfg,
 	}, nil
 }
 
 // encryptAccessToken encrypts the access token before storage
-func (h *SessionHandler) encryptAccessToken(plaintext string) (string, error) {
+func (h *SessionHandler) encryptAccessToken(ctx context.Context, shop, plaintext string) (string, error) {
+	return encryptSessionAccessToken(ctx, h.keys, shop, plaintext)
+}
+
+// encryptSessionAccessToken encrypts an access token in the hex encoded form sessions store
+func encryptSessionAccessToken(ctx context.Context, keys security.KeyProvider, shop, plaintext string) (string, error) {
 	if plaintext == "" {
 		return "", nil
 	}
-	encrypted, err := security.EncryptAESGCM(h.encryptionKey, []byte(plaintext))
+	encrypted, err := keys.Encrypt(ctx, shop, []byte(plaintext))
 	if err != nil {
 		return "", err
 	}
@@ -53,7 +57,7 @@ func (h *SessionHandler) encryptAccessToken(plaintext string) (string, error) {
 }
 
 // decryptAccessToken decrypts the access token after retrieval
-func (h *SessionHandler) decryptAccessToken(ciphertext string) (string, error) {
+func (h *SessionHandler) decryptAccessToken(ctx context.Context, shop, ciphertext string) (string, error) {
 	if ciphertext == "" {
 		return "", nil
 	}
@@ -62,7 +66,7 @@ func (h *SessionHandler) decryptAccessToken(ciphertext string) (string, error) {
 		// If it's not hex, assume it's already plaintext (for backward compatibility)
 		return ciphertext, nil
 	}
-	decrypted, err := security.DecryptAESGCM(h.encryptionKey, encrypted)
+	decrypted, err := h.keys.Decrypt(ctx, shop, encrypted)
 	if err != nil {
 		return "", err
 	}
@@ -115,7 +119,7 @@ func (h *SessionHandler) StoreSession(c *gin.Context) {
 	plaintextToken := session.AccessToken
 
 	// Encrypt access token before storing in session
-	encryptedToken, err := h.encryptAccessToken(session.AccessToken)
+	encryptedToken, err := h.encryptAccessToken(c.Request.Context(), session.Shop, session.AccessToken)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Internal server error",
@@ -142,7 +146,7 @@ func (h *SessionHandler) StoreSession(c *gin.Context) {
 
 	// Automatically create or update store when session is stored
 	// Use the original plaintext token for store creation
-	if err := h.createOrUpdateStoreFromSession(c.Request.Context(), session.Shop, plaintextToken); err != nil {
+	if err := h.createOrUpdateStoreFromSession(c.Request.Context(), session.Shop, plaintextToken, session.Scope); err != nil {
 		// Log error but don't fail the session storage
 		// Session was stored successfully, store creation is a bonus
 		c.JSON(http.StatusOK, gin.H{
@@ -161,7 +165,7 @@ func (h *SessionHandler) StoreSession(c *gin.Context) {
 }
 
 // createOrUpdateStoreFromSession creates or updates a store based on session data
-func (h *SessionHandler) createOrUpdateStoreFromSession(ctx context.Context, shopDomain, accessToken string) error {
+func (h *SessionHandler) createOrUpdateStoreFromSession(ctx context.Context, shopDomain, accessToken, scope string) error {
 	// Normalize shop domain
 	shopDomain = strings.ToLower(strings.TrimSpace(shopDomain))
 	shopDomain = strings.TrimPrefix(shopDomain, "https://")
@@ -176,12 +180,15 @@ func (h *SessionHandler) createOrUpdateStoreFromSession(ctx context.Context, sho
 	existingStore, err := h.storeRepo.GetByShopDomain(ctx, shopDomain)
 	if err == nil && existingStore != nil {
 		// Store exists, update access token if needed
-		encryptedToken, err := security.EncryptAESGCM(h.encryptionKey, []byte(accessToken))
+		encryptedToken, err := h.keys.Encrypt(ctx, shopDomain, []byte(accessToken))
 		if err != nil {
 			return err
 		}
 
 		existingStore.EncryptedAccessToken = encryptedToken
+		if scope != "" {
+			existingStore.GrantedScopes = services.ParseScopes(scope)
+		}
 		existingStore.UpdatedAt = time.Now().UTC()
 		_, err = h.storeRepo.CreateOrUpdate(ctx, existingStore)
 		return err
@@ -200,7 +207,7 @@ func (h *SessionHandler) createOrUpdateStoreFromSession(ctx context.Context, sho
 	}
 
 	// Encrypt access token
-	encryptedToken, err := security.EncryptAESGCM(h.encryptionKey, []byte(accessToken))
+	encryptedToken, err := h.keys.Encrypt(ctx, shopDomain, []byte(accessToken))
 	if err != nil {
 		return err
 	}
@@ -215,7 +222,7 @@ func (h *SessionHandler) createOrUpdateStoreFromSession(ctx context.Context, sho
 
 	var encryptedMeiliKey []byte
 	if meiliKey != "" {
-		encryptedMeiliKey, err = security.EncryptAESGCM(h.encryptionKey, []byte(meiliKey))
+		encryptedMeiliKey, err = h.keys.Encrypt(ctx, shopDomain, []byte(meiliKey))
 		if err != nil {
 			return err
 		}
@@ -235,6 +242,7 @@ func (h *SessionHandler) createOrUpdateStoreFromSession(ctx context.Context, sho
 		ShopDomain:           shopDomain,
 		ShopName:             shopName,
 		EncryptedAccessToken: encryptedToken,
+		GrantedScopes:        services.ParseScopes(scope),
 		APIKeyPrivate:        privateKey,
 		ProductIndexUID:      indexUID,
 		MeilisearchIndexUID:  indexUID,
@@ -257,10 +265,18 @@ func (h *SessionHandler) createOrUpdateStoreFromSession(ctx context.Context, sho
 
 	// Ensure Meilisearch index exists
 	if h.meiliService != nil && dbStore.IndexUID() != "" {
-		if err := h.meiliService.EnsureIndex(dbStore.IndexUID()); err != nil {
+		meili, err := h.meiliService.ForStore(dbStore)
+		if err != nil {
+			return nil
+		}
+		if err := meili.EnsureIndex(dbStore.IndexUID()); err != nil {
 			// Log but don't fail - index creation can be retried later
 			return nil
 		}
+		if err := meili.ConfigureProductIndex(dbStore.IndexUID()); err != nil {
+			// Settings are applied again by the webhook worker
+			return nil
+		}
 	}
 
 	return nil
@@ -295,7 +311,7 @@ func (h *SessionHandler) LoadSession(c *gin.Context) {
 	}
 
 	// Decrypt access token before returning
-	decryptedToken, err := h.decryptAccessToken(session.AccessToken)
+	decryptedToken, err := h.decryptAccessToken(c.Request.Context(), session.Shop, session.AccessToken)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Internal server error",
@@ -395,7 +411,7 @@ func (h *SessionHandler) FindSessionsByShop(c *gin.Context) {
 
 	// Decrypt access tokens for all sessions
 	for _, session := range sessions {
-		decryptedToken, err := h.decryptAccessToken(session.AccessToken)
+		decryptedToken, err := h.decryptAccessToken(c.Request.Context(), session.Shop, session.AccessToken)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Internal server error",
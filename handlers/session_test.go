@@ -29,6 +29,8 @@ func setupSessionTest(t *testing.T) (*gin.Engine, *repositories.SessionRepositor
 
 	_, sessionRepo := testhelpers.SetupTestRepositories(db)
 	meiliService := services.NewMeilisearchService(cfg)
+	meiliRegistry, err := services.NewMeilisearchRegistry(cfg, testhelpers.TestKeyProvider(cfg), meiliService)
+	require.NoError(t, err)
 
 	// Setup router directly
 	gin.SetMode(gin.TestMode)
@@ -36,7 +38,7 @@ func setupSessionTest(t *testing.T) (*gin.Engine, *repositories.SessionRepositor
 	router.Use(middleware.CORSMiddleware())
 
 	storeRepo, _ := testhelpers.SetupTestRepositories(db)
-	sessionHandler, err := NewSessionHandler(sessionRepo, storeRepo, meiliService, cfg)
+	sessionHandler, err := NewSessionHandler(sessionRepo, storeRepo, meiliRegistry, cfg, testhelpers.TestKeyProvider(cfg))
 	require.NoError(t, err)
 
 	api := router.Group("/api")
@@ -13,13 +13,15 @@ import (
 type SettingsHandler struct {
 	meilisearchService *services.MeilisearchService
 	clientRepo         *repositories.ClientRepository
+	indexes            *ClientIndexResolver
 }
 
 // NewSettingsHandler creates a new settings handler
-func NewSettingsHandler(meilisearchService *services.MeilisearchService, clientRepo *repositories.ClientRepository) *SettingsHandler {
+func NewSettingsHandler(meilisearchService *services.MeilisearchService, clientRepo *repositories.ClientRepository, indexes *ClientIndexResolver) *SettingsHandler {
 	return &SettingsHandler{
 		meilisearchService: meilisearchService,
 		clientRepo:         clientRepo,
+		indexes:            indexes,
 	}
 }
 
@@ -52,22 +54,12 @@ func (h *SettingsHandler) UpdateSettings(c *gin.Context) {
 			return
 		}
 
-		// Verify that the user has access to this client (if using JWT)
+		// Verify that the user holds a sufficient role on this client (if using JWT)
 		if userID, ok := c.Get("user_id"); ok {
 			userIDStr, _ := userID.(string)
 			userIDObj, err := primitive.ObjectIDFromHex(userIDStr)
-			if err == nil {
-				hasAccess := false
-				for _, uid := range client.UserIDs {
-					if uid == userIDObj {
-						hasAccess = true
-						break
-					}
-				}
-				if !hasAccess {
-					c.JSON(http.StatusForbidden, gin.H{"error": "User does not have access to this client"})
-					return
-				}
+			if err == nil && !checkClientRole(c, client, userIDObj, models.ClientRoleDeveloper) {
+				return
 			}
 		}
 
@@ -90,8 +82,11 @@ func (h *SettingsHandler) UpdateSettings(c *gin.Context) {
 		return
 	}
 
-	// Construct the actual Meilisearch index UID
-	meiliIndexUID := clientName + "__" + indexName
+	// Resolve the actual Meilisearch index UID
+	meiliIndexUID, meili, _, ok := resolveClientIndex(c, h.indexes, h.meilisearchService, clientName, indexName)
+	if !ok {
+		return
+	}
 
 	// Parse request body as flexible JSON structure (supports nested JSON)
 	var settingsRequest models.SettingsRequest
@@ -104,7 +99,7 @@ func (h *SettingsHandler) UpdateSettings(c *gin.Context) {
 	}
 
 	// Update settings (pass through any request body structure to Meilisearch)
-	settingsResponse, err := h.meilisearchService.UpdateSettings(meiliIndexUID, &settingsRequest)
+	settingsResponse, err := meili.UpdateSettings(meiliIndexUID, &settingsRequest)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "failed to update settings",
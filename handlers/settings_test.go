@@ -18,7 +18,7 @@ func setupSettingsTest(t *testing.T) *gin.Engine {
 	cfg := testhelpers.TestConfig()
 	meiliService := services.NewMeilisearchService(cfg)
 
-	settingsHandler := NewSettingsHandler(meiliService)
+	settingsHandler := NewSettingsHandler(meiliService, nil, nil)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
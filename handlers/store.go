@@ -30,7 +30,9 @@ func (h *StoreHandler) GetCurrentStore(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, store.ToPublicView())
+	view := store.ToPublicView()
+	view.MissingScopes = middleware.GetMissingScopes(c)
+	c.JSON(http.StatusOK, view)
 }
 
 func (h *StoreHandler) GetSyncStatus(c *gin.Context) {
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"mgsearch/middleware"
+	"mgsearch/models"
+	"mgsearch/repositories"
+	"mgsearch/services"
+	"mgsearch/workers"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxIndexedMetafieldNamespaces = 10
+	maxIndexedLocales             = 20
+	// localizationSyncTimeout bounds the product resync started after the settings change
+	localizationSyncTimeout = 30 * time.Minute
+)
+
+var (
+	metafieldNamespacePattern = regexp.MustCompile(`^[A-Za-z0-9_$:.-]{1,255}$`)
+	localePattern             = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,4})?$`)
+)
+
+type StoreIndexingHandler struct {
+	stores       *repositories.StoreRepository
+	meili        *services.MeilisearchRegistry
+	content      *workers.ContentSyncer
+	localization *workers.LocalizationSyncer
+}
+
+type updateIndexingRequest struct {
+	MetafieldNamespaces []string `json:"metafield_namespaces"`
+	Locales             []string `json:"locales"`
+	LocaleMode          string   `json:"locale_mode"`
+}
+
+func NewStoreIndexingHandler(stores *repositories.StoreRepository, meili *services.MeilisearchRegistry, content *workers.ContentSyncer, localization *workers.LocalizationSyncer) *StoreIndexingHandler {
+	return &StoreIndexingHandler{stores: stores, meili: meili, content: content, localization: localization}
+}
+
+// GetIndexing handles GET /api/stores/current/indexing
+// Returns which metafield namespaces and locales are indexed for the store.
+func (h *StoreIndexingHandler) GetIndexing(c *gin.Context) {
+	store, ok := h.currentStore(c)
+	if !ok {
+		return
+	}
+
+	contentIndexes := map[string]string{}
+	for _, documentType := range models.ContentDocumentTypes {
+		contentIndexes[documentType] = store.ContentIndexUID(documentType)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"indexing":        store.Indexing,
+		"locale_indexes":  store.LocaleIndexUIDs(),
+		"content_indexes": contentIndexes,
+	})
+}
+
+// UpdateIndexing handles PUT /api/stores/current/indexing
+// Locale indexes that are no longer configured are deleted, and the products already indexed are
+// re-localized with the new settings in the background.
+func (h *StoreIndexingHandler) UpdateIndexing(c *gin.Context) {
+	store, ok := h.currentStore(c)
+	if !ok {
+		return
+	}
+
+	var req updateIndexingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body", "details": err.Error()})
+		return
+	}
+
+	indexing, err := normalizeIndexing(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	meili, err := h.meili.ForStore(store)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve meilisearch instance", "details": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.stores.UpdateIndexing(ctx, store.ID.Hex(), indexing); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update indexing settings", "details": err.Error()})
+		return
+	}
+	previousIndexes := store.LocaleIndexUIDs()
+	store.Indexing = indexing
+
+	// Create locale indexes up front so storefront searches do not hit missing indexes
+	localeIndexes := store.LocaleIndexUIDs()
+	for _, uid := range localeIndexes {
+		if err := meili.EnsureIndex(uid); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create locale index", "details": err.Error()})
+			return
+		}
+		if err := meili.ConfigureProductIndex(uid); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to configure locale index", "details": err.Error()})
+			return
+		}
+	}
+
+	// Indexes of removed locales, or of every locale when translations move back into fields, would
+	// keep serving stale translations
+	for locale, uid := range previousIndexes {
+		if localeIndexes[locale] == uid {
+			continue
+		}
+		if err := meili.DeleteIndex(uid); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete locale index", "details": err.Error()})
+			return
+		}
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), localizationSyncTimeout)
+		defer cancel()
+		if _, err := h.localization.Sync(ctx, store); err != nil {
+			log.Printf("failed to sync product localization of %s: %v", store.ShopDomain, err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, gin.H{
+		"indexing":       indexing,
+		"locale_indexes": localeIndexes,
+	})
+}
+
+// SyncContent handles POST /api/stores/current/content/sync
+// Re-indexes the store's published collections, pages and blog articles into their own indexes.
+func (h *StoreIndexingHandler) SyncContent(c *gin.Context) {
+	store, ok := h.currentStore(c)
+	if !ok {
+		return
+	}
+
+	counts, err := h.content.Sync(c.Request.Context(), store)
+	if errors.Is(err, services.ErrDocumentLimitReached) {
+		planLimitErrorResponse(c, err, "failed to sync content")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to sync content", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"indexed": counts})
+}
+
+// normalizeIndexing validates the requested settings and removes duplicates.
+func normalizeIndexing(req updateIndexingRequest) (models.StoreIndexing, error) {
+	indexing := models.StoreIndexing{
+		MetafieldNamespaces: []string{},
+		Locales:             []string{},
+		LocaleMode:          strings.ToLower(strings.TrimSpace(req.LocaleMode)),
+	}
+
+	seen := map[string]bool{}
+	for _, namespace := range req.MetafieldNamespaces {
+		namespace = strings.TrimSpace(namespace)
+		if !metafieldNamespacePattern.MatchString(namespace) {
+			return indexing, fmt.Errorf("invalid metafield namespace %q", namespace)
+		}
+		if !seen[namespace] {
+			seen[namespace] = true
+			indexing.MetafieldNamespaces = append(indexing.MetafieldNamespaces, namespace)
+		}
+	}
+	if len(indexing.MetafieldNamespaces) > maxIndexedMetafieldNamespaces {
+		return indexing, fmt.Errorf("at most %d metafield namespaces can be indexed", maxIndexedMetafieldNamespaces)
+	}
+
+	seen = map[string]bool{}
+	for _, locale := range req.Locales {
+		locale = strings.TrimSpace(locale)
+		if !localePattern.MatchString(locale) {
+			return indexing, fmt.Errorf("invalid locale %q", locale)
+		}
+		if !seen[strings.ToLower(locale)] {
+			seen[strings.ToLower(locale)] = true
+			indexing.Locales = append(indexing.Locales, locale)
+		}
+	}
+	if len(indexing.Locales) > maxIndexedLocales {
+		return indexing, fmt.Errorf("at most %d locales can be indexed", maxIndexedLocales)
+	}
+
+	switch indexing.LocaleMode {
+	case "":
+		indexing.LocaleMode = models.LocaleModeFields
+	case models.LocaleModeFields, models.LocaleModeIndexes:
+	default:
+		return indexing, fmt.Errorf("locale_mode must be %q or %q", models.LocaleModeFields, models.LocaleModeIndexes)
+	}
+
+	return indexing, nil
+}
+
+func (h *StoreIndexingHandler) currentStore(c *gin.Context) (*models.Store, bool) {
+	storeID, ok := middleware.GetStoreID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, false
+	}
+
+	store, err := h.stores.GetByID(c.Request.Context(), storeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "store not found", "details": err.Error()})
+		return nil, false
+	}
+	return store, true
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"mgsearch/config"
+	"mgsearch/middleware"
+	"mgsearch/models"
+	"mgsearch/pkg/auth"
+	"mgsearch/repositories"
+
+	"github.com/gin-gonic/gin"
+)
+
+// storeLinkTokenTTL bounds how long a merchant has to redeem a link token in the dashboard.
+const storeLinkTokenTTL = 15 * time.Minute
+
+// StoreLinkHandler attaches Shopify stores to v1 clients so the store's index can be managed with
+// the client's dashboard users and API keys.
+type StoreLinkHandler struct {
+	cfg     *config.Config
+	stores  *repositories.StoreRepository
+	clients *repositories.ClientRepository
+	indexes *repositories.IndexRepository
+}
+
+type linkStoreRequest struct {
+	LinkToken string `json:"link_token" binding:"required"`
+}
+
+func NewStoreLinkHandler(cfg *config.Config, stores *repositories.StoreRepository, clients *repositories.ClientRepository, indexes *repositories.IndexRepository) *StoreLinkHandler {
+	return &StoreLinkHandler{
+		cfg:     cfg,
+		stores:  stores,
+		clients: clients,
+		indexes: indexes,
+	}
+}
+
+// CreateLinkToken handles POST /api/stores/current/link-token
+// Issues a short-lived token the merchant pastes into the dashboard to link the store to a client.
+func (h *StoreLinkHandler) CreateLinkToken(c *gin.Context) {
+	storeID, ok := middleware.GetStoreID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	store, err := h.stores.GetByID(c.Request.Context(), storeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "store not found", "details": err.Error()})
+		return
+	}
+
+	token, err := auth.GenerateStoreLinkToken(store.ID.Hex(), store.ShopDomain, []byte(h.cfg.JWTSigningKey), storeLinkTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate link token", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"link_token": token,
+		"expires_at": time.Now().UTC().Add(storeLinkTokenTTL),
+	})
+}
+
+// LinkStore handles POST /api/v1/clients/:client_id/stores
+// Links the store named by the link token to the client and registers its product index.
+func (h *StoreLinkHandler) LinkStore(c *gin.Context) {
+	client, ok := h.authorizedClient(c, models.ClientRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req linkStoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	claims, err := auth.ParseStoreLinkToken(req.LinkToken, []byte(h.cfg.JWTSigningKey))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired link token"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	store, err := h.stores.GetByID(ctx, claims.StoreID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "store not found"})
+		return
+	}
+	if store.ClientID != nil && *store.ClientID != client.ID {
+		c.JSON(http.StatusConflict, gin.H{"error": "store is already linked to another client"})
+		return
+	}
+	if store.IndexUID() == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "store index not configured"})
+		return
+	}
+
+	if err := h.stores.SetClient(ctx, store.ID.Hex(), &client.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to link store", "details": err.Error()})
+		return
+	}
+	store.ClientID = &client.ID
+
+	storeID := store.ID
+	index, err := h.indexes.Create(ctx, &models.Index{
+		ClientID:   client.ID,
+		Name:       store.IndexUID(),
+		UID:        store.IndexUID(),
+		PrimaryKey: "id",
+		StoreID:    &storeID,
+	})
+	if err != nil {
+		if err.Error() != "index already exists" {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to register store index", "details": err.Error()})
+			return
+		}
+		// Linking again is idempotent
+		if index, err = h.indexes.FindByNameAndClientID(ctx, store.IndexUID(), client.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load store index", "details": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"store": store.ToPublicView(),
+		"index": index,
+	})
+}
+
+// ListStores handles GET /api/v1/clients/:client_id/stores
+func (h *StoreLinkHandler) ListStores(c *gin.Context) {
+	client, ok := h.authorizedClient(c, models.ClientRoleViewer)
+	if !ok {
+		return
+	}
+
+	stores, err := h.stores.FindByClientID(c.Request.Context(), client.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch stores", "details": err.Error()})
+		return
+	}
+
+	views := make([]models.StorePublicView, len(stores))
+	for i, store := range stores {
+		views[i] = store.ToPublicView()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"stores": views})
+}
+
+// UnlinkStore handles DELETE /api/v1/clients/:client_id/stores/:store_id
+// Detaches the store and removes its index registration; the Meilisearch index itself is kept.
+func (h *StoreLinkHandler) UnlinkStore(c *gin.Context) {
+	client, ok := h.authorizedClient(c, models.ClientRoleAdmin)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	store, err := h.stores.GetByID(ctx, c.Param("store_id"))
+	if err != nil || store.ClientID == nil || *store.ClientID != client.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "store not found"})
+		return
+	}
+
+	if err := h.stores.SetClient(ctx, store.ID.Hex(), nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlink store", "details": err.Error()})
+		return
+	}
+	if err := h.indexes.DeleteByStoreID(ctx, client.ID, store.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove store index", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "store unlinked"})
+}
+
+// authorizedClient loads the client named in the URL and checks the authenticated user holds at
+// least role min on it.
+func (h *StoreLinkHandler) authorizedClient(c *gin.Context, min models.ClientRole) (*models.Client, bool) {
+	client, _, ok := requireClientRole(c, h.clients, min)
+	return client, ok
+}
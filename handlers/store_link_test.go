@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mgsearch/config"
+	"mgsearch/middleware"
+	"mgsearch/models"
+	"mgsearch/pkg/auth"
+	"mgsearch/repositories"
+	"mgsearch/services"
+	"mgsearch/testhelpers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestStoreLinkHandler_LinkAndUnlink(t *testing.T) {
+	ctx := context.Background()
+	cfg := testhelpers.TestConfig()
+
+	_, db, cleanup, err := testhelpers.SetupTestDatabase(ctx, cfg)
+	require.NoError(t, err)
+	defer func() {
+		testhelpers.CleanupTestDatabase(ctx, db)
+		cleanup()
+	}()
+
+	storeRepo, _ := testhelpers.SetupTestRepositories(db)
+	clientRepo := repositories.NewClientRepository(db)
+	indexRepo := repositories.NewIndexRepository(db)
+	userRepo := repositories.NewUserRepository(db)
+
+	user, err := userRepo.Create(ctx, &models.User{Email: "link@example.com", PasswordHash: "hashed", FirstName: "Link", LastName: "User", ClientIDs: []primitive.ObjectID{}, IsActive: true})
+	require.NoError(t, err)
+	client, err := clientRepo.Create(ctx, &models.Client{Name: "link-client", UserIDs: []primitive.ObjectID{user.ID}, APIKeys: []models.APIKey{}, IsActive: true})
+	require.NoError(t, err)
+	store, err := storeRepo.CreateOrUpdate(ctx, &models.Store{
+		ID:              primitive.NewObjectID(),
+		ShopDomain:      "link-test.myshopify.com",
+		ProductIndexUID: "link_test_all_products",
+		Status:          "active",
+		InstalledAt:     time.Now(),
+	})
+	require.NoError(t, err)
+
+	userToken, err := auth.GenerateJWT(user.ID.Hex(), user.Email, []byte(cfg.JWTSigningKey), time.Hour)
+	require.NoError(t, err)
+	sessionToken, err := auth.GenerateSessionToken(store.ID.Hex(), store.ShopDomain, []byte(cfg.JWTSigningKey), time.Hour)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handler := NewStoreLinkHandler(cfg, storeRepo, clientRepo, indexRepo)
+	router.POST("/api/stores/current/link-token", middleware.NewAuthMiddleware(cfg.JWTSigningKey).RequireStoreSession(), handler.CreateLinkToken)
+	clientsGroup := router.Group("/api/v1/clients", middleware.NewJWTMiddleware(cfg.JWTSigningKey, nil).RequireAuth())
+	clientsGroup.POST("/:client_id/stores", handler.LinkStore)
+	clientsGroup.GET("/:client_id/stores", handler.ListStores)
+	clientsGroup.DELETE("/:client_id/stores/:store_id", handler.UnlinkStore)
+
+	do := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var payload bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&payload).Encode(body))
+		}
+		req := httptest.NewRequest(method, path, &payload)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/stores/current/link-token", sessionToken, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var tokenResponse struct {
+		LinkToken string `json:"link_token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokenResponse))
+
+	storesPath := "/api/v1/clients/" + client.ID.Hex() + "/stores"
+
+	// A store session token is not a link token
+	w = do(http.MethodPost, storesPath, userToken, gin.H{"link_token": sessionToken})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do(http.MethodPost, storesPath, userToken, gin.H{"link_token": tokenResponse.LinkToken})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	index, err := indexRepo.FindByNameAndClientID(ctx, "link_test_all_products", client.ID)
+	require.NoError(t, err)
+	require.NotNil(t, index.StoreID)
+	assert.Equal(t, store.ID, *index.StoreID)
+
+	// Linking twice is idempotent
+	w = do(http.MethodPost, storesPath, userToken, gin.H{"link_token": tokenResponse.LinkToken})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = do(http.MethodGet, storesPath, userToken, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "link-test.myshopify.com")
+
+	resolver := NewClientIndexResolver(indexRepo, storeRepo, mustMeilisearchRegistry(t, cfg), services.NewMeilisearchService(cfg))
+	uid, _, _, err := resolver.Resolve(ctx, client.ID.Hex(), client.Name, "link_test_all_products")
+	require.NoError(t, err)
+	assert.Equal(t, "link_test_all_products", uid)
+	uid, _, _, err = resolver.Resolve(ctx, client.ID.Hex(), client.Name, "movies")
+	require.NoError(t, err)
+	assert.Equal(t, "link-client__movies", uid)
+
+	w = do(http.MethodDelete, storesPath+"/"+store.ID.Hex(), userToken, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	_, err = indexRepo.FindByNameAndClientID(ctx, "link_test_all_products", client.ID)
+	assert.Error(t, err)
+}
+
+func mustMeilisearchRegistry(t *testing.T, cfg *config.Config) *services.MeilisearchRegistry {
+	registry, err := services.NewMeilisearchRegistry(cfg, testhelpers.TestKeyProvider(cfg), services.NewMeilisearchService(cfg))
+	require.NoError(t, err)
+	return registry
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,7 +13,9 @@ import (
 	"mgsearch/models"
 	"mgsearch/pkg/auth"
 	"mgsearch/repositories"
+	"mgsearch/services"
 	"mgsearch/testhelpers"
+	"mgsearch/workers"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -62,6 +65,14 @@ func setupStoreTest(t *testing.T) (*gin.Engine, *repositories.StoreRepository, s
 	router.Use(middleware.CORSMiddleware())
 
 	storeHandler := NewStoreHandler(storeRepo)
+	meiliRegistry, err := services.NewMeilisearchRegistry(cfg, testhelpers.TestKeyProvider(cfg), services.NewMeilisearchService(cfg))
+	require.NoError(t, err)
+	contentSyncer, err := workers.NewContentSyncer(testhelpers.TestKeyProvider(cfg), repositories.NewDocumentVersionRepository(db), services.NewShopifyService(cfg), meiliRegistry, services.NewPlanLimits(repositories.NewUsageRepository(db)))
+	require.NoError(t, err)
+	localizationSyncer, err := workers.NewLocalizationSyncer(testhelpers.TestKeyProvider(cfg), services.NewShopifyService(cfg), meiliRegistry)
+	require.NoError(t, err)
+	storeIndexingHandler := NewStoreIndexingHandler(storeRepo, meiliRegistry, contentSyncer, localizationSyncer)
+	storefrontKeyHandler := NewStorefrontKeyHandler(cfg, storeRepo)
 	authMiddleware := middleware.NewAuthMiddleware(cfg.JWTSigningKey)
 
 	api := router.Group("/api")
@@ -71,6 +82,9 @@ func setupStoreTest(t *testing.T) (*gin.Engine, *repositories.StoreRepository, s
 		{
 			storeGroup.GET("/current", storeHandler.GetCurrentStore)
 			storeGroup.GET("/sync-status", storeHandler.GetSyncStatus)
+			storeGroup.GET("/current/indexing", storeIndexingHandler.GetIndexing)
+			storeGroup.PUT("/current/indexing", storeIndexingHandler.UpdateIndexing)
+			storeGroup.POST("/current/storefront-key/rotate", storefrontKeyHandler.RotateKey)
 		}
 	}
 
@@ -194,3 +208,150 @@ func TestStoreHandler_GetSyncStatus(t *testing.T) {
 	}
 }
 
+func TestStoreIndexingHandler_UpdateIndexing(t *testing.T) {
+	router, _, token, cleanup := setupStoreTest(t)
+	defer cleanup()
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "invalid locale", body: `{"locales": ["french"]}`, expectedStatus: http.StatusBadRequest},
+		{name: "invalid namespace", body: `{"metafield_namespaces": ["has space"]}`, expectedStatus: http.StatusBadRequest},
+		{name: "invalid locale mode", body: `{"locales": ["fr"], "locale_mode": "columns"}`, expectedStatus: http.StatusBadRequest},
+		{name: "valid settings", body: `{"metafield_namespaces": ["custom", "custom", "specs"], "locales": ["fr", "pt-BR"]}`, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/api/stores/current/indexing", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/stores/current/indexing", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var result struct {
+		Indexing      models.StoreIndexing `json:"indexing"`
+		LocaleIndexes map[string]string    `json:"locale_indexes"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, []string{"custom", "specs"}, result.Indexing.MetafieldNamespaces)
+	assert.Equal(t, []string{"fr", "pt-BR"}, result.Indexing.Locales)
+	assert.Equal(t, models.LocaleModeFields, result.Indexing.LocaleMode)
+	// Translations are stored as fields, so no locale indexes exist
+	assert.Empty(t, result.LocaleIndexes)
+}
+
+func TestStoreIndexingHandler_UpdateIndexingDeletesLocaleIndexes(t *testing.T) {
+	ctx := context.Background()
+	cfg := testhelpers.TestConfig()
+	meili := testhelpers.NewMockMeilisearch()
+	t.Cleanup(meili.Close)
+	cfg.MeilisearchURL = meili.URL()
+
+	_, db, cleanup, err := testhelpers.SetupTestDatabase(ctx, cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		testhelpers.CleanupTestDatabase(ctx, db)
+		cleanup()
+	})
+
+	storeRepo := repositories.NewStoreRepository(db)
+	store, err := storeRepo.CreateOrUpdate(ctx, &models.Store{
+		ShopDomain:          "locale-test.myshopify.com",
+		ShopName:            "Locale Test Store",
+		ProductIndexUID:     "locale-test_all_products",
+		MeilisearchIndexUID: "locale-test_all_products",
+		Status:              "active",
+		InstalledAt:         time.Now(),
+	})
+	require.NoError(t, err)
+	token, err := auth.GenerateSessionToken(store.ID.Hex(), store.ShopDomain, []byte(cfg.JWTSigningKey), time.Hour)
+	require.NoError(t, err)
+
+	keys := testhelpers.TestKeyProvider(cfg)
+	meiliRegistry, err := services.NewMeilisearchRegistry(cfg, keys, services.NewMeilisearchService(cfg))
+	require.NoError(t, err)
+	localizationSyncer, err := workers.NewLocalizationSyncer(keys, services.NewShopifyService(cfg), meiliRegistry)
+	require.NoError(t, err)
+	handler := NewStoreIndexingHandler(storeRepo, meiliRegistry, nil, localizationSyncer)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PUT("/api/stores/current/indexing", middleware.NewAuthMiddleware(cfg.JWTSigningKey).RequireStoreSession(), handler.UpdateIndexing)
+	update := func(body string) {
+		req := httptest.NewRequest(http.MethodPut, "/api/stores/current/indexing", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+
+	update(`{"locales": ["fr", "de"], "locale_mode": "indexes"}`)
+	assert.True(t, meili.HasIndex(store.LocaleIndexUID("fr")))
+	assert.True(t, meili.HasIndex(store.LocaleIndexUID("de")))
+
+	update(`{"locales": ["fr"], "locale_mode": "indexes"}`)
+	assert.True(t, meili.HasIndex(store.LocaleIndexUID("fr")))
+	assert.False(t, meili.HasIndex(store.LocaleIndexUID("de")))
+
+	update(`{"locales": ["fr"], "locale_mode": "fields"}`)
+	assert.False(t, meili.HasIndex(store.LocaleIndexUID("fr")))
+}
+
+func TestStorefrontKeyHandler_RotateKey(t *testing.T) {
+	router, storeRepo, token, cleanup := setupStoreTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	rotate := func(body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodPost, "/api/stores/current/storefront-key/rotate", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		return resp, result
+	}
+
+	resp, first := rotate("")
+	require.Equal(t, http.StatusOK, resp.Code)
+	firstKey, _ := first["api_key_public"].(string)
+	require.NotEmpty(t, firstKey)
+
+	resp, second := rotate("")
+	require.Equal(t, http.StatusOK, resp.Code)
+	secondKey, _ := second["api_key_public"].(string)
+	assert.NotEqual(t, firstKey, secondKey)
+	assert.NotNil(t, second["previous_key_expires_at"])
+
+	// Both keys resolve to the store during the overlap window
+	for _, key := range []string{firstKey, secondKey} {
+		store, err := storeRepo.GetByPublicAPIKey(ctx, key)
+		require.NoError(t, err)
+		assert.Len(t, store.KeyRotations, 2)
+		assert.Equal(t, models.StorefrontKeyPrefix(firstKey), store.KeyRotations[1].PreviousKeyPrefix)
+	}
+
+	resp, third := rotate(`{"revoke_previous": true}`)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Nil(t, third["previous_key_expires_at"])
+
+	_, err := storeRepo.GetByPublicAPIKey(ctx, secondKey)
+	assert.EqualError(t, err, "store not found")
+	_, err = storeRepo.GetByPublicAPIKey(ctx, third["api_key_public"].(string))
+	assert.NoError(t, err)
+}
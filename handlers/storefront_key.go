@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"mgsearch/config"
+	"mgsearch/middleware"
+	"mgsearch/models"
+	"mgsearch/pkg/security"
+	"mgsearch/repositories"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StorefrontKeyHandler manages the public key themes use to call the storefront search API.
+type StorefrontKeyHandler struct {
+	cfg    *config.Config
+	stores *repositories.StoreRepository
+}
+
+type rotateStorefrontKeyRequest struct {
+	// RevokePrevious disables the old key immediately instead of after the overlap window, for keys
+	// known to be abused.
+	RevokePrevious bool `json:"revoke_previous"`
+}
+
+func NewStorefrontKeyHandler(cfg *config.Config, stores *repositories.StoreRepository) *StorefrontKeyHandler {
+	return &StorefrontKeyHandler{cfg: cfg, stores: stores}
+}
+
+// RotateKey handles POST /api/stores/current/storefront-key/rotate
+// Issues a new storefront key. The old key keeps working for the configured overlap window so themes
+// can be updated without failed searches.
+func (h *StorefrontKeyHandler) RotateKey(c *gin.Context) {
+	storeID, ok := middleware.GetStoreID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req rotateStorefrontKeyRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+			return
+		}
+	}
+
+	store, err := h.stores.GetByID(c.Request.Context(), storeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "store not found", "details": err.Error()})
+		return
+	}
+
+	newKey, err := security.GenerateAPIKey(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate storefront key"})
+		return
+	}
+
+	now := time.Now().UTC()
+	rotation := models.StoreKeyRotation{
+		KeyPrefix:         models.StorefrontKeyPrefix(newKey),
+		PreviousKeyPrefix: models.StorefrontKeyPrefix(store.APIKeyPublic),
+		RotatedAt:         now,
+	}
+	if store.APIKeyPublic != "" && !req.RevokePrevious && h.cfg.KeyRotationOverlap > 0 {
+		expiresAt := now.Add(h.cfg.KeyRotationOverlap)
+		rotation.PreviousKeyExpiresAt = &expiresAt
+	}
+
+	if err := h.stores.RotateStorefrontKey(c.Request.Context(), storeID, store.APIKeyPublic, newKey, rotation.PreviousKeyExpiresAt, rotation); err != nil {
+		if err.Error() == "storefront key changed concurrently" {
+			c.JSON(http.StatusConflict, gin.H{"error": "storefront key was rotated by another request", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rotate storefront key", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_key_public":          newKey,
+		"previous_key_expires_at": rotation.PreviousKeyExpiresAt,
+		"rotation":                rotation,
+	})
+}
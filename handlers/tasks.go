@@ -4,23 +4,28 @@ import (
 	"mgsearch/services"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 type TasksHandler struct {
 	meilisearchService *services.MeilisearchService
+	indexes            *ClientIndexResolver
 }
 
 // NewTasksHandler creates a new tasks handler
-func NewTasksHandler(meilisearchService *services.MeilisearchService) *TasksHandler {
+func NewTasksHandler(meilisearchService *services.MeilisearchService, indexes *ClientIndexResolver) *TasksHandler {
 	return &TasksHandler{
 		meilisearchService: meilisearchService,
+		indexes:            indexes,
 	}
 }
 
 // GetTask handles task details requests
 // GET /api/v1/clients/:client_id/tasks/:task_id
+// Query: index (optional) - name of the index the task belongs to; required for tasks of linked
+// Shopify store indexes hosted on their own Meilisearch instance
 // Returns task details from Meilisearch
 func (h *TasksHandler) GetTask(c *gin.Context) {
 	// Get client ID and task ID from URL parameters
@@ -49,8 +54,16 @@ func (h *TasksHandler) GetTask(c *gin.Context) {
 		return
 	}
 
+	meili := h.meilisearchService
+	if indexName := strings.TrimSpace(c.Query("index")); indexName != "" {
+		var ok bool
+		if _, meili, _, ok = resolveClientIndex(c, h.indexes, h.meilisearchService, c.GetString("client_name"), indexName); !ok {
+			return
+		}
+	}
+
 	// Get task details from Meilisearch
-	taskResponse, err := h.meilisearchService.GetTask(taskID)
+	taskResponse, err := meili.GetTask(taskID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "failed to get task details",
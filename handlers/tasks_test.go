@@ -16,7 +16,7 @@ func setupTasksTest(t *testing.T) *gin.Engine {
 	cfg := testhelpers.TestConfig()
 	meiliService := services.NewMeilisearchService(cfg)
 
-	tasksHandler := NewTasksHandler(meiliService)
+	tasksHandler := NewTasksHandler(meiliService, nil)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
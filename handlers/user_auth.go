@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -12,44 +13,68 @@ import (
 	"mgsearch/middleware"
 	"mgsearch/models"
 	"mgsearch/pkg/auth"
+	"mgsearch/pkg/security"
 	"mgsearch/repositories"
+	"mgsearch/services"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type UserAuthHandler struct {
-	cfg        *config.Config
-	userRepo   *repositories.UserRepository
-	clientRepo *repositories.ClientRepository
+	cfg            *config.Config
+	userRepo       *repositories.UserRepository
+	clientRepo     *repositories.ClientRepository
+	refreshTokens  *repositories.RefreshTokenRepository
+	revocations    *services.TokenRevocationService
+	resetTokens    *repositories.PasswordResetRepository
+	verifications  *repositories.EmailVerificationRepository
+	invites        *repositories.ClientInviteRepository
+	loginThrottle  *services.LoginThrottle
+	securityEvents *repositories.SecurityEventRepository
+	mfaChallenges  *repositories.MFAChallengeRepository
+	keys           security.KeyProvider
+	ssoLogins      *repositories.SSOLoginRepository
+	oidc           *services.OIDCProvider // nil when single sign-on is not configured
+	mailer         services.Mailer
 }
 
-func NewUserAuthHandler(cfg *config.Config, userRepo *repositories.UserRepository, clientRepo *repositories.ClientRepository) *UserAuthHandler {
-	return &UserAuthHandler{
-		cfg:        cfg,
-		userRepo:   userRepo,
-		clientRepo: clientRepo,
-	}
+// UserAuthDeps holds the repositories and services the user auth handler depends on
+type UserAuthDeps struct {
+	Users          *repositories.UserRepository
+	Clients        *repositories.ClientRepository
+	RefreshTokens  *repositories.RefreshTokenRepository
+	Revocations    *services.TokenRevocationService
+	ResetTokens    *repositories.PasswordResetRepository
+	Verifications  *repositories.EmailVerificationRepository
+	Invites        *repositories.ClientInviteRepository
+	LoginThrottle  *services.LoginThrottle
+	SecurityEvents *repositories.SecurityEventRepository
+	MFAChallenges  *repositories.MFAChallengeRepository
+	Keys           security.KeyProvider
+	SSOLogins      *repositories.SSOLoginRepository
+	OIDC           *services.OIDCProvider // nil when single sign-on is not configured
+	Mailer         services.Mailer
 }
 
-// verifyClientAccess checks if the user has access to the specified client
-// Returns the client if access is granted, nil if no access, error if client not found
-func (h *UserAuthHandler) verifyClientAccess(c *gin.Context, clientID, userID primitive.ObjectID) (*models.Client, error) {
-	// Get client
-	client, err := h.clientRepo.FindByID(c.Request.Context(), clientID)
-	if err != nil {
-		return nil, err
-	}
-
-	// Check if user has access to this client
-	for _, uid := range client.UserIDs {
-		if uid == userID {
-			return client, nil
-		}
+func NewUserAuthHandler(cfg *config.Config, deps UserAuthDeps) *UserAuthHandler {
+	return &UserAuthHandler{
+		cfg:            cfg,
+		userRepo:       deps.Users,
+		clientRepo:     deps.Clients,
+		refreshTokens:  deps.RefreshTokens,
+		revocations:    deps.Revocations,
+		resetTokens:    deps.ResetTokens,
+		verifications:  deps.Verifications,
+		invites:        deps.Invites,
+		loginThrottle:  deps.LoginThrottle,
+		securityEvents: deps.SecurityEvents,
+		mfaChallenges:  deps.MFAChallenges,
+		keys:           deps.Keys,
+		ssoLogins:      deps.SSOLogins,
+		oidc:           deps.OIDC,
+		mailer:         deps.Mailer,
 	}
-
-	// User doesn't have access
-	return nil, nil
 }
 
 // RegisterUserRequest represents the user registration request
@@ -101,18 +126,22 @@ func (h *UserAuthHandler) RegisterUser(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := auth.GenerateJWT(user.ID.Hex(), user.Email, []byte(h.cfg.JWTSigningKey), 24*time.Hour)
+	// The account works right away; a failed verification mail can be resent
+	if err := h.sendVerificationMail(c, user); err != nil {
+		log.Printf("failed to send verification mail to user %s: %v", user.ID.Hex(), err)
+	}
+
+	// Issue an access token and the refresh token that renews it
+	tokens, err := h.startSession(c, user, false)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
+	c.JSON(http.StatusCreated, tokens.response(gin.H{
 		"message": "user registered successfully",
 		"user":    user.ToPublicView(),
-		"token":   token,
-	})
+	}))
 }
 
 // LoginRequest represents the login request
@@ -132,9 +161,15 @@ func (h *UserAuthHandler) Login(c *gin.Context) {
 	// Normalize email
 	email := strings.ToLower(strings.TrimSpace(req.Email))
 
+	// Reject attempts on locked accounts and IPs before looking at the password
+	if !h.checkLoginThrottle(c, email) {
+		return
+	}
+
 	// Find user
 	user, err := h.userRepo.FindByEmail(c.Request.Context(), email)
 	if err != nil {
+		h.recordLoginFailure(c, email, nil)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid email or password"})
 		return
 	}
@@ -147,22 +182,29 @@ func (h *UserAuthHandler) Login(c *gin.Context) {
 
 	// Verify password
 	if err := auth.VerifyPassword(req.Password, user.PasswordHash); err != nil {
+		h.recordLoginFailure(c, email, user)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid email or password"})
 		return
 	}
 
-	// Generate JWT token
-	token, err := auth.GenerateJWT(user.ID.Hex(), user.Email, []byte(h.cfg.JWTSigningKey), 24*time.Hour)
+	// Failed logins are only cleared once the second factor passes too
+	if user.MFAEnabled {
+		h.startMFAChallenge(c, user, false)
+		return
+	}
+	h.clearLoginFailures(c, user)
+
+	// Issue an access token and the refresh token that renews it
+	tokens, err := h.startSession(c, user, false)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusOK, tokens.response(gin.H{
 		"message": "login successful",
 		"user":    user.ToPublicView(),
-		"token":   token,
-	})
+	}))
 }
 
 // GetCurrentUser handles GET /api/v1/auth/me
@@ -267,6 +309,18 @@ func (h *UserAuthHandler) RegisterClient(c *gin.Context) {
 		return
 	}
 
+	if h.cfg.RequireEmailVerify {
+		user, err := h.userRepo.FindByID(c.Request.Context(), userObjID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if !user.EmailVerified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "email verification required", "details": "verify your email address before creating a client"})
+			return
+		}
+	}
+
 	// Check if client name already exists
 	existingClient, _ := h.clientRepo.FindByName(c.Request.Context(), req.Name)
 	if existingClient != nil {
@@ -279,6 +333,7 @@ func (h *UserAuthHandler) RegisterClient(c *gin.Context) {
 		Name:        req.Name,
 		Description: req.Description,
 		UserIDs:     []primitive.ObjectID{userObjID},
+		Members:     []models.ClientMember{{UserID: userObjID, Role: models.ClientRoleOwner, AddedAt: time.Now().UTC()}},
 		APIKeys:     []models.APIKey{},
 		IsActive:    true,
 	}
@@ -310,33 +365,8 @@ type GenerateAPIKeyRequest struct {
 
 // GenerateAPIKey handles POST /api/v1/auth/clients/:client_id/api-keys
 func (h *UserAuthHandler) GenerateAPIKey(c *gin.Context) {
-	userID, ok := middleware.GetUserID(c)
+	client, _, ok := requireClientRole(c, h.clientRepo, models.ClientRoleAdmin)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
-		return
-	}
-
-	userObjID, err := primitive.ObjectIDFromHex(userID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
-		return
-	}
-
-	clientIDStr := c.Param("client_id")
-	clientID, err := primitive.ObjectIDFromHex(clientIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client ID"})
-		return
-	}
-
-	// Verify user has access to this client
-	client, err := h.verifyClientAccess(c, clientID, userObjID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
-		return
-	}
-	if client == nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "access denied to this client"})
 		return
 	}
 
@@ -383,7 +413,7 @@ func (h *UserAuthHandler) GenerateAPIKey(c *gin.Context) {
 	}
 
 	// Add API key to client
-	if err := h.clientRepo.AddAPIKey(c.Request.Context(), clientID, apiKey); err != nil {
+	if err := h.clientRepo.AddAPIKey(c.Request.Context(), client.ID, apiKey); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add API key", "details": err.Error()})
 		return
 	}
@@ -399,22 +429,8 @@ func (h *UserAuthHandler) GenerateAPIKey(c *gin.Context) {
 
 // RevokeAPIKey handles DELETE /api/v1/auth/clients/:client_id/api-keys/:key_id
 func (h *UserAuthHandler) RevokeAPIKey(c *gin.Context) {
-	userID, ok := middleware.GetUserID(c)
+	client, _, ok := requireClientRole(c, h.clientRepo, models.ClientRoleAdmin)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
-		return
-	}
-
-	userObjID, err := primitive.ObjectIDFromHex(userID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
-		return
-	}
-
-	clientIDStr := c.Param("client_id")
-	clientID, err := primitive.ObjectIDFromHex(clientIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client ID"})
 		return
 	}
 
@@ -425,19 +441,8 @@ func (h *UserAuthHandler) RevokeAPIKey(c *gin.Context) {
 		return
 	}
 
-	// Verify user has access to this client
-	client, err := h.verifyClientAccess(c, clientID, userObjID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
-		return
-	}
-	if client == nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "access denied to this client"})
-		return
-	}
-
 	// Revoke API key
-	if err := h.clientRepo.RevokeAPIKey(c.Request.Context(), clientID, keyID); err != nil {
+	if err := h.clientRepo.RevokeAPIKey(c.Request.Context(), client.ID, keyID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke API key", "details": err.Error()})
 		return
 	}
@@ -449,33 +454,8 @@ func (h *UserAuthHandler) RevokeAPIKey(c *gin.Context) {
 
 // GetClientDetails handles GET /api/v1/auth/clients/:client_id
 func (h *UserAuthHandler) GetClientDetails(c *gin.Context) {
-	userID, ok := middleware.GetUserID(c)
+	client, _, ok := requireClientRole(c, h.clientRepo, models.ClientRoleViewer)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
-		return
-	}
-
-	userObjID, err := primitive.ObjectIDFromHex(userID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
-		return
-	}
-
-	clientIDStr := c.Param("client_id")
-	clientID, err := primitive.ObjectIDFromHex(clientIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client ID"})
-		return
-	}
-
-	// Verify user has access to this client
-	client, err := h.verifyClientAccess(c, clientID, userObjID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
-		return
-	}
-	if client == nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "access denied to this client"})
 		return
 	}
 
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,6 +16,7 @@ import (
 	"mgsearch/models"
 	"mgsearch/pkg/auth"
 	"mgsearch/repositories"
+	"mgsearch/services"
 	"mgsearch/testhelpers"
 
 	"github.com/gin-gonic/gin"
@@ -31,12 +34,39 @@ func setupUserAuthTest(t *testing.T) (*gin.Engine, *UserAuthHandler, *repositori
 
 	userRepo := repositories.NewUserRepository(db)
 	clientRepo := repositories.NewClientRepository(db)
-
-	handler := NewUserAuthHandler(cfg, userRepo, clientRepo)
-	jwtMiddleware := middleware.NewJWTMiddleware(cfg.JWTSigningKey)
+	refreshTokenRepo := repositories.NewRefreshTokenRepository(db)
+	revocations := services.NewTokenRevocationService(userRepo, repositories.NewRevokedTokenRepository(db), cfg.TokenCacheTTL)
+
+	resetRepo := repositories.NewPasswordResetRepository(db)
+	verificationRepo := repositories.NewEmailVerificationRepository(db)
+	inviteRepo := repositories.NewClientInviteRepository(db)
+	loginThrottle := services.NewLoginThrottle(repositories.NewLoginAttemptRepository(db), services.LoginPolicy{
+		MaxFailures:   cfg.LoginMaxFailures,
+		MaxIPFailures: cfg.LoginMaxIPFailures,
+		Window:        cfg.LoginFailureWindow,
+		Lockout:       cfg.LoginLockout,
+	})
+
+	handler := NewUserAuthHandler(cfg, UserAuthDeps{
+		Users:          userRepo,
+		Clients:        clientRepo,
+		RefreshTokens:  refreshTokenRepo,
+		Revocations:    revocations,
+		ResetTokens:    resetRepo,
+		Verifications:  verificationRepo,
+		Invites:        inviteRepo,
+		LoginThrottle:  loginThrottle,
+		SecurityEvents: repositories.NewSecurityEventRepository(db),
+		MFAChallenges:  repositories.NewMFAChallengeRepository(db),
+		Keys:           testhelpers.TestKeyProvider(cfg),
+		SSOLogins:      repositories.NewSSOLoginRepository(db),
+		Mailer:         services.NewMemoryMailer(),
+	})
+	jwtMiddleware := middleware.NewJWTMiddleware(cfg.JWTSigningKey, revocations)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
+	require.NoError(t, router.SetTrustedProxies(cfg.TrustedProxies))
 
 	v1 := router.Group("/api/v1")
 	{
@@ -45,6 +75,24 @@ func setupUserAuthTest(t *testing.T) (*gin.Engine, *UserAuthHandler, *repositori
 			authGroup.POST("/register/user", handler.RegisterUser)
 			authGroup.POST("/register/client", jwtMiddleware.RequireAuth(), handler.RegisterClient)
 			authGroup.POST("/login", handler.Login)
+			authGroup.POST("/login/unlock", handler.UnlockAccount)
+			authGroup.POST("/login/mfa", handler.LoginMFA)
+			authGroup.POST("/sso/start", handler.StartSSO)
+			authGroup.POST("/sso/callback", handler.SSOCallback)
+			authGroup.POST("/refresh", handler.Refresh)
+			authGroup.POST("/logout", handler.Logout)
+			authGroup.POST("/logout-all", jwtMiddleware.RequireAuth(), handler.LogoutAll)
+			authGroup.POST("/password/change", jwtMiddleware.RequireAuth(), handler.ChangePassword)
+			authGroup.POST("/password/forgot", handler.ForgotPassword)
+			authGroup.POST("/password/reset", handler.ResetPassword)
+			authGroup.POST("/email/verify", handler.VerifyEmail)
+			authGroup.POST("/email/resend", jwtMiddleware.RequireAuth(), handler.ResendVerification)
+			authGroup.POST("/mfa/enroll", jwtMiddleware.RequireAuth(), handler.EnrollMFA)
+			authGroup.POST("/mfa/confirm", jwtMiddleware.RequireAuth(), handler.ConfirmMFA)
+			authGroup.POST("/mfa/disable", jwtMiddleware.RequireAuth(), handler.DisableMFA)
+			authGroup.POST("/mfa/recovery-codes", jwtMiddleware.RequireAuth(), handler.RegenerateRecoveryCodes)
+			authGroup.POST("/invites/accept", jwtMiddleware.RequireAuth(), handler.AcceptInvite)
+			authGroup.POST("/invites/register", handler.RegisterWithInvite)
 			authGroup.GET("/me", jwtMiddleware.RequireAuth(), handler.GetCurrentUser)
 			authGroup.PUT("/user", jwtMiddleware.RequireAuth(), handler.UpdateUser)
 		}
@@ -54,6 +102,16 @@ func setupUserAuthTest(t *testing.T) (*gin.Engine, *UserAuthHandler, *repositori
 		{
 			clientsGroup.GET("", handler.GetUserClients)
 			clientsGroup.GET("/:client_id", handler.GetClientDetails)
+
+			// Members and roles
+			clientsGroup.GET("/:client_id/members", handler.ListMembers)
+			clientsGroup.PUT("/:client_id/members/:user_id", handler.UpdateMemberRole)
+			clientsGroup.DELETE("/:client_id/members/:user_id", handler.RemoveMember)
+			clientsGroup.POST("/:client_id/leave", handler.LeaveClient)
+			clientsGroup.PUT("/:client_id/security", handler.UpdateClientSecurity)
+			clientsGroup.POST("/:client_id/invites", handler.CreateInvite)
+			clientsGroup.GET("/:client_id/invites", handler.ListInvites)
+			clientsGroup.DELETE("/:client_id/invites/:invite_id", handler.RevokeInvite)
 			clientsGroup.POST("/:client_id/api-keys", handler.GenerateAPIKey)
 			clientsGroup.DELETE("/:client_id/api-keys/:key_id", handler.RevokeAPIKey)
 		}
@@ -1091,3 +1149,1058 @@ func TestUserAuthHandler_GetClientDetails(t *testing.T) {
 		})
 	}
 }
+
+func TestUserAuthHandler_RefreshToken(t *testing.T) {
+	router, _, userRepo, _, _, cleanup := setupUserAuthTest(t)
+	defer cleanup()
+
+	passwordHash, _ := auth.HashPassword("SecurePass123!")
+	_, err := userRepo.Create(context.Background(), &models.User{
+		Email:        "refresh@example.com",
+		PasswordHash: passwordHash,
+		FirstName:    "Refresh",
+		LastName:     "User",
+		ClientIDs:    []primitive.ObjectID{},
+		IsActive:     true,
+	})
+	require.NoError(t, err)
+
+	post := func(path string, body map[string]interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+		bodyBytes, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", path, bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var result map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &result)
+		return w, result
+	}
+	login := func() string {
+		w, result := post("/api/v1/auth/login", map[string]interface{}{
+			"email":    "refresh@example.com",
+			"password": "SecurePass123!",
+		})
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		assert.NotEmpty(t, result["token"])
+		require.NotEmpty(t, result["refresh_token"])
+		return result["refresh_token"].(string)
+	}
+	refresh := func(token string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		return post("/api/v1/auth/refresh", map[string]interface{}{"refresh_token": token})
+	}
+
+	t.Run("refresh rotates the token", func(t *testing.T) {
+		first := login()
+
+		w, result := refresh(first)
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		assert.NotEmpty(t, result["token"])
+		second := result["refresh_token"].(string)
+		assert.NotEqual(t, first, second)
+
+		w, _ = refresh(second)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("reuse revokes every session", func(t *testing.T) {
+		stolen := login()
+		other := login()
+
+		w, result := refresh(stolen)
+		require.Equal(t, http.StatusOK, w.Code)
+		rotated := result["refresh_token"].(string)
+
+		w, result = refresh(stolen)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "refresh token reuse detected", result["error"])
+
+		w, _ = refresh(rotated)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w, _ = refresh(other)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("logout revokes the family", func(t *testing.T) {
+		first := login()
+		kept := login()
+
+		w, result := refresh(first)
+		require.Equal(t, http.StatusOK, w.Code)
+		current := result["refresh_token"].(string)
+
+		w, _ = post("/api/v1/auth/logout", map[string]interface{}{"refresh_token": first})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w, result = refresh(current)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "refresh token revoked", result["error"])
+
+		// Sessions from other logins are unaffected
+		w, _ = refresh(kept)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w, _ = post("/api/v1/auth/logout", map[string]interface{}{"refresh_token": first})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		w, _ := refresh("not-a-real-token")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestUserAuthHandler_TokenRevocation(t *testing.T) {
+	router, handler, userRepo, _, _, cleanup := setupUserAuthTest(t)
+	defer cleanup()
+
+	passwordHash, _ := auth.HashPassword("SecurePass123!")
+	testUser := &models.User{
+		Email:        "revoke@example.com",
+		PasswordHash: passwordHash,
+		FirstName:    "Revoke",
+		LastName:     "User",
+		ClientIDs:    []primitive.ObjectID{},
+		IsActive:     true,
+	}
+	_, err := userRepo.Create(context.Background(), testUser)
+	require.NoError(t, err)
+
+	login := func() (string, string) {
+		bodyBytes, _ := json.Marshal(map[string]interface{}{
+			"email":    "revoke@example.com",
+			"password": "SecurePass123!",
+		})
+		req := httptest.NewRequest("POST", "/api/v1/auth/login", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return result["token"].(string), result["refresh_token"].(string)
+	}
+	me := func(token string) int {
+		req := httptest.NewRequest("GET", "/api/v1/auth/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("logout revokes the presented access token", func(t *testing.T) {
+		token, refreshToken := login()
+		other, _ := login()
+		require.Equal(t, http.StatusOK, me(token))
+
+		bodyBytes, _ := json.Marshal(map[string]interface{}{"refresh_token": refreshToken})
+		req := httptest.NewRequest("POST", "/api/v1/auth/logout", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, http.StatusUnauthorized, me(token))
+		assert.Equal(t, http.StatusOK, me(other))
+	})
+
+	t.Run("logout everywhere revokes every access token", func(t *testing.T) {
+		first, _ := login()
+		second, _ := login()
+
+		req := httptest.NewRequest("POST", "/api/v1/auth/logout-all", nil)
+		req.Header.Set("Authorization", "Bearer "+first)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+
+		assert.Equal(t, http.StatusUnauthorized, me(first))
+		assert.Equal(t, http.StatusUnauthorized, me(second))
+
+		fresh, _ := login()
+		assert.Equal(t, http.StatusOK, me(fresh))
+	})
+
+	t.Run("tokens issued before a password change are rejected", func(t *testing.T) {
+		token, _ := login()
+		require.Equal(t, http.StatusOK, me(token))
+
+		newHash, _ := auth.HashPassword("EvenMoreSecure456!")
+		require.NoError(t, userRepo.UpdatePassword(context.Background(), testUser.ID, newHash))
+		handler.revocations.Forget(testUser.ID)
+
+		assert.Equal(t, http.StatusUnauthorized, me(token))
+	})
+}
+
+func TestUserAuthHandler_PasswordFlows(t *testing.T) {
+	router, handler, userRepo, _, _, cleanup := setupUserAuthTest(t)
+	defer cleanup()
+
+	passwordHash, _ := auth.HashPassword("SecurePass123!")
+	_, err := userRepo.Create(context.Background(), &models.User{
+		Email:        "password@example.com",
+		PasswordHash: passwordHash,
+		FirstName:    "Password",
+		LastName:     "User",
+		ClientIDs:    []primitive.ObjectID{},
+		IsActive:     true,
+	})
+	require.NoError(t, err)
+
+	post := func(path, token string, body map[string]interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+		bodyBytes, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", path, bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var result map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &result)
+		return w, result
+	}
+	login := func(password string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		return post("/api/v1/auth/login", "", map[string]interface{}{
+			"email":    "password@example.com",
+			"password": password,
+		})
+	}
+
+	t.Run("change password", func(t *testing.T) {
+		w, result := login("SecurePass123!")
+		require.Equal(t, http.StatusOK, w.Code)
+		token := result["token"].(string)
+
+		w, _ = post("/api/v1/auth/password/change", token, map[string]interface{}{
+			"current_password": "WrongPass123!",
+			"new_password":     "ChangedPass456!",
+		})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w, result = post("/api/v1/auth/password/change", token, map[string]interface{}{
+			"current_password": "SecurePass123!",
+			"new_password":     "ChangedPass456!",
+		})
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		newToken := result["token"].(string)
+
+		// The old access token ends with the change, the one returned by it keeps working
+		w, _ = post("/api/v1/auth/password/change", token, map[string]interface{}{
+			"current_password": "ChangedPass456!",
+			"new_password":     "SecurePass123!",
+		})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w, _ = login("SecurePass123!")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w, _ = login("ChangedPass456!")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w, _ = post("/api/v1/auth/password/change", newToken, map[string]interface{}{
+			"current_password": "ChangedPass456!",
+			"new_password":     "SecurePass123!",
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("forgot and reset password", func(t *testing.T) {
+		mailer := handler.mailer.(*services.MemoryMailer)
+
+		w, result := post("/api/v1/auth/password/forgot", "", map[string]interface{}{"email": "unknown@example.com"})
+		require.Equal(t, http.StatusOK, w.Code)
+		unknownMessage := result["message"]
+
+		w, result = post("/api/v1/auth/password/forgot", "", map[string]interface{}{"email": "Password@Example.com"})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, unknownMessage, result["message"])
+
+		// Mail is sent after responding
+		require.Eventually(t, func() bool { return len(mailer.Messages()) > 0 }, 5*time.Second, 10*time.Millisecond)
+		messages := mailer.Messages()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "password@example.com", messages[0].To)
+		_, link, found := strings.Cut(messages[0].Body, "https://dashboard.example.com/reset-password?token=")
+		require.True(t, found, "reset link missing from %q", messages[0].Body)
+		resetToken := strings.Fields(link)[0]
+
+		w, _ = post("/api/v1/auth/password/reset", "", map[string]interface{}{
+			"token":        resetToken,
+			"new_password": "ResetPass789!",
+		})
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+
+		w, _ = login("ResetPass789!")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// Reset tokens are single-use
+		w, _ = post("/api/v1/auth/password/reset", "", map[string]interface{}{
+			"token":        resetToken,
+			"new_password": "AnotherPass000!",
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("a new reset link invalidates the previous one", func(t *testing.T) {
+		mailer := handler.mailer.(*services.MemoryMailer)
+		for i := 0; i < 2; i++ {
+			sent := len(mailer.Messages())
+			w, _ := post("/api/v1/auth/password/forgot", "", map[string]interface{}{"email": "password@example.com"})
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Eventually(t, func() bool { return len(mailer.Messages()) > sent }, 5*time.Second, 10*time.Millisecond)
+		}
+
+		messages := mailer.Messages()
+		require.GreaterOrEqual(t, len(messages), 2)
+		tokenFrom := func(msg services.MailMessage) string {
+			_, link, _ := strings.Cut(msg.Body, "?token=")
+			return strings.Fields(link)[0]
+		}
+
+		w, _ := post("/api/v1/auth/password/reset", "", map[string]interface{}{
+			"token":        tokenFrom(messages[len(messages)-2]),
+			"new_password": "StalePass111!",
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w, _ = post("/api/v1/auth/password/reset", "", map[string]interface{}{
+			"token":        tokenFrom(messages[len(messages)-1]),
+			"new_password": "FreshPass222!",
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("reset mails are limited per account", func(t *testing.T) {
+		mailer := handler.mailer.(*services.MemoryMailer)
+		sent := len(mailer.Messages())
+
+		// The account was sent three links within the hour; further requests get the usual response
+		w, result := post("/api/v1/auth/password/forgot", "", map[string]interface{}{"email": "password@example.com"})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, forgotPasswordResponse["message"], result["message"])
+		assert.Never(t, func() bool { return len(mailer.Messages()) > sent }, 200*time.Millisecond, 10*time.Millisecond)
+	})
+}
+
+func TestUserAuthHandler_EmailVerification(t *testing.T) {
+	router, handler, _, _, cfg, cleanup := setupUserAuthTest(t)
+	defer cleanup()
+	cfg.RequireEmailVerify = true
+	mailer := handler.mailer.(*services.MemoryMailer)
+
+	post := func(path, token string, body map[string]interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+		bodyBytes, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", path, bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var result map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &result)
+		return w, result
+	}
+	register := func(email string) string {
+		w, result := post("/api/v1/auth/register/user", "", map[string]interface{}{
+			"email":      email,
+			"password":   "SecurePass123!",
+			"first_name": "Verify",
+			"last_name":  "User",
+		})
+		require.Equal(t, http.StatusCreated, w.Code, "Response body: %s", w.Body.String())
+		assert.Equal(t, false, result["user"].(map[string]interface{})["email_verified"])
+		return result["token"].(string)
+	}
+	lastToken := func() string {
+		messages := mailer.Messages()
+		require.NotEmpty(t, messages)
+		_, link, found := strings.Cut(messages[len(messages)-1].Body, "https://dashboard.example.com/verify-email?token=")
+		require.True(t, found)
+		return strings.Fields(link)[0]
+	}
+
+	t.Run("client creation requires a verified email", func(t *testing.T) {
+		token := register("verify@example.com")
+		verificationToken := lastToken()
+		assert.Equal(t, "verify@example.com", mailer.Messages()[len(mailer.Messages())-1].To)
+
+		w, result := post("/api/v1/auth/register/client", token, map[string]interface{}{"name": "Unverified Client"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, "email verification required", result["error"])
+
+		w, result = post("/api/v1/auth/email/verify", "", map[string]interface{}{"token": verificationToken})
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		assert.Equal(t, true, result["user"].(map[string]interface{})["email_verified"])
+
+		w, _ = post("/api/v1/auth/register/client", token, map[string]interface{}{"name": "Verified Client"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		w, _ = post("/api/v1/auth/email/verify", "", map[string]interface{}{"token": verificationToken})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w, _ = post("/api/v1/auth/email/resend", token, nil)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("resend is rate limited and replaces the previous link", func(t *testing.T) {
+		token := register("resend@example.com")
+		first := lastToken()
+
+		for i := 1; i < maxVerificationMails; i++ {
+			w, _ := post("/api/v1/auth/email/resend", token, nil)
+			require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		}
+		w, _ := post("/api/v1/auth/email/resend", token, nil)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+		w, _ = post("/api/v1/auth/email/verify", "", map[string]interface{}{"token": first})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w, _ = post("/api/v1/auth/email/verify", "", map[string]interface{}{"token": lastToken()})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestUserAuthHandler_ClientMembers(t *testing.T) {
+	router, _, userRepo, clientRepo, cfg, cleanup := setupUserAuthTest(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	newUser := func(email string) (*models.User, string) {
+		user, err := userRepo.Create(ctx, &models.User{
+			Email:        email,
+			PasswordHash: "hashed",
+			FirstName:    "Member",
+			LastName:     "User",
+			ClientIDs:    []primitive.ObjectID{},
+			IsActive:     true,
+		})
+		require.NoError(t, err)
+		token, err := auth.GenerateJWT(user.ID.Hex(), user.Email, []byte(cfg.JWTSigningKey), time.Hour)
+		require.NoError(t, err)
+		return user, token
+	}
+	owner, ownerToken := newUser("owner@example.com")
+	member, memberToken := newUser("member@example.com")
+
+	client, err := clientRepo.Create(ctx, &models.Client{
+		Name:     "members-client",
+		UserIDs:  []primitive.ObjectID{owner.ID},
+		APIKeys:  []models.APIKey{},
+		IsActive: true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, clientRepo.AddMember(ctx, client.ID, member.ID, models.ClientRoleViewer))
+
+	request := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var reader *bytes.Buffer
+		if body != nil {
+			bodyBytes, _ := json.Marshal(body)
+			reader = bytes.NewBuffer(bodyBytes)
+		} else {
+			reader = bytes.NewBuffer(nil)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	base := "/api/v1/clients/" + client.ID.Hex()
+	setRole := func(token string, user *models.User, role models.ClientRole) *httptest.ResponseRecorder {
+		return request("PUT", base+"/members/"+user.ID.Hex(), token, map[string]interface{}{"role": role})
+	}
+
+	t.Run("viewers can read but not manage keys", func(t *testing.T) {
+		w := request("GET", base+"/members", memberToken, nil)
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		var result map[string][]map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		require.Len(t, result["members"], 2)
+		assert.Equal(t, "owner", result["members"][0]["role"])
+		assert.Equal(t, "owner@example.com", result["members"][0]["email"])
+		assert.Equal(t, "viewer", result["members"][1]["role"])
+
+		w = request("POST", base+"/api-keys", memberToken, map[string]interface{}{"name": "viewer key"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = setRole(memberToken, member, models.ClientRoleAdmin)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("admins manage keys but not owners", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, setRole(ownerToken, member, models.ClientRoleAdmin).Code)
+
+		w := request("POST", base+"/api-keys", memberToken, map[string]interface{}{"name": "admin key"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		assert.Equal(t, http.StatusForbidden, setRole(memberToken, member, models.ClientRoleOwner).Code)
+		assert.Equal(t, http.StatusForbidden, setRole(memberToken, owner, models.ClientRoleViewer).Code)
+		assert.Equal(t, http.StatusBadRequest, setRole(ownerToken, member, "superuser").Code)
+	})
+
+	t.Run("every client keeps an owner", func(t *testing.T) {
+		assert.Equal(t, http.StatusConflict, setRole(ownerToken, owner, models.ClientRoleAdmin).Code)
+
+		require.Equal(t, http.StatusOK, setRole(ownerToken, member, models.ClientRoleOwner).Code)
+		assert.Equal(t, http.StatusOK, setRole(ownerToken, owner, models.ClientRoleViewer).Code)
+
+		updated, err := clientRepo.FindByID(ctx, client.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, updated.OwnerCount())
+		role, _ := updated.RoleOf(owner.ID)
+		assert.Equal(t, models.ClientRoleViewer, role)
+	})
+}
+
+func TestUserAuthHandler_ClientInvites(t *testing.T) {
+	router, handler, userRepo, clientRepo, cfg, cleanup := setupUserAuthTest(t)
+	defer cleanup()
+	ctx := context.Background()
+	mailer := handler.mailer.(*services.MemoryMailer)
+
+	newUser := func(email string) (*models.User, string) {
+		user, err := userRepo.Create(ctx, &models.User{
+			Email:        email,
+			PasswordHash: "hashed",
+			FirstName:    "Invite",
+			LastName:     "User",
+			ClientIDs:    []primitive.ObjectID{},
+			IsActive:     true,
+		})
+		require.NoError(t, err)
+		token, err := auth.GenerateJWT(user.ID.Hex(), user.Email, []byte(cfg.JWTSigningKey), time.Hour)
+		require.NoError(t, err)
+		return user, token
+	}
+	owner, ownerToken := newUser("owner@example.com")
+	existing, existingToken := newUser("existing@example.com")
+	_, otherToken := newUser("other@example.com")
+
+	client, err := clientRepo.Create(ctx, &models.Client{
+		Name:     "invites-client",
+		UserIDs:  []primitive.ObjectID{owner.ID},
+		APIKeys:  []models.APIKey{},
+		IsActive: true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, userRepo.AddClientToUser(ctx, owner.ID, client.ID))
+
+	request := func(method, path, token string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+		bodyBytes, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var result map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &result)
+		return w, result
+	}
+	base := "/api/v1/clients/" + client.ID.Hex()
+	invite := func(email string, role models.ClientRole) (string, string) {
+		w, result := request("POST", base+"/invites", ownerToken, map[string]interface{}{"email": email, "role": role})
+		require.Equal(t, http.StatusCreated, w.Code, "Response body: %s", w.Body.String())
+		messages := mailer.Messages()
+		_, link, found := strings.Cut(messages[len(messages)-1].Body, "https://dashboard.example.com/accept-invite?token=")
+		require.True(t, found, "invite link missing from %q", messages[len(messages)-1].Body)
+		return result["invite"].(map[string]interface{})["id"].(string), strings.Fields(link)[0]
+	}
+	pendingInvites := func() []interface{} {
+		w, result := request("GET", base+"/invites", ownerToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		return result["invites"].([]interface{})
+	}
+
+	t.Run("existing user accepts an invite", func(t *testing.T) {
+		_, token := invite("Existing@Example.com", models.ClientRoleDeveloper)
+		require.Len(t, pendingInvites(), 1)
+
+		w, _ := request("POST", "/api/v1/auth/invites/accept", otherToken, map[string]interface{}{"token": token})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w, _ = request("POST", "/api/v1/auth/invites/accept", existingToken, map[string]interface{}{"token": token})
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+
+		updated, err := clientRepo.FindByID(ctx, client.ID)
+		require.NoError(t, err)
+		role, ok := updated.RoleOf(existing.ID)
+		require.True(t, ok)
+		assert.Equal(t, models.ClientRoleDeveloper, role)
+		user, err := userRepo.FindByID(ctx, existing.ID)
+		require.NoError(t, err)
+		assert.Contains(t, user.ClientIDs, client.ID)
+		assert.True(t, user.EmailVerified)
+
+		// Invitations are single-use and stay on record once accepted
+		w, _ = request("POST", "/api/v1/auth/invites/accept", existingToken, map[string]interface{}{"token": token})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Empty(t, pendingInvites())
+		w, result := request("GET", base+"/invites?all=true", ownerToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "accepted", result["invites"].([]interface{})[0].(map[string]interface{})["status"])
+
+		w, _ = request("POST", base+"/invites", ownerToken, map[string]interface{}{"email": "existing@example.com", "role": "viewer"})
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("new user registers with an invite", func(t *testing.T) {
+		_, token := invite("newcomer@example.com", models.ClientRoleViewer)
+
+		w, result := request("POST", "/api/v1/auth/invites/register", "", map[string]interface{}{
+			"token":      token,
+			"password":   "SecurePass123!",
+			"first_name": "New",
+			"last_name":  "Comer",
+		})
+		require.Equal(t, http.StatusCreated, w.Code, "Response body: %s", w.Body.String())
+		assert.NotEmpty(t, result["token"])
+		assert.Equal(t, true, result["user"].(map[string]interface{})["email_verified"])
+
+		w, _ = request("GET", base, result["token"].(string), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("revoked and reissued invites stop working", func(t *testing.T) {
+		inviteID, token := invite("revoked@example.com", models.ClientRoleViewer)
+		w, _ := request("DELETE", base+"/invites/"+inviteID, ownerToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		w, _ = request("DELETE", base+"/invites/"+inviteID, ownerToken, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		_, first := invite("reissued@example.com", models.ClientRoleViewer)
+		invite("reissued@example.com", models.ClientRoleViewer)
+		assert.Len(t, pendingInvites(), 1)
+
+		for _, stale := range []string{token, first} {
+			w, _ = request("POST", "/api/v1/auth/invites/register", "", map[string]interface{}{
+				"token":      stale,
+				"password":   "SecurePass123!",
+				"first_name": "Stale",
+				"last_name":  "Invite",
+			})
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("members are removed and leave", func(t *testing.T) {
+		w, _ := request("POST", base+"/leave", ownerToken, nil)
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		w, _ = request("DELETE", base+"/members/"+existing.ID.Hex(), ownerToken, nil)
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		user, err := userRepo.FindByID(ctx, existing.ID)
+		require.NoError(t, err)
+		assert.NotContains(t, user.ClientIDs, client.ID)
+
+		w, _ = request("GET", base, existingToken, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w, _ = request("POST", base+"/leave", existingToken, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		newcomer, err := userRepo.FindByEmail(ctx, "newcomer@example.com")
+		require.NoError(t, err)
+		newcomerToken, err := auth.GenerateJWT(newcomer.ID.Hex(), newcomer.Email, []byte(cfg.JWTSigningKey), time.Hour)
+		require.NoError(t, err)
+		w, _ = request("POST", base+"/leave", newcomerToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestUserAuthHandler_LoginLockout(t *testing.T) {
+	router, handler, userRepo, _, cfg, cleanup := setupUserAuthTest(t)
+	defer cleanup()
+	ctx := context.Background()
+	mailer := handler.mailer.(*services.MemoryMailer)
+
+	passwordHash, err := auth.HashPassword("SecurePass123!")
+	require.NoError(t, err)
+	user, err := userRepo.Create(ctx, &models.User{
+		Email:        "locked@example.com",
+		PasswordHash: passwordHash,
+		FirstName:    "Locked",
+		LastName:     "User",
+		ClientIDs:    []primitive.ObjectID{},
+		IsActive:     true,
+	})
+	require.NoError(t, err)
+
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		bodyBytes, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", path, bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	login := func(password string) *httptest.ResponseRecorder {
+		return post("/api/v1/auth/login", map[string]interface{}{"email": user.Email, "password": password})
+	}
+
+	t.Run("repeated failures are delayed", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusUnauthorized, login("WrongPassword").Code)
+		}
+		w := login("SecurePass123!")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	})
+
+	t.Run("locked accounts are unlocked by email", func(t *testing.T) {
+		// Record the remaining failures directly rather than waiting out the delays
+		for i := 3; i < cfg.LoginMaxFailures; i++ {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("POST", "/api/v1/auth/login", nil)
+			handler.recordLoginFailure(c, user.Email, user)
+		}
+
+		w := login("SecurePass123!")
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), "login temporarily locked")
+
+		events, err := handler.securityEvents.List(ctx, user.Email, "", 10)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, models.SecurityEventLoginLocked, events[0].Type)
+		assert.Equal(t, user.ID, *events[0].UserID)
+
+		// The unlock mail is sent after responding
+		require.Eventually(t, func() bool { return len(mailer.Messages()) > 0 }, 5*time.Second, 10*time.Millisecond)
+		messages := mailer.Messages()
+		require.Len(t, messages, 1)
+		_, link, found := strings.Cut(messages[0].Body, "https://dashboard.example.com/unlock-account?token=")
+		require.True(t, found, "unlock link missing from %q", messages[0].Body)
+		unlockToken := strings.Fields(link)[0]
+
+		w = post("/api/v1/auth/login/unlock", map[string]interface{}{"token": unlockToken})
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		assert.Equal(t, http.StatusBadRequest, post("/api/v1/auth/login/unlock", map[string]interface{}{"token": unlockToken}).Code)
+
+		assert.Equal(t, http.StatusOK, login("SecurePass123!").Code)
+		events, err = handler.securityEvents.List(ctx, user.Email, "", 10)
+		require.NoError(t, err)
+		assert.Equal(t, models.SecurityEventLoginUnlocked, events[0].Type)
+	})
+}
+
+func TestUserAuthHandler_LoginLockoutIgnoresForwardedFor(t *testing.T) {
+	router, handler, _, _, cfg, cleanup := setupUserAuthTest(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// httptest requests come from 192.0.2.1, which is not a trusted proxy
+	login := func(email, forwardedFor string) *httptest.ResponseRecorder {
+		bodyBytes, _ := json.Marshal(map[string]interface{}{"email": email, "password": "WrongPassword"})
+		req := httptest.NewRequest("POST", "/api/v1/auth/login", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A new forwarded address on every attempt still counts against the peer address
+	for i := 0; i < cfg.LoginMaxIPFailures; i++ {
+		w := login(fmt.Sprintf("guess-%d@example.com", i), fmt.Sprintf("203.0.113.%d", i%250+1))
+		require.Equal(t, http.StatusUnauthorized, w.Code, "attempt %d: %s", i, w.Body.String())
+	}
+	w := login("another@example.com", "198.51.100.7")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "login temporarily locked")
+
+	events, err := handler.securityEvents.List(ctx, "", "192.0.2.1", 10)
+	require.NoError(t, err)
+	require.NotEmpty(t, events)
+	assert.Equal(t, models.SecurityEventLoginIPLocked, events[0].Type)
+
+	// Behind a trusted proxy the forwarded address is the client
+	require.NoError(t, router.SetTrustedProxies([]string{"192.0.2.1"}))
+	assert.Equal(t, http.StatusUnauthorized, login("another@example.com", "198.51.100.7").Code)
+}
+
+func TestUserAuthHandler_MFA(t *testing.T) {
+	router, _, userRepo, clientRepo, cfg, cleanup := setupUserAuthTest(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	passwordHash, err := auth.HashPassword("SecurePass123!")
+	require.NoError(t, err)
+	user, err := userRepo.Create(ctx, &models.User{
+		Email:        "mfa@example.com",
+		PasswordHash: passwordHash,
+		FirstName:    "MFA",
+		LastName:     "User",
+		ClientIDs:    []primitive.ObjectID{},
+		IsActive:     true,
+	})
+	require.NoError(t, err)
+	member, err := userRepo.Create(ctx, &models.User{
+		Email:        "member@example.com",
+		PasswordHash: passwordHash,
+		FirstName:    "Member",
+		LastName:     "User",
+		ClientIDs:    []primitive.ObjectID{},
+		IsActive:     true,
+	})
+	require.NoError(t, err)
+	memberToken, err := auth.GenerateJWT(member.ID.Hex(), member.Email, []byte(cfg.JWTSigningKey), time.Hour)
+	require.NoError(t, err)
+
+	client, err := clientRepo.Create(ctx, &models.Client{
+		Name:     "mfa-client",
+		UserIDs:  []primitive.ObjectID{user.ID, member.ID},
+		APIKeys:  []models.APIKey{},
+		IsActive: true,
+	})
+	require.NoError(t, err)
+
+	request := func(method, path, token string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+		bodyBytes, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var result map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &result)
+		return w, result
+	}
+	login := func() map[string]interface{} {
+		w, result := request("POST", "/api/v1/auth/login", "", map[string]interface{}{"email": user.Email, "password": "SecurePass123!"})
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		return result
+	}
+
+	session := login()
+	token := session["token"].(string)
+
+	// Enroll and confirm
+	w, result := request("POST", "/api/v1/auth/mfa/enroll", token, map[string]interface{}{"password": "WrongPassword"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w, result = request("POST", "/api/v1/auth/mfa/enroll", token, map[string]interface{}{"password": "SecurePass123!"})
+	require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+	secret := result["secret"].(string)
+	assert.Contains(t, result["provisioning_uri"], "otpauth://totp/")
+
+	w, _ = request("POST", "/api/v1/auth/mfa/confirm", token, map[string]interface{}{"code": "000000"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	code, err := auth.TOTPCode(secret, time.Now())
+	require.NoError(t, err)
+	w, result = request("POST", "/api/v1/auth/mfa/confirm", token, map[string]interface{}{"code": code})
+	require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+	recoveryCodes := result["recovery_codes"].([]interface{})
+	require.Len(t, recoveryCodes, 10)
+
+	// The earlier session ended
+	w, _ = request("GET", "/api/v1/auth/me", token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w, _ = request("POST", "/api/v1/auth/refresh", "", map[string]interface{}{"refresh_token": session["refresh_token"]})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Logging in takes a second step
+	challenge := login()
+	assert.Equal(t, true, challenge["mfa_required"])
+	assert.Nil(t, challenge["token"])
+	mfaToken := challenge["mfa_token"].(string)
+
+	w, result = request("POST", "/api/v1/auth/login/mfa", "", map[string]interface{}{"mfa_token": mfaToken, "code": "000000"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, float64(maxMFAAttempts-1), result["attempts_remaining"])
+
+	w, result = request("POST", "/api/v1/auth/login/mfa", "", map[string]interface{}{"mfa_token": mfaToken, "code": recoveryCodes[0]})
+	require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+	mfaSession := result["token"].(string)
+	claims, err := auth.ParseJWT(mfaSession, []byte(cfg.JWTSigningKey))
+	require.NoError(t, err)
+	assert.True(t, claims.MFA)
+
+	// Challenges and recovery codes work once
+	w, _ = request("POST", "/api/v1/auth/login/mfa", "", map[string]interface{}{"mfa_token": mfaToken, "code": recoveryCodes[1]})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w, _ = request("POST", "/api/v1/auth/login/mfa", "", map[string]interface{}{"mfa_token": login()["mfa_token"], "code": recoveryCodes[0]})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Clients can require two-factor authentication
+	base := "/api/v1/clients/" + client.ID.Hex()
+	w, _ = request("PUT", base+"/security", memberToken, map[string]interface{}{"require_mfa": true})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w, result = request("PUT", base+"/security", mfaSession, map[string]interface{}{"require_mfa": true})
+	require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+	assert.Equal(t, true, result["client"].(map[string]interface{})["require_mfa"])
+
+	w, _ = request("GET", base, memberToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "two-factor authentication required")
+	w, result = request("GET", base+"/members", mfaSession, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, result["members"], 2)
+
+	// Disabling takes the password and a code
+	w, _ = request("POST", "/api/v1/auth/mfa/disable", mfaSession, map[string]interface{}{"password": "SecurePass123!", "code": "000000"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w, result = request("POST", "/api/v1/auth/mfa/disable", mfaSession, map[string]interface{}{"password": "SecurePass123!", "code": recoveryCodes[2]})
+	require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+	assert.NotEmpty(t, result["token"])
+	assert.NotEmpty(t, login()["token"])
+}
+
+func TestUserAuthHandler_SSO(t *testing.T) {
+	router, handler, userRepo, clientRepo, cfg, cleanup := setupUserAuthTest(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	request := func(method, path, token string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+		bodyBytes, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var result map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &result)
+		return w, result
+	}
+
+	w, _ := request("POST", "/api/v1/auth/sso/start", "", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	idp := testhelpers.NewMockOIDCProvider(cfg.OIDCClientID)
+	defer idp.Close()
+	cfg.OIDCIssuerURL = idp.Issuer()
+	handler.oidc = services.NewOIDCProvider(cfg)
+
+	authorize := func(identity testhelpers.MockOIDCIdentity) (string, string) {
+		w, result := request("POST", "/api/v1/auth/sso/start", "", nil)
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		code, state, err := idp.Authorize(result["authorization_url"].(string), identity)
+		require.NoError(t, err)
+		return code, state
+	}
+	ssoLogin := func(identity testhelpers.MockOIDCIdentity) (*httptest.ResponseRecorder, map[string]interface{}) {
+		code, state := authorize(identity)
+		return request("POST", "/api/v1/auth/sso/callback", "", map[string]interface{}{"code": code, "state": state})
+	}
+
+	t.Run("new identities are provisioned", func(t *testing.T) {
+		code, state := authorize(testhelpers.MockOIDCIdentity{Subject: "sso-new", Email: "new@example.com", EmailVerified: true, GivenName: "New", FamilyName: "User"})
+		w, result := request("POST", "/api/v1/auth/sso/callback", "", map[string]interface{}{"code": code, "state": state})
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		user := result["user"].(map[string]interface{})
+		assert.Equal(t, "new@example.com", user["email"])
+		assert.Equal(t, true, user["email_verified"])
+		assert.Equal(t, true, user["sso_linked"])
+
+		claims, err := auth.ParseJWT(result["token"].(string), []byte(cfg.JWTSigningKey))
+		require.NoError(t, err)
+		assert.True(t, claims.SSO)
+
+		// Refreshed tokens keep the SSO claim
+		w, result = request("POST", "/api/v1/auth/refresh", "", map[string]interface{}{"refresh_token": result["refresh_token"]})
+		require.Equal(t, http.StatusOK, w.Code)
+		claims, err = auth.ParseJWT(result["token"].(string), []byte(cfg.JWTSigningKey))
+		require.NoError(t, err)
+		assert.True(t, claims.SSO)
+
+		// States work once
+		w, _ = request("POST", "/api/v1/auth/sso/callback", "", map[string]interface{}{"code": code, "state": state})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		events, err := handler.securityEvents.List(ctx, "new@example.com", "", 10)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, models.SecurityEventSSOProvisioned, events[0].Type)
+	})
+
+	t.Run("existing accounts are linked by verified email", func(t *testing.T) {
+		passwordHash, err := auth.HashPassword("SecurePass123!")
+		require.NoError(t, err)
+		existing, err := userRepo.Create(ctx, &models.User{
+			Email:        "existing@example.com",
+			PasswordHash: passwordHash,
+			FirstName:    "Existing",
+			LastName:     "User",
+			ClientIDs:    []primitive.ObjectID{},
+			IsActive:     true,
+		})
+		require.NoError(t, err)
+
+		w, _ := ssoLogin(testhelpers.MockOIDCIdentity{Subject: "sso-existing", Email: "existing@example.com"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w, result := ssoLogin(testhelpers.MockOIDCIdentity{Subject: "sso-existing", Email: "existing@example.com", EmailVerified: true})
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		assert.Equal(t, existing.ID.Hex(), result["user"].(map[string]interface{})["id"])
+
+		// The link follows the subject, not the address
+		w, result = ssoLogin(testhelpers.MockOIDCIdentity{Subject: "sso-existing", Email: "renamed@example.com"})
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		assert.Equal(t, existing.ID.Hex(), result["user"].(map[string]interface{})["id"])
+
+		// Another identity with the same address cannot take the account over
+		w, _ = ssoLogin(testhelpers.MockOIDCIdentity{Subject: "sso-other", Email: "existing@example.com", EmailVerified: true})
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("rejected codes", func(t *testing.T) {
+		_, state := authorize(testhelpers.MockOIDCIdentity{Subject: "sso-new", Email: "new@example.com", EmailVerified: true})
+		w, _ := request("POST", "/api/v1/auth/sso/callback", "", map[string]interface{}{"code": "forged", "state": state})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("clients can require single sign-on", func(t *testing.T) {
+		passwordHash, err := auth.HashPassword("SecurePass123!")
+		require.NoError(t, err)
+		owner, err := userRepo.Create(ctx, &models.User{
+			Email:        "sso-owner@example.com",
+			PasswordHash: passwordHash,
+			FirstName:    "SSO",
+			LastName:     "Owner",
+			ClientIDs:    []primitive.ObjectID{},
+			IsActive:     true,
+		})
+		require.NoError(t, err)
+		client, err := clientRepo.Create(ctx, &models.Client{
+			Name:     "sso-client",
+			UserIDs:  []primitive.ObjectID{owner.ID},
+			APIKeys:  []models.APIKey{},
+			IsActive: true,
+		})
+		require.NoError(t, err)
+		base := "/api/v1/clients/" + client.ID.Hex()
+
+		w, result := request("POST", "/api/v1/auth/login", "", map[string]interface{}{"email": owner.Email, "password": "SecurePass123!"})
+		require.Equal(t, http.StatusOK, w.Code)
+		passwordToken := result["token"].(string)
+
+		w, _ = request("PUT", base+"/security", passwordToken, map[string]interface{}{})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w, _ = request("PUT", base+"/security", passwordToken, map[string]interface{}{"require_sso": true})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w, result = ssoLogin(testhelpers.MockOIDCIdentity{Subject: "sso-owner", Email: owner.Email, EmailVerified: true})
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		ssoToken := result["token"].(string)
+
+		w, result = request("PUT", base+"/security", ssoToken, map[string]interface{}{"require_sso": true})
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		assert.Equal(t, true, result["client"].(map[string]interface{})["require_sso"])
+
+		w, _ = request("GET", base, passwordToken, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "single sign-on required")
+		w, _ = request("GET", base, ssoToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
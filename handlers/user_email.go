@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mgsearch/middleware"
+	"mgsearch/models"
+	"mgsearch/pkg/auth"
+	"mgsearch/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// verificationMailWindow and maxVerificationMails limit how many verification mails a user can
+	// request, signup included.
+	verificationMailWindow = time.Hour
+	maxVerificationMails   = 3
+)
+
+// VerifyEmailRequest represents the verify email request
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// VerifyEmail handles POST /api/v1/auth/email/verify
+func (h *UserAuthHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	token, err := h.verifications.Consume(ctx, auth.HashOpaqueToken(req.Token))
+	if err != nil {
+		if err.Error() == "verification token not found" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired verification token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify token", "details": err.Error()})
+		return
+	}
+
+	// The token proves ownership of the address it was sent to, not of a later one
+	user, err := h.userRepo.FindByID(ctx, token.UserID)
+	if err != nil || user.Email != token.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired verification token"})
+		return
+	}
+
+	if err := h.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email", "details": err.Error()})
+		return
+	}
+	if err := h.verifications.InvalidateForUser(ctx, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to invalidate verification tokens", "details": err.Error()})
+		return
+	}
+	user.EmailVerified = true
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "email verified successfully",
+		"user":    user.ToPublicView(),
+	})
+}
+
+// ResendVerification handles POST /api/v1/auth/email/resend. Earlier links stop working.
+func (h *UserAuthHandler) ResendVerification(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.userRepo.FindByID(ctx, userObjID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusConflict, gin.H{"error": "email already verified"})
+		return
+	}
+
+	sent, err := h.verifications.CountSince(ctx, user.ID, time.Now().UTC().Add(-verificationMailWindow))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check verification mails", "details": err.Error()})
+		return
+	}
+	if sent >= maxVerificationMails {
+		c.Header("Retry-After", strconv.Itoa(int(verificationMailWindow.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many verification emails", "details": "try again later"})
+		return
+	}
+
+	if err := h.sendVerificationMail(c, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send verification email", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "verification email sent"})
+}
+
+// sendVerificationMail issues a verification token for the user's current email and mails the link.
+// Outstanding tokens of the user are invalidated.
+func (h *UserAuthHandler) sendVerificationMail(c *gin.Context, user *models.User) error {
+	if h.cfg.EmailVerifyURL == "" {
+		return errors.New("EMAIL_VERIFICATION_URL is not configured")
+	}
+
+	rawToken, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request.Context()
+	if err := h.verifications.InvalidateForUser(ctx, user.ID); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	token := &models.EmailVerificationToken{
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: tokenHash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(h.cfg.EmailVerifyTTL),
+	}
+	if err := h.verifications.Create(ctx, token); err != nil {
+		return err
+	}
+
+	return h.mailer.Send(ctx, verificationMail(user, tokenLink(h.cfg.EmailVerifyURL, rawToken), h.cfg.EmailVerifyTTL))
+}
+
+func verificationMail(user *models.User, link string, ttl time.Duration) services.MailMessage {
+	return services.MailMessage{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(`Hi %s,
+
+Please confirm that this is your email address by opening the link below:
+
+%s
+
+The link expires in %s. If you did not create an account, you can ignore this email.
+`, user.FirstName, link, formatMailDuration(ttl)),
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mgsearch/models"
+	"mgsearch/pkg/auth"
+	"mgsearch/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unlockMailTimeout bounds the token update and delivery of the unlock mail done after responding
+const unlockMailTimeout = 30 * time.Second
+
+// UnlockAccountRequest represents the unlock account request
+type UnlockAccountRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// UnlockAccount handles POST /api/v1/auth/login/unlock. The token comes from the mail sent when the
+// account was locked; it clears the account's failed logins but not those of the client IP.
+func (h *UserAuthHandler) UnlockAccount(c *gin.Context) {
+	var req UnlockAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	email, err := h.loginThrottle.Unlock(c.Request.Context(), auth.HashOpaqueToken(req.Token))
+	if err != nil {
+		if err.Error() == "unlock token not found" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired unlock token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock account", "details": err.Error()})
+		return
+	}
+
+	event := &models.SecurityEvent{Type: models.SecurityEventLoginUnlocked, Email: email}
+	if user, err := h.userRepo.FindByEmail(c.Request.Context(), email); err == nil {
+		event.UserID = &user.ID
+	}
+	h.recordSecurityEvent(c, event)
+
+	c.JSON(http.StatusOK, gin.H{"message": "account unlocked"})
+}
+
+// ListSecurityEvents handles GET /api/admin/security-events
+// Supports ?email=, ?ip_address= and ?limit= (default 50, max 500), newest first
+func (h *UserAuthHandler) ListSecurityEvents(c *gin.Context) {
+	limit := int64(50)
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		if parsed > 500 {
+			parsed = 500
+		}
+		limit = parsed
+	}
+
+	email := strings.ToLower(strings.TrimSpace(c.Query("email")))
+	events, err := h.securityEvents.List(c.Request.Context(), email, c.Query("ip_address"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list security events", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+// checkLoginThrottle rejects the login attempt with 429 while the account or client IP is locked or
+// has to wait out a delay
+func (h *UserAuthHandler) checkLoginThrottle(c *gin.Context, email string) bool {
+	check, err := h.loginThrottle.Check(c.Request.Context(), email, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check login attempts", "details": err.Error()})
+		return false
+	}
+	if check.Allowed {
+		return true
+	}
+
+	// Round up so clients retrying at Retry-After are not turned away again
+	c.Header("Retry-After", strconv.Itoa(int((check.RetryAfter+time.Second-1)/time.Second)))
+	if check.Locked {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "login temporarily locked", "details": "too many failed login attempts; try again later"})
+		return false
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed login attempts", "details": "try again later"})
+	return false
+}
+
+// recordLoginFailure counts a failed login. When it locks the account, the owner is mailed an unlock
+// link; lockouts are audited. user is nil for unknown addresses. Errors are only logged, the login
+// has failed regardless.
+func (h *UserAuthHandler) recordLoginFailure(c *gin.Context, email string, user *models.User) {
+	failure, err := h.loginThrottle.Failure(c.Request.Context(), email, c.ClientIP())
+	if err != nil {
+		log.Printf("failed to record failed login: %v", err)
+		return
+	}
+
+	if failure.IPLocked {
+		h.recordSecurityEvent(c, &models.SecurityEvent{
+			Type:    models.SecurityEventLoginIPLocked,
+			Details: "locked for " + formatMailDuration(h.cfg.LoginLockout),
+		})
+	}
+	if !failure.AccountLocked {
+		return
+	}
+
+	event := &models.SecurityEvent{
+		Type:    models.SecurityEventLoginLocked,
+		Email:   email,
+		Details: "locked for " + formatMailDuration(h.cfg.LoginLockout),
+	}
+	if user != nil {
+		event.UserID = &user.ID
+	}
+	h.recordSecurityEvent(c, event)
+
+	// Mail off the request path, so the response time does not tell registered addresses apart
+	if user != nil && user.IsActive {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), unlockMailTimeout)
+			defer cancel()
+			if err := h.sendUnlockMail(ctx, user); err != nil {
+				log.Printf("failed to send unlock mail to user %s: %v", user.ID.Hex(), err)
+			}
+		}()
+	}
+}
+
+// clearLoginFailures forgets the failed logins of the account after a successful login. Errors are
+// only logged.
+func (h *UserAuthHandler) clearLoginFailures(c *gin.Context, user *models.User) {
+	if err := h.loginThrottle.Success(c.Request.Context(), user.Email); err != nil {
+		log.Printf("failed to clear failed logins of user %s: %v", user.ID.Hex(), err)
+	}
+}
+
+// sendUnlockMail issues an unlock token for the locked account and mails the link
+func (h *UserAuthHandler) sendUnlockMail(ctx context.Context, user *models.User) error {
+	if h.cfg.LoginUnlockURL == "" {
+		return errors.New("LOGIN_UNLOCK_URL is not configured")
+	}
+
+	rawToken, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	if err := h.loginThrottle.SetUnlockToken(ctx, user.Email, tokenHash); err != nil {
+		return err
+	}
+	return h.mailer.Send(ctx, unlockMail(user, tokenLink(h.cfg.LoginUnlockURL, rawToken), h.cfg.LoginLockout))
+}
+
+// recordSecurityEvent stamps the event with the request's client and stores it. Audit failures are
+// only logged.
+func (h *UserAuthHandler) recordSecurityEvent(c *gin.Context, event *models.SecurityEvent) {
+	event.IPAddress = c.ClientIP()
+	event.UserAgent = c.Request.UserAgent()
+	if err := h.securityEvents.Record(c.Request.Context(), event); err != nil {
+		log.Printf("failed to record security event %s: %v", event.Type, err)
+	}
+}
+
+func unlockMail(user *models.User, link string, lockout time.Duration) services.MailMessage {
+	return services.MailMessage{
+		To:      user.Email,
+		Subject: "Your account has been locked",
+		Body: fmt.Sprintf(`Hi %s,
+
+Your account was locked for %s after too many failed login attempts. If this was you, open the
+link below to unlock it right away:
+
+%s
+
+If you did not try to log in, someone may be guessing your password. Consider changing it once you
+are signed in.
+`, user.FirstName, formatMailDuration(lockout), link),
+	}
+}
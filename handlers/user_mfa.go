@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"mgsearch/middleware"
+	"mgsearch/models"
+	"mgsearch/pkg/auth"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// recoveryCodeCount is how many recovery codes are issued at a time
+	recoveryCodeCount = 10
+	// maxMFAAttempts is how many codes can be tried against one MFA challenge
+	maxMFAAttempts = 5
+)
+
+// EnrollMFARequest represents the start two-factor enrollment request
+type EnrollMFARequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// MFACodeRequest carries a TOTP code or a recovery code
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DisableMFARequest represents the disable two-factor authentication request
+type DisableMFARequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// LoginMFARequest represents the second login step
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// EnrollMFA handles POST /api/v1/auth/mfa/enroll. It returns a new TOTP secret and its provisioning
+// URI for the authenticator app; two-factor authentication is enabled once ConfirmMFA accepts a code.
+func (h *UserAuthHandler) EnrollMFA(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req EnrollMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	if user.MFAEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication already enabled"})
+		return
+	}
+	if err := auth.VerifyPassword(req.Password, user.PasswordHash); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "password is incorrect"})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate secret"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	encrypted, err := h.keys.Encrypt(ctx, mfaKeyScope(user), []byte(secret))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encrypt secret", "details": err.Error()})
+		return
+	}
+	if err := h.userRepo.SetPendingTOTPSecret(ctx, user.ID, encrypted); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start enrollment", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "add the account to your authenticator app, then confirm with a code",
+		"secret":           secret,
+		"provisioning_uri": auth.TOTPProvisioningURI(h.cfg.MFAIssuer, user.Email, secret),
+	})
+}
+
+// ConfirmMFA handles POST /api/v1/auth/mfa/confirm. A code from the enrolled authenticator enables
+// two-factor authentication and returns the recovery codes, which are shown only once. Every other
+// session of the user ends; the response carries a fresh token pair.
+func (h *UserAuthHandler) ConfirmMFA(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	if user.MFAEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication already enabled"})
+		return
+	}
+	if len(user.PendingTOTPSecret) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no two-factor enrollment in progress"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	secret, err := h.keys.Decrypt(ctx, mfaKeyScope(user), user.PendingTOTPSecret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decrypt secret", "details": err.Error()})
+		return
+	}
+	step, valid := auth.ValidateTOTP(string(secret), req.Code, time.Now(), 0)
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid two-factor code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+	if err := h.userRepo.EnableMFA(ctx, user.ID, user.PendingTOTPSecret, hashes, step); err != nil {
+		if err.Error() == "mfa enrollment not found" {
+			c.JSON(http.StatusConflict, gin.H{"error": "enrollment was restarted", "details": "confirm with a code for the latest secret"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enable two-factor authentication", "details": err.Error()})
+		return
+	}
+	user.MFAEnabled = true
+	user.TokenVersion++
+
+	// Sessions started with only a password must not gain the MFA claim on refresh
+	h.restartSession(c, user, gin.H{
+		"message":        "two-factor authentication enabled",
+		"recovery_codes": codes,
+		"user":           user.ToPublicView(),
+	})
+}
+
+// DisableMFA handles POST /api/v1/auth/mfa/disable. It requires the password and a TOTP or recovery
+// code. Every other session of the user ends; the response carries a fresh token pair.
+func (h *UserAuthHandler) DisableMFA(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req DisableMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	if !user.MFAEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is not enabled"})
+		return
+	}
+	if err := auth.VerifyPassword(req.Password, user.PasswordHash); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "password is incorrect"})
+		return
+	}
+	if !h.requireSecondFactor(c, user, req.Code) {
+		return
+	}
+
+	if err := h.userRepo.DisableMFA(c.Request.Context(), user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to disable two-factor authentication", "details": err.Error()})
+		return
+	}
+	user.MFAEnabled = false
+	user.TokenVersion++
+
+	h.restartSession(c, user, gin.H{
+		"message": "two-factor authentication disabled",
+		"user":    user.ToPublicView(),
+	})
+}
+
+// RegenerateRecoveryCodes handles POST /api/v1/auth/mfa/recovery-codes. Earlier recovery codes stop
+// working.
+func (h *UserAuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	if !user.MFAEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is not enabled"})
+		return
+	}
+	if !h.requireSecondFactor(c, user, req.Code) {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+	if err := h.userRepo.ReplaceRecoveryCodes(c.Request.Context(), user.ID, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store recovery codes", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "recovery codes regenerated",
+		"recovery_codes": codes,
+	})
+}
+
+// LoginMFA handles POST /api/v1/auth/login/mfa, the second step of a login with two-factor
+// authentication. Wrong codes count as failed logins of the account.
+func (h *UserAuthHandler) LoginMFA(c *gin.Context) {
+	var req LoginMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	challenge, err := h.mfaChallenges.RecordAttempt(ctx, auth.HashOpaqueToken(req.MFAToken), maxMFAAttempts)
+	if err != nil {
+		if err.Error() == "mfa challenge not found" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify mfa token", "details": err.Error()})
+		return
+	}
+
+	user, err := h.userRepo.FindByID(ctx, challenge.UserID)
+	if err != nil || !user.IsActive || !user.MFAEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token"})
+		return
+	}
+	if !h.checkLoginThrottle(c, user.Email) {
+		return
+	}
+
+	valid, err := h.verifySecondFactor(ctx, user, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify two-factor code", "details": err.Error()})
+		return
+	}
+	if !valid {
+		h.recordLoginFailure(c, user.Email, user)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":              "invalid two-factor code",
+			"attempts_remaining": maxMFAAttempts - challenge.Attempts,
+		})
+		return
+	}
+
+	if err := h.mfaChallenges.Consume(ctx, challenge.ID); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token"})
+		return
+	}
+	h.clearLoginFailures(c, user)
+
+	tokens, err := h.startSession(c, user, challenge.SSO)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens.response(gin.H{
+		"message": "login successful",
+		"user":    user.ToPublicView(),
+	}))
+}
+
+// startMFAChallenge answers a correct password or single sign-on of a user with two-factor
+// authentication with a challenge token for LoginMFA instead of tokens
+func (h *UserAuthHandler) startMFAChallenge(c *gin.Context, user *models.User, sso bool) {
+	rawToken, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate mfa token"})
+		return
+	}
+
+	now := time.Now().UTC()
+	challenge := &models.MFAChallenge{
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(h.cfg.MFAChallengeTTL),
+		SSO:       sso,
+	}
+	if err := h.mfaChallenges.Create(c.Request.Context(), challenge); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create mfa challenge", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "two-factor authentication required",
+		"mfa_required":   true,
+		"mfa_token":      rawToken,
+		"mfa_expires_at": challenge.ExpiresAt,
+	})
+}
+
+// requireSecondFactor checks code for the user, writing the error response when it is not valid
+func (h *UserAuthHandler) requireSecondFactor(c *gin.Context, user *models.User, code string) bool {
+	valid, err := h.verifySecondFactor(c.Request.Context(), user, code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify two-factor code", "details": err.Error()})
+		return false
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid two-factor code"})
+		return false
+	}
+	return true
+}
+
+// verifySecondFactor reports whether code is a current TOTP code or an unused recovery code of the
+// user. Accepted codes cannot be used again.
+func (h *UserAuthHandler) verifySecondFactor(ctx context.Context, user *models.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if !isTOTPCode(code) {
+		return h.userRepo.UseRecoveryCode(ctx, user.ID, auth.HashRecoveryCode(code))
+	}
+
+	secret, err := h.keys.Decrypt(ctx, mfaKeyScope(user), user.TOTPSecret)
+	if err != nil {
+		return false, err
+	}
+	step, valid := auth.ValidateTOTP(string(secret), code, time.Now(), user.TOTPLastStep)
+	if !valid {
+		return false, nil
+	}
+	return h.userRepo.UseTOTPStep(ctx, user.ID, step)
+}
+
+// restartSession ends every session of the user after their token version was bumped and writes a
+// response with a fresh token pair merged with extra. The new session keeps the login method of the
+// current one.
+func (h *UserAuthHandler) restartSession(c *gin.Context, user *models.User, extra gin.H) {
+	h.revocations.Forget(user.ID)
+	if err := h.refreshTokens.RevokeAllForUser(c.Request.Context(), user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions", "details": err.Error()})
+		return
+	}
+
+	tokens, err := h.startSession(c, user, middleware.HasSSO(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens.response(extra))
+}
+
+// currentUser loads the authenticated user, writing the error response when that fails
+func (h *UserAuthHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return nil, false
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return nil, false
+	}
+
+	user, err := h.userRepo.FindByID(c.Request.Context(), userObjID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// newRecoveryCodes returns fresh recovery codes and the hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// mfaKeyScope is the encryption scope of a user's TOTP secret
+func mfaKeyScope(user *models.User) string {
+	return "user:" + user.ID.Hex()
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"mgsearch/middleware"
+	"mgsearch/models"
+	"mgsearch/pkg/auth"
+	"mgsearch/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ChangePasswordRequest represents the change password request
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+const (
+	// passwordResetMailWindow and maxPasswordResetMails limit how many reset mails an account can be
+	// sent, so the endpoint cannot be used to flood an address
+	passwordResetMailWindow = time.Hour
+	maxPasswordResetMails   = 3
+	// passwordResetMailTimeout bounds the lookup and delivery done after responding
+	passwordResetMailTimeout = 30 * time.Second
+)
+
+// ForgotPasswordRequest represents the forgot password request
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest represents the reset password request
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+// forgotPasswordResponse is returned whether or not the email belongs to an account, so the endpoint
+// cannot be used to find registered addresses.
+var forgotPasswordResponse = gin.H{"message": "if the email is registered, a password reset link has been sent"}
+
+// ChangePassword handles POST /api/v1/auth/password/change. Every session of the user ends; the
+// response carries a fresh token pair so the current device stays signed in.
+func (h *UserAuthHandler) ChangePassword(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.userRepo.FindByID(ctx, userObjID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	if err := auth.VerifyPassword(req.CurrentPassword, user.PasswordHash); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"})
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "new password must differ from the current password"})
+		return
+	}
+
+	if err := h.setPassword(c, user, req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password", "details": err.Error()})
+		return
+	}
+
+	// Tokens issued from here on carry the bumped version
+	user.TokenVersion++
+	tokens, err := h.startSession(c, user, middleware.HasSSO(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens.response(gin.H{
+		"message": "password changed successfully",
+	}))
+}
+
+// ForgotPassword handles POST /api/v1/auth/password/forgot. A reset link is mailed to active
+// accounts; earlier links of the account stop working. The account is looked up after responding,
+// so known and unknown addresses take equally long to answer.
+func (h *UserAuthHandler) ForgotPassword(c *gin.Context) {
+	if h.cfg.PasswordResetURL == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "password reset is not configured"})
+		return
+	}
+
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	ipAddress := c.ClientIP()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), passwordResetMailTimeout)
+		defer cancel()
+		if err := h.sendPasswordResetMail(ctx, email, ipAddress); err != nil {
+			log.Printf("failed to send password reset mail: %v", err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, forgotPasswordResponse)
+}
+
+// sendPasswordResetMail issues a reset token for the active account with the email address and
+// mails the link. Unknown addresses and accounts that reached the mail limit are skipped; the
+// response is the same either way.
+func (h *UserAuthHandler) sendPasswordResetMail(ctx context.Context, email, ipAddress string) error {
+	user, err := h.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		if err.Error() == "user not found" {
+			return nil
+		}
+		return err
+	}
+	if !user.IsActive {
+		return nil
+	}
+
+	sent, err := h.resetTokens.CountSince(ctx, user.ID, time.Now().UTC().Add(-passwordResetMailWindow))
+	if err != nil {
+		return err
+	}
+	if sent >= maxPasswordResetMails {
+		log.Printf("password reset mail limit reached for user %s", user.ID.Hex())
+		return nil
+	}
+
+	rawToken, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if err := h.resetTokens.InvalidateForUser(ctx, user.ID); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	resetToken := &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		IPAddress: ipAddress,
+		CreatedAt: now,
+		ExpiresAt: now.Add(h.cfg.PasswordResetTTL),
+	}
+	if err := h.resetTokens.Create(ctx, resetToken); err != nil {
+		return err
+	}
+
+	if err := h.mailer.Send(ctx, passwordResetMail(user, tokenLink(h.cfg.PasswordResetURL, rawToken), h.cfg.PasswordResetTTL)); err != nil {
+		return fmt.Errorf("user %s: %w", user.ID.Hex(), err)
+	}
+	return nil
+}
+
+// ResetPassword handles POST /api/v1/auth/password/reset. The reset token works once, and every
+// session of the user ends.
+func (h *UserAuthHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	resetToken, err := h.resetTokens.Consume(ctx, auth.HashOpaqueToken(req.Token))
+	if err != nil {
+		if err.Error() == "reset token not found" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify reset token", "details": err.Error()})
+		return
+	}
+
+	user, err := h.userRepo.FindByID(ctx, resetToken.UserID)
+	if err != nil || !user.IsActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset token"})
+		return
+	}
+
+	if err := h.setPassword(c, user, req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password", "details": err.Error()})
+		return
+	}
+	if err := h.resetTokens.InvalidateForUser(ctx, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to invalidate reset tokens", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password reset successfully"})
+}
+
+// setPassword stores the new password and ends every session of the user. UpdatePassword bumps the
+// token version, so only the cached token state and the refresh tokens need revoking here.
+func (h *UserAuthHandler) setPassword(c *gin.Context, user *models.User, password string) error {
+	passwordHash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request.Context()
+	if err := h.userRepo.UpdatePassword(ctx, user.ID, passwordHash); err != nil {
+		return err
+	}
+	h.revocations.Forget(user.ID)
+	return h.refreshTokens.RevokeAllForUser(ctx, user.ID)
+}
+
+// tokenLink appends token to a dashboard URL as the token query parameter
+func tokenLink(baseURL, token string) string {
+	separator := "?"
+	if strings.Contains(baseURL, "?") {
+		separator = "&"
+	}
+	return baseURL + separator + "token=" + url.QueryEscape(token)
+}
+
+func passwordResetMail(user *models.User, link string, ttl time.Duration) services.MailMessage {
+	return services.MailMessage{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(`Hi %s,
+
+We received a request to reset your password. Use the link below to choose a new one:
+
+%s
+
+The link expires in %s and can only be used once. If you did not request a reset, you can ignore
+this email; your password will not change.
+`, user.FirstName, link, formatMailDuration(ttl)),
+	}
+}
+
+// formatMailDuration renders ttl for mail text, e.g. "7 days", "1 hour" or "30 minutes"
+func formatMailDuration(ttl time.Duration) string {
+	const day = 24 * time.Hour
+	if ttl >= day && ttl%day == 0 {
+		if days := int(ttl / day); days != 1 {
+			return fmt.Sprintf("%d days", days)
+		}
+		return "1 day"
+	}
+	if ttl >= time.Hour && ttl%time.Hour == 0 {
+		if hours := int(ttl / time.Hour); hours != 1 {
+			return fmt.Sprintf("%d hours", hours)
+		}
+		return "1 hour"
+	}
+	if minutes := int(ttl / time.Minute); minutes != 1 {
+		return fmt.Sprintf("%d minutes", minutes)
+	}
+	return "1 minute"
+}
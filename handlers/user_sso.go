@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"mgsearch/models"
+	"mgsearch/pkg/auth"
+	"mgsearch/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SSOCallbackRequest carries the parameters the identity provider redirected to the dashboard with
+type SSOCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// StartSSO handles POST /api/v1/auth/sso/start. It returns the identity provider URL to send the
+// browser to; the provider redirects back to OIDC_REDIRECT_URL with a code and state for SSOCallback.
+func (h *UserAuthHandler) StartSSO(c *gin.Context) {
+	if h.oidc == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "single sign-on is not configured"})
+		return
+	}
+
+	state, stateHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start single sign-on"})
+		return
+	}
+	nonce, _, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start single sign-on"})
+		return
+	}
+	verifier, _, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start single sign-on"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	authorizationURL, err := h.oidc.AuthorizationURL(ctx, state, nonce, auth.PKCEChallenge(verifier))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable", "details": err.Error()})
+		return
+	}
+
+	now := time.Now().UTC()
+	login := &models.SSOLogin{
+		StateHash:    stateHash,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(h.cfg.OIDCStateTTL),
+	}
+	if err := h.ssoLogins.Create(ctx, login); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start single sign-on", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"authorization_url": authorizationURL,
+		"expires_at":        login.ExpiresAt,
+	})
+}
+
+// SSOCallback handles POST /api/v1/auth/sso/callback. The identity is matched to its linked user,
+// else to the user with the provider-verified email address, else a user is provisioned. Users with
+// two-factor authentication still complete the login with LoginMFA.
+func (h *UserAuthHandler) SSOCallback(c *gin.Context) {
+	if h.oidc == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "single sign-on is not configured"})
+		return
+	}
+
+	var req SSOCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	login, err := h.ssoLogins.Consume(ctx, auth.HashOpaqueToken(req.State))
+	if err != nil {
+		if err.Error() == "sso login not found" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired sso state", "details": "start the login again"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to complete single sign-on", "details": err.Error()})
+		return
+	}
+
+	identity, err := h.oidc.Exchange(ctx, req.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		if errors.Is(err, services.ErrSSORejected) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "single sign-on failed", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable", "details": err.Error()})
+		return
+	}
+
+	user, ok := h.ssoUser(c, identity)
+	if !ok {
+		return
+	}
+	if !user.IsActive {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "account is inactive"})
+		return
+	}
+
+	if user.MFAEnabled {
+		h.startMFAChallenge(c, user, true)
+		return
+	}
+
+	tokens, err := h.startSession(c, user, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens.response(gin.H{
+		"message": "login successful",
+		"user":    user.ToPublicView(),
+	}))
+}
+
+// ssoUser returns the user of the identity, linking or provisioning one as needed, and writes the
+// error response when there is none. Accounts are only matched by email address when the provider
+// verified it, so an identity cannot take over an account by claiming its address.
+func (h *UserAuthHandler) ssoUser(c *gin.Context, identity *services.OIDCIdentity) (*models.User, bool) {
+	ctx := c.Request.Context()
+	user, err := h.userRepo.FindBySSOIdentity(ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		return user, true
+	}
+	if err.Error() != "user not found" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user", "details": err.Error()})
+		return nil, false
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "identity provider did not return a verified email address"})
+		return nil, false
+	}
+
+	user, err = h.userRepo.FindByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		return h.linkSSOUser(c, user, identity)
+	case err.Error() != "user not found":
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user", "details": err.Error()})
+		return nil, false
+	case !h.cfg.OIDCProvisionUsers:
+		c.JSON(http.StatusForbidden, gin.H{"error": "no account for this identity", "details": "ask an administrator to create your account"})
+		return nil, false
+	}
+
+	return h.provisionSSOUser(c, identity)
+}
+
+// linkSSOUser links the identity to the existing user with its email address
+func (h *UserAuthHandler) linkSSOUser(c *gin.Context, user *models.User, identity *services.OIDCIdentity) (*models.User, bool) {
+	if err := h.userRepo.LinkSSOIdentity(c.Request.Context(), user.ID, identity.Issuer, identity.Subject); err != nil {
+		if err.Error() == "user already linked to another sso identity" || err.Error() == "sso identity already linked" {
+			c.JSON(http.StatusConflict, gin.H{"error": "account is linked to another identity"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to link identity", "details": err.Error()})
+		return nil, false
+	}
+	user.SSOIssuer = identity.Issuer
+	user.SSOSubject = identity.Subject
+
+	// The provider vouched for the address
+	if !user.EmailVerified {
+		if err := h.userRepo.MarkEmailVerified(c.Request.Context(), user.ID); err != nil {
+			log.Printf("failed to mark email of user %s verified: %v", user.ID.Hex(), err)
+		} else {
+			user.EmailVerified = true
+		}
+	}
+
+	h.recordSecurityEvent(c, &models.SecurityEvent{
+		Type:    models.SecurityEventSSOLinked,
+		UserID:  &user.ID,
+		Email:   user.Email,
+		Details: identity.Issuer,
+	})
+	return user, true
+}
+
+// provisionSSOUser creates a user for the identity. Provisioned users have no password; they can
+// set one with the password reset flow.
+func (h *UserAuthHandler) provisionSSOUser(c *gin.Context, identity *services.OIDCIdentity) (*models.User, bool) {
+	firstName, lastName := identity.GivenName, identity.FamilyName
+	if firstName == "" && lastName == "" {
+		firstName, lastName, _ = strings.Cut(strings.TrimSpace(identity.Name), " ")
+	}
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	user, err := h.userRepo.Create(c.Request.Context(), &models.User{
+		Email:         identity.Email,
+		FirstName:     firstName,
+		LastName:      lastName,
+		ClientIDs:     []primitive.ObjectID{},
+		IsActive:      true,
+		EmailVerified: true,
+		SSOIssuer:     identity.Issuer,
+		SSOSubject:    identity.Subject,
+	})
+	if err != nil {
+		if err.Error() == "email already exists" {
+			c.JSON(http.StatusConflict, gin.H{"error": "account was created concurrently", "details": "sign in again"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user", "details": err.Error()})
+		return nil, false
+	}
+
+	h.recordSecurityEvent(c, &models.SecurityEvent{
+		Type:    models.SecurityEventSSOProvisioned,
+		UserID:  &user.ID,
+		Email:   user.Email,
+		Details: identity.Issuer,
+	})
+	return user, true
+}
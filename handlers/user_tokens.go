@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"mgsearch/middleware"
+	"mgsearch/models"
+	"mgsearch/pkg/auth"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefreshTokenRequest carries the refresh token for POST /api/v1/auth/refresh and /logout
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// tokenPair is the access and refresh token issued on login, registration and refresh
+type tokenPair struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+	refreshID        primitive.ObjectID
+}
+
+// issueTokens creates an access token and a refresh token in familyID. The refresh token is not
+// stored; callers persist it with saveRefreshToken once any previous token has been marked used.
+// sso marks families started with single sign-on, which their tokens keep across refreshes.
+func (h *UserAuthHandler) issueTokens(c *gin.Context, user *models.User, familyID primitive.ObjectID, sso bool) (*tokenPair, *models.RefreshToken, error) {
+	now := time.Now().UTC()
+	accessToken, err := auth.GenerateAccessToken(user.ID.Hex(), user.Email, user.TokenVersion, user.MFAEnabled, sso, []byte(h.cfg.JWTSigningKey), h.cfg.AccessTokenTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rawRefresh, refreshHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	record := &models.RefreshToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: refreshHash,
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(h.cfg.RefreshTokenTTL),
+		SSO:       sso,
+	}
+
+	return &tokenPair{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  now.Add(h.cfg.AccessTokenTTL),
+		RefreshToken:     rawRefresh,
+		RefreshExpiresAt: record.ExpiresAt,
+		refreshID:        record.ID,
+	}, record, nil
+}
+
+// startSession issues the first token pair of a new refresh token family
+func (h *UserAuthHandler) startSession(c *gin.Context, user *models.User, sso bool) (*tokenPair, error) {
+	tokens, record, err := h.issueTokens(c, user, primitive.NewObjectID(), sso)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.refreshTokens.Create(c.Request.Context(), record); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// response returns the token fields of an auth response, merged with extra
+func (p *tokenPair) response(extra gin.H) gin.H {
+	body := gin.H{
+		"token":              p.AccessToken,
+		"expires_at":         p.AccessExpiresAt,
+		"refresh_token":      p.RefreshToken,
+		"refresh_expires_at": p.RefreshExpiresAt,
+	}
+	for key, value := range extra {
+		body[key] = value
+	}
+	return body
+}
+
+// Refresh handles POST /api/v1/auth/refresh. The presented refresh token is exchanged for a new
+// access token and a new refresh token; it cannot be used again. Presenting a token that was
+// already exchanged means it has leaked, so every session of the user is revoked.
+func (h *UserAuthHandler) Refresh(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	current, err := h.refreshTokens.FindByHash(ctx, auth.HashOpaqueToken(req.RefreshToken))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case current.RevokedAt != nil:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token revoked"})
+		return
+	case current.UsedAt != nil:
+		h.revokeOnReuse(c, current)
+		return
+	case !now.Before(current.ExpiresAt):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token expired"})
+		return
+	}
+
+	user, err := h.userRepo.FindByID(ctx, current.UserID)
+	if err != nil || !user.IsActive {
+		if revokeErr := h.refreshTokens.RevokeFamily(ctx, current.FamilyID); revokeErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke refresh token", "details": revokeErr.Error()})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "account is inactive"})
+		return
+	}
+
+	tokens, record, err := h.issueTokens(c, user, current.FamilyID, current.SSO)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	used, err := h.refreshTokens.MarkUsed(ctx, current.ID, tokens.refreshID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh token", "details": err.Error()})
+		return
+	}
+	if !used {
+		// Another request exchanged the token first
+		h.revokeOnReuse(c, current)
+		return
+	}
+
+	if err := h.refreshTokens.Create(ctx, record); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store refresh token", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens.response(nil))
+}
+
+// Logout handles POST /api/v1/auth/logout. It revokes the refresh token and every token issued from
+// the same login, plus the access token sent in the Authorization header, if any.
+func (h *UserAuthHandler) Logout(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.revokeAccessToken(c); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke access token", "details": err.Error()})
+		return
+	}
+
+	current, err := h.refreshTokens.FindByHash(ctx, auth.HashOpaqueToken(req.RefreshToken))
+	if err != nil {
+		// Unknown or already deleted tokens are logged out already
+		c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+		return
+	}
+
+	if err := h.refreshTokens.RevokeFamily(ctx, current.FamilyID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke refresh token", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// LogoutAll handles POST /api/v1/auth/logout-all. It revokes every refresh token and access token
+// of the user, on every device.
+func (h *UserAuthHandler) LogoutAll(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	if err := h.revokeAllSessions(c.Request.Context(), userObjID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out everywhere"})
+}
+
+// DeactivateUser handles POST /api/admin/users/:user_id/deactivate. The user can no longer log in,
+// and tokens already issued stop working.
+func (h *UserAuthHandler) DeactivateUser(c *gin.Context) {
+	userObjID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.userRepo.Delete(ctx, userObjID); err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to deactivate user", "details": err.Error()})
+		return
+	}
+	h.revocations.Forget(userObjID)
+
+	if err := h.refreshTokens.RevokeAllForUser(ctx, userObjID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user deactivated"})
+}
+
+// revokeOnReuse ends every session of the token's user after a used refresh token was presented again
+func (h *UserAuthHandler) revokeOnReuse(c *gin.Context, token *models.RefreshToken) {
+	if err := h.revokeAllSessions(c.Request.Context(), token.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reuse detected", "details": "all sessions have been revoked"})
+}
+
+// revokeAllSessions revokes every refresh token of the user and invalidates their access tokens
+func (h *UserAuthHandler) revokeAllSessions(ctx context.Context, userID primitive.ObjectID) error {
+	if err := h.refreshTokens.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+	return h.revocations.RevokeAllTokens(ctx, userID)
+}
+
+// revokeAccessToken denylists the access token in the Authorization header. Missing, invalid and
+// expired tokens are ignored since they are unusable anyway.
+func (h *UserAuthHandler) revokeAccessToken(c *gin.Context) error {
+	header := c.GetHeader("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return nil
+	}
+
+	claims, err := auth.ParseJWT(strings.TrimSpace(header[7:]), []byte(h.cfg.JWTSigningKey))
+	if err != nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return nil
+	}
+	return h.revocations.RevokeToken(c.Request.Context(), userID, claims.ID, claims.ExpiresAt.Time)
+}
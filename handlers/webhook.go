@@ -1,32 +1,40 @@
 package handlers
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"mgsearch/models"
 	"mgsearch/repositories"
 	"mgsearch/services"
+	"mgsearch/workers"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type WebhookHandler struct {
-	shopify *services.ShopifyService
-	stores  *repositories.StoreRepository
-	meili   *services.MeilisearchService
+	shopify   *services.ShopifyService
+	stores    *repositories.StoreRepository
+	events    *repositories.WebhookEventRepository
+	processor *workers.WebhookProcessor
 }
 
-func NewWebhookHandler(shopify *services.ShopifyService, stores *repositories.StoreRepository, meili *services.MeilisearchService) *WebhookHandler {
+func NewWebhookHandler(shopify *services.ShopifyService, stores *repositories.StoreRepository, events *repositories.WebhookEventRepository, processor *workers.WebhookProcessor) *WebhookHandler {
 	return &WebhookHandler{
-		shopify: shopify,
-		stores:  stores,
-		meili:   meili,
+		shopify:   shopify,
+		stores:    stores,
+		events:    events,
+		processor: processor,
 	}
 }
 
+// HandleShopifyWebhook verifies and persists a delivery, then acknowledges it immediately.
+// Shopify expects a response within a few seconds, so indexing happens in the background
+// WebhookProcessor rather than on the request path.
 func (h *WebhookHandler) HandleShopifyWebhook(c *gin.Context) {
 	topic := c.Param("topic")
 	subtopic := c.Param("subtopic")
@@ -34,6 +42,8 @@ func (h *WebhookHandler) HandleShopifyWebhook(c *gin.Context) {
 
 	signature := c.GetHeader("X-Shopify-Hmac-Sha256")
 	shopDomain := c.GetHeader("X-Shopify-Shop-Domain")
+	webhookID := c.GetHeader("X-Shopify-Webhook-Id")
+	triggeredAt := c.GetHeader("X-Shopify-Triggered-At")
 
 	if signature == "" || shopDomain == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing required headers"})
@@ -57,62 +67,100 @@ func (h *WebhookHandler) HandleShopifyWebhook(c *gin.Context) {
 		return
 	}
 
-	indexUID := store.IndexUID()
-	if indexUID == "" {
+	if store.IndexUID() == "" {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "store index not configured"})
 		return
 	}
 
-	switch event {
-	case "products/create", "products/update":
-		if err := h.handleProductUpsert(store, indexUID, body); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update index", "details": err.Error()})
-			return
-		}
-	case "products/delete":
-		if err := h.handleProductDelete(store, indexUID, body); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete document", "details": err.Error()})
-			return
-		}
-	default:
+	if !workers.SupportsTopic(event) {
 		c.JSON(http.StatusOK, gin.H{"message": "event ignored"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "processed"})
-}
+	// Shopify keeps the webhook id stable across retries; deliveries without one cannot be
+	// deduplicated but are still persisted so they can be processed and replayed.
+	if webhookID == "" {
+		webhookID = primitive.NewObjectID().Hex()
+	}
 
-func (h *WebhookHandler) handleProductUpsert(store *models.Store, indexUID string, payload []byte) error {
-	var product map[string]interface{}
-	if err := json.Unmarshal(payload, &product); err != nil {
-		return err
+	delivery := &models.WebhookEvent{
+		ID:         webhookID,
+		ShopDomain: shopDomain,
+		Topic:      event,
+		Payload:    string(body),
+	}
+	// Deletes are versioned by the time Shopify sent them; without the header the receipt time is used
+	if parsed, err := time.Parse(time.RFC3339Nano, triggeredAt); err == nil {
+		parsed = parsed.UTC()
+		delivery.TriggeredAt = &parsed
 	}
 
-	if product["id"] == nil {
-		return fmt.Errorf("product id missing")
+	// Persist the raw delivery before acknowledging so nothing is lost if this replica dies
+	duplicate, err := h.events.RecordDelivery(c.Request.Context(), delivery)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record webhook delivery", "details": err.Error()})
+		return
+	}
+	if duplicate {
+		c.JSON(http.StatusOK, gin.H{"status": "duplicate"})
+		return
 	}
 
-	document := models.Document(product)
-	document["shop_domain"] = store.ShopDomain
-	document["store_id"] = store.ID.Hex()
-	document["document_type"] = store.DocumentType()
+	h.processor.Notify()
 
-	_, err := h.meili.IndexDocument(indexUID, document)
-	return err
+	c.JSON(http.StatusOK, gin.H{"status": "accepted", "webhook_id": webhookID})
 }
 
-func (h *WebhookHandler) handleProductDelete(store *models.Store, indexUID string, payload []byte) error {
-	var product struct {
-		ID interface{} `json:"id"`
+// ListWebhookEvents handles GET /api/admin/webhooks
+// Optional query parameters: shop, status, limit (default 50, max 500)
+func (h *WebhookHandler) ListWebhookEvents(c *gin.Context) {
+	limit := int64(50)
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		if parsed > 500 {
+			parsed = 500
+		}
+		limit = parsed
 	}
-	if err := json.Unmarshal(payload, &product); err != nil {
-		return err
+
+	events, err := h.events.List(c.Request.Context(), c.Query("shop"), c.Query("status"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list webhook events", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+// GetWebhookEvent handles GET /api/admin/webhooks/:id
+// Returns the retained delivery including its raw payload
+func (h *WebhookHandler) GetWebhookEvent(c *gin.Context) {
+	event, err := h.events.FindByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook event not found"})
+		return
 	}
 
-	if product.ID == nil {
-		return fmt.Errorf("product id missing")
+	c.JSON(http.StatusOK, event)
+}
+
+// ReplayWebhookEvent handles POST /api/admin/webhooks/:id/replay
+// Queues a retained delivery for processing again
+func (h *WebhookHandler) ReplayWebhookEvent(c *gin.Context) {
+	if err := h.events.Replay(c.Request.Context(), c.Param("id")); err != nil {
+		if err.Error() == "webhook event not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "webhook event not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to replay webhook event", "details": err.Error()})
+		return
 	}
 
-	idStr := fmt.Sprintf("%v", product.ID)
-	return h.meili.DeleteDocument(indexUID, idStr)
+	h.processor.Notify()
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "queued", "webhook_id": c.Param("id")})
 }
@@ -16,6 +16,7 @@ import (
 	"mgsearch/repositories"
 	"mgsearch/services"
 	"mgsearch/testhelpers"
+	"mgsearch/workers"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -23,7 +24,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func setupWebhookTest(t *testing.T) (*gin.Engine, *repositories.StoreRepository, string, func()) {
+func setupWebhookTest(t *testing.T) (*gin.Engine, *workers.WebhookProcessor, *repositories.WebhookEventRepository, string, func()) {
 	ctx := context.Background()
 	cfg := testhelpers.TestConfig()
 
@@ -32,6 +33,8 @@ func setupWebhookTest(t *testing.T) (*gin.Engine, *repositories.StoreRepository,
 
 	storeRepo, _ := testhelpers.SetupTestRepositories(db)
 	meiliService := services.NewMeilisearchService(cfg)
+	meiliRegistry, err := services.NewMeilisearchRegistry(cfg, testhelpers.TestKeyProvider(cfg), meiliService)
+	require.NoError(t, err)
 	shopifyService := services.NewShopifyService(cfg)
 
 	// Create a test store
@@ -59,11 +62,14 @@ func setupWebhookTest(t *testing.T) (*gin.Engine, *repositories.StoreRepository,
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	webhookHandler := NewWebhookHandler(shopifyService, storeRepo, meiliService)
+	eventRepo := repositories.NewWebhookEventRepository(db)
+	processor, err := workers.NewWebhookProcessor(cfg, testhelpers.TestKeyProvider(cfg), eventRepo, storeRepo, repositories.NewDocumentVersionRepository(db), repositories.NewShopifyCollectionRepository(db), repositories.NewInventoryRepository(db), shopifyService, meiliRegistry, services.NewPlanLimits(repositories.NewUsageRepository(db)))
+	require.NoError(t, err)
+	webhookHandler := NewWebhookHandler(shopifyService, storeRepo, eventRepo, processor)
 
 	router.POST("/webhooks/shopify/:topic/:subtopic", webhookHandler.HandleShopifyWebhook)
 
-	return router, storeRepo, cfg.WebhookSharedSecret, func() {
+	return router, processor, eventRepo, cfg.WebhookSharedSecret, func() {
 		testhelpers.CleanupTestDatabase(ctx, db)
 		cleanup()
 	}
@@ -77,7 +83,7 @@ func calculateHMAC(secret, body string) string {
 }
 
 func TestWebhookHandler_HandleShopifyWebhook(t *testing.T) {
-	router, _, secret, cleanup := setupWebhookTest(t)
+	router, _, _, secret, cleanup := setupWebhookTest(t)
 	defer cleanup()
 
 	productPayload := map[string]interface{}{
@@ -111,7 +117,7 @@ func TestWebhookHandler_HandleShopifyWebhook(t *testing.T) {
 				var result map[string]interface{}
 				err := json.Unmarshal(resp.Body.Bytes(), &result)
 				require.NoError(t, err)
-				assert.Equal(t, "processed", result["status"])
+				assert.Equal(t, "accepted", result["status"])
 			},
 		},
 		{
@@ -184,13 +190,13 @@ func TestWebhookHandler_HandleShopifyWebhook(t *testing.T) {
 			expectedStatus: http.StatusNotFound,
 		},
 		{
-			name:           "product without ID",
+			name:           "product without ID is acknowledged and fails in the background",
 			topic:          "products",
 			subtopic:       "create",
 			body:           []byte(`{"title": "Product without ID"}`),
 			signature:      calculateHMAC(secret, `{"title": "Product without ID"}`),
 			shopDomain:     "webhook-test.myshopify.com",
-			expectedStatus: http.StatusInternalServerError,
+			expectedStatus: http.StatusOK,
 		},
 	}
 
@@ -217,3 +223,85 @@ func TestWebhookHandler_HandleShopifyWebhook(t *testing.T) {
 	}
 }
 
+func TestWebhookHandler_Idempotency(t *testing.T) {
+	router, processor, eventRepo, secret, cleanup := setupWebhookTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	send := func(subtopic, webhookID string, payload map[string]interface{}) map[string]interface{} {
+		bodyBytes, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", "/webhooks/shopify/products/"+subtopic, bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Shopify-Hmac-Sha256", calculateHMAC(secret, string(bodyBytes)))
+		req.Header.Set("X-Shopify-Shop-Domain", "webhook-test.myshopify.com")
+		req.Header.Set("X-Shopify-Webhook-Id", webhookID)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return result
+	}
+
+	// process drains the queue synchronously and returns the final status of the delivery
+	process := func(webhookID string) string {
+		for {
+			processed, err := processor.ProcessNext(ctx)
+			require.NoError(t, err)
+			if !processed {
+				break
+			}
+		}
+		event, err := eventRepo.FindByID(ctx, webhookID)
+		require.NoError(t, err)
+		return event.Status
+	}
+
+	newer := map[string]interface{}{"id": 777, "title": "Newer", "updated_at": "2024-05-02T10:00:00Z"}
+	older := map[string]interface{}{"id": 777, "title": "Older", "updated_at": "2024-05-01T10:00:00Z"}
+
+	t.Run("retried delivery is persisted once", func(t *testing.T) {
+		assert.Equal(t, "accepted", send("update", "delivery-1", newer)["status"])
+		assert.Equal(t, "duplicate", send("update", "delivery-1", newer)["status"])
+		assert.Equal(t, models.WebhookStatusProcessed, process("delivery-1"))
+	})
+
+	t.Run("older update cannot overwrite newer one", func(t *testing.T) {
+		send("update", "delivery-2", older)
+		assert.Equal(t, models.WebhookStatusStale, process("delivery-2"))
+	})
+
+	t.Run("update delivered after delete is ignored", func(t *testing.T) {
+		send("delete", "delivery-3", map[string]interface{}{"id": 777})
+		assert.Equal(t, models.WebhookStatusProcessed, process("delivery-3"))
+		send("update", "delivery-4", newer)
+		assert.Equal(t, models.WebhookStatusStale, process("delivery-4"))
+	})
+
+	t.Run("trigger time is recorded", func(t *testing.T) {
+		bodyBytes, _ := json.Marshal(map[string]interface{}{"id": 778})
+		req := httptest.NewRequest("POST", "/webhooks/shopify/products/delete", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("X-Shopify-Hmac-Sha256", calculateHMAC(secret, string(bodyBytes)))
+		req.Header.Set("X-Shopify-Shop-Domain", "webhook-test.myshopify.com")
+		req.Header.Set("X-Shopify-Webhook-Id", "delivery-5")
+		req.Header.Set("X-Shopify-Triggered-At", "2024-05-03T10:00:00.123456789Z")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		event, err := eventRepo.FindByID(ctx, "delivery-5")
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2024, 5, 3, 10, 0, 0, 123000000, time.UTC), event.DeliveredAt())
+	})
+
+		t.Run("retained delivery can be replayed", func(t *testing.T) {
+		require.NoError(t, eventRepo.Replay(ctx, "delivery-1"))
+		event, err := eventRepo.FindByID(ctx, "delivery-1")
+		require.NoError(t, err)
+		assert.Equal(t, models.WebhookStatusPending, event.Status)
+		assert.NotEmpty(t, event.Payload)
+	})
+}
@@ -11,8 +11,10 @@ import (
 	"mgsearch/handlers"
 	"mgsearch/middleware"
 	"mgsearch/pkg/database"
+	"mgsearch/pkg/security"
 	"mgsearch/repositories"
 	"mgsearch/services"
+	"mgsearch/workers"
 
 	"github.com/gin-gonic/gin"
 )
@@ -62,34 +64,124 @@ func main() {
 	sessionRepo := repositories.NewSessionRepository(db)
 	userRepo := repositories.NewUserRepository(db)
 	clientRepo := repositories.NewClientRepository(db)
+	refreshTokenRepo := repositories.NewRefreshTokenRepository(db)
+	revokedTokenRepo := repositories.NewRevokedTokenRepository(db)
+	passwordResetRepo := repositories.NewPasswordResetRepository(db)
+	emailVerificationRepo := repositories.NewEmailVerificationRepository(db)
+	clientInviteRepo := repositories.NewClientInviteRepository(db)
+	loginAttemptRepo := repositories.NewLoginAttemptRepository(db)
+	securityEventRepo := repositories.NewSecurityEventRepository(db)
 	indexRepo := repositories.NewIndexRepository(db)
+	webhookEventRepo := repositories.NewWebhookEventRepository(db)
+	documentVersionRepo := repositories.NewDocumentVersionRepository(db)
+	shopifyCollectionRepo := repositories.NewShopifyCollectionRepository(db)
+	inventoryRepo := repositories.NewInventoryRepository(db)
+	usageRepo := repositories.NewUsageRepository(db)
+	keyProvider, err := security.NewKeyProvider(cfg, repositories.NewDataKeyRepository(db))
+	if err != nil {
+		log.Fatalf("failed to initialize encryption keys: %v", err)
+	}
 	meiliService := services.NewMeilisearchService(cfg)
 	shopifyService := services.NewShopifyService(cfg)
+	meiliRegistry, err := services.NewMeilisearchRegistry(cfg, keyProvider, meiliService)
+	if err != nil {
+		log.Fatalf("failed to initialize meilisearch registry: %v", err)
+	}
+	planLimits := services.NewPlanLimits(usageRepo)
 
-	authHandler, err := handlers.NewAuthHandler(cfg, shopifyService, storeRepo, meiliService)
+	authHandler, err := handlers.NewAuthHandler(cfg, keyProvider, shopifyService, storeRepo, sessionRepo, meiliRegistry)
 	if err != nil {
 		log.Fatalf("failed to initialize auth handler: %v", err)
 	}
 	storeHandler := handlers.NewStoreHandler(storeRepo)
-	sessionHandler, err := handlers.NewSessionHandler(sessionRepo, storeRepo, meiliService, cfg)
+	storefrontKeyHandler := handlers.NewStorefrontKeyHandler(cfg, storeRepo)
+	reencryptor, err := workers.NewReencryptor(keyProvider, storeRepo, sessionRepo)
+	if err != nil {
+		log.Fatalf("failed to initialize re-encryptor: %v", err)
+	}
+	encryptionHandler := handlers.NewEncryptionHandler(reencryptor)
+	contentSyncer, err := workers.NewContentSyncer(keyProvider, documentVersionRepo, shopifyService, meiliRegistry, planLimits)
+	if err != nil {
+		log.Fatalf("failed to initialize content syncer: %v", err)
+	}
+	localizationSyncer, err := workers.NewLocalizationSyncer(keyProvider, shopifyService, meiliRegistry)
+	if err != nil {
+		log.Fatalf("failed to initialize localization syncer: %v", err)
+	}
+	storeIndexingHandler := handlers.NewStoreIndexingHandler(storeRepo, meiliRegistry, contentSyncer, localizationSyncer)
+	sessionHandler, err := handlers.NewSessionHandler(sessionRepo, storeRepo, meiliRegistry, cfg, keyProvider)
 	if err != nil {
 		log.Fatalf("failed to initialize session handler: %v", err)
 	}
-	webhookHandler := handlers.NewWebhookHandler(shopifyService, storeRepo, meiliService)
-	searchHandler := handlers.NewSearchHandler(meiliService, clientRepo)
-	settingsHandler := handlers.NewSettingsHandler(meiliService, clientRepo)
-	tasksHandler := handlers.NewTasksHandler(meiliService)
+	webhookProcessor, err := workers.NewWebhookProcessor(cfg, keyProvider, webhookEventRepo, storeRepo, documentVersionRepo, shopifyCollectionRepo, inventoryRepo, shopifyService, meiliRegistry, planLimits)
+	if err != nil {
+		log.Fatalf("failed to initialize webhook processor: %v", err)
+	}
+	webhookProcessor.Start(context.Background(), cfg.WebhookWorkers)
+	webhookHandler := handlers.NewWebhookHandler(shopifyService, storeRepo, webhookEventRepo, webhookProcessor)
+	appProxyHandler := handlers.NewAppProxyHandler(shopifyService, storeRepo, planLimits, meiliRegistry)
+	billingHandler, err := handlers.NewBillingHandler(cfg, keyProvider, shopifyService, storeRepo, usageRepo, meiliRegistry)
+	if err != nil {
+		log.Fatalf("failed to initialize billing handler: %v", err)
+	}
+	clientIndexResolver := handlers.NewClientIndexResolver(indexRepo, storeRepo, meiliRegistry, meiliService)
+	searchHandler := handlers.NewSearchHandler(meiliService, clientRepo, clientIndexResolver, planLimits)
+	settingsHandler := handlers.NewSettingsHandler(meiliService, clientRepo, clientIndexResolver)
+	tasksHandler := handlers.NewTasksHandler(meiliService, clientIndexResolver)
+	storeLinkHandler := handlers.NewStoreLinkHandler(cfg, storeRepo, clientRepo, indexRepo)
 	indexHandler := handlers.NewIndexHandler(clientRepo, indexRepo, meiliService)
 
 	// User auth handlers and middleware
-	userAuthHandler := handlers.NewUserAuthHandler(cfg, userRepo, clientRepo)
-	jwtMiddleware := middleware.NewJWTMiddleware(cfg.JWTSigningKey)
+	mailer, err := services.NewMailer(cfg)
+	if err != nil {
+		log.Fatalf("failed to initialize mailer: %v", err)
+	}
+	tokenRevocations := services.NewTokenRevocationService(userRepo, revokedTokenRepo, cfg.TokenCacheTTL)
+	loginThrottle := services.NewLoginThrottle(loginAttemptRepo, services.LoginPolicy{
+		MaxFailures:   cfg.LoginMaxFailures,
+		MaxIPFailures: cfg.LoginMaxIPFailures,
+		Window:        cfg.LoginFailureWindow,
+		Lockout:       cfg.LoginLockout,
+	})
+	// Single sign-on stays disabled without a provider
+	var oidcProvider *services.OIDCProvider
+	if cfg.OIDCIssuerURL != "" {
+		oidcProvider = services.NewOIDCProvider(cfg)
+	}
+	userAuthHandler := handlers.NewUserAuthHandler(cfg, handlers.UserAuthDeps{
+		Users:          userRepo,
+		Clients:        clientRepo,
+		RefreshTokens:  refreshTokenRepo,
+		Revocations:    tokenRevocations,
+		ResetTokens:    passwordResetRepo,
+		Verifications:  emailVerificationRepo,
+		Invites:        clientInviteRepo,
+		LoginThrottle:  loginThrottle,
+		SecurityEvents: securityEventRepo,
+		MFAChallenges:  repositories.NewMFAChallengeRepository(db),
+		Keys:           keyProvider,
+		SSOLogins:      repositories.NewSSOLoginRepository(db),
+		OIDC:           oidcProvider,
+		Mailer:         mailer,
+	})
+	jwtMiddleware := middleware.NewJWTMiddleware(cfg.JWTSigningKey, tokenRevocations)
 	apiKeyMiddleware := middleware.NewAPIKeyMiddleware(clientRepo)
 
 	// Legacy middleware
 	authMiddleware := middleware.NewAuthMiddleware(cfg.JWTSigningKey)
+	// Embedded admin requests (App Bridge session tokens), falling back to legacy store sessions
+	shopifySessionMiddleware := middleware.NewShopifySessionMiddleware(cfg.ShopifyAPIKey, cfg.ShopifyAPISecret, storeRepo, authMiddleware)
+	scopeMiddleware, err := middleware.NewScopeMiddleware(cfg, keyProvider, storeRepo, shopifyService)
+	if err != nil {
+		log.Fatalf("failed to initialize scope middleware: %v", err)
+	}
 
 	router := gin.Default()
+	// Client IPs drive login lockouts and audit records, so X-Forwarded-For is only honoured from
+	// configured proxies
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// Add CORS middleware for storefront requests
 	router.Use(middleware.CORSMiddleware())
@@ -109,12 +201,24 @@ func main() {
 			shopifyGroup.GET("/callback", authHandler.Callback)
 			shopifyGroup.POST("/exchange", authHandler.ExchangeToken)
 			shopifyGroup.POST("/install", authHandler.InstallStore)
+			shopifyGroup.POST("/token-exchange", authHandler.TokenExchange)
 		}
 
+		// Shopify redirects here after the merchant approves or declines a charge
+		api.GET("/billing/callback", billingHandler.Callback)
+
 		storeGroup := api.Group("/stores")
-		storeGroup.Use(authMiddleware.RequireStoreSession())
+		storeGroup.Use(shopifySessionMiddleware.RequireStoreSession(), scopeMiddleware.FlagMissingScopes())
 		{
 			storeGroup.GET("/current", storeHandler.GetCurrentStore)
+			storeGroup.GET("/current/reauthorize", authHandler.Reauthorize)
+			storeGroup.POST("/current/link-token", storeLinkHandler.CreateLinkToken)
+			storeGroup.POST("/current/storefront-key/rotate", storefrontKeyHandler.RotateKey)
+			storeGroup.GET("/current/indexing", storeIndexingHandler.GetIndexing)
+			storeGroup.PUT("/current/indexing", storeIndexingHandler.UpdateIndexing)
+			storeGroup.POST("/current/content/sync", storeIndexingHandler.SyncContent)
+			storeGroup.GET("/current/billing", billingHandler.GetBilling)
+			storeGroup.POST("/current/billing/subscribe", billingHandler.Subscribe)
 			storeGroup.GET("/sync-status", storeHandler.GetSyncStatus)
 		}
 
@@ -128,6 +232,18 @@ func main() {
 			sessionGroup.GET("/shop/:shop", sessionHandler.FindSessionsByShop)
 		}
 
+		// Operator endpoints (ADMIN_API_KEY)
+		adminGroup := api.Group("/admin")
+		adminGroup.Use(middleware.RequireAdminAPIKey(cfg.AdminAPIKey))
+		{
+			adminGroup.GET("/webhooks", webhookHandler.ListWebhookEvents)
+			adminGroup.GET("/webhooks/:id", webhookHandler.GetWebhookEvent)
+			adminGroup.POST("/webhooks/:id/replay", webhookHandler.ReplayWebhookEvent)
+			adminGroup.POST("/encryption/reencrypt", encryptionHandler.Reencrypt)
+			adminGroup.POST("/users/:user_id/deactivate", userAuthHandler.DeactivateUser)
+			adminGroup.GET("/security-events", userAuthHandler.ListSecurityEvents)
+		}
+
 		// Dev Proxy Routes
 		devGroup := api.Group("/dev")
 		{
@@ -142,6 +258,15 @@ func main() {
 
 	router.POST("/webhooks/shopify/:topic/:subtopic", webhookHandler.HandleShopifyWebhook)
 
+	// Shopify App Proxy (storefront requests signed by Shopify)
+	appProxyGroup := router.Group("/apps/mgsearch")
+	{
+		appProxyGroup.GET("/search", appProxyHandler.Search)
+		appProxyGroup.GET("/search/all", appProxyHandler.GroupedSearch)
+		appProxyGroup.GET("/suggestions", appProxyHandler.Suggestions)
+		appProxyGroup.GET("/products/:id/similar", appProxyHandler.SimilarProducts)
+	}
+
 	v1 := router.Group("/api/v1")
 	{
 		// Public auth endpoints
@@ -150,6 +275,24 @@ func main() {
 			authGroup.POST("/register/user", userAuthHandler.RegisterUser)
 			authGroup.POST("/register/client", jwtMiddleware.RequireAuth(), userAuthHandler.RegisterClient)
 			authGroup.POST("/login", userAuthHandler.Login)
+			authGroup.POST("/login/unlock", userAuthHandler.UnlockAccount)
+			authGroup.POST("/login/mfa", userAuthHandler.LoginMFA)
+			authGroup.POST("/sso/start", userAuthHandler.StartSSO)
+			authGroup.POST("/sso/callback", userAuthHandler.SSOCallback)
+			authGroup.POST("/refresh", userAuthHandler.Refresh)
+			authGroup.POST("/logout", userAuthHandler.Logout)
+			authGroup.POST("/logout-all", jwtMiddleware.RequireAuth(), userAuthHandler.LogoutAll)
+			authGroup.POST("/password/change", jwtMiddleware.RequireAuth(), userAuthHandler.ChangePassword)
+			authGroup.POST("/password/forgot", userAuthHandler.ForgotPassword)
+			authGroup.POST("/password/reset", userAuthHandler.ResetPassword)
+			authGroup.POST("/email/verify", userAuthHandler.VerifyEmail)
+			authGroup.POST("/email/resend", jwtMiddleware.RequireAuth(), userAuthHandler.ResendVerification)
+			authGroup.POST("/mfa/enroll", jwtMiddleware.RequireAuth(), userAuthHandler.EnrollMFA)
+			authGroup.POST("/mfa/confirm", jwtMiddleware.RequireAuth(), userAuthHandler.ConfirmMFA)
+			authGroup.POST("/mfa/disable", jwtMiddleware.RequireAuth(), userAuthHandler.DisableMFA)
+			authGroup.POST("/mfa/recovery-codes", jwtMiddleware.RequireAuth(), userAuthHandler.RegenerateRecoveryCodes)
+			authGroup.POST("/invites/accept", jwtMiddleware.RequireAuth(), userAuthHandler.AcceptInvite)
+			authGroup.POST("/invites/register", userAuthHandler.RegisterWithInvite)
 			authGroup.GET("/me", jwtMiddleware.RequireAuth(), userAuthHandler.GetCurrentUser)
 			authGroup.PUT("/user", jwtMiddleware.RequireAuth(), userAuthHandler.UpdateUser)
 		}
@@ -163,6 +306,20 @@ func main() {
 			clientsGroup.GET("", userAuthHandler.GetUserClients)
 			clientsGroup.GET("/:client_id", userAuthHandler.GetClientDetails)
 
+			// Members and roles
+			clientsGroup.GET("/:client_id/members", userAuthHandler.ListMembers)
+			clientsGroup.PUT("/:client_id/members/:user_id", userAuthHandler.UpdateMemberRole)
+			clientsGroup.DELETE("/:client_id/members/:user_id", userAuthHandler.RemoveMember)
+			clientsGroup.POST("/:client_id/leave", userAuthHandler.LeaveClient)
+
+			// Security settings
+			clientsGroup.PUT("/:client_id/security", userAuthHandler.UpdateClientSecurity)
+
+			// Invitations
+			clientsGroup.POST("/:client_id/invites", userAuthHandler.CreateInvite)
+			clientsGroup.GET("/:client_id/invites", userAuthHandler.ListInvites)
+			clientsGroup.DELETE("/:client_id/invites/:invite_id", userAuthHandler.RevokeInvite)
+
 			// API key management
 			clientsGroup.POST("/:client_id/api-keys", userAuthHandler.GenerateAPIKey)
 			clientsGroup.DELETE("/:client_id/api-keys/:key_id", userAuthHandler.RevokeAPIKey)
@@ -171,6 +328,11 @@ func main() {
 			clientsGroup.POST("/:client_id/indexes", indexHandler.CreateIndex)
 			clientsGroup.GET("/:client_id/indexes", indexHandler.GetClientIndexes)
 
+			// Linked Shopify stores
+			clientsGroup.POST("/:client_id/stores", storeLinkHandler.LinkStore)
+			clientsGroup.GET("/:client_id/stores", storeLinkHandler.ListStores)
+			clientsGroup.DELETE("/:client_id/stores/:store_id", storeLinkHandler.UnlinkStore)
+
 			// Index operations (JWT access for dashboard)
 			clientsGroup.POST("/:client_id/indexes/:index_name/documents", searchHandler.IndexDocument)
 			clientsGroup.PATCH("/:client_id/indexes/:index_name/settings", settingsHandler.UpdateSettings)
@@ -188,6 +350,12 @@ func main() {
 
 		// Tasks endpoint (API key authentication required)
 		v1.GET("/clients/:client_id/tasks/:task_id", apiKeyMiddleware.RequireAPIKey(), tasksHandler.GetTask)
+
+		// Storefront search (store's public key in the X-Storefront-Key header)
+		v1.GET("/search", appProxyHandler.Search)
+		v1.GET("/search/all", appProxyHandler.GroupedSearch)
+		v1.GET("/suggestions", appProxyHandler.Suggestions)
+		v1.GET("/products/:id/similar", appProxyHandler.SimilarProducts)
 	}
 
 	addr := ":" + cfg.ServerPort
@@ -213,7 +381,16 @@ func validateConfig(cfg *config.Config) {
 	if cfg.JWTSigningKey == "" {
 		log.Fatal("JWT_SIGNING_KEY is required")
 	}
-	if cfg.EncryptionKey == "" {
+	if cfg.EncryptionKey == "" && cfg.EncryptionKeys == "" && cfg.EncryptionKeyFile == "" {
 		log.Fatal("ENCRYPTION_KEY is required (32-byte hex string)")
 	}
+	if cfg.RequireEmailVerify && cfg.EmailVerifyURL == "" {
+		log.Fatal("EMAIL_VERIFICATION_URL is required when REQUIRE_EMAIL_VERIFICATION is enabled")
+	}
+	if cfg.LoginMaxFailures <= 0 {
+		log.Fatal("LOGIN_MAX_FAILURES must be positive")
+	}
+	if cfg.OIDCIssuerURL != "" && (cfg.OIDCClientID == "" || cfg.OIDCRedirectURL == "") {
+		log.Fatal("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ISSUER_URL is set")
+	}
 }
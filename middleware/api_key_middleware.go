@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"net/http"
 	"strings"
 
@@ -40,3 +41,36 @@ func OptionalAPIKeyMiddleware(apiKey string) gin.HandlerFunc {
 	}
 }
 
+// RequireAdminAPIKey protects operator endpoints with the ADMIN_API_KEY bearer token.
+// Unlike OptionalAPIKeyMiddleware, requests are rejected when no key is configured.
+func RequireAdminAPIKey(apiKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if apiKey == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "admin endpoints are disabled",
+				"code":  "FORBIDDEN",
+			})
+			return
+		}
+
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" || !strings.HasPrefix(strings.ToLower(authHeader), "bearer ") {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid or missing authentication token",
+				"code":  "UNAUTHORIZED",
+			})
+			return
+		}
+
+		token := strings.TrimSpace(authHeader[7:])
+		if subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid or missing authentication token",
+				"code":  "UNAUTHORIZED",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
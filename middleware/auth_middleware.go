@@ -53,3 +53,12 @@ func GetStoreID(c *gin.Context) (string, bool) {
 	storeID, ok := value.(string)
 	return storeID, ok
 }
+
+func GetShopDomain(c *gin.Context) (string, bool) {
+	value, ok := c.Get(contextShopKey)
+	if !ok {
+		return "", false
+	}
+	shop, ok := value.(string)
+	return shop, ok
+}
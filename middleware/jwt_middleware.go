@@ -1,9 +1,13 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strings"
 
+	"mgsearch/services"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 )
@@ -12,23 +16,38 @@ const (
 	ContextUserIDKey   = "user_id"
 	ContextUserEmail   = "user_email"
 	ContextClientIDKey = "client_id"
+	ContextMFAKey      = "mfa"
+	ContextSSOKey      = "sso"
 )
 
 // JWTClaims represents the JWT token claims
 type JWTClaims struct {
-	UserID   string `json:"user_id"`
-	Email    string `json:"email"`
-	ClientID string `json:"client_id,omitempty"`
+	UserID       string `json:"user_id"`
+	Email        string `json:"email"`
+	ClientID     string `json:"client_id,omitempty"`
+	TokenVersion int    `json:"tv,omitempty"`
+	MFA          bool   `json:"mfa,omitempty"`
+	SSO          bool   `json:"sso,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// TokenChecker rejects user tokens that were revoked before they expired. It is implemented by
+// services.TokenRevocationService.
+type TokenChecker interface {
+	CheckToken(ctx context.Context, userID string, tokenVersion int, tokenID string) error
+}
+
 type JWTMiddleware struct {
 	signingKey []byte
+	tokens     TokenChecker
 }
 
-func NewJWTMiddleware(signingKey string) *JWTMiddleware {
+// NewJWTMiddleware creates the middleware for user tokens. tokens may be nil, in which case any
+// unexpired token is accepted.
+func NewJWTMiddleware(signingKey string, tokens TokenChecker) *JWTMiddleware {
 	return &JWTMiddleware{
 		signingKey: []byte(signingKey),
+		tokens:     tokens,
 	}
 }
 
@@ -62,9 +81,28 @@ func (m *JWTMiddleware) RequireAuth() gin.HandlerFunc {
 			return
 		}
 
+		if m.tokens != nil {
+			if err := m.tokens.CheckToken(c.Request.Context(), claims.UserID, claims.TokenVersion, claims.ID); err != nil {
+				if errors.Is(err, services.ErrTokenRevoked) {
+					c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+						"error": "token has been revoked",
+						"code":  "UNAUTHORIZED",
+					})
+					return
+				}
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+					"error":   "failed to verify token",
+					"details": err.Error(),
+				})
+				return
+			}
+		}
+
 		// Set user information in context
 		c.Set(ContextUserIDKey, claims.UserID)
 		c.Set(ContextUserEmail, claims.Email)
+		c.Set(ContextMFAKey, claims.MFA)
+		c.Set(ContextSSOKey, claims.SSO)
 		if claims.ClientID != "" {
 			c.Set(ContextClientIDKey, claims.ClientID)
 		}
@@ -102,3 +140,23 @@ func GetClientID(c *gin.Context) (string, bool) {
 	clientID, ok := value.(string)
 	return clientID, ok
 }
+
+// HasMFA reports whether the user's session was started with two-factor authentication
+func HasMFA(c *gin.Context) bool {
+	value, ok := c.Get(ContextMFAKey)
+	if !ok {
+		return false
+	}
+	mfa, ok := value.(bool)
+	return ok && mfa
+}
+
+// HasSSO reports whether the user's session was started with single sign-on
+func HasSSO(c *gin.Context) bool {
+	value, ok := c.Get(ContextSSOKey)
+	if !ok {
+		return false
+	}
+	sso, ok := value.(bool)
+	return ok && sso
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"mgsearch/config"
+	"mgsearch/pkg/security"
+	"mgsearch/repositories"
+	"mgsearch/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const contextMissingScopesKey = "missing_scopes"
+
+// scopeLookupRetryDelay is how long a shop whose scopes could not be fetched is left alone before
+// Shopify is asked again, so a failing lookup does not cost an Admin API call per request.
+const scopeLookupRetryDelay = 5 * time.Minute
+
+// ScopeMiddleware compares the scopes granted to a store's access token with the scopes the app
+// currently requests, so stores installed by an older release can be asked to re-authorize.
+type ScopeMiddleware struct {
+	stores  *repositories.StoreRepository
+	shopify *services.ShopifyService
+	keys    security.KeyProvider
+
+	mu      sync.Mutex
+	fetched map[string]scopeLookup
+}
+
+// scopeLookup is the outcome of asking Shopify for a shop's scopes: the granted scopes, or after a
+// failure the time from which the lookup may be retried.
+type scopeLookup struct {
+	granted []string
+	retryAt time.Time
+}
+
+func NewScopeMiddleware(cfg *config.Config, keys security.KeyProvider, stores *repositories.StoreRepository, shopify *services.ShopifyService) (*ScopeMiddleware, error) {
+	if keys == nil {
+		return nil, errors.New("key provider is required")
+	}
+
+	return &ScopeMiddleware{
+		stores:  stores,
+		shopify: shopify,
+		keys:    keys,
+		fetched: map[string]scopeLookup{},
+	}, nil
+}
+
+// FlagMissingScopes runs after a store session middleware. Requests are never rejected; stores
+// missing required scopes get an X-Missing-Scopes response header and the list in the context.
+func (m *ScopeMiddleware) FlagMissingScopes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		storeID, ok := GetStoreID(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		// App Bridge sessions come with the store loaded; legacy sessions only carry its ID
+		store, ok := GetStore(c)
+		if !ok {
+			var err error
+			store, err = m.stores.GetByID(c.Request.Context(), storeID)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "store not found", "details": err.Error()})
+				return
+			}
+		}
+
+		granted := store.GrantedScopes
+		if len(granted) == 0 {
+			// Stores installed before scopes were recorded: ask Shopify once and remember the answer
+			granted, ok = m.lookupGrantedScopes(c, storeID, store.ShopDomain, store.EncryptedAccessToken)
+			if !ok {
+				c.Next()
+				return
+			}
+		}
+
+		missing := services.MissingScopes(granted, m.shopify.RequiredScopes())
+		if len(missing) > 0 {
+			c.Header("X-Missing-Scopes", strings.Join(missing, ","))
+			c.Set(contextMissingScopesKey, missing)
+		}
+		c.Next()
+	}
+}
+
+// lookupGrantedScopes returns the scopes fetched from Shopify for a store that has none recorded.
+// Fetched scopes are stored on the store and kept per shop, so they are requested once even when
+// the write fails; failed lookups are retried after scopeLookupRetryDelay. ok is false while the
+// scopes are unknown.
+func (m *ScopeMiddleware) lookupGrantedScopes(c *gin.Context, storeID, shop string, encryptedToken []byte) ([]string, bool) {
+	m.mu.Lock()
+	lookup, found := m.fetched[shop]
+	m.mu.Unlock()
+	if found {
+		if lookup.granted != nil {
+			return lookup.granted, true
+		}
+		if time.Now().Before(lookup.retryAt) {
+			return nil, false
+		}
+	}
+
+	granted, err := m.fetchGrantedScopes(c, shop, encryptedToken)
+	if err != nil {
+		log.Printf("scope check: failed to fetch scopes for %s: %v", shop, err)
+		m.remember(shop, scopeLookup{retryAt: time.Now().Add(scopeLookupRetryDelay)})
+		return nil, false
+	}
+	if granted == nil {
+		granted = []string{}
+	}
+	m.remember(shop, scopeLookup{granted: granted})
+
+	if err := m.stores.UpdateGrantedScopes(c.Request.Context(), storeID, granted); err != nil {
+		log.Printf("scope check: failed to persist scopes for %s: %v", shop, err)
+	}
+	return granted, true
+}
+
+func (m *ScopeMiddleware) remember(shop string, lookup scopeLookup) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fetched[shop] = lookup
+}
+
+func (m *ScopeMiddleware) fetchGrantedScopes(c *gin.Context, shop string, encryptedToken []byte) ([]string, error) {
+	token, err := m.keys.Decrypt(c.Request.Context(), shop, encryptedToken)
+	if err != nil {
+		return nil, err
+	}
+	return m.shopify.ListAccessScopes(c.Request.Context(), shop, string(token))
+}
+
+// GetMissingScopes returns the required scopes the current store has not granted.
+func GetMissingScopes(c *gin.Context) []string {
+	value, ok := c.Get(contextMissingScopesKey)
+	if !ok {
+		return []string{}
+	}
+	missing, _ := value.([]string)
+	return missing
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mgsearch/models"
+	"mgsearch/repositories"
+	"mgsearch/services"
+	"mgsearch/testhelpers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopeMiddleware_FlagMissingScopes(t *testing.T) {
+	ctx := context.Background()
+	cfg := testhelpers.TestConfig()
+	cfg.ShopifyScopes = "read_products,read_content"
+
+	_, db, cleanup, err := testhelpers.SetupTestDatabase(ctx, cfg)
+	require.NoError(t, err)
+	defer cleanup()
+
+	// Fake Admin API; the access token tells the shops apart, revoked tokens are rejected
+	calls := map[string]int{}
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Shopify-Access-Token")
+		calls[token]++
+		if token == "shpat_revoked" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_scopes": []map[string]string{{"handle": "read_products"}},
+		})
+	}))
+	defer admin.Close()
+	shopify := services.NewShopifyService(cfg)
+	shopify.SetBaseURL(admin.URL)
+
+	keys := testhelpers.TestKeyProvider(cfg)
+	stores := repositories.NewStoreRepository(db)
+	newStore := func(shop, accessToken string) *models.Store {
+		encrypted, err := keys.Encrypt(ctx, shop, []byte(accessToken))
+		require.NoError(t, err)
+		store, err := stores.CreateOrUpdate(ctx, &models.Store{
+			ShopDomain:           shop,
+			ShopName:             shop,
+			EncryptedAccessToken: encrypted,
+			APIKeyPrivate:        "private-" + shop,
+			ProductIndexUID:      "products",
+			WebhookSecret:        "secret",
+			InstalledAt:          time.Now().UTC(),
+		})
+		require.NoError(t, err)
+		return store
+	}
+	legacy := newStore("legacy-scopes.myshopify.com", "shpat_legacy")
+	revoked := newStore("revoked-scopes.myshopify.com", "shpat_revoked")
+
+	scopes, err := NewScopeMiddleware(cfg, keys, stores, shopify)
+	require.NoError(t, err)
+	sessions := NewShopifySessionMiddleware(cfg.ShopifyAPIKey, cfg.ShopifyAPISecret, stores, NewAuthMiddleware(cfg.JWTSigningKey))
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/store", sessions.RequireStoreSession(), scopes.FlagMissingScopes(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"missing": GetMissingScopes(c)})
+	})
+
+	request := func(shop string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/store", nil)
+		req.Header.Set("Authorization", "Bearer "+testhelpers.ShopifySessionToken(cfg, shop))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("scopes are fetched once and recorded", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			w := request(legacy.ShopDomain)
+			require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+			assert.Equal(t, "read_content", w.Header().Get("X-Missing-Scopes"))
+		}
+		assert.Equal(t, 1, calls["shpat_legacy"])
+
+		store, err := stores.GetByShopDomain(ctx, legacy.ShopDomain)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"read_products"}, store.GrantedScopes)
+	})
+
+	t.Run("failed lookups are not retried on every request", func(t *testing.T) {
+		w := request(revoked.ShopDomain)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-Missing-Scopes"))
+		attempted := calls["shpat_revoked"]
+		require.NotZero(t, attempted)
+
+		w = request(revoked.ShopDomain)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, attempted, calls["shpat_revoked"])
+	})
+
+	t.Run("recorded scopes need no lookup", func(t *testing.T) {
+		require.NoError(t, stores.UpdateGrantedScopes(ctx, revoked.ID.Hex(), []string{"read_products", "read_content"}))
+		w := request(revoked.ShopDomain)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-Missing-Scopes"))
+		assert.JSONEq(t, `{"missing":[]}`, w.Body.String())
+	})
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mgsearch/models"
+	"mgsearch/pkg/auth"
+	"mgsearch/repositories"
+	"mgsearch/testhelpers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestShopifySessionMiddleware_RequireStoreSession(t *testing.T) {
+	ctx := context.Background()
+	cfg := testhelpers.TestConfig()
+
+	_, db, cleanup, err := testhelpers.SetupTestDatabase(ctx, cfg)
+	require.NoError(t, err)
+	defer cleanup()
+
+	stores := repositories.NewStoreRepository(db)
+	newStore := func(shop string) *models.Store {
+		store, err := stores.CreateOrUpdate(ctx, &models.Store{
+			ShopDomain:           shop,
+			ShopName:             shop,
+			EncryptedAccessToken: []byte("encrypted"),
+			APIKeyPrivate:        "private-" + shop,
+			ProductIndexUID:      "products",
+			WebhookSecret:        "secret",
+			InstalledAt:          time.Now().UTC(),
+		})
+		require.NoError(t, err)
+		return store
+	}
+	active := newStore("active-shop.myshopify.com")
+	uninstalled := newStore("uninstalled-shop.myshopify.com")
+	_, err = db.Collection("stores").UpdateOne(ctx, bson.M{"_id": uninstalled.ID}, bson.M{"$set": bson.M{"status": "uninstalled"}})
+	require.NoError(t, err)
+
+	sessions := NewShopifySessionMiddleware(cfg.ShopifyAPIKey, cfg.ShopifyAPISecret, stores, NewAuthMiddleware(cfg.JWTSigningKey))
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/store", sessions.RequireStoreSession(), func(c *gin.Context) {
+		storeID, _ := GetStoreID(c)
+		shop, _ := GetShopDomain(c)
+		_, embedded := GetShopifySession(c)
+		c.JSON(http.StatusOK, gin.H{"store_id": storeID, "shop": shop, "embedded": embedded})
+	})
+
+	request := func(token string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodGet, "/store", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var result map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &result)
+		return w, result
+	}
+
+	t.Run("active store", func(t *testing.T) {
+		w, result := request(testhelpers.ShopifySessionToken(cfg, active.ShopDomain))
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		assert.Equal(t, active.ID.Hex(), result["store_id"])
+		assert.Equal(t, active.ShopDomain, result["shop"])
+		assert.Equal(t, true, result["embedded"])
+	})
+
+	t.Run("stores that are not installed", func(t *testing.T) {
+		for _, shop := range []string{uninstalled.ShopDomain, "unknown-shop.myshopify.com"} {
+			w, result := request(testhelpers.ShopifySessionToken(cfg, shop))
+			assert.Equal(t, http.StatusUnauthorized, w.Code, shop)
+			assert.Equal(t, "STORE_NOT_INSTALLED", result["code"], shop)
+		}
+	})
+
+	t.Run("invalid session token", func(t *testing.T) {
+		w, _ := request("")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		other := *cfg
+		other.ShopifyAPISecret = "another-secret"
+		w, _ = request(testhelpers.ShopifySessionToken(&other, active.ShopDomain))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "1", w.Header().Get("X-Shopify-Retry-Invalid-Session-Request"))
+	})
+
+	t.Run("legacy store session token", func(t *testing.T) {
+		token, err := auth.GenerateSessionToken(active.ID.Hex(), active.ShopDomain, []byte(cfg.JWTSigningKey), time.Hour)
+		require.NoError(t, err)
+		w, result := request(token)
+		require.Equal(t, http.StatusOK, w.Code, "Response body: %s", w.Body.String())
+		assert.Equal(t, active.ID.Hex(), result["store_id"])
+		assert.Equal(t, false, result["embedded"])
+	})
+}
@@ -11,13 +11,73 @@ type Client struct {
 	ID          primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
 	Name        string               `bson:"name" json:"name"`
 	Description string               `bson:"description,omitempty" json:"description,omitempty"`
-	UserIDs     []primitive.ObjectID `bson:"user_ids" json:"user_ids"`
+	UserIDs     []primitive.ObjectID `bson:"user_ids" json:"user_ids"` // Mirrors Members for lookups by user
+	Members     []ClientMember       `bson:"members" json:"members"`
 	APIKeys     []APIKey             `bson:"api_keys" json:"api_keys"`
 	IsActive    bool                 `bson:"is_active" json:"is_active"`
+	RequireMFA  bool                 `bson:"require_mfa" json:"require_mfa"` // Members must sign in with two-factor authentication
+	RequireSSO  bool                 `bson:"require_sso" json:"require_sso"` // Members must sign in with single sign-on
 	CreatedAt   time.Time            `bson:"created_at" json:"created_at"`
 	UpdatedAt   time.Time            `bson:"updated_at" json:"updated_at"`
 }
 
+// ClientRole is the role of a member on a client. Each role includes the permissions of the roles
+// below it.
+type ClientRole string
+
+const (
+	ClientRoleOwner     ClientRole = "owner"     // Manages members, including other owners
+	ClientRoleAdmin     ClientRole = "admin"     // Manages API keys, linked stores and non-owner members
+	ClientRoleDeveloper ClientRole = "developer" // Creates indexes, writes documents and changes settings
+	ClientRoleViewer    ClientRole = "viewer"    // Read-only access
+)
+
+var clientRoleRanks = map[ClientRole]int{
+	ClientRoleViewer:    1,
+	ClientRoleDeveloper: 2,
+	ClientRoleAdmin:     3,
+	ClientRoleOwner:     4,
+}
+
+// IsValid reports whether r is a known role
+func (r ClientRole) IsValid() bool {
+	_, ok := clientRoleRanks[r]
+	return ok
+}
+
+// Includes reports whether r grants at least the permissions of min
+func (r ClientRole) Includes(min ClientRole) bool {
+	return r.IsValid() && clientRoleRanks[r] >= clientRoleRanks[min]
+}
+
+// ClientMember is a user's membership on a client
+type ClientMember struct {
+	UserID  primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Role    ClientRole         `bson:"role" json:"role"`
+	AddedAt time.Time          `bson:"added_at" json:"added_at"`
+}
+
+// RoleOf returns the role of the user on the client, if the user is a member
+func (c *Client) RoleOf(userID primitive.ObjectID) (ClientRole, bool) {
+	for _, member := range c.Members {
+		if member.UserID == userID {
+			return member.Role, true
+		}
+	}
+	return "", false
+}
+
+// OwnerCount returns the number of owners of the client
+func (c *Client) OwnerCount() int {
+	owners := 0
+	for _, member := range c.Members {
+		if member.Role == ClientRoleOwner {
+			owners++
+		}
+	}
+	return owners
+}
+
 // APIKey represents an API key for client authentication
 type APIKey struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
@@ -52,8 +112,11 @@ func (c *Client) ToPublicView() map[string]interface{} {
 		"name":        c.Name,
 		"description": c.Description,
 		"user_ids":    c.UserIDs,
+		"members":     c.Members,
 		"api_keys":    apiKeys,
 		"is_active":   c.IsActive,
+		"require_mfa": c.RequireMFA,
+		"require_sso": c.RequireSSO,
 		"created_at":  c.CreatedAt,
 		"updated_at":  c.UpdatedAt,
 	}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InviteStatus is the lifecycle state of a client invitation
+type InviteStatus string
+
+const (
+	InviteStatusPending  InviteStatus = "pending"
+	InviteStatusAccepted InviteStatus = "accepted"
+	InviteStatusRevoked  InviteStatus = "revoked"
+	// InviteStatusExpired is never stored; it is reported for pending invitations past ExpiresAt
+	InviteStatusExpired InviteStatus = "expired"
+)
+
+// ClientInvite invites an email address to join a client with a role. The invitation link carries a
+// single-use token of which only the SHA-256 hash is stored. Invitations are kept once accepted or
+// revoked.
+type ClientInvite struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	ClientID   primitive.ObjectID  `bson:"client_id" json:"client_id"`
+	Email      string              `bson:"email" json:"email"`
+	Role       ClientRole          `bson:"role" json:"role"`
+	TokenHash  string              `bson:"token_hash" json:"-"`
+	Status     InviteStatus        `bson:"status" json:"status"`
+	InvitedBy  primitive.ObjectID  `bson:"invited_by" json:"invited_by"`
+	CreatedAt  time.Time           `bson:"created_at" json:"created_at"`
+	ExpiresAt  time.Time           `bson:"expires_at" json:"expires_at"`
+	AcceptedAt *time.Time          `bson:"accepted_at,omitempty" json:"accepted_at,omitempty"`
+	AcceptedBy *primitive.ObjectID `bson:"accepted_by,omitempty" json:"accepted_by,omitempty"`
+	RevokedAt  *time.Time          `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	RevokedBy  *primitive.ObjectID `bson:"revoked_by,omitempty" json:"revoked_by,omitempty"`
+}
+
+// StatusAt returns the status of the invitation at the given time, reporting pending invitations
+// past their expiry as expired
+func (i *ClientInvite) StatusAt(now time.Time) InviteStatus {
+	if i.Status == InviteStatusPending && !now.Before(i.ExpiresAt) {
+		return InviteStatusExpired
+	}
+	return i.Status
+}
+
+// ToPublicView returns the invitation as shown to client members
+func (i *ClientInvite) ToPublicView(now time.Time) map[string]interface{} {
+	view := map[string]interface{}{
+		"id":         i.ID.Hex(),
+		"client_id":  i.ClientID.Hex(),
+		"email":      i.Email,
+		"role":       i.Role,
+		"status":     i.StatusAt(now),
+		"invited_by": i.InvitedBy.Hex(),
+		"created_at": i.CreatedAt,
+		"expires_at": i.ExpiresAt,
+	}
+	if i.AcceptedAt != nil {
+		view["accepted_at"] = i.AcceptedAt
+	}
+	if i.AcceptedBy != nil {
+		view["accepted_by"] = i.AcceptedBy.Hex()
+	}
+	if i.RevokedAt != nil {
+		view["revoked_at"] = i.RevokedAt
+	}
+	if i.RevokedBy != nil {
+		view["revoked_by"] = i.RevokedBy.Hex()
+	}
+	return view
+}
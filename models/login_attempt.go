@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// LoginAttempt counts recent failed logins for an account or a client IP. The ID is the scope
+// followed by the email address or IP, e.g. "account:jane@example.com" or "ip:203.0.113.7", so
+// every replica updates the same document.
+type LoginAttempt struct {
+	ID              string     `bson:"_id" json:"id"`
+	Failures        int        `bson:"failures" json:"failures"`
+	LastFailureAt   time.Time  `bson:"last_failure_at" json:"last_failure_at"`
+	LockedAt        *time.Time `bson:"locked_at,omitempty" json:"locked_at,omitempty"`
+	LockedUntil     *time.Time `bson:"locked_until,omitempty" json:"locked_until,omitempty"`
+	UnlockTokenHash string     `bson:"unlock_token_hash,omitempty" json:"-"`
+	ExpiresAt       time.Time  `bson:"expires_at" json:"expires_at"`
+}
+
+// IsLocked reports whether the account or IP is locked at the given time
+func (a *LoginAttempt) IsLocked(now time.Time) bool {
+	return a.LockedUntil != nil && now.Before(*a.LockedUntil)
+}
@@ -0,0 +1,129 @@
+package models
+
+import "time"
+
+// Plan levels stored on Store.PlanLevel.
+const (
+	PlanFree     = "free"
+	PlanBasic    = "basic"
+	PlanPro      = "pro"
+	PlanBusiness = "business"
+)
+
+// Plan features that can be switched on per plan.
+const (
+	FeatureSuggestions     = "suggestions"
+	FeatureSimilarProducts = "similar_products"
+)
+
+// Plan describes what a store may use and what Shopify bills for it. Zero limits mean unlimited.
+type Plan struct {
+	Level              string   `json:"level"`
+	Name               string   `json:"name"`
+	Price              float64  `json:"price"`
+	CurrencyCode       string   `json:"currency_code"`
+	TrialDays          int      `json:"trial_days"`
+	DocumentLimit      int64    `json:"document_limit"`
+	MonthlySearchLimit int64    `json:"monthly_search_limit"`
+	Features           []string `json:"features"`
+}
+
+// Plans lists the available plans in upgrade order.
+var Plans = []Plan{
+	{
+		Level:              PlanFree,
+		Name:               "Free",
+		CurrencyCode:       "USD",
+		DocumentLimit:      500,
+		MonthlySearchLimit: 5000,
+		Features:           []string{},
+	},
+	{
+		Level:              PlanBasic,
+		Name:               "Basic",
+		Price:              19,
+		CurrencyCode:       "USD",
+		TrialDays:          14,
+		DocumentLimit:      5000,
+		MonthlySearchLimit: 50000,
+		Features:           []string{FeatureSuggestions},
+	},
+	{
+		Level:              PlanPro,
+		Name:               "Pro",
+		Price:              49,
+		CurrencyCode:       "USD",
+		TrialDays:          14,
+		DocumentLimit:      50000,
+		MonthlySearchLimit: 500000,
+		Features:           []string{FeatureSuggestions, FeatureSimilarProducts},
+	},
+	{
+		Level:        PlanBusiness,
+		Name:         "Business",
+		Price:        199,
+		CurrencyCode: "USD",
+		TrialDays:    14,
+		Features:     []string{FeatureSuggestions, FeatureSimilarProducts},
+	},
+}
+
+// PlanByLevel returns the plan with the given level.
+func PlanByLevel(level string) (Plan, bool) {
+	for _, plan := range Plans {
+		if plan.Level == level {
+			return plan, true
+		}
+	}
+	return Plan{}, false
+}
+
+// HasFeature reports whether the plan includes the feature.
+func (p Plan) HasFeature(feature string) bool {
+	for _, f := range p.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFree reports whether the plan is billed at all.
+func (p Plan) IsFree() bool {
+	return p.Price == 0
+}
+
+// Subscription statuses reported by the Shopify Billing API.
+const (
+	SubscriptionStatusPending   = "PENDING"
+	SubscriptionStatusActive    = "ACTIVE"
+	SubscriptionStatusDeclined  = "DECLINED"
+	SubscriptionStatusCancelled = "CANCELLED"
+	SubscriptionStatusExpired   = "EXPIRED"
+	SubscriptionStatusFrozen    = "FROZEN"
+)
+
+// StoreSubscription is a Shopify recurring application charge: the one backing the store's paid
+// plan, or a charge for another plan awaiting the merchant's approval.
+type StoreSubscription struct {
+	ID          string     `json:"id" bson:"id"` // AppSubscription GraphQL ID
+	PlanLevel   string     `json:"plan_level" bson:"plan_level"`
+	Status      string     `json:"status" bson:"status"`
+	Test        bool       `json:"test" bson:"test"`
+	CreatedAt   time.Time  `json:"created_at" bson:"created_at"`
+	ActivatedAt *time.Time `json:"activated_at,omitempty" bson:"activated_at,omitempty"`
+}
+
+// StoreUsage counts the metered usage of a store in a billing period (calendar month, UTC).
+type StoreUsage struct {
+	ID        string    `json:"-" bson:"_id"`
+	StoreID   string    `json:"store_id" bson:"store_id"`
+	Period    string    `json:"period" bson:"period"`
+	Searches  int64     `json:"searches" bson:"searches"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// UsagePeriod returns the billing period key for t, e.g. "2024-05".
+func UsagePeriod(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
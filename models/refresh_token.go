@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefreshToken is a single-use credential for obtaining a new access token. Only the SHA-256 hash of
+// the token is stored. Each refresh replaces the token with a new one in the same family, which
+// starts at login; presenting a token that was already used revokes every session of the user.
+type RefreshToken struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	FamilyID   primitive.ObjectID  `bson:"family_id" json:"family_id"`
+	TokenHash  string              `bson:"token_hash" json:"-"`
+	UserAgent  string              `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	IPAddress  string              `bson:"ip_address,omitempty" json:"ip_address,omitempty"`
+	CreatedAt  time.Time           `bson:"created_at" json:"created_at"`
+	ExpiresAt  time.Time           `bson:"expires_at" json:"expires_at"`
+	UsedAt     *time.Time          `bson:"used_at,omitempty" json:"used_at,omitempty"`
+	ReplacedBy *primitive.ObjectID `bson:"replaced_by,omitempty" json:"replaced_by,omitempty"`
+	RevokedAt  *time.Time          `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	SSO        bool                `bson:"sso,omitempty" json:"sso,omitempty"` // The family was started with single sign-on
+}
+
+// IsActive reports whether the token can still be exchanged at now.
+func (t *RefreshToken) IsActive(now time.Time) bool {
+	return t.UsedAt == nil && t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
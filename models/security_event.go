@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Security event types
+const (
+	SecurityEventLoginLocked    = "login_locked"
+	SecurityEventLoginIPLocked  = "login_ip_locked"
+	SecurityEventLoginUnlocked  = "login_unlocked"
+	SecurityEventSSOLinked      = "sso_linked"
+	SecurityEventSSOProvisioned = "sso_provisioned"
+)
+
+// SecurityEvent is an audit log entry for security relevant account activity
+type SecurityEvent struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Type      string              `bson:"type" json:"type"`
+	UserID    *primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	Email     string              `bson:"email,omitempty" json:"email,omitempty"`
+	IPAddress string              `bson:"ip_address,omitempty" json:"ip_address,omitempty"`
+	UserAgent string              `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	Details   string              `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+// ShopifyCollection is the collection payload delivered by collections/* webhooks and the Admin
+// REST custom and smart collection resources. Memberships are not part of the payload and are
+// fetched from the Admin API.
+type ShopifyCollection struct {
+	ID          int64         `json:"id"`
+	Handle      string        `json:"handle"`
+	Title       string        `json:"title"`
+	BodyHTML    string        `json:"body_html"`
+	PublishedAt *string       `json:"published_at"`
+	UpdatedAt   string        `json:"updated_at"`
+	Image       *ShopifyImage `json:"image"`
+}
+
+// ShopifyInventoryLevel is the payload of inventory_levels/update webhooks and the Admin API
+// inventory level resource.
+type ShopifyInventoryLevel struct {
+	InventoryItemID int64  `json:"inventory_item_id"`
+	LocationID      int64  `json:"location_id"`
+	Available       *int   `json:"available"`
+	UpdatedAt       string `json:"updated_at"`
+}
+
+// ShopifyLocation is the payload of locations/* webhooks.
+type ShopifyLocation struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Active    bool   `json:"active"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// ShopifyProductListing is the payload of product_listings/* webhooks: a product as published to
+// the app's sales channel.
+type ShopifyProductListing struct {
+	ProductListing struct {
+		ProductID int64 `json:"product_id"`
+		ShopifyProduct
+	} `json:"product_listing"`
+}
+
+// CollectionMembership stores which products belong to a Shopify collection, so product
+// documents can carry their collection handles.
+type CollectionMembership struct {
+	ID           string    `json:"id" bson:"_id"`
+	StoreID      string    `json:"store_id" bson:"store_id"`
+	CollectionID int64     `json:"collection_id" bson:"collection_id"`
+	Handle       string    `json:"handle" bson:"handle"`
+	Title        string    `json:"title" bson:"title"`
+	ProductIDs   []int64   `json:"product_ids" bson:"product_ids"`
+	UpdatedAt    time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// InventoryItem maps a Shopify inventory item to its product variant and keeps the last known
+// total quantity reported on the variant.
+type InventoryItem struct {
+	ID              string    `json:"id" bson:"_id"`
+	StoreID         string    `json:"store_id" bson:"store_id"`
+	InventoryItemID int64     `json:"inventory_item_id" bson:"inventory_item_id"`
+	ProductID       int64     `json:"product_id" bson:"product_id"`
+	VariantID       int64     `json:"variant_id" bson:"variant_id"`
+	Tracked         bool      `json:"tracked" bson:"tracked"`
+	ContinueSelling bool      `json:"continue_selling" bson:"continue_selling"`
+	Quantity        int       `json:"quantity" bson:"quantity"`
+	UpdatedAt       time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// InventoryLevel is the available quantity of an inventory item at one location.
+type InventoryLevel struct {
+	ID              string    `json:"id" bson:"_id"`
+	StoreID         string    `json:"store_id" bson:"store_id"`
+	InventoryItemID int64     `json:"inventory_item_id" bson:"inventory_item_id"`
+	LocationID      int64     `json:"location_id" bson:"location_id"`
+	Available       int       `json:"available" bson:"available"`
+	UpdatedAt       time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Location is a Shopify location; stock at inactive locations does not count as sellable.
+type Location struct {
+	ID         string    `json:"id" bson:"_id"`
+	StoreID    string    `json:"store_id" bson:"store_id"`
+	LocationID int64     `json:"location_id" bson:"location_id"`
+	Name       string    `json:"name" bson:"name"`
+	Active     bool      `json:"active" bson:"active"`
+	UpdatedAt  time.Time `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Document types tag every search document with the kind of storefront resource it describes.
+// Product documents use the store's configured type (see Store.DocumentType).
+const (
+	DocumentTypeProduct    = "product"
+	DocumentTypeCollection = "collection"
+	DocumentTypePage       = "page"
+	DocumentTypeArticle    = "article"
+)
+
+// ContentDocumentTypes lists the non-product types indexed into their own indexes.
+var ContentDocumentTypes = []string{DocumentTypeCollection, DocumentTypePage, DocumentTypeArticle}
+
+// ShopifyPage is an online store page from the Admin REST API.
+type ShopifyPage struct {
+	ID          int64   `json:"id"`
+	Title       string  `json:"title"`
+	Handle      string  `json:"handle"`
+	BodyHTML    string  `json:"body_html"`
+	Author      string  `json:"author"`
+	PublishedAt *string `json:"published_at"`
+	UpdatedAt   string  `json:"updated_at"`
+}
+
+// ShopifyBlog is an online store blog from the Admin REST API.
+type ShopifyBlog struct {
+	ID     int64  `json:"id"`
+	Title  string `json:"title"`
+	Handle string `json:"handle"`
+}
+
+// ShopifyArticle is a blog article from the Admin REST API.
+type ShopifyArticle struct {
+	ID          int64         `json:"id"`
+	BlogID      int64         `json:"blog_id"`
+	Title       string        `json:"title"`
+	Handle      string        `json:"handle"`
+	BodyHTML    string        `json:"body_html"`
+	SummaryHTML string        `json:"summary_html"`
+	Author      string        `json:"author"`
+	Tags        string        `json:"tags"`
+	PublishedAt *string       `json:"published_at"`
+	UpdatedAt   string        `json:"updated_at"`
+	Image       *ShopifyImage `json:"image"`
+}
+
+// ShopifyContentDocument is the search document stored for collections, pages and articles.
+type ShopifyContentDocument struct {
+	ID           int64    `json:"id"`
+	StoreID      string   `json:"store_id"`
+	ShopDomain   string   `json:"shop_domain"`
+	DocumentType string   `json:"document_type"`
+	Title        string   `json:"title"`
+	Handle       string   `json:"handle"`
+	URL          string   `json:"url"`
+	Body         string   `json:"body"`
+	Summary      string   `json:"summary,omitempty"`
+	Author       string   `json:"author,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	BlogHandle   string   `json:"blog_handle,omitempty"`
+	BlogTitle    string   `json:"blog_title,omitempty"`
+	ImageURL     string   `json:"image_url,omitempty"`
+	PublishedAt  string   `json:"published_at,omitempty"`
+	UpdatedAt    string   `json:"updated_at,omitempty"`
+}
+
+// IsPublished reports whether a collection is visible on the online store.
+func (c *ShopifyCollection) IsPublished() bool {
+	return c.PublishedAt != nil && *c.PublishedAt != ""
+}
+
+// ToDocument converts the typed search document into the generic document payload sent to Meilisearch.
+func (d *ShopifyContentDocument) ToDocument() (Document, error) {
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s document: %w", d.DocumentType, err)
+	}
+
+	var document Document
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s document: %w", d.DocumentType, err)
+	}
+
+	return document, nil
+}
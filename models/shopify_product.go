@@ -0,0 +1,145 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ShopifyProduct mirrors the product payload delivered by Shopify webhooks and the Admin REST API.
+// Only the fields needed to build search documents are decoded; everything else is ignored.
+type ShopifyProduct struct {
+	ID          int64                  `json:"id"`
+	Title       string                 `json:"title"`
+	BodyHTML    string                 `json:"body_html"`
+	Vendor      string                 `json:"vendor"`
+	ProductType string                 `json:"product_type"`
+	Handle      string                 `json:"handle"`
+	Status      string                 `json:"status"`
+	Tags        string                 `json:"tags"`
+	PublishedAt *string                `json:"published_at"`
+	CreatedAt   string                 `json:"created_at"`
+	UpdatedAt   string                 `json:"updated_at"`
+	Variants    []ShopifyVariant       `json:"variants"`
+	Options     []ShopifyProductOption `json:"options"`
+	Images      []ShopifyImage         `json:"images"`
+	Image       *ShopifyImage          `json:"image"`
+}
+
+// ShopifyVariant is a single purchasable variant of a Shopify product.
+type ShopifyVariant struct {
+	ID                  int64   `json:"id"`
+	Title               string  `json:"title"`
+	Price               string  `json:"price"`
+	CompareAtPrice      *string `json:"compare_at_price"`
+	SKU                 string  `json:"sku"`
+	Barcode             string  `json:"barcode"`
+	InventoryItemID     int64   `json:"inventory_item_id"`
+	InventoryQuantity   int     `json:"inventory_quantity"`
+	InventoryPolicy     string  `json:"inventory_policy"`
+	InventoryManagement *string `json:"inventory_management"`
+}
+
+// ShopifyProductOption is a product option such as "Size" or "Color" with its values.
+type ShopifyProductOption struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// ShopifyImage is a product image reference.
+type ShopifyImage struct {
+	ID  int64  `json:"id"`
+	Src string `json:"src"`
+	Alt string `json:"alt,omitempty"`
+}
+
+// IsPublished reports whether the product is active and published, i.e. visible on the storefront.
+// Draft, archived and unpublished products must not be searchable.
+func (p *ShopifyProduct) IsPublished() bool {
+	if p.Status != "" && !strings.EqualFold(p.Status, "active") {
+		return false
+	}
+	return p.PublishedAt != nil && *p.PublishedAt != ""
+}
+
+// DocumentID returns the identifier used as the Meilisearch primary key.
+func (p *ShopifyProduct) DocumentID() string {
+	return fmt.Sprintf("%d", p.ID)
+}
+
+// ShopifyProductDocument is the flattened representation of a Shopify product stored in Meilisearch.
+type ShopifyProductDocument struct {
+	ID                int64                                `json:"id"`
+	StoreID           string                               `json:"store_id"`
+	ShopDomain        string                               `json:"shop_domain"`
+	DocumentType      string                               `json:"document_type"`
+	Title             string                               `json:"title"`
+	Handle            string                               `json:"handle"`
+	URL               string                               `json:"url"`
+	Description       string                               `json:"description"`
+	Vendor            string                               `json:"vendor"`
+	ProductType       string                               `json:"product_type"`
+	Tags              []string                             `json:"tags"`
+	Options           []ShopifyProductOption               `json:"options"`
+	SKUs              []string                             `json:"skus"`
+	PriceMin          float64                              `json:"price_min"`
+	PriceMax          float64                              `json:"price_max"`
+	CompareAtPriceMin float64                              `json:"compare_at_price_min,omitempty"`
+	CompareAtPriceMax float64                              `json:"compare_at_price_max,omitempty"`
+	InStock           bool                                 `json:"in_stock"`
+	Collections       []string                             `json:"collections"`
+	CollectionIDs     []int64                              `json:"collection_ids"`
+	VariantsCount     int                                  `json:"variants_count"`
+	ImageURL          string                               `json:"image_url,omitempty"`
+	ImageURLs         []string                             `json:"image_urls"`
+	Metafields        map[string]map[string]interface{}    `json:"metafields,omitempty"`
+	Translations      map[string]ShopifyProductTranslation `json:"translations,omitempty"`
+	Locale            string                               `json:"locale,omitempty"`
+	PublishedAt       string                               `json:"published_at,omitempty"`
+	CreatedAt         string                               `json:"created_at,omitempty"`
+	UpdatedAt         string                               `json:"updated_at,omitempty"`
+}
+
+// ShopifyMetafield is a product metafield as returned by the Admin GraphQL API.
+type ShopifyMetafield struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	Type      string `json:"type"`
+}
+
+// ShopifyTranslation is a single translated field of a resource, keyed as in Shopify's
+// translatable content (title, body_html, handle, product_type, ...).
+type ShopifyTranslation struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ShopifyProductLocalization holds the metafields and per-locale translations of a product.
+type ShopifyProductLocalization struct {
+	Metafields   []ShopifyMetafield
+	Translations map[string][]ShopifyTranslation
+}
+
+// ShopifyProductTranslation is the translated subset of a product document for one locale.
+type ShopifyProductTranslation struct {
+	Title       string `json:"title,omitempty"`
+	Handle      string `json:"handle,omitempty"`
+	Description string `json:"description,omitempty"`
+	ProductType string `json:"product_type,omitempty"`
+}
+
+// ToDocument converts the typed search document into the generic document payload sent to Meilisearch.
+func (d *ShopifyProductDocument) ToDocument() (Document, error) {
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal product document: %w", err)
+	}
+
+	var document Document
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal product document: %w", err)
+	}
+
+	return document, nil
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SSOLogin is a single sign-on login started with the OpenID Connect provider. The callback finds it
+// by the state sent to the provider, of which only the SHA-256 hash is stored, and completes it
+// once.
+type SSOLogin struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	StateHash    string             `bson:"state_hash" json:"-"`
+	Nonce        string             `bson:"nonce" json:"-"`         // Expected in the ID token
+	CodeVerifier string             `bson:"code_verifier" json:"-"` // PKCE verifier of the authorization code
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	ExpiresAt    time.Time          `bson:"expires_at" json:"expires_at"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -11,8 +12,13 @@ type Store struct {
 	ID                   primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
 	ShopDomain           string                 `json:"shop_domain" bson:"shop_domain"`
 	ShopName             string                 `json:"shop_name" bson:"shop_name"`
+	ClientID             *primitive.ObjectID    `json:"client_id,omitempty" bson:"client_id,omitempty"`
 	EncryptedAccessToken []byte                 `json:"-" bson:"encrypted_access_token"`
+	GrantedScopes        []string               `json:"granted_scopes" bson:"granted_scopes"`
 	APIKeyPublic         string                 `json:"api_key_public" bson:"api_key_public"`
+	PreviousAPIKeyPublic string                 `json:"-" bson:"previous_api_key_public,omitempty"`
+	PreviousKeyExpiresAt *time.Time             `json:"previous_key_expires_at,omitempty" bson:"previous_key_expires_at,omitempty"`
+	KeyRotations         []StoreKeyRotation     `json:"key_rotations,omitempty" bson:"key_rotations,omitempty"`
 	APIKeyPrivate        string                 `json:"-" bson:"api_key_private"`
 	ProductIndexUID      string                 `json:"product_index_uid" bson:"product_index_uid"`
 	MeilisearchIndexUID  string                 `json:"meilisearch_index_uid" bson:"meilisearch_index_uid"`
@@ -20,6 +26,9 @@ type Store struct {
 	MeilisearchURL       string                 `json:"meilisearch_url" bson:"meilisearch_url"`
 	MeilisearchAPIKey    []byte                 `json:"-" bson:"meilisearch_api_key"`
 	PlanLevel            string                 `json:"plan_level" bson:"plan_level"`
+	Subscription         *StoreSubscription     `json:"subscription,omitempty" bson:"subscription,omitempty"`
+	PendingSubscription  *StoreSubscription     `json:"pending_subscription,omitempty" bson:"pending_subscription,omitempty"`
+	Indexing             StoreIndexing          `json:"indexing" bson:"indexing"`
 	Status               string                 `json:"status" bson:"status"`
 	WebhookSecret        string                 `json:"-" bson:"webhook_secret"`
 	InstalledAt          time.Time              `json:"installed_at" bson:"installed_at"`
@@ -34,6 +43,7 @@ type StorePublicView struct {
 	ID              string                 `json:"id"`
 	ShopDomain      string                 `json:"shop_domain"`
 	ShopName        string                 `json:"shop_name"`
+	ClientID        string                 `json:"client_id,omitempty"`
 	PlanLevel       string                 `json:"plan_level"`
 	Status          string                 `json:"status"`
 	ProductIndexUID string                 `json:"product_index_uid"`
@@ -41,6 +51,10 @@ type StorePublicView struct {
 	MeilisearchURL  string                 `json:"meilisearch_url"`
 	DocumentType    string                 `json:"meilisearch_document_type"`
 	APIKeyPublic    string                 `json:"api_key_public,omitempty"` // Storefront key for search API
+	KeyRotations    []StoreKeyRotation     `json:"key_rotations,omitempty"`
+	GrantedScopes   []string               `json:"granted_scopes"`
+	MissingScopes   []string               `json:"missing_scopes,omitempty"`
+	Indexing        StoreIndexing          `json:"indexing"`
 	SyncState       map[string]interface{} `json:"sync_state"`
 	InstalledAt     time.Time              `json:"installed_at"`
 }
@@ -51,6 +65,7 @@ func (s *Store) ToPublicView() StorePublicView {
 		ID:              s.ID.Hex(),
 		ShopDomain:      s.ShopDomain,
 		ShopName:        s.ShopName,
+		ClientID:        s.ClientIDHex(),
 		PlanLevel:       s.PlanLevel,
 		Status:          s.Status,
 		ProductIndexUID: s.ProductIndexUID,
@@ -58,11 +73,41 @@ func (s *Store) ToPublicView() StorePublicView {
 		MeilisearchURL:  s.MeilisearchURL,
 		DocumentType:    s.MeilisearchDocType,
 		APIKeyPublic:    s.APIKeyPublic, // Include storefront key
+		KeyRotations:    s.KeyRotations,
+		GrantedScopes:   s.GrantedScopes,
+		Indexing:        s.Indexing,
 		SyncState:       s.SyncState,
 		InstalledAt:     s.InstalledAt,
 	}
 }
 
+// ClientIDHex returns the ID of the dashboard client the store is linked to, or "" when unlinked.
+func (s *Store) ClientIDHex() string {
+	if s.ClientID == nil {
+		return ""
+	}
+	return s.ClientID.Hex()
+}
+
+// StoreKeyRotation records one rotation of a store's storefront key. Only key prefixes are kept
+// so the history can be shown in the dashboard without exposing the keys.
+type StoreKeyRotation struct {
+	KeyPrefix            string     `json:"key_prefix" bson:"key_prefix"`
+	PreviousKeyPrefix    string     `json:"previous_key_prefix,omitempty" bson:"previous_key_prefix,omitempty"`
+	RotatedAt            time.Time  `json:"rotated_at" bson:"rotated_at"`
+	PreviousKeyExpiresAt *time.Time `json:"previous_key_expires_at,omitempty" bson:"previous_key_expires_at,omitempty"`
+}
+
+// StorefrontKeyPrefix returns the leading characters of a storefront key used to identify it in
+// rotation history.
+func StorefrontKeyPrefix(key string) string {
+	const prefixLen = 8
+	if len(key) <= prefixLen {
+		return key
+	}
+	return key[:prefixLen]
+}
+
 // IndexUID returns the effective Meilisearch index identifier for the store.
 func (s *Store) IndexUID() string {
 	if s.MeilisearchIndexUID != "" {
@@ -71,10 +116,82 @@ func (s *Store) IndexUID() string {
 	return s.ProductIndexUID
 }
 
+// Locale modes control where translated product fields are indexed.
+const (
+	// LocaleModeFields stores translations on the product document under translations.<locale>.
+	LocaleModeFields = "fields"
+	// LocaleModeIndexes writes a fully translated copy of each product into one index per locale.
+	LocaleModeIndexes = "indexes"
+)
+
+// StoreIndexing configures which Shopify data beyond the product resource is indexed.
+type StoreIndexing struct {
+	MetafieldNamespaces []string `json:"metafield_namespaces" bson:"metafield_namespaces"`
+	Locales             []string `json:"locales" bson:"locales"`
+	LocaleMode          string   `json:"locale_mode" bson:"locale_mode"`
+}
+
+// RequiresLocalization reports whether product documents need metafields or translations fetched
+// from the Admin API.
+func (i StoreIndexing) RequiresLocalization() bool {
+	return len(i.MetafieldNamespaces) > 0 || len(i.Locales) > 0
+}
+
+// LocaleIndexUID returns the index holding the store's products translated into locale, e.g.
+// shop_all_products_fr or shop_all_products_pt_br.
+func (s *Store) LocaleIndexUID(locale string) string {
+	suffix := strings.ReplaceAll(strings.ToLower(locale), "-", "_")
+	return s.IndexUID() + "_" + suffix
+}
+
+// LocaleIndexUIDs maps each configured locale to its index when translations are indexed per
+// locale. It returns an empty map otherwise.
+func (s *Store) LocaleIndexUIDs() map[string]string {
+	uids := map[string]string{}
+	if s.Indexing.LocaleMode != LocaleModeIndexes || s.IndexUID() == "" {
+		return uids
+	}
+	for _, locale := range s.Indexing.Locales {
+		uids[locale] = s.LocaleIndexUID(locale)
+	}
+	return uids
+}
+
+// SearchIndexUID returns the index storefront searches in locale should use, falling back to the
+// primary index when the locale has no index of its own.
+func (s *Store) SearchIndexUID(locale string) string {
+	for configured, uid := range s.LocaleIndexUIDs() {
+		if strings.EqualFold(configured, locale) {
+			return uid
+		}
+	}
+	return s.IndexUID()
+}
+
+// ContentIndexUID returns the index holding the store's documents of a non-product type, named
+// after the product index: shop_all_products becomes shop_all_collections, shop_all_pages and
+// shop_all_articles.
+func (s *Store) ContentIndexUID(documentType string) string {
+	base := s.IndexUID()
+	if base == "" {
+		return ""
+	}
+	return strings.TrimSuffix(base, "_all_products") + "_all_" + documentType + "s"
+}
+
 // DocumentType returns the type label used for Meilisearch documents.
 func (s *Store) DocumentType() string {
 	if s.MeilisearchDocType != "" {
 		return s.MeilisearchDocType
 	}
-	return "product"
+	return DocumentTypeProduct
+}
+
+// Plan returns the store's current plan, falling back to the free plan for unknown levels.
+func (s *Store) Plan() Plan {
+	if plan, ok := PlanByLevel(s.PlanLevel); ok {
+		return plan
+	}
+	plan, _ := PlanByLevel(PlanFree)
+	return plan
 }
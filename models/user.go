@@ -8,27 +8,39 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID           primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
-	Email        string               `bson:"email" json:"email"`
-	PasswordHash string               `bson:"password_hash" json:"-"`
-	FirstName    string               `bson:"first_name" json:"first_name"`
-	LastName     string               `bson:"last_name" json:"last_name"`
-	ClientIDs    []primitive.ObjectID `bson:"client_ids" json:"client_ids"`
-	IsActive     bool                 `bson:"is_active" json:"is_active"`
-	CreatedAt    time.Time            `bson:"created_at" json:"created_at"`
-	UpdatedAt    time.Time            `bson:"updated_at" json:"updated_at"`
+	ID                primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Email             string               `bson:"email" json:"email"`
+	PasswordHash      string               `bson:"password_hash" json:"-"`
+	FirstName         string               `bson:"first_name" json:"first_name"`
+	LastName          string               `bson:"last_name" json:"last_name"`
+	ClientIDs         []primitive.ObjectID `bson:"client_ids" json:"client_ids"`
+	IsActive          bool                 `bson:"is_active" json:"is_active"`
+	EmailVerified     bool                 `bson:"email_verified" json:"email_verified"`
+	TokenVersion      int                  `bson:"token_version" json:"-"` // Bumped to invalidate every issued access token
+	MFAEnabled        bool                 `bson:"mfa_enabled" json:"mfa_enabled"`
+	TOTPSecret        []byte               `bson:"totp_secret,omitempty" json:"-"`         // Encrypted; set once MFA is confirmed
+	PendingTOTPSecret []byte               `bson:"pending_totp_secret,omitempty" json:"-"` // Encrypted; awaiting the first code
+	TOTPLastStep      int64                `bson:"totp_last_step,omitempty" json:"-"`      // Time step of the last accepted code
+	RecoveryCodes     []string             `bson:"recovery_codes,omitempty" json:"-"`      // Hashes of unused recovery codes
+	SSOIssuer         string               `bson:"sso_issuer,omitempty" json:"-"`          // OpenID Connect provider of the linked identity
+	SSOSubject        string               `bson:"sso_subject,omitempty" json:"-"`         // Subject of the linked identity at SSOIssuer
+	CreatedAt         time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt         time.Time            `bson:"updated_at" json:"updated_at"`
 }
 
 // ToPublicView returns user data without sensitive information
 func (u *User) ToPublicView() map[string]interface{} {
 	return map[string]interface{}{
-		"id":         u.ID.Hex(),
-		"email":      u.Email,
-		"first_name": u.FirstName,
-		"last_name":  u.LastName,
-		"client_ids": u.ClientIDs,
-		"is_active":  u.IsActive,
-		"created_at": u.CreatedAt,
-		"updated_at": u.UpdatedAt,
+		"id":             u.ID.Hex(),
+		"email":          u.Email,
+		"first_name":     u.FirstName,
+		"last_name":      u.LastName,
+		"client_ids":     u.ClientIDs,
+		"is_active":      u.IsActive,
+		"email_verified": u.EmailVerified,
+		"mfa_enabled":    u.MFAEnabled,
+		"sso_linked":     u.SSOSubject != "",
+		"created_at":     u.CreatedAt,
+		"updated_at":     u.UpdatedAt,
 	}
 }
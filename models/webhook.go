@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Webhook event processing states.
+const (
+	WebhookStatusPending    = "pending"
+	WebhookStatusProcessing = "processing"
+	WebhookStatusProcessed  = "processed"
+	WebhookStatusStale      = "stale"
+	WebhookStatusFailed     = "failed"
+	WebhookStatusRejected   = "rejected" // Not applied because the store's plan does not allow it
+)
+
+// WebhookEvent is a verified Shopify webhook delivery persisted for asynchronous processing.
+// The ID is the X-Shopify-Webhook-Id header, which Shopify keeps stable across retries, so it also
+// serves as the deduplication key. The raw payload is retained so deliveries can be replayed.
+// TriggeredAt is the X-Shopify-Triggered-At header, the time Shopify emitted the event.
+type WebhookEvent struct {
+	ID            string     `json:"id" bson:"_id"`
+	ShopDomain    string     `json:"shop_domain" bson:"shop_domain"`
+	Topic         string     `json:"topic" bson:"topic"`
+	Payload       string     `json:"payload,omitempty" bson:"payload"`
+	Status        string     `json:"status" bson:"status"`
+	Attempts      int        `json:"attempts" bson:"attempts"`
+	LastError     string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" bson:"next_attempt_at"`
+	LockedUntil   *time.Time `json:"-" bson:"locked_until,omitempty"`
+	TriggeredAt   *time.Time `json:"triggered_at,omitempty" bson:"triggered_at,omitempty"`
+	ReceivedAt    time.Time  `json:"received_at" bson:"received_at"`
+	ProcessedAt   *time.Time `json:"processed_at,omitempty" bson:"processed_at,omitempty"`
+}
+
+// DeliveredAt returns when Shopify sent the event, falling back to when it was received for
+// deliveries without a X-Shopify-Triggered-At header. Unlike the processing time it does not
+// depend on queueing or retries.
+func (e *WebhookEvent) DeliveredAt() time.Time {
+	if e.TriggeredAt != nil && !e.TriggeredAt.IsZero() {
+		return e.TriggeredAt.UTC()
+	}
+	return e.ReceivedAt.UTC()
+}
+
+// DocumentVersion tracks the Shopify updated_at timestamp of the last change applied to an indexed
+// document, so that out-of-order webhook deliveries cannot overwrite newer data with older data.
+// The worker applying a change leases the document until the change reached the index.
+type DocumentVersion struct {
+	ID          string     `json:"id" bson:"_id"`
+	StoreID     string     `json:"store_id" bson:"store_id"`
+	DocumentID  string     `json:"document_id" bson:"document_id"`
+	UpdatedAt   time.Time  `json:"updated_at" bson:"updated_at"`
+	Deleted     bool       `json:"deleted" bson:"deleted"`
+	RecordedAt  time.Time  `json:"recorded_at" bson:"recorded_at"`
+	LockedUntil *time.Time `json:"-" bson:"locked_until,omitempty"`
+	LockToken   string     `json:"-" bson:"lock_token,omitempty"`
+}
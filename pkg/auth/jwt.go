@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -8,18 +10,38 @@ import (
 
 // JWTClaims represents JWT token claims
 type JWTClaims struct {
-	UserID   string `json:"user_id"`
-	Email    string `json:"email"`
-	ClientID string `json:"client_id,omitempty"`
+	UserID       string `json:"user_id"`
+	Email        string `json:"email"`
+	ClientID     string `json:"client_id,omitempty"`
+	TokenVersion int    `json:"tv,omitempty"`  // User token version the token was issued at
+	MFA          bool   `json:"mfa,omitempty"` // The session was started with two-factor authentication
+	SSO          bool   `json:"sso,omitempty"` // The session was started with single sign-on
 	jwt.RegisteredClaims
 }
 
 // GenerateJWT generates a new JWT token for a user
 func GenerateJWT(userID, email string, signingKey []byte, duration time.Duration) (string, error) {
+	return GenerateAccessToken(userID, email, 0, false, false, signingKey, duration)
+}
+
+// GenerateAccessToken generates a JWT token for a user at the user's current token version. The
+// token carries a unique ID (jti) so it can be revoked on its own before it expires. mfa marks
+// tokens of users who signed in with two-factor authentication, sso those of sessions started with
+// single sign-on.
+func GenerateAccessToken(userID, email string, tokenVersion int, mfa, sso bool, signingKey []byte, duration time.Duration) (string, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
 	claims := JWTClaims{
-		UserID: userID,
-		Email:  email,
+		UserID:       userID,
+		Email:        email,
+		TokenVersion: tokenVersion,
+		MFA:          mfa,
+		SSO:          sso,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
@@ -68,3 +90,11 @@ func ParseJWT(tokenString string, signingKey []byte) (*JWTClaims, error) {
 
 	return claims, nil
 }
+
+func newTokenID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ShopifySessionClaims are the claims of an App Bridge session token issued by Shopify to an
+// embedded app. The token is signed with the app's API secret and identifies the shop (dest) and
+// the staff member (sub) using the app.
+type ShopifySessionClaims struct {
+	Dest      string `json:"dest"`
+	SessionID string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// ShopDomain returns the myshopify.com domain the token was issued for.
+func (c *ShopifySessionClaims) ShopDomain() string {
+	parsed, err := url.Parse(c.Dest)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// ParseShopifySessionToken validates an App Bridge session token: HS256 signature with the app
+// secret, exp and nbf, an audience equal to the app's API key, and a dest shop matching the issuer.
+func ParseShopifySessionToken(tokenString, apiKey, apiSecret string) (*ShopifySessionClaims, error) {
+	if apiKey == "" || apiSecret == "" {
+		return nil, errors.New("shopify app credentials not configured")
+	}
+
+	claims := &ShopifySessionClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(apiSecret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	// RegisteredClaims only checks exp and nbf when present; session tokens must carry both
+	if claims.ExpiresAt == nil || claims.NotBefore == nil {
+		return nil, errors.New("session token missing exp or nbf")
+	}
+	if !claims.VerifyAudience(apiKey, true) {
+		return nil, errors.New("session token audience mismatch")
+	}
+
+	shop := claims.ShopDomain()
+	if !strings.HasSuffix(shop, ".myshopify.com") {
+		return nil, errors.New("session token has invalid dest")
+	}
+	issuer, err := url.Parse(claims.Issuer)
+	if err != nil || !strings.EqualFold(issuer.Hostname(), shop) {
+		return nil, errors.New("session token issuer does not match dest")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAppKey    = "app-api-key"
+	testAppSecret = "app-api-secret"
+)
+
+func signSessionToken(t *testing.T, claims ShopifySessionClaims, method jwt.SigningMethod, secret string) string {
+	token, err := jwt.NewWithClaims(method, claims).SignedString([]byte(secret))
+	require.NoError(t, err)
+	return token
+}
+
+func validSessionClaims() ShopifySessionClaims {
+	now := time.Now()
+	return ShopifySessionClaims{
+		Dest: "https://demo.myshopify.com",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://demo.myshopify.com/admin",
+			Subject:   "42",
+			Audience:  jwt.ClaimStrings{testAppKey},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			NotBefore: jwt.NewNumericDate(now.Add(-time.Second)),
+			IssuedAt:  jwt.NewNumericDate(now.Add(-time.Second)),
+		},
+	}
+}
+
+func TestParseShopifySessionToken(t *testing.T) {
+	token := signSessionToken(t, validSessionClaims(), jwt.SigningMethodHS256, testAppSecret)
+
+	claims, err := ParseShopifySessionToken(token, testAppKey, testAppSecret)
+	require.NoError(t, err)
+	assert.Equal(t, "demo.myshopify.com", claims.ShopDomain())
+	assert.Equal(t, "42", claims.Subject)
+}
+
+func TestParseShopifySessionToken_Rejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*ShopifySessionClaims)
+		method jwt.SigningMethod
+		secret string
+	}{
+		{name: "wrong secret", secret: "other-secret"},
+		{name: "wrong algorithm", method: jwt.SigningMethodHS512},
+		{name: "expired", mutate: func(c *ShopifySessionClaims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }},
+		{name: "not yet valid", mutate: func(c *ShopifySessionClaims) { c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Minute)) }},
+		{name: "missing nbf", mutate: func(c *ShopifySessionClaims) { c.NotBefore = nil }},
+		{name: "other app", mutate: func(c *ShopifySessionClaims) { c.Audience = jwt.ClaimStrings{"other-app"} }},
+		{name: "dest not a shop", mutate: func(c *ShopifySessionClaims) { c.Dest = "https://evil.example.com" }},
+		{name: "issuer mismatch", mutate: func(c *ShopifySessionClaims) { c.Issuer = "https://other.myshopify.com/admin" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validSessionClaims()
+			if tt.mutate != nil {
+				tt.mutate(&claims)
+			}
+			method := tt.method
+			if method == nil {
+				method = jwt.SigningMethodHS256
+			}
+			secret := tt.secret
+			if secret == "" {
+				secret = testAppSecret
+			}
+
+			_, err := ParseShopifySessionToken(signSessionToken(t, claims, method, secret), testAppKey, testAppSecret)
+			assert.Error(t, err)
+		})
+	}
+}
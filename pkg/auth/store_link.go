@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// storeLinkAudience distinguishes store link tokens from other tokens signed with the same key.
+const storeLinkAudience = "mgsearch:store-link"
+
+// StoreLinkClaims authorize attaching a Shopify store to a dashboard client. The token is issued to
+// the store's embedded admin and redeemed by a dashboard user, proving control of both sides.
+type StoreLinkClaims struct {
+	StoreID string `json:"link_store_id"`
+	Shop    string `json:"shop"`
+	jwt.RegisteredClaims
+}
+
+// GenerateStoreLinkToken creates a short-lived token for linking the store to a client.
+func GenerateStoreLinkToken(storeID, shop string, signingKey []byte, ttl time.Duration) (string, error) {
+	claims := StoreLinkClaims{
+		StoreID: storeID,
+		Shop:    shop,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{storeLinkAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(signingKey)
+}
+
+// ParseStoreLinkToken validates a store link token and returns its claims.
+func ParseStoreLinkToken(tokenString string, signingKey []byte) (*StoreLinkClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &StoreLinkClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return signingKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*StoreLinkClaims)
+	if !ok || !token.Valid || claims.StoreID == "" || !claims.VerifyAudience(storeLinkAudience, true) {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
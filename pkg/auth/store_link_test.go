@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreLinkToken(t *testing.T) {
+	key := []byte("test-signing-key")
+
+	token, err := GenerateStoreLinkToken("store-1", "demo.myshopify.com", key, time.Minute)
+	require.NoError(t, err)
+
+	claims, err := ParseStoreLinkToken(token, key)
+	require.NoError(t, err)
+	assert.Equal(t, "store-1", claims.StoreID)
+	assert.Equal(t, "demo.myshopify.com", claims.Shop)
+
+	_, err = ParseStoreLinkToken(token, []byte("other-key"))
+	assert.Error(t, err)
+
+	expired, err := GenerateStoreLinkToken("store-1", "demo.myshopify.com", key, -time.Minute)
+	require.NoError(t, err)
+	_, err = ParseStoreLinkToken(expired, key)
+	assert.Error(t, err)
+
+	// Store session tokens must not be accepted as link tokens
+	session, err := GenerateSessionToken("store-1", "demo.myshopify.com", key, time.Minute)
+	require.NoError(t, err)
+	_, err = ParseStoreLinkToken(session, key)
+	assert.Error(t, err)
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfc6238Secret is the SHA-1 test key of RFC 6238, "12345678901234567890", base32 encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// The last six digits of the RFC 6238 SHA-1 test vectors
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range vectors {
+		code, err := TOTPCode(rfc6238Secret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, expected, code, "time %d", unix)
+	}
+
+	_, err := TOTPCode("not base32!", time.Now())
+	assert.Error(t, err)
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := totpStep(now)
+
+	step, ok := ValidateTOTP(rfc6238Secret, "050471", now, 0)
+	require.True(t, ok)
+	assert.Equal(t, current, step)
+
+	// Codes of the neighbouring periods are accepted for clock drift, older ones are not
+	previous, err := TOTPCode(rfc6238Secret, now.Add(-totpPeriod))
+	require.NoError(t, err)
+	step, ok = ValidateTOTP(rfc6238Secret, previous, now, 0)
+	require.True(t, ok)
+	assert.Equal(t, current-1, step)
+	stale, err := TOTPCode(rfc6238Secret, now.Add(-2*totpPeriod))
+	require.NoError(t, err)
+	_, ok = ValidateTOTP(rfc6238Secret, stale, now, 0)
+	assert.False(t, ok)
+
+	// A code cannot be used twice
+	_, ok = ValidateTOTP(rfc6238Secret, "050471", now, current)
+	assert.False(t, ok)
+
+	_, ok = ValidateTOTP(rfc6238Secret, "12345", now, 0)
+	assert.False(t, ok)
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	code, err := TOTPCode(secret, time.Now())
+	require.NoError(t, err)
+	_, ok := ValidateTOTP(secret, code, time.Now(), 0)
+	assert.True(t, ok)
+
+	uri := TOTPProvisioningURI("MG Search", "jane@example.com", secret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/MG%20Search:jane@example.com?"), uri)
+	assert.Contains(t, uri, "secret="+secret)
+	assert.Contains(t, uri, "issuer=MG+Search")
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, code)
+		assert.False(t, seen[code])
+		seen[code] = true
+	}
+
+	hash := HashRecoveryCode(codes[0])
+	assert.Equal(t, hash, HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))))
+	assert.NotEqual(t, hash, HashRecoveryCode(codes[1]))
+}
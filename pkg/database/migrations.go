@@ -3,12 +3,18 @@ package database
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// WebhookEventRetention controls how long webhook deliveries (including raw payloads) are kept for
+// deduplication and replay. Shopify retries failed deliveries for up to 48 hours, so this comfortably
+// covers the retry window.
+const WebhookEventRetention = 7 * 24 * time.Hour
+
 // RunMigrations creates MongoDB collections and indexes required for the service.
 // For production, prefer using a dedicated migration tool, but this ensures
 // local development works out-of-the-box.
@@ -28,6 +34,14 @@ func RunMigrations(ctx context.Context, client *mongo.Client, dbName string) err
 			Keys:    map[string]interface{}{"api_key_public": 1},
 			Options: options.Index().SetUnique(true),
 		},
+		{
+			Keys:    map[string]interface{}{"client_id": 1},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    map[string]interface{}{"previous_api_key_public": 1},
+			Options: options.Index().SetSparse(true),
+		},
 	}
 
 	if _, err := storesCollection.Indexes().CreateMany(ctx, storeIndexes); err != nil {
@@ -66,6 +80,11 @@ func RunMigrations(ctx context.Context, client *mongo.Client, dbName string) err
 		{
 			Keys: map[string]interface{}{"is_active": 1},
 		},
+		{
+			// One user per single sign-on identity
+			Keys:    bson.D{{Key: "sso_issuer", Value: 1}, {Key: "sso_subject", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"sso_subject": bson.M{"$exists": true}}),
+		},
 	}
 
 	if _, err := usersCollection.Indexes().CreateMany(ctx, userIndexes); err != nil {
@@ -96,6 +115,22 @@ func RunMigrations(ctx context.Context, client *mongo.Client, dbName string) err
 		return fmt.Errorf("failed to create client indexes: %w", err)
 	}
 
+	// Clients created before memberships had roles: every user had full access, so they become owners
+	backfillMembers := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"members": bson.M{
+				"$map": bson.M{
+					"input": bson.M{"$ifNull": bson.A{"$user_ids", bson.A{}}},
+					"as":    "user_id",
+					"in":    bson.M{"user_id": "$$user_id", "role": "owner", "added_at": "$created_at"},
+				},
+			},
+		}}},
+	}
+	if _, err := clientsCollection.UpdateMany(ctx, bson.M{"members": bson.M{"$exists": false}}, backfillMembers); err != nil {
+		return fmt.Errorf("failed to backfill client members: %w", err)
+	}
+
 	// Create indexes collection and indexes
 	indexesCollection := db.Collection("indexes")
 
@@ -118,5 +153,258 @@ func RunMigrations(ctx context.Context, client *mongo.Client, dbName string) err
 		return fmt.Errorf("failed to create index indexes: %w", err)
 	}
 
+	// Create webhook_events collection and indexes
+	webhookEventsCollection := db.Collection("webhook_events")
+
+	// Delivery records and their payloads expire automatically after the retention window
+	webhookEventIndexes := []mongo.IndexModel{
+		{
+			Keys:    map[string]interface{}{"received_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(int32(WebhookEventRetention.Seconds())),
+		},
+		{
+			Keys: map[string]interface{}{"shop_domain": 1},
+		},
+		{
+			Keys: bson.D{
+				{Key: "status", Value: 1},
+				{Key: "next_attempt_at", Value: 1},
+			},
+		},
+	}
+
+	if _, err := webhookEventsCollection.Indexes().CreateMany(ctx, webhookEventIndexes); err != nil {
+		return fmt.Errorf("failed to create webhook event indexes: %w", err)
+	}
+
+	// Create document_versions collection and indexes
+	documentVersionsCollection := db.Collection("document_versions")
+
+	documentVersionIndexes := []mongo.IndexModel{
+		{
+			Keys: map[string]interface{}{"store_id": 1},
+		},
+	}
+
+	if _, err := documentVersionsCollection.Indexes().CreateMany(ctx, documentVersionIndexes); err != nil {
+		return fmt.Errorf("failed to create document version indexes: %w", err)
+	}
+
+	// Create shopify_collections collection and indexes
+	shopifyCollectionsCollection := db.Collection("shopify_collections")
+
+	shopifyCollectionIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "store_id", Value: 1},
+				{Key: "product_ids", Value: 1},
+			},
+		},
+	}
+
+	if _, err := shopifyCollectionsCollection.Indexes().CreateMany(ctx, shopifyCollectionIndexes); err != nil {
+		return fmt.Errorf("failed to create shopify collection indexes: %w", err)
+	}
+
+	// Create inventory collections and indexes
+	inventoryItemIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "store_id", Value: 1},
+				{Key: "product_id", Value: 1},
+			},
+		},
+	}
+
+	if _, err := db.Collection("inventory_items").Indexes().CreateMany(ctx, inventoryItemIndexes); err != nil {
+		return fmt.Errorf("failed to create inventory item indexes: %w", err)
+	}
+
+	inventoryLevelIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "store_id", Value: 1},
+				{Key: "inventory_item_id", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				{Key: "store_id", Value: 1},
+				{Key: "location_id", Value: 1},
+			},
+		},
+	}
+
+	if _, err := db.Collection("inventory_levels").Indexes().CreateMany(ctx, inventoryLevelIndexes); err != nil {
+		return fmt.Errorf("failed to create inventory level indexes: %w", err)
+	}
+
+	locationIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "store_id", Value: 1},
+				{Key: "active", Value: 1},
+			},
+		},
+	}
+
+	if _, err := db.Collection("shopify_locations").Indexes().CreateMany(ctx, locationIndexes); err != nil {
+		return fmt.Errorf("failed to create location indexes: %w", err)
+	}
+
+	// Refresh tokens are deleted once they expire
+	refreshTokenIndexes := []mongo.IndexModel{
+		{
+			Keys:    map[string]interface{}{"token_hash": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: map[string]interface{}{"family_id": 1},
+		},
+		{
+			Keys: map[string]interface{}{"user_id": 1},
+		},
+		{
+			Keys:    map[string]interface{}{"expires_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	if _, err := db.Collection("refresh_tokens").Indexes().CreateMany(ctx, refreshTokenIndexes); err != nil {
+		return fmt.Errorf("failed to create refresh token indexes: %w", err)
+	}
+
+	// Revoked access tokens only need to be kept until they expire
+	revokedTokenIndexes := []mongo.IndexModel{
+		{
+			Keys:    map[string]interface{}{"expires_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	if _, err := db.Collection("revoked_tokens").Indexes().CreateMany(ctx, revokedTokenIndexes); err != nil {
+		return fmt.Errorf("failed to create revoked token indexes: %w", err)
+	}
+
+	// Password reset tokens are deleted once they expire
+	passwordResetIndexes := []mongo.IndexModel{
+		{
+			Keys:    map[string]interface{}{"token_hash": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys:    map[string]interface{}{"expires_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	if _, err := db.Collection("password_reset_tokens").Indexes().CreateMany(ctx, passwordResetIndexes); err != nil {
+		return fmt.Errorf("failed to create password reset indexes: %w", err)
+	}
+
+	// Email verification tokens are deleted once they expire
+	emailVerificationIndexes := []mongo.IndexModel{
+		{
+			Keys:    map[string]interface{}{"token_hash": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys:    map[string]interface{}{"expires_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	if _, err := db.Collection("email_verification_tokens").Indexes().CreateMany(ctx, emailVerificationIndexes); err != nil {
+		return fmt.Errorf("failed to create email verification indexes: %w", err)
+	}
+
+	// Invitations are kept after they are accepted, revoked or expired so the dashboard can show them
+	clientInviteIndexes := []mongo.IndexModel{
+		{
+			Keys:    map[string]interface{}{"token_hash": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "client_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: map[string]interface{}{"email": 1},
+		},
+	}
+
+	if _, err := db.Collection("client_invites").Indexes().CreateMany(ctx, clientInviteIndexes); err != nil {
+		return fmt.Errorf("failed to create client invite indexes: %w", err)
+	}
+
+	// Failed login records are deleted once their failures and lockout have lapsed
+	loginAttemptIndexes := []mongo.IndexModel{
+		{
+			Keys:    map[string]interface{}{"unlock_token_hash": 1},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    map[string]interface{}{"expires_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	if _, err := db.Collection("login_attempts").Indexes().CreateMany(ctx, loginAttemptIndexes); err != nil {
+		return fmt.Errorf("failed to create login attempt indexes: %w", err)
+	}
+
+	securityEventIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "email", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "ip_address", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: map[string]interface{}{"created_at": -1},
+		},
+	}
+
+	if _, err := db.Collection("security_events").Indexes().CreateMany(ctx, securityEventIndexes); err != nil {
+		return fmt.Errorf("failed to create security event indexes: %w", err)
+	}
+
+	// MFA challenges are deleted once they expire
+	mfaChallengeIndexes := []mongo.IndexModel{
+		{
+			Keys:    map[string]interface{}{"token_hash": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    map[string]interface{}{"expires_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	if _, err := db.Collection("mfa_challenges").Indexes().CreateMany(ctx, mfaChallengeIndexes); err != nil {
+		return fmt.Errorf("failed to create mfa challenge indexes: %w", err)
+	}
+
+	// Started SSO logins are deleted once they expire
+	ssoLoginIndexes := []mongo.IndexModel{
+		{
+			Keys:    map[string]interface{}{"state_hash": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    map[string]interface{}{"expires_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	if _, err := db.Collection("sso_logins").Indexes().CreateMany(ctx, ssoLoginIndexes); err != nil {
+		return fmt.Errorf("failed to create sso login indexes: %w", err)
+	}
+
 	return nil
 }
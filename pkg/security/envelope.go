@@ -0,0 +1,213 @@
+package security
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// envelopeMarker starts every ciphertext sealed with a per-scope data key.
+const envelopeMarker byte = 0xE6
+
+// ErrDataKeyNotFound is returned by DataKeyStore implementations when a scope has no data key yet.
+var ErrDataKeyNotFound = errors.New("data key not found")
+
+// WrappedDataKey is a data key encrypted by the master key provider, as persisted by a DataKeyStore.
+type WrappedDataKey struct {
+	Scope   string
+	Wrapped []byte
+}
+
+// DataKeyStore persists wrapped data keys for envelope encryption.
+type DataKeyStore interface {
+	// GetDataKey returns the wrapped data key for scope, or ErrDataKeyNotFound.
+	GetDataKey(ctx context.Context, scope string) ([]byte, error)
+	// CreateDataKey stores wrapped as the data key for scope unless one already exists, and returns
+	// the key that is stored afterwards, so concurrent creators agree on a single key.
+	CreateDataKey(ctx context.Context, scope string, wrapped []byte) ([]byte, error)
+	// ListDataKeys returns every stored data key.
+	ListDataKeys(ctx context.Context) ([]WrappedDataKey, error)
+	// ReplaceDataKey swaps the wrapped key for scope from current to replacement, reporting false
+	// when it no longer holds current.
+	ReplaceDataKey(ctx context.Context, scope string, current, replacement []byte) (bool, error)
+}
+
+// DataKeyRewrapper is implemented by providers whose data keys are themselves encrypted, so that
+// rotating the master key only needs the data keys re-wrapped rather than every secret.
+type DataKeyRewrapper interface {
+	RewrapDataKeys(ctx context.Context) (int, error)
+}
+
+// EnvelopeKeyProvider seals each scope's secrets with a random data key of its own. Data keys are
+// wrapped by the master provider and persisted in a DataKeyStore; unwrapped keys are cached in
+// memory. The scope is authenticated with every ciphertext, so secrets cannot be moved between
+// stores. Secrets sealed directly by the master provider, from before envelope encryption was
+// enabled, remain readable until they are re-encrypted.
+type EnvelopeKeyProvider struct {
+	master KeyProvider
+	store  DataKeyStore
+
+	mu    sync.RWMutex
+	cache map[string][]byte
+}
+
+func NewEnvelopeKeyProvider(master KeyProvider, store DataKeyStore) *EnvelopeKeyProvider {
+	return &EnvelopeKeyProvider{
+		master: master,
+		store:  store,
+		cache:  make(map[string][]byte),
+	}
+}
+
+// Encrypt seals plaintext with the scope's data key, creating the key on first use. Secrets without a
+// scope are sealed by the master provider.
+func (p *EnvelopeKeyProvider) Encrypt(ctx context.Context, scope string, plaintext []byte) ([]byte, error) {
+	if scope == "" {
+		return p.master.Encrypt(ctx, scope, plaintext)
+	}
+
+	dataKey, err := p.dataKey(ctx, scope, true)
+	if err != nil {
+		return nil, err
+	}
+	aesgcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aesgcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to read nonce: %w", err)
+	}
+
+	out := make([]byte, 0, 1+len(nonce)+len(plaintext)+aesgcm.Overhead())
+	out = append(out, envelopeMarker)
+	out = append(out, nonce...)
+	return aesgcm.Seal(out, nonce, plaintext, envelopeAAD(scope)), nil
+}
+
+func (p *EnvelopeKeyProvider) Decrypt(ctx context.Context, scope string, ciphertext []byte) ([]byte, error) {
+	if plaintext, ok, err := p.open(ctx, scope, ciphertext); ok || err != nil {
+		return plaintext, err
+	}
+	return p.master.Decrypt(ctx, scope, ciphertext)
+}
+
+// IsCurrent reports whether ciphertext is sealed with the scope's data key. Secrets still sealed by
+// the master provider are not current, so re-encryption moves them under a data key.
+func (p *EnvelopeKeyProvider) IsCurrent(ctx context.Context, scope string, ciphertext []byte) bool {
+	if scope == "" {
+		return p.master.IsCurrent(ctx, scope, ciphertext)
+	}
+	_, ok, err := p.open(ctx, scope, ciphertext)
+	return ok && err == nil
+}
+
+// RewrapDataKeys re-encrypts data keys that are not sealed with the master provider's current key.
+// It returns the number of keys rewrapped.
+func (p *EnvelopeKeyProvider) RewrapDataKeys(ctx context.Context) (int, error) {
+	keys, err := p.store.ListDataKeys(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list data keys: %w", err)
+	}
+
+	rewrapped := 0
+	for _, key := range keys {
+		if p.master.IsCurrent(ctx, "", key.Wrapped) {
+			continue
+		}
+		dataKey, err := p.master.Decrypt(ctx, "", key.Wrapped)
+		if err != nil {
+			return rewrapped, fmt.Errorf("failed to unwrap data key for %s: %w", key.Scope, err)
+		}
+		wrapped, err := p.master.Encrypt(ctx, "", dataKey)
+		if err != nil {
+			return rewrapped, fmt.Errorf("failed to wrap data key for %s: %w", key.Scope, err)
+		}
+		replaced, err := p.store.ReplaceDataKey(ctx, key.Scope, key.Wrapped, wrapped)
+		if err != nil {
+			return rewrapped, fmt.Errorf("failed to store data key for %s: %w", key.Scope, err)
+		}
+		if replaced {
+			rewrapped++
+		}
+	}
+	return rewrapped, nil
+}
+
+// open decrypts an envelope ciphertext with the scope's data key. ok is false when ciphertext is not
+// an envelope ciphertext of this scope, including when the scope has no data key.
+func (p *EnvelopeKeyProvider) open(ctx context.Context, scope string, ciphertext []byte) ([]byte, bool, error) {
+	if scope == "" || len(ciphertext) < 1 || ciphertext[0] != envelopeMarker {
+		return nil, false, nil
+	}
+
+	dataKey, err := p.dataKey(ctx, scope, false)
+	if errors.Is(err, ErrDataKeyNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	aesgcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, false, err
+	}
+
+	body := ciphertext[1:]
+	nonceSize := aesgcm.NonceSize()
+	if len(body) < nonceSize {
+		return nil, false, nil
+	}
+	plaintext, err := aesgcm.Open(nil, body[:nonceSize], body[nonceSize:], envelopeAAD(scope))
+	if err != nil {
+		// A master-sealed ciphertext can start with the marker byte by chance
+		return nil, false, nil
+	}
+	return plaintext, true, nil
+}
+
+// dataKey returns the unwrapped data key for scope, generating and storing one when create is set.
+func (p *EnvelopeKeyProvider) dataKey(ctx context.Context, scope string, create bool) ([]byte, error) {
+	p.mu.RLock()
+	key, ok := p.cache[scope]
+	p.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	wrapped, err := p.store.GetDataKey(ctx, scope)
+	if errors.Is(err, ErrDataKeyNotFound) && create {
+		fresh := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, fresh); err != nil {
+			return nil, fmt.Errorf("failed to generate data key: %w", err)
+		}
+		sealed, err := p.master.Encrypt(ctx, "", fresh)
+		if err != nil {
+			return nil, fmt.Errorf("failed to wrap data key: %w", err)
+		}
+		wrapped, err = p.store.CreateDataKey(ctx, scope, sealed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store data key: %w", err)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	key, err = p.master.Decrypt(ctx, "", wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	p.mu.Lock()
+	p.cache[scope] = key
+	p.mu.Unlock()
+	return key, nil
+}
+
+func envelopeAAD(scope string) []byte {
+	return append([]byte{envelopeMarker}, scope...)
+}
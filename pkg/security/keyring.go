@@ -0,0 +1,213 @@
+package security
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keyringMarker starts every ciphertext written by a Keyring. The next byte is the ID of the key
+// that sealed it; both bytes are authenticated as additional data.
+const keyringMarker byte = 0xE5
+
+// keyringHeaderLen is the length of the marker and key ID prefix.
+const keyringHeaderLen = 2
+
+// LegacyKeyID is the ID given to ENCRYPTION_KEY when no ENCRYPTION_KEYS are configured.
+const LegacyKeyID byte = 1
+
+// Keyring holds the encryption keys secrets can be sealed with. New ciphertexts use the primary key
+// and carry its ID, so any key still in the ring can open them after the primary changes.
+// Ciphertexts written by EncryptAESGCM before keyrings existed carry no ID; they are opened by
+// trying each key.
+type Keyring struct {
+	keys      map[byte][]byte
+	primaryID byte
+}
+
+// NewKeyring builds a keyring from 32-byte keys indexed by ID. primaryID must be one of them.
+func NewKeyring(primaryID byte, keys map[byte][]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keyring has no keys")
+	}
+	ring := &Keyring{keys: make(map[byte][]byte, len(keys)), primaryID: primaryID}
+	for id, key := range keys {
+		if id == 0 {
+			return nil, errors.New("key ID 0 is reserved")
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %d must be 32 bytes", id)
+		}
+		ring.keys[id] = key
+	}
+	if _, ok := ring.keys[primaryID]; !ok {
+		return nil, fmt.Errorf("primary key %d is not in the keyring", primaryID)
+	}
+	return ring, nil
+}
+
+// LoadKeyring builds the keyring from configuration. keys lists hex keys as "id:hex" pairs
+// separated by commas, e.g. "1:ab12...,2:cd34...". legacyKey (ENCRYPTION_KEY) joins the ring as key
+// 1 unless keys already defines that ID. primaryID selects the key new secrets are sealed with; 0
+// picks the highest ID.
+func LoadKeyring(keys, legacyKey string, primaryID int) (*Keyring, error) {
+	ring := map[byte][]byte{}
+	for _, entry := range strings.Split(keys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		idPart, hexKey, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid keyring entry %q: expected id:hex", entry)
+		}
+		id, err := parseKeyID(idPart)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := ring[id]; exists {
+			return nil, fmt.Errorf("duplicate encryption key ID %d", id)
+		}
+		key, err := MustDecodeKey(strings.TrimSpace(hexKey))
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", id, err)
+		}
+		ring[id] = key
+	}
+
+	if strings.TrimSpace(legacyKey) != "" {
+		if _, exists := ring[LegacyKeyID]; !exists {
+			key, err := MustDecodeKey(strings.TrimSpace(legacyKey))
+			if err != nil {
+				return nil, err
+			}
+			ring[LegacyKeyID] = key
+		}
+	}
+
+	var primary byte
+	if primaryID > 0 {
+		id, err := parseKeyID(strconv.Itoa(primaryID))
+		if err != nil {
+			return nil, err
+		}
+		primary = id
+	} else {
+		for id := range ring {
+			if id > primary {
+				primary = id
+			}
+		}
+	}
+
+	return NewKeyring(primary, ring)
+}
+
+func parseKeyID(value string) (byte, error) {
+	id, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || id < 1 || id > 255 {
+		return 0, fmt.Errorf("invalid encryption key ID %q: must be 1-255", value)
+	}
+	return byte(id), nil
+}
+
+// PrimaryKeyID returns the ID of the key new secrets are sealed with.
+func (k *Keyring) PrimaryKeyID() byte {
+	return k.primaryID
+}
+
+// KeyIDs returns the IDs of all keys in the ring in ascending order.
+func (k *Keyring) KeyIDs() []byte {
+	ids := make([]byte, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Encrypt seals plaintext with the primary key using AES-256-GCM.
+func (k *Keyring) Encrypt(plaintext []byte) ([]byte, error) {
+	aesgcm, err := newGCM(k.keys[k.primaryID])
+	if err != nil {
+		return nil, err
+	}
+
+	header := []byte{keyringMarker, k.primaryID}
+	nonce := make([]byte, aesgcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to read nonce: %w", err)
+	}
+
+	out := make([]byte, 0, keyringHeaderLen+len(nonce)+len(plaintext)+aesgcm.Overhead())
+	out = append(out, header...)
+	out = append(out, nonce...)
+	return aesgcm.Seal(out, nonce, plaintext, header), nil
+}
+
+// Decrypt opens a ciphertext sealed by any key in the ring, including unversioned ciphertexts
+// written by EncryptAESGCM.
+func (k *Keyring) Decrypt(ciphertext []byte) ([]byte, error) {
+	plaintext, _, err := k.open(ciphertext)
+	return plaintext, err
+}
+
+// IsCurrent reports whether ciphertext is sealed with the primary key, i.e. re-encrypting it would
+// not change the key protecting it.
+func (k *Keyring) IsCurrent(ciphertext []byte) bool {
+	_, id, err := k.open(ciphertext)
+	return err == nil && id == k.primaryID
+}
+
+// open decrypts ciphertext and returns the ID of the key that sealed it; the ID is 0 for
+// unversioned ciphertexts.
+func (k *Keyring) open(ciphertext []byte) ([]byte, byte, error) {
+	if len(ciphertext) > keyringHeaderLen && ciphertext[0] == keyringMarker {
+		if key, ok := k.keys[ciphertext[1]]; ok {
+			if plaintext, err := openVersioned(key, ciphertext); err == nil {
+				return plaintext, ciphertext[1], nil
+			}
+		}
+	}
+
+	// A random nonce can start with the marker byte, so unversioned ciphertexts are tried even when
+	// the header looked valid
+	for _, id := range k.KeyIDs() {
+		if plaintext, err := DecryptAESGCM(k.keys[id], ciphertext); err == nil {
+			return plaintext, 0, nil
+		}
+	}
+	return nil, 0, errors.New("failed to decrypt: no key in the keyring opens the ciphertext")
+}
+
+func openVersioned(key, ciphertext []byte) ([]byte, error) {
+	aesgcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header, body := ciphertext[:keyringHeaderLen], ciphertext[keyringHeaderLen:]
+	nonceSize := aesgcm.NonceSize()
+	if len(body) < nonceSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aesgcm.Open(nil, body[:nonceSize], body[nonceSize:], header)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm: %w", err)
+	}
+	return aesgcm, nil
+}
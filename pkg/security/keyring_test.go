@@ -0,0 +1,113 @@
+package security
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(fill byte) []byte {
+	return bytes.Repeat([]byte{fill}, 32)
+}
+
+func TestKeyring_EncryptDecrypt(t *testing.T) {
+	ring, err := NewKeyring(2, map[byte][]byte{1: testKey(1), 2: testKey(2)})
+	require.NoError(t, err)
+
+	ciphertext, err := ring.Encrypt([]byte("shpat_secret"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{keyringMarker, 2}, ciphertext[:keyringHeaderLen])
+
+	plaintext, err := ring.Decrypt(ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "shpat_secret", string(plaintext))
+	assert.True(t, ring.IsCurrent(ciphertext))
+}
+
+func TestKeyring_DecryptsOlderKeysAfterRotation(t *testing.T) {
+	oldRing, err := NewKeyring(1, map[byte][]byte{1: testKey(1)})
+	require.NoError(t, err)
+	sealed, err := oldRing.Encrypt([]byte("token"))
+	require.NoError(t, err)
+	legacy, err := EncryptAESGCM(testKey(1), []byte("legacy-token"))
+	require.NoError(t, err)
+
+	ring, err := NewKeyring(2, map[byte][]byte{1: testKey(1), 2: testKey(2)})
+	require.NoError(t, err)
+
+	plaintext, err := ring.Decrypt(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "token", string(plaintext))
+	assert.False(t, ring.IsCurrent(sealed))
+
+	plaintext, err = ring.Decrypt(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, "legacy-token", string(plaintext))
+	assert.False(t, ring.IsCurrent(legacy))
+}
+
+func TestKeyring_RejectsUnknownOrTamperedCiphertexts(t *testing.T) {
+	ring, err := NewKeyring(1, map[byte][]byte{1: testKey(1), 2: testKey(2)})
+	require.NoError(t, err)
+
+	ciphertext, err := ring.Encrypt([]byte("token"))
+	require.NoError(t, err)
+
+	// The key ID is authenticated, so pointing it at another key in the ring fails
+	tampered := append([]byte{}, ciphertext...)
+	tampered[1] = 2
+	_, err = ring.Decrypt(tampered)
+	assert.Error(t, err)
+
+	other, err := NewKeyring(3, map[byte][]byte{3: testKey(3)})
+	require.NoError(t, err)
+	_, err = other.Decrypt(ciphertext)
+	assert.Error(t, err)
+}
+
+func TestLoadKeyring(t *testing.T) {
+	legacyHex := strings.Repeat("01", 32)
+	newHex := strings.Repeat("02", 32)
+
+	t.Run("legacy key only", func(t *testing.T) {
+		ring, err := LoadKeyring("", legacyHex, 0)
+		require.NoError(t, err)
+		assert.Equal(t, LegacyKeyID, ring.PrimaryKeyID())
+		assert.Equal(t, []byte{1}, ring.KeyIDs())
+	})
+
+	t.Run("highest key is primary by default", func(t *testing.T) {
+		ring, err := LoadKeyring("2:"+newHex, legacyHex, 0)
+		require.NoError(t, err)
+		assert.Equal(t, byte(2), ring.PrimaryKeyID())
+		assert.Equal(t, []byte{1, 2}, ring.KeyIDs())
+	})
+
+	t.Run("explicit primary", func(t *testing.T) {
+		ring, err := LoadKeyring("2:"+newHex, legacyHex, 1)
+		require.NoError(t, err)
+		assert.Equal(t, byte(1), ring.PrimaryKeyID())
+	})
+
+	invalid := map[string]struct {
+		keys    string
+		legacy  string
+		primary int
+	}{
+		"missing id":      {keys: newHex},
+		"id out of range": {keys: "256:" + newHex},
+		"duplicate id":    {keys: "2:" + newHex + ",2:" + newHex},
+		"short key":       {keys: "2:abcd"},
+		"unknown primary": {keys: "2:" + newHex, legacy: legacyHex, primary: 3},
+		"no keys":         {},
+	}
+	for name, tc := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadKeyring(tc.keys, tc.legacy, tc.primary)
+			assert.Error(t, err)
+		})
+	}
+}
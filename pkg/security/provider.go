@@ -0,0 +1,200 @@
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"mgsearch/config"
+)
+
+// KeyProvider encrypts and decrypts stored secrets with keys it manages. scope names the owner of a
+// secret (the shop domain for store and session secrets) so providers can keep separate keys per
+// store; providers with a single keyring ignore it. Handlers and workers only depend on this
+// interface, so key material can move to an external KMS without touching them.
+type KeyProvider interface {
+	Encrypt(ctx context.Context, scope string, plaintext []byte) ([]byte, error)
+	Decrypt(ctx context.Context, scope string, ciphertext []byte) ([]byte, error)
+	// IsCurrent reports whether ciphertext is already sealed the way Encrypt would seal it now, so
+	// re-encrypting it would not change the key protecting it.
+	IsCurrent(ctx context.Context, scope string, ciphertext []byte) bool
+}
+
+// NewKeyProvider builds the provider selected by configuration: the keyring file when
+// ENCRYPTION_KEYRING_FILE is set, ENCRYPTION_KEYS/ENCRYPTION_KEY otherwise, wrapped in envelope
+// encryption when ENCRYPTION_ENVELOPE is enabled. dataKeys is only used in envelope mode.
+func NewKeyProvider(cfg *config.Config, dataKeys DataKeyStore) (KeyProvider, error) {
+	var master KeyProvider
+	if cfg.EncryptionKeyFile != "" {
+		provider, err := NewFileKeyProvider(cfg.EncryptionKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		master = provider
+	} else {
+		provider, err := NewEnvKeyProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		master = provider
+	}
+
+	if !cfg.EncryptionEnvelope {
+		return master, nil
+	}
+	if dataKeys == nil {
+		return nil, errors.New("envelope encryption requires a data key store")
+	}
+	return NewEnvelopeKeyProvider(master, dataKeys), nil
+}
+
+// EnvKeyProvider seals every secret with the keyring configured through environment variables.
+type EnvKeyProvider struct {
+	keyring *Keyring
+}
+
+// NewEnvKeyProvider loads the keyring from ENCRYPTION_KEYS, ENCRYPTION_KEY and
+// ENCRYPTION_PRIMARY_KEY_ID.
+func NewEnvKeyProvider(cfg *config.Config) (*EnvKeyProvider, error) {
+	keyring, err := LoadKeyring(cfg.EncryptionKeys, cfg.EncryptionKey, cfg.EncryptionPrimaryID)
+	if err != nil {
+		return nil, err
+	}
+	return &EnvKeyProvider{keyring: keyring}, nil
+}
+
+func (p *EnvKeyProvider) Encrypt(_ context.Context, _ string, plaintext []byte) ([]byte, error) {
+	return p.keyring.Encrypt(plaintext)
+}
+
+func (p *EnvKeyProvider) Decrypt(_ context.Context, _ string, ciphertext []byte) ([]byte, error) {
+	return p.keyring.Decrypt(ciphertext)
+}
+
+func (p *EnvKeyProvider) IsCurrent(_ context.Context, _ string, ciphertext []byte) bool {
+	return p.keyring.IsCurrent(ciphertext)
+}
+
+// keyringFile is the JSON layout of a local keyring file:
+//
+//	{"primary_key_id": 2, "keys": {"1": "<hex>", "2": "<hex>"}}
+type keyringFile struct {
+	PrimaryKeyID int               `json:"primary_key_id"`
+	Keys         map[string]string `json:"keys"`
+}
+
+// FileKeyProvider seals every secret with a keyring read from a local JSON file. The file is read
+// again whenever its modification time changes, so keys can be added or promoted without a restart.
+type FileKeyProvider struct {
+	path string
+
+	mu      sync.Mutex
+	keyring *Keyring
+	modTime time.Time
+}
+
+// NewFileKeyProvider loads the keyring file at path.
+func NewFileKeyProvider(path string) (*FileKeyProvider, error) {
+	provider := &FileKeyProvider{path: path}
+	if _, err := provider.current(); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+func (p *FileKeyProvider) Encrypt(_ context.Context, _ string, plaintext []byte) ([]byte, error) {
+	keyring, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+	return keyring.Encrypt(plaintext)
+}
+
+func (p *FileKeyProvider) Decrypt(_ context.Context, _ string, ciphertext []byte) ([]byte, error) {
+	keyring, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+	return keyring.Decrypt(ciphertext)
+}
+
+func (p *FileKeyProvider) IsCurrent(_ context.Context, _ string, ciphertext []byte) bool {
+	keyring, err := p.current()
+	return err == nil && keyring.IsCurrent(ciphertext)
+}
+
+// current returns the keyring, reloading the file if it changed. A file that fails to load after a
+// change keeps the previous keyring in use.
+func (p *FileKeyProvider) current() (*Keyring, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		if p.keyring != nil {
+			return p.keyring, nil
+		}
+		return nil, fmt.Errorf("failed to read keyring file: %w", err)
+	}
+	if p.keyring != nil && info.ModTime().Equal(p.modTime) {
+		return p.keyring, nil
+	}
+
+	keyring, err := loadKeyringFile(p.path)
+	if err != nil {
+		if p.keyring != nil {
+			log.Printf("keyring file %s: keeping previous keys: %v", p.path, err)
+			p.modTime = info.ModTime()
+			return p.keyring, nil
+		}
+		return nil, err
+	}
+	p.keyring = keyring
+	p.modTime = info.ModTime()
+	return keyring, nil
+}
+
+func loadKeyringFile(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring file: %w", err)
+	}
+
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring file: %w", err)
+	}
+
+	keys := make(map[byte][]byte, len(file.Keys))
+	var highest byte
+	for idText, hexKey := range file.Keys {
+		id, err := parseKeyID(idText)
+		if err != nil {
+			return nil, err
+		}
+		key, err := MustDecodeKey(hexKey)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", id, err)
+		}
+		keys[id] = key
+		if id > highest {
+			highest = id
+		}
+	}
+
+	primary := highest
+	if file.PrimaryKeyID != 0 {
+		id, err := parseKeyID(strconv.Itoa(file.PrimaryKeyID))
+		if err != nil {
+			return nil, err
+		}
+		primary = id
+	}
+	return NewKeyring(primary, keys)
+}
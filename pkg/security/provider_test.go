@@ -0,0 +1,175 @@
+package security
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mgsearch/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryDataKeyStore is an in-memory DataKeyStore for tests.
+type memoryDataKeyStore struct {
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+func newMemoryDataKeyStore() *memoryDataKeyStore {
+	return &memoryDataKeyStore{keys: map[string][]byte{}}
+}
+
+func (s *memoryDataKeyStore) GetDataKey(_ context.Context, scope string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.keys[scope]; ok {
+		return key, nil
+	}
+	return nil, ErrDataKeyNotFound
+}
+
+func (s *memoryDataKeyStore) CreateDataKey(_ context.Context, scope string, wrapped []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.keys[scope]; ok {
+		return key, nil
+	}
+	s.keys[scope] = wrapped
+	return wrapped, nil
+}
+
+func (s *memoryDataKeyStore) ListDataKeys(_ context.Context) ([]WrappedDataKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []WrappedDataKey{}
+	for scope, wrapped := range s.keys {
+		keys = append(keys, WrappedDataKey{Scope: scope, Wrapped: wrapped})
+	}
+	return keys, nil
+}
+
+func (s *memoryDataKeyStore) ReplaceDataKey(_ context.Context, scope string, current, replacement []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if string(s.keys[scope]) != string(current) {
+		return false, nil
+	}
+	s.keys[scope] = replacement
+	return true, nil
+}
+
+func envProvider(t *testing.T, keys string, primary int) *EnvKeyProvider {
+	provider, err := NewEnvKeyProvider(&config.Config{EncryptionKeys: keys, EncryptionPrimaryID: primary})
+	require.NoError(t, err)
+	return provider
+}
+
+func TestNewKeyProvider(t *testing.T) {
+	keyHex := strings.Repeat("01", 32)
+
+	provider, err := NewKeyProvider(&config.Config{EncryptionKey: keyHex}, nil)
+	require.NoError(t, err)
+	assert.IsType(t, &EnvKeyProvider{}, provider)
+
+	provider, err = NewKeyProvider(&config.Config{EncryptionKey: keyHex, EncryptionEnvelope: true}, newMemoryDataKeyStore())
+	require.NoError(t, err)
+	assert.IsType(t, &EnvelopeKeyProvider{}, provider)
+
+	_, err = NewKeyProvider(&config.Config{EncryptionKey: keyHex, EncryptionEnvelope: true}, nil)
+	assert.Error(t, err)
+}
+
+func TestFileKeyProvider_ReloadsChangedFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	writeFile := func(content string, modTime time.Time) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	start := time.Now().Add(-time.Hour)
+	writeFile(`{"keys": {"1": "`+strings.Repeat("01", 32)+`"}}`, start)
+	provider, err := NewFileKeyProvider(path)
+	require.NoError(t, err)
+
+	sealed, err := provider.Encrypt(ctx, "shop.myshopify.com", []byte("token"))
+	require.NoError(t, err)
+	assert.Equal(t, byte(1), sealed[1])
+
+	// Promote a new key; the old one stays readable
+	writeFile(`{"primary_key_id": 2, "keys": {"1": "`+strings.Repeat("01", 32)+`", "2": "`+strings.Repeat("02", 32)+`"}}`, start.Add(time.Minute))
+	assert.False(t, provider.IsCurrent(ctx, "shop.myshopify.com", sealed))
+	plaintext, err := provider.Decrypt(ctx, "shop.myshopify.com", sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "token", string(plaintext))
+
+	resealed, err := provider.Encrypt(ctx, "shop.myshopify.com", plaintext)
+	require.NoError(t, err)
+	assert.Equal(t, byte(2), resealed[1])
+
+	// A broken file keeps the last good keyring
+	writeFile(`{not json`, start.Add(2*time.Minute))
+	assert.True(t, provider.IsCurrent(ctx, "shop.myshopify.com", resealed))
+}
+
+func TestEnvelopeKeyProvider(t *testing.T) {
+	ctx := context.Background()
+	master := envProvider(t, "1:"+strings.Repeat("01", 32), 0)
+	store := newMemoryDataKeyStore()
+	provider := NewEnvelopeKeyProvider(master, store)
+
+	sealed, err := provider.Encrypt(ctx, "a.myshopify.com", []byte("token-a"))
+	require.NoError(t, err)
+	assert.Equal(t, envelopeMarker, sealed[0])
+	assert.Len(t, store.keys, 1)
+	assert.True(t, provider.IsCurrent(ctx, "a.myshopify.com", sealed))
+
+	plaintext, err := provider.Decrypt(ctx, "a.myshopify.com", sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "token-a", string(plaintext))
+
+	// Ciphertexts are bound to their scope
+	_, err = provider.Decrypt(ctx, "b.myshopify.com", sealed)
+	assert.Error(t, err)
+
+	// Secrets sealed by the master before envelope encryption still open, but are not current
+	legacy, err := master.Encrypt(ctx, "a.myshopify.com", []byte("legacy"))
+	require.NoError(t, err)
+	plaintext, err = provider.Decrypt(ctx, "a.myshopify.com", legacy)
+	require.NoError(t, err)
+	assert.Equal(t, "legacy", string(plaintext))
+	assert.False(t, provider.IsCurrent(ctx, "a.myshopify.com", legacy))
+}
+
+func TestEnvelopeKeyProvider_RewrapDataKeys(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryDataKeyStore()
+	oldMaster := envProvider(t, "1:"+strings.Repeat("01", 32), 0)
+
+	sealed, err := NewEnvelopeKeyProvider(oldMaster, store).Encrypt(ctx, "a.myshopify.com", []byte("token"))
+	require.NoError(t, err)
+
+	newMaster := envProvider(t, "1:"+strings.Repeat("01", 32)+",2:"+strings.Repeat("02", 32), 2)
+	provider := NewEnvelopeKeyProvider(newMaster, store)
+
+	rewrapped, err := provider.RewrapDataKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, rewrapped)
+	assert.True(t, newMaster.IsCurrent(ctx, "", store.keys["a.myshopify.com"]))
+
+	// The data key itself is unchanged, so existing secrets stay current and readable without key 1
+	onlyNew := envProvider(t, "2:"+strings.Repeat("02", 32), 0)
+	plaintext, err := NewEnvelopeKeyProvider(onlyNew, store).Decrypt(ctx, "a.myshopify.com", sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "token", string(plaintext))
+
+	rewrapped, err = provider.RewrapDataKeys(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, rewrapped)
+}
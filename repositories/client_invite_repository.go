@@ -0,0 +1,162 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"mgsearch/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ClientInviteRepository struct {
+	collection *mongo.Collection
+}
+
+func NewClientInviteRepository(db *mongo.Database) *ClientInviteRepository {
+	return &ClientInviteRepository{
+		collection: db.Collection("client_invites"),
+	}
+}
+
+// Create stores a new pending invitation
+func (r *ClientInviteRepository) Create(ctx context.Context, invite *models.ClientInvite) error {
+	if invite.ID.IsZero() {
+		invite.ID = primitive.NewObjectID()
+	}
+	if invite.CreatedAt.IsZero() {
+		invite.CreatedAt = time.Now().UTC()
+	}
+	invite.Status = models.InviteStatusPending
+
+	_, err := r.collection.InsertOne(ctx, invite)
+	return err
+}
+
+// FindPendingByHash finds a pending, unexpired invitation by token hash
+func (r *ClientInviteRepository) FindPendingByHash(ctx context.Context, tokenHash string) (*models.ClientInvite, error) {
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"status":     models.InviteStatusPending,
+		"expires_at": bson.M{"$gt": time.Now().UTC()},
+	}
+
+	var invite models.ClientInvite
+	err := r.collection.FindOne(ctx, filter).Decode(&invite)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("invite not found")
+		}
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// ListByClient returns the invitations of a client, newest first. With pendingOnly set, accepted,
+// revoked and expired invitations are left out.
+func (r *ClientInviteRepository) ListByClient(ctx context.Context, clientID primitive.ObjectID, pendingOnly bool) ([]*models.ClientInvite, error) {
+	filter := bson.M{"client_id": clientID}
+	if pendingOnly {
+		filter["status"] = models.InviteStatusPending
+		filter["expires_at"] = bson.M{"$gt": time.Now().UTC()}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	invites := []*models.ClientInvite{}
+	if err := cursor.All(ctx, &invites); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// Accept marks a pending, unexpired invitation as accepted by the user. It succeeds only once per
+// invitation.
+func (r *ClientInviteRepository) Accept(ctx context.Context, id, userID primitive.ObjectID) error {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"_id":        id,
+		"status":     models.InviteStatusPending,
+		"expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{
+		"status":      models.InviteStatusAccepted,
+		"accepted_at": now,
+		"accepted_by": userID,
+	}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("invite not found")
+	}
+
+	return nil
+}
+
+// Reopen returns an invitation accepted by the user to pending, for when the acceptance could not
+// be completed
+func (r *ClientInviteRepository) Reopen(ctx context.Context, id, userID primitive.ObjectID) error {
+	filter := bson.M{"_id": id, "status": models.InviteStatusAccepted, "accepted_by": userID}
+	update := bson.M{
+		"$set":   bson.M{"status": models.InviteStatusPending},
+		"$unset": bson.M{"accepted_at": "", "accepted_by": ""},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("invite not found")
+	}
+
+	return nil
+}
+
+// Revoke revokes a pending invitation of the client
+func (r *ClientInviteRepository) Revoke(ctx context.Context, clientID, id, revokedBy primitive.ObjectID) error {
+	filter := bson.M{"_id": id, "client_id": clientID, "status": models.InviteStatusPending}
+	update := bson.M{"$set": bson.M{
+		"status":     models.InviteStatusRevoked,
+		"revoked_at": time.Now().UTC(),
+		"revoked_by": revokedBy,
+	}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("invite not found")
+	}
+
+	return nil
+}
+
+// RevokePendingForEmail revokes every pending invitation of the email address to the client
+func (r *ClientInviteRepository) RevokePendingForEmail(ctx context.Context, clientID primitive.ObjectID, email string, revokedBy primitive.ObjectID) error {
+	filter := bson.M{"client_id": clientID, "email": email, "status": models.InviteStatusPending}
+	update := bson.M{"$set": bson.M{
+		"status":     models.InviteStatusRevoked,
+		"revoked_at": time.Now().UTC(),
+		"revoked_by": revokedBy,
+	}}
+
+	_, err := r.collection.UpdateMany(ctx, filter, update)
+	return err
+}
@@ -23,10 +23,12 @@ func NewClientRepository(db *mongo.Database) *ClientRepository {
 	}
 }
 
-// Create creates a new client
+// Create creates a new client. Users listed in UserIDs without a membership become owners, and
+// members missing from UserIDs are added to it.
 func (r *ClientRepository) Create(ctx context.Context, client *models.Client) (*models.Client, error) {
 	client.CreatedAt = time.Now().UTC()
 	client.UpdatedAt = time.Now().UTC()
+	normalizeMembers(client)
 
 	result, err := r.collection.InsertOne(ctx, client)
 	if err != nil {
@@ -177,12 +179,14 @@ func (r *ClientRepository) RevokeAPIKey(ctx context.Context, clientID, apiKeyID
 	return nil
 }
 
-// AddUserToClient adds a user ID to client's user_ids array
-func (r *ClientRepository) AddUserToClient(ctx context.Context, clientID, userID primitive.ObjectID) error {
+// SetRequireMFA sets whether members of the client must sign in with two-factor authentication
+func (r *ClientRepository) SetRequireMFA(ctx context.Context, clientID primitive.ObjectID, required bool) error {
 	filter := bson.M{"_id": clientID}
 	update := bson.M{
-		"$addToSet": bson.M{"user_ids": userID},
-		"$set":      bson.M{"updated_at": time.Now().UTC()},
+		"$set": bson.M{
+			"require_mfa": required,
+			"updated_at":  time.Now().UTC(),
+		},
 	}
 
 	result, err := r.collection.UpdateOne(ctx, filter, update)
@@ -197,12 +201,14 @@ func (r *ClientRepository) AddUserToClient(ctx context.Context, clientID, userID
 	return nil
 }
 
-// RemoveUserFromClient removes a user ID from client's user_ids array
-func (r *ClientRepository) RemoveUserFromClient(ctx context.Context, clientID, userID primitive.ObjectID) error {
+// SetRequireSSO sets whether members of the client must sign in with single sign-on
+func (r *ClientRepository) SetRequireSSO(ctx context.Context, clientID primitive.ObjectID, required bool) error {
 	filter := bson.M{"_id": clientID}
 	update := bson.M{
-		"$pull": bson.M{"user_ids": userID},
-		"$set":  bson.M{"updated_at": time.Now().UTC()},
+		"$set": bson.M{
+			"require_sso": required,
+			"updated_at":  time.Now().UTC(),
+		},
 	}
 
 	result, err := r.collection.UpdateOne(ctx, filter, update)
@@ -217,6 +223,105 @@ func (r *ClientRepository) RemoveUserFromClient(ctx context.Context, clientID, u
 	return nil
 }
 
+// AddMember adds the user to the client with the given role. Existing members keep their role.
+func (r *ClientRepository) AddMember(ctx context.Context, clientID, userID primitive.ObjectID, role models.ClientRole) error {
+	filter := bson.M{"_id": clientID, "members.user_id": bson.M{"$ne": userID}}
+	update := bson.M{
+		"$push":     bson.M{"members": models.ClientMember{UserID: userID, Role: role, AddedAt: time.Now().UTC()}},
+		"$addToSet": bson.M{"user_ids": userID},
+		"$set":      bson.M{"updated_at": time.Now().UTC()},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		if _, err := r.FindByID(ctx, clientID); err != nil {
+			return err
+		}
+		return errors.New("user is already a member")
+	}
+
+	return nil
+}
+
+// UpdateMemberRole changes the role of a member. Demoting the last owner fails, so every client
+// keeps at least one owner.
+func (r *ClientRepository) UpdateMemberRole(ctx context.Context, clientID, userID primitive.ObjectID, role models.ClientRole) error {
+	filter := bson.M{"_id": clientID, "members.user_id": userID}
+	if role != models.ClientRoleOwner {
+		filter = r.keepsOwner(filter, userID)
+	}
+	update := bson.M{"$set": bson.M{"members.$[member].role": role, "updated_at": time.Now().UTC()}}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"member.user_id": userID}},
+	})
+
+	result, err := r.collection.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return r.membershipError(ctx, clientID, userID)
+	}
+
+	return nil
+}
+
+// RemoveMember removes the user from the client. Removing the last owner fails.
+func (r *ClientRepository) RemoveMember(ctx context.Context, clientID, userID primitive.ObjectID) error {
+	filter := r.keepsOwner(bson.M{"_id": clientID, "members.user_id": userID}, userID)
+	update := bson.M{
+		"$pull": bson.M{"members": bson.M{"user_id": userID}, "user_ids": userID},
+		"$set":  bson.M{"updated_at": time.Now().UTC()},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return r.membershipError(ctx, clientID, userID)
+	}
+
+	return nil
+}
+
+// keepsOwner extends filter to only match clients with an owner other than userID
+func (r *ClientRepository) keepsOwner(filter bson.M, userID primitive.ObjectID) bson.M {
+	filter["members"] = bson.M{"$elemMatch": bson.M{"role": models.ClientRoleOwner, "user_id": bson.M{"$ne": userID}}}
+	return filter
+}
+
+// membershipError explains why a membership update matched no client
+func (r *ClientRepository) membershipError(ctx context.Context, clientID, userID primitive.ObjectID) error {
+	client, err := r.FindByID(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if _, ok := client.RoleOf(userID); !ok {
+		return errors.New("member not found")
+	}
+	return errors.New("client must keep at least one owner")
+}
+
+// normalizeMembers keeps UserIDs and Members listing the same users
+func normalizeMembers(client *models.Client) {
+	for _, userID := range client.UserIDs {
+		if _, ok := client.RoleOf(userID); !ok {
+			client.Members = append(client.Members, models.ClientMember{UserID: userID, Role: models.ClientRoleOwner, AddedAt: client.CreatedAt})
+		}
+	}
+	client.UserIDs = make([]primitive.ObjectID, 0, len(client.Members))
+	for _, member := range client.Members {
+		client.UserIDs = append(client.UserIDs, member.UserID)
+	}
+}
+
 // FindByUserID finds all clients associated with a user
 func (r *ClientRepository) FindByUserID(ctx context.Context, userID primitive.ObjectID) ([]*models.Client, error) {
 	filter := bson.M{"user_ids": userID, "is_active": true}
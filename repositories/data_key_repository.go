@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"mgsearch/pkg/security"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DataKeyRepository persists the wrapped per-store data keys used by envelope encryption. It
+// implements security.DataKeyStore.
+type DataKeyRepository struct {
+	collection *mongo.Collection
+}
+
+type dataKeyDocument struct {
+	Scope     string    `bson:"_id"`
+	Wrapped   []byte    `bson:"wrapped_key"`
+	CreatedAt time.Time `bson:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+func NewDataKeyRepository(db *mongo.Database) *DataKeyRepository {
+	return &DataKeyRepository{collection: db.Collection("data_keys")}
+}
+
+func (r *DataKeyRepository) GetDataKey(ctx context.Context, scope string) ([]byte, error) {
+	var doc dataKeyDocument
+	err := r.collection.FindOne(ctx, bson.M{"_id": scope}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, security.ErrDataKeyNotFound
+		}
+		return nil, err
+	}
+	return doc.Wrapped, nil
+}
+
+// CreateDataKey inserts the data key unless the scope already has one and returns the stored key.
+func (r *DataKeyRepository) CreateDataKey(ctx context.Context, scope string, wrapped []byte) ([]byte, error) {
+	now := time.Now().UTC()
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	update := bson.M{
+		"$setOnInsert": bson.M{
+			"wrapped_key": wrapped,
+			"created_at":  now,
+			"updated_at":  now,
+		},
+	}
+
+	var doc dataKeyDocument
+	if err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": scope}, update, opts).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc.Wrapped, nil
+}
+
+func (r *DataKeyRepository) ListDataKeys(ctx context.Context) ([]security.WrappedDataKey, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []dataKeyDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	keys := make([]security.WrappedDataKey, 0, len(docs))
+	for _, doc := range docs {
+		keys = append(keys, security.WrappedDataKey{Scope: doc.Scope, Wrapped: doc.Wrapped})
+	}
+	return keys, nil
+}
+
+func (r *DataKeyRepository) ReplaceDataKey(ctx context.Context, scope string, current, replacement []byte) (bool, error) {
+	filter := bson.M{"_id": scope, "wrapped_key": current}
+	update := bson.M{"$set": bson.M{"wrapped_key": replacement, "updated_at": time.Now().UTC()}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"mgsearch/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type EmailVerificationRepository struct {
+	collection *mongo.Collection
+}
+
+func NewEmailVerificationRepository(db *mongo.Database) *EmailVerificationRepository {
+	return &EmailVerificationRepository{
+		collection: db.Collection("email_verification_tokens"),
+	}
+}
+
+// Create stores a new verification token
+func (r *EmailVerificationRepository) Create(ctx context.Context, token *models.EmailVerificationToken) error {
+	if token.ID.IsZero() {
+		token.ID = primitive.NewObjectID()
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := r.collection.InsertOne(ctx, token)
+	return err
+}
+
+// Consume marks an unused, unexpired token as used and returns it
+func (r *EmailVerificationRepository) Consume(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error) {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"used_at": now}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var token models.EmailVerificationToken
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("verification token not found")
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// InvalidateForUser marks every outstanding verification token of the user as used
+func (r *EmailVerificationRepository) InvalidateForUser(ctx context.Context, userID primitive.ObjectID) error {
+	filter := bson.M{"user_id": userID, "used_at": bson.M{"$exists": false}}
+	_, err := r.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"used_at": time.Now().UTC()}})
+	return err
+}
+
+// CountSince returns how many verification tokens were issued to the user since the given time
+func (r *EmailVerificationRepository) CountSince(ctx context.Context, userID primitive.ObjectID, since time.Time) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{"user_id": userID, "created_at": bson.M{"$gte": since}})
+}
@@ -70,6 +70,12 @@ func (r *IndexRepository) FindByNameAndClientID(ctx context.Context, name string
 	return &index, nil
 }
 
+// DeleteByStoreID removes the index records registered for a linked store.
+func (r *IndexRepository) DeleteByStoreID(ctx context.Context, clientID, storeID primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"client_id": clientID, "store_id": storeID})
+	return err
+}
+
 // FindByID finds an index by ID
 func (r *IndexRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Index, error) {
 	var index models.Index
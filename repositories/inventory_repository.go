@@ -0,0 +1,211 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"mgsearch/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InventoryRepository keeps the inventory state needed to compute in-stock flags: inventory items
+// mapped to their products, per-location levels and the store's locations.
+type InventoryRepository struct {
+	items     *mongo.Collection
+	levels    *mongo.Collection
+	locations *mongo.Collection
+}
+
+func NewInventoryRepository(db *mongo.Database) *InventoryRepository {
+	return &InventoryRepository{
+		items:     db.Collection("inventory_items"),
+		levels:    db.Collection("inventory_levels"),
+		locations: db.Collection("shopify_locations"),
+	}
+}
+
+// ReplaceProductItems stores the product's inventory items and drops items of variants that no
+// longer exist. Per-location levels of the stored items are cleared, since the quantities reported
+// on the product supersede them.
+func (r *InventoryRepository) ReplaceProductItems(ctx context.Context, storeID string, productID int64, items []models.InventoryItem) error {
+	now := time.Now().UTC()
+	itemIDs := make([]int64, 0, len(items))
+	for i := range items {
+		item := items[i]
+		item.ID = fmt.Sprintf("%s:%d", storeID, item.InventoryItemID)
+		item.StoreID = storeID
+		item.UpdatedAt = now
+		itemIDs = append(itemIDs, item.InventoryItemID)
+
+		opts := options.Replace().SetUpsert(true)
+		if _, err := r.items.ReplaceOne(ctx, bson.M{"_id": item.ID}, item, opts); err != nil {
+			return err
+		}
+	}
+
+	_, err := r.items.DeleteMany(ctx, bson.M{
+		"store_id":          storeID,
+		"product_id":        productID,
+		"inventory_item_id": bson.M{"$nin": itemIDs},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.levels.DeleteMany(ctx, bson.M{
+		"store_id":          storeID,
+		"inventory_item_id": bson.M{"$in": itemIDs},
+	})
+	return err
+}
+
+// DeleteProductItems removes all inventory state of a deleted product.
+func (r *InventoryRepository) DeleteProductItems(ctx context.Context, storeID string, productID int64) error {
+	items, err := r.FindItemsByProducts(ctx, storeID, []int64{productID})
+	if err != nil {
+		return err
+	}
+
+	itemIDs := make([]int64, 0, len(items))
+	for _, item := range items {
+		itemIDs = append(itemIDs, item.InventoryItemID)
+	}
+
+	if _, err := r.levels.DeleteMany(ctx, bson.M{"store_id": storeID, "inventory_item_id": bson.M{"$in": itemIDs}}); err != nil {
+		return err
+	}
+	_, err = r.items.DeleteMany(ctx, bson.M{"store_id": storeID, "product_id": productID})
+	return err
+}
+
+// FindItem returns the inventory item or nil if it is unknown (e.g. its product was never indexed).
+func (r *InventoryRepository) FindItem(ctx context.Context, storeID string, inventoryItemID int64) (*models.InventoryItem, error) {
+	var item models.InventoryItem
+	err := r.items.FindOne(ctx, bson.M{"_id": fmt.Sprintf("%s:%d", storeID, inventoryItemID)}).Decode(&item)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// FindItemsByProducts returns the inventory items of the given products.
+func (r *InventoryRepository) FindItemsByProducts(ctx context.Context, storeID string, productIDs []int64) ([]models.InventoryItem, error) {
+	cursor, err := r.items.Find(ctx, bson.M{"store_id": storeID, "product_id": bson.M{"$in": productIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	items := []models.InventoryItem{}
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ReplaceItemLevels replaces all known levels of an inventory item.
+func (r *InventoryRepository) ReplaceItemLevels(ctx context.Context, storeID string, inventoryItemID int64, levels []models.InventoryLevel) error {
+	if _, err := r.levels.DeleteMany(ctx, bson.M{"store_id": storeID, "inventory_item_id": inventoryItemID}); err != nil {
+		return err
+	}
+
+	if len(levels) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	docs := make([]interface{}, 0, len(levels))
+	for _, level := range levels {
+		level.ID = fmt.Sprintf("%s:%d:%d", storeID, level.InventoryItemID, level.LocationID)
+		level.StoreID = storeID
+		level.UpdatedAt = now
+		docs = append(docs, level)
+	}
+	_, err := r.levels.InsertMany(ctx, docs)
+	return err
+}
+
+// FindLevelsByItems returns the known levels of the given inventory items.
+func (r *InventoryRepository) FindLevelsByItems(ctx context.Context, storeID string, inventoryItemIDs []int64) ([]models.InventoryLevel, error) {
+	cursor, err := r.levels.Find(ctx, bson.M{"store_id": storeID, "inventory_item_id": bson.M{"$in": inventoryItemIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	levels := []models.InventoryLevel{}
+	if err := cursor.All(ctx, &levels); err != nil {
+		return nil, err
+	}
+	return levels, nil
+}
+
+// ProductIDsAtLocation returns the products that have stock levels recorded at the location.
+func (r *InventoryRepository) ProductIDsAtLocation(ctx context.Context, storeID string, locationID int64) ([]int64, error) {
+	itemIDs, err := r.levels.Distinct(ctx, "inventory_item_id", bson.M{"store_id": storeID, "location_id": locationID})
+	if err != nil {
+		return nil, err
+	}
+	if len(itemIDs) == 0 {
+		return []int64{}, nil
+	}
+
+	productIDs, err := r.items.Distinct(ctx, "product_id", bson.M{"store_id": storeID, "inventory_item_id": bson.M{"$in": itemIDs}})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]int64, 0, len(productIDs))
+	for _, id := range productIDs {
+		if productID, ok := id.(int64); ok {
+			result = append(result, productID)
+		}
+	}
+	return result, nil
+}
+
+// UpsertLocation records a location and whether it is active.
+func (r *InventoryRepository) UpsertLocation(ctx context.Context, location *models.Location) error {
+	location.ID = fmt.Sprintf("%s:%d", location.StoreID, location.LocationID)
+	location.UpdatedAt = time.Now().UTC()
+
+	opts := options.Replace().SetUpsert(true)
+	_, err := r.locations.ReplaceOne(ctx, bson.M{"_id": location.ID}, location, opts)
+	return err
+}
+
+// DeleteLocation removes a location together with the levels recorded at it.
+func (r *InventoryRepository) DeleteLocation(ctx context.Context, storeID string, locationID int64) error {
+	if _, err := r.levels.DeleteMany(ctx, bson.M{"store_id": storeID, "location_id": locationID}); err != nil {
+		return err
+	}
+	_, err := r.locations.DeleteOne(ctx, bson.M{"_id": fmt.Sprintf("%s:%d", storeID, locationID)})
+	return err
+}
+
+// InactiveLocationIDs returns the store's deactivated locations.
+func (r *InventoryRepository) InactiveLocationIDs(ctx context.Context, storeID string) (map[int64]bool, error) {
+	cursor, err := r.locations.Find(ctx, bson.M{"store_id": storeID, "active": false})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var locations []models.Location
+	if err := cursor.All(ctx, &locations); err != nil {
+		return nil, err
+	}
+
+	inactive := make(map[int64]bool, len(locations))
+	for _, location := range locations {
+		inactive[location.LocationID] = true
+	}
+	return inactive, nil
+}
@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"mgsearch/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoginAttemptRepository tracks failed logins in Mongo so lockouts apply across replicas
+type LoginAttemptRepository struct {
+	collection *mongo.Collection
+}
+
+func NewLoginAttemptRepository(db *mongo.Database) *LoginAttemptRepository {
+	return &LoginAttemptRepository{
+		collection: db.Collection("login_attempts"),
+	}
+}
+
+// Find returns the failed login record with the given ID
+func (r *LoginAttemptRepository) Find(ctx context.Context, id string) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&attempt)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("login attempt not found")
+		}
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// RecordFailure counts a failed login and returns the updated record. Failures older than window are
+// forgotten. Reaching maxFailures while not locked locks the record until now+lockout and sets
+// locked_at to now. The update is a single atomic upsert, so concurrent failures on different
+// replicas are all counted.
+func (r *LoginAttemptRepository) RecordFailure(ctx context.Context, id string, now time.Time, window time.Duration, maxFailures int, lockout time.Duration) (*models.LoginAttempt, error) {
+	epoch := time.Unix(0, 0).UTC()
+	shouldLock := bson.M{"$and": bson.A{
+		bson.M{"$gte": bson.A{"$failures", maxFailures}},
+		bson.M{"$lte": bson.A{bson.M{"$ifNull": bson.A{"$locked_until", epoch}}, now}},
+	}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"failures": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{bson.M{"$ifNull": bson.A{"$last_failure_at", epoch}}, now.Add(-window)}},
+				bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}},
+				1,
+			}},
+			"last_failure_at": now,
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"locked_at":    bson.M{"$cond": bson.A{shouldLock, now, "$locked_at"}},
+			"locked_until": bson.M{"$cond": bson.A{shouldLock, now.Add(lockout), "$locked_until"}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"expires_at": bson.M{"$max": bson.A{now.Add(window), bson.M{"$ifNull": bson.A{"$locked_until", epoch}}}},
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var attempt models.LoginAttempt
+	if err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, pipeline, opts).Decode(&attempt); err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// Clear forgets the failed logins of the record
+func (r *LoginAttemptRepository) Clear(ctx context.Context, id string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// SetUnlockToken stores the hash of a token that clears the record, replacing any earlier one
+func (r *LoginAttemptRepository) SetUnlockToken(ctx context.Context, id, tokenHash string) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"unlock_token_hash": tokenHash}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("login attempt not found")
+	}
+
+	return nil
+}
+
+// ConsumeUnlockToken deletes the record holding the unlock token and returns it
+func (r *LoginAttemptRepository) ConsumeUnlockToken(ctx context.Context, tokenHash string) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := r.collection.FindOneAndDelete(ctx, bson.M{"unlock_token_hash": tokenHash}).Decode(&attempt)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("unlock token not found")
+		}
+		return nil, err
+	}
+	return &attempt, nil
+}
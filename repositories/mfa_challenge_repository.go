@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"mgsearch/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MFAChallengeRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMFAChallengeRepository(db *mongo.Database) *MFAChallengeRepository {
+	return &MFAChallengeRepository{
+		collection: db.Collection("mfa_challenges"),
+	}
+}
+
+// Create stores a new challenge
+func (r *MFAChallengeRepository) Create(ctx context.Context, challenge *models.MFAChallenge) error {
+	if challenge.ID.IsZero() {
+		challenge.ID = primitive.NewObjectID()
+	}
+	if challenge.CreatedAt.IsZero() {
+		challenge.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := r.collection.InsertOne(ctx, challenge)
+	return err
+}
+
+// RecordAttempt counts a verification attempt on an unused, unexpired challenge with fewer than
+// maxAttempts attempts so far, and returns it
+func (r *MFAChallengeRepository) RecordAttempt(ctx context.Context, tokenHash string, maxAttempts int) (*models.MFAChallenge, error) {
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now().UTC()},
+		"attempts":   bson.M{"$lt": maxAttempts},
+	}
+	update := bson.M{"$inc": bson.M{"attempts": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var challenge models.MFAChallenge
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&challenge)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("mfa challenge not found")
+		}
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// Consume marks the challenge as used. It succeeds only once per challenge.
+func (r *MFAChallengeRepository) Consume(ctx context.Context, id primitive.ObjectID) error {
+	filter := bson.M{"_id": id, "used_at": bson.M{"$exists": false}}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"used_at": time.Now().UTC()}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("mfa challenge not found")
+	}
+
+	return nil
+}
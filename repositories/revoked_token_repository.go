@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"mgsearch/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RevokedTokenRepository struct {
+	collection *mongo.Collection
+}
+
+func NewRevokedTokenRepository(db *mongo.Database) *RevokedTokenRepository {
+	return &RevokedTokenRepository{
+		collection: db.Collection("revoked_tokens"),
+	}
+}
+
+// Revoke adds the access token to the denylist until expiresAt
+func (r *RevokedTokenRepository) Revoke(ctx context.Context, tokenID string, userID primitive.ObjectID, expiresAt time.Time) error {
+	update := bson.M{
+		"$setOnInsert": models.RevokedToken{
+			TokenID:   tokenID,
+			UserID:    userID,
+			ExpiresAt: expiresAt,
+			RevokedAt: time.Now().UTC(),
+		},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": tokenID}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// IsRevoked reports whether the access token is on the denylist
+func (r *RevokedTokenRepository) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	err := r.collection.FindOne(ctx, bson.M{"_id": tokenID}).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"mgsearch/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SecurityEventRepository stores the security audit log
+type SecurityEventRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSecurityEventRepository(db *mongo.Database) *SecurityEventRepository {
+	return &SecurityEventRepository{
+		collection: db.Collection("security_events"),
+	}
+}
+
+// Record appends an event to the audit log
+func (r *SecurityEventRepository) Record(ctx context.Context, event *models.SecurityEvent) error {
+	if event.ID.IsZero() {
+		event.ID = primitive.NewObjectID()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := r.collection.InsertOne(ctx, event)
+	return err
+}
+
+// List returns the newest events matching the given email and IP address; empty values match any
+func (r *SecurityEventRepository) List(ctx context.Context, email, ipAddress string, limit int64) ([]*models.SecurityEvent, error) {
+	filter := bson.M{}
+	if email != "" {
+		filter["email"] = email
+	}
+	if ipAddress != "" {
+		filter["ip_address"] = ipAddress
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []*models.SecurityEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
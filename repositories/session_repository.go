@@ -108,3 +108,34 @@ func (r *SessionRepository) GetByShop(ctx context.Context, shop string) ([]*mode
 
 	return sessions, nil
 }
+
+// ListBatch returns up to limit sessions with IDs greater than afterID, in ID order, for jobs that
+// walk every session. Pass "" to start from the beginning.
+func (r *SessionRepository) ListBatch(ctx context.Context, afterID string, limit int64) ([]*models.Session, error) {
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(limit)
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$gt": afterID}}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []*models.Session
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, fmt.Errorf("failed to decode sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// ReplaceAccessToken swaps the session's stored access token from current to replacement. It reports
+// false without writing when the session was updated or deleted meanwhile.
+func (r *SessionRepository) ReplaceAccessToken(ctx context.Context, id, current, replacement string) (bool, error) {
+	filter := bson.M{"_id": id, "access_token": current}
+	update := bson.M{"$set": bson.M{"access_token": replacement}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mgsearch/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ShopifyCollectionRepository struct {
+	collection *mongo.Collection
+}
+
+func NewShopifyCollectionRepository(db *mongo.Database) *ShopifyCollectionRepository {
+	return &ShopifyCollectionRepository{collection: db.Collection("shopify_collections")}
+}
+
+func collectionMembershipKey(storeID string, collectionID int64) string {
+	return fmt.Sprintf("%s:%d", storeID, collectionID)
+}
+
+// Upsert stores the collection and its product memberships and returns the product IDs that
+// belonged to it before the update, so callers can refresh products that left the collection.
+func (r *ShopifyCollectionRepository) Upsert(ctx context.Context, membership *models.CollectionMembership) ([]int64, error) {
+	membership.ID = collectionMembershipKey(membership.StoreID, membership.CollectionID)
+	membership.UpdatedAt = time.Now().UTC()
+	if membership.ProductIDs == nil {
+		membership.ProductIDs = []int64{}
+	}
+
+	opts := options.FindOneAndReplace().SetUpsert(true).SetReturnDocument(options.Before)
+
+	var previous models.CollectionMembership
+	err := r.collection.FindOneAndReplace(ctx, bson.M{"_id": membership.ID}, membership, opts).Decode(&previous)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return []int64{}, nil
+		}
+		return nil, err
+	}
+	return previous.ProductIDs, nil
+}
+
+// Delete removes the collection and returns the product IDs that belonged to it.
+func (r *ShopifyCollectionRepository) Delete(ctx context.Context, storeID string, collectionID int64) ([]int64, error) {
+	var previous models.CollectionMembership
+	err := r.collection.FindOneAndDelete(ctx, bson.M{"_id": collectionMembershipKey(storeID, collectionID)}).Decode(&previous)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return []int64{}, nil
+		}
+		return nil, err
+	}
+	return previous.ProductIDs, nil
+}
+
+// FindByProducts returns every collection of the store containing at least one of the products.
+func (r *ShopifyCollectionRepository) FindByProducts(ctx context.Context, storeID string, productIDs []int64) ([]*models.CollectionMembership, error) {
+	filter := bson.M{
+		"store_id":    storeID,
+		"product_ids": bson.M{"$in": productIDs},
+	}
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	memberships := []*models.CollectionMembership{}
+	if err := cursor.All(ctx, &memberships); err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
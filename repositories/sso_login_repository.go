@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"mgsearch/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type SSOLoginRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSSOLoginRepository(db *mongo.Database) *SSOLoginRepository {
+	return &SSOLoginRepository{
+		collection: db.Collection("sso_logins"),
+	}
+}
+
+// Create stores a started login
+func (r *SSOLoginRepository) Create(ctx context.Context, login *models.SSOLogin) error {
+	if login.ID.IsZero() {
+		login.ID = primitive.NewObjectID()
+	}
+	if login.CreatedAt.IsZero() {
+		login.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := r.collection.InsertOne(ctx, login)
+	return err
+}
+
+// Consume deletes and returns the unexpired login with the state hash, so each login completes once
+func (r *SSOLoginRepository) Consume(ctx context.Context, stateHash string) (*models.SSOLogin, error) {
+	filter := bson.M{
+		"state_hash": stateHash,
+		"expires_at": bson.M{"$gt": time.Now().UTC()},
+	}
+
+	var login models.SSOLogin
+	err := r.collection.FindOneAndDelete(ctx, filter).Decode(&login)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("sso login not found")
+		}
+		return nil, err
+	}
+	return &login, nil
+}
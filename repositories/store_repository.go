@@ -50,20 +50,22 @@ func (r *StoreRepository) CreateOrUpdate(ctx context.Context, store *models.Stor
 		"$set": bson.M{
 			"shop_name":                store.ShopName,
 			"encrypted_access_token":   store.EncryptedAccessToken,
+			"granted_scopes":           store.GrantedScopes,
 			"api_key_private":          store.APIKeyPrivate,
 			"product_index_uid":        store.ProductIndexUID,
 			"meilisearch_index_uid":    store.MeilisearchIndexUID,
 			"meilisearch_document_type": store.MeilisearchDocType,
 			"meilisearch_url":          store.MeilisearchURL,
 			"meilisearch_api_key":      store.MeilisearchAPIKey,
-			"plan_level":              store.PlanLevel,
 			"status":                  "active",
 			"webhook_secret":          store.WebhookSecret,
 			"installed_at":            store.InstalledAt,
 			"sync_state":              store.SyncState,
 			"updated_at":              store.UpdatedAt,
 		},
+		// The plan is owned by billing once the store exists; re-installs must not reset it
 		"$setOnInsert": bson.M{
+			"plan_level": store.PlanLevel,
 			"created_at": store.CreatedAt,
 		},
 	}
@@ -138,3 +140,295 @@ func (r *StoreRepository) UpdateSyncState(ctx context.Context, storeID string, s
 	_, err = r.collection.UpdateOne(ctx, filter, update)
 	return err
 }
+
+// UpdateAccessToken replaces the store's encrypted offline access token and the scopes granted to
+// it, and reactivates the store.
+func (r *StoreRepository) UpdateAccessToken(ctx context.Context, storeID string, encryptedToken []byte, grantedScopes []string) error {
+	objectID, err := primitive.ObjectIDFromHex(storeID)
+	if err != nil {
+		return fmt.Errorf("invalid store ID: %w", err)
+	}
+
+	filter := bson.M{"_id": objectID}
+	update := bson.M{
+		"$set": bson.M{
+			"encrypted_access_token": encryptedToken,
+			"granted_scopes":         grantedScopes,
+			"status":                 "active",
+			"updated_at":             time.Now().UTC(),
+		},
+	}
+
+	_, err = r.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// UpdateGrantedScopes records the scopes granted to the store's current access token.
+func (r *StoreRepository) UpdateGrantedScopes(ctx context.Context, storeID string, grantedScopes []string) error {
+	objectID, err := primitive.ObjectIDFromHex(storeID)
+	if err != nil {
+		return fmt.Errorf("invalid store ID: %w", err)
+	}
+
+	filter := bson.M{"_id": objectID}
+	update := bson.M{
+		"$set": bson.M{
+			"granted_scopes": grantedScopes,
+			"updated_at":     time.Now().UTC(),
+		},
+	}
+
+	_, err = r.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// UpdateSubscription records a status change of the subscription backing the store's plan without
+// changing the plan.
+func (r *StoreRepository) UpdateSubscription(ctx context.Context, storeID string, subscription *models.StoreSubscription) error {
+	objectID, err := primitive.ObjectIDFromHex(storeID)
+	if err != nil {
+		return fmt.Errorf("invalid store ID: %w", err)
+	}
+
+	filter := bson.M{"_id": objectID}
+	update := bson.M{
+		"$set": bson.M{
+			"subscription": subscription,
+			"updated_at":   time.Now().UTC(),
+		},
+	}
+
+	_, err = r.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// UpdatePendingSubscription records the charge awaiting the merchant's approval, or clears it when
+// subscription is nil. The store's plan and active subscription are left alone.
+func (r *StoreRepository) UpdatePendingSubscription(ctx context.Context, storeID string, subscription *models.StoreSubscription) error {
+	objectID, err := primitive.ObjectIDFromHex(storeID)
+	if err != nil {
+		return fmt.Errorf("invalid store ID: %w", err)
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"pending_subscription": subscription,
+			"updated_at":           time.Now().UTC(),
+		},
+	}
+	if subscription == nil {
+		update = bson.M{
+			"$set":   bson.M{"updated_at": time.Now().UTC()},
+			"$unset": bson.M{"pending_subscription": ""},
+		}
+	}
+
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	return err
+}
+
+// ActivateSubscription switches the store to the plan of an approved charge and makes it the
+// store's subscription. The pending charge is cleared when it is the one being activated.
+func (r *StoreRepository) ActivateSubscription(ctx context.Context, storeID string, subscription *models.StoreSubscription) error {
+	objectID, err := primitive.ObjectIDFromHex(storeID)
+	if err != nil {
+		return fmt.Errorf("invalid store ID: %w", err)
+	}
+
+	now := time.Now().UTC()
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{
+		"$set": bson.M{
+			"plan_level":   subscription.PlanLevel,
+			"subscription": subscription,
+			"updated_at":   now,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objectID, "pending_subscription.id": subscription.ID}, bson.M{
+		"$unset": bson.M{"pending_subscription": ""},
+	})
+	return err
+}
+
+// SetClient links the store to a dashboard client, or unlinks it when clientID is nil.
+func (r *StoreRepository) SetClient(ctx context.Context, storeID string, clientID *primitive.ObjectID) error {
+	objectID, err := primitive.ObjectIDFromHex(storeID)
+	if err != nil {
+		return fmt.Errorf("invalid store ID: %w", err)
+	}
+
+	update := bson.M{
+		"$set": bson.M{"client_id": clientID, "updated_at": time.Now().UTC()},
+	}
+	if clientID == nil {
+		update = bson.M{
+			"$set":   bson.M{"updated_at": time.Now().UTC()},
+			"$unset": bson.M{"client_id": ""},
+		}
+	}
+
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	return err
+}
+
+// FindByClientID lists the stores linked to a dashboard client.
+func (r *StoreRepository) FindByClientID(ctx context.Context, clientID primitive.ObjectID) ([]*models.Store, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"client_id": clientID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	stores := []*models.Store{}
+	if err := cursor.All(ctx, &stores); err != nil {
+		return nil, err
+	}
+	return stores, nil
+}
+
+// UpdateIndexing replaces the store's metafield and translation indexing settings.
+func (r *StoreRepository) UpdateIndexing(ctx context.Context, storeID string, indexing models.StoreIndexing) error {
+	objectID, err := primitive.ObjectIDFromHex(storeID)
+	if err != nil {
+		return fmt.Errorf("invalid store ID: %w", err)
+	}
+
+	filter := bson.M{"_id": objectID}
+	update := bson.M{
+		"$set": bson.M{
+			"indexing":   indexing,
+			"updated_at": time.Now().UTC(),
+		},
+	}
+
+	_, err = r.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// UpdatePlan switches the store to a plan and records the subscription paying for it (nil for the
+// free plan).
+func (r *StoreRepository) UpdatePlan(ctx context.Context, storeID, planLevel string, subscription *models.StoreSubscription) error {
+	objectID, err := primitive.ObjectIDFromHex(storeID)
+	if err != nil {
+		return fmt.Errorf("invalid store ID: %w", err)
+	}
+
+	filter := bson.M{"_id": objectID}
+	update := bson.M{
+		"$set": bson.M{
+			"plan_level":   planLevel,
+			"subscription": subscription,
+			"updated_at":   time.Now().UTC(),
+		},
+	}
+
+	_, err = r.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// maxKeyRotations bounds the storefront key rotation history kept on a store.
+const maxKeyRotations = 20
+
+// RotateStorefrontKey replaces the store's storefront key with newKey and records the rotation. The
+// key being replaced stays valid until previousExpiresAt; when that is nil it is revoked at once.
+// The update only applies while currentKey is still the store's key, so concurrent rotations cannot
+// silently discard a key that was just handed out.
+func (r *StoreRepository) RotateStorefrontKey(ctx context.Context, storeID, currentKey, newKey string, previousExpiresAt *time.Time, rotation models.StoreKeyRotation) error {
+	objectID, err := primitive.ObjectIDFromHex(storeID)
+	if err != nil {
+		return fmt.Errorf("invalid store ID: %w", err)
+	}
+
+	filter := bson.M{"_id": objectID, "api_key_public": currentKey}
+	if currentKey == "" {
+		// Stores installed before storefront keys were issued have no key field at all
+		filter["api_key_public"] = bson.M{"$in": bson.A{"", nil}}
+	}
+
+	set := bson.M{
+		"api_key_public": newKey,
+		"updated_at":     time.Now().UTC(),
+	}
+	update := bson.M{
+		"$set": set,
+		"$push": bson.M{
+			"key_rotations": bson.M{"$each": bson.A{rotation}, "$slice": -maxKeyRotations},
+		},
+	}
+	if currentKey != "" && previousExpiresAt != nil {
+		set["previous_api_key_public"] = currentKey
+		set["previous_key_expires_at"] = previousExpiresAt
+	} else {
+		update["$unset"] = bson.M{"previous_api_key_public": "", "previous_key_expires_at": ""}
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("storefront key changed concurrently")
+	}
+	return nil
+}
+
+// GetByPublicAPIKey finds the store a storefront key belongs to. A store's previous key matches until
+// its rotation overlap window closes.
+func (r *StoreRepository) GetByPublicAPIKey(ctx context.Context, key string) (*models.Store, error) {
+	if key == "" {
+		return nil, errors.New("store not found")
+	}
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"api_key_public": key},
+		bson.M{"previous_api_key_public": key, "previous_key_expires_at": bson.M{"$gt": time.Now().UTC()}},
+	}}
+
+	var store models.Store
+	err := r.collection.FindOne(ctx, filter).Decode(&store)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("store not found")
+		}
+		return nil, err
+	}
+	return &store, nil
+}
+
+// ListBatch returns up to limit stores with IDs greater than afterID, in ID order, for jobs that walk
+// every store. Pass primitive.NilObjectID to start from the beginning.
+func (r *StoreRepository) ListBatch(ctx context.Context, afterID primitive.ObjectID, limit int64) ([]*models.Store, error) {
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(limit)
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$gt": afterID}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	stores := []*models.Store{}
+	if err := cursor.All(ctx, &stores); err != nil {
+		return nil, err
+	}
+	return stores, nil
+}
+
+// ReplaceEncryptedSecret swaps one of the store's encrypted fields (encrypted_access_token or
+// meilisearch_api_key) from current to replacement. It reports false without writing when the field
+// no longer holds current, e.g. because the store re-installed meanwhile.
+func (r *StoreRepository) ReplaceEncryptedSecret(ctx context.Context, storeID primitive.ObjectID, field string, current, replacement []byte) (bool, error) {
+	if field != "encrypted_access_token" && field != "meilisearch_api_key" {
+		return false, fmt.Errorf("unsupported encrypted field %q", field)
+	}
+
+	filter := bson.M{"_id": storeID, field: current}
+	update := bson.M{"$set": bson.M{field: replacement}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mgsearch/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UsageRepository keeps per-store monthly usage counters used for plan enforcement.
+type UsageRepository struct {
+	collection *mongo.Collection
+}
+
+func NewUsageRepository(db *mongo.Database) *UsageRepository {
+	return &UsageRepository{collection: db.Collection("store_usage")}
+}
+
+// IncrementSearches counts one search for the store in the current period and returns the total.
+func (r *UsageRepository) IncrementSearches(ctx context.Context, storeID string) (int64, error) {
+	now := time.Now().UTC()
+	period := models.UsagePeriod(now)
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	filter := bson.M{"_id": fmt.Sprintf("%s:%s", storeID, period)}
+	update := bson.M{
+		"$inc": bson.M{"searches": 1},
+		"$set": bson.M{"updated_at": now},
+		"$setOnInsert": bson.M{
+			"store_id": storeID,
+			"period":   period,
+		},
+	}
+
+	var usage models.StoreUsage
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&usage); err != nil {
+		return 0, err
+	}
+	return usage.Searches, nil
+}
+
+// GetCurrent returns the store's usage in the current period.
+func (r *UsageRepository) GetCurrent(ctx context.Context, storeID string) (*models.StoreUsage, error) {
+	period := models.UsagePeriod(time.Now())
+
+	var usage models.StoreUsage
+	err := r.collection.FindOne(ctx, bson.M{"_id": fmt.Sprintf("%s:%s", storeID, period)}).Decode(&usage)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return &models.StoreUsage{StoreID: storeID, Period: period}, nil
+		}
+		return nil, err
+	}
+	return &usage, nil
+}
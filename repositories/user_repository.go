@@ -53,6 +53,45 @@ func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*models
 	return &user, nil
 }
 
+// FindBySSOIdentity finds the user linked to the single sign-on identity
+func (r *UserRepository) FindBySSOIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	var user models.User
+	err := r.collection.FindOne(ctx, bson.M{"sso_issuer": issuer, "sso_subject": subject}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// LinkSSOIdentity links the single sign-on identity to a user who has none yet
+func (r *UserRepository) LinkSSOIdentity(ctx context.Context, userID primitive.ObjectID, issuer, subject string) error {
+	filter := bson.M{"_id": userID, "sso_subject": bson.M{"$exists": false}}
+	update := bson.M{
+		"$set": bson.M{
+			"sso_issuer":  issuer,
+			"sso_subject": subject,
+			"updated_at":  time.Now().UTC(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return errors.New("sso identity already linked")
+		}
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("user already linked to another sso identity")
+	}
+
+	return nil
+}
+
 // FindByID finds a user by ID
 func (r *UserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
 	var user models.User
@@ -93,7 +132,7 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 	return nil
 }
 
-// UpdatePassword updates a user's password
+// UpdatePassword updates a user's password and invalidates the user's access tokens
 func (r *UserRepository) UpdatePassword(ctx context.Context, userID primitive.ObjectID, passwordHash string) error {
 	filter := bson.M{"_id": userID}
 	update := bson.M{
@@ -101,6 +140,183 @@ func (r *UserRepository) UpdatePassword(ctx context.Context, userID primitive.Ob
 			"password_hash": passwordHash,
 			"updated_at":    time.Now().UTC(),
 		},
+		"$inc": bson.M{"token_version": 1},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("user not found")
+	}
+
+	return nil
+}
+
+// MarkEmailVerified records that the user proved ownership of their email address
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, userID primitive.ObjectID) error {
+	filter := bson.M{"_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"email_verified": true,
+			"updated_at":     time.Now().UTC(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("user not found")
+	}
+
+	return nil
+}
+
+// SetPendingTOTPSecret stores an encrypted TOTP secret that becomes active once EnableMFA confirms
+// it
+func (r *UserRepository) SetPendingTOTPSecret(ctx context.Context, userID primitive.ObjectID, secret []byte) error {
+	filter := bson.M{"_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"pending_totp_secret": secret,
+			"updated_at":          time.Now().UTC(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("user not found")
+	}
+
+	return nil
+}
+
+// EnableMFA activates the pending TOTP secret with the given recovery code hashes. step is the time
+// step of the code that confirmed it. It fails when secret is no longer the pending secret, e.g.
+// after enrolling again. The user's access tokens are invalidated.
+func (r *UserRepository) EnableMFA(ctx context.Context, userID primitive.ObjectID, secret []byte, recoveryCodes []string, step int64) error {
+	filter := bson.M{"_id": userID, "pending_totp_secret": secret}
+	update := bson.M{
+		"$set": bson.M{
+			"mfa_enabled":    true,
+			"totp_secret":    secret,
+			"totp_last_step": step,
+			"recovery_codes": recoveryCodes,
+			"updated_at":     time.Now().UTC(),
+		},
+		"$unset": bson.M{"pending_totp_secret": ""},
+		"$inc":   bson.M{"token_version": 1},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("mfa enrollment not found")
+	}
+
+	return nil
+}
+
+// DisableMFA removes the user's TOTP secret and recovery codes and invalidates their access tokens
+func (r *UserRepository) DisableMFA(ctx context.Context, userID primitive.ObjectID) error {
+	filter := bson.M{"_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"mfa_enabled": false,
+			"updated_at":  time.Now().UTC(),
+		},
+		"$unset": bson.M{"totp_secret": "", "pending_totp_secret": "", "totp_last_step": "", "recovery_codes": ""},
+		"$inc":   bson.M{"token_version": 1},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("user not found")
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes replaces the user's recovery code hashes
+func (r *UserRepository) ReplaceRecoveryCodes(ctx context.Context, userID primitive.ObjectID, recoveryCodes []string) error {
+	filter := bson.M{"_id": userID, "mfa_enabled": true}
+	update := bson.M{
+		"$set": bson.M{
+			"recovery_codes": recoveryCodes,
+			"updated_at":     time.Now().UTC(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("user not found")
+	}
+
+	return nil
+}
+
+// UseTOTPStep records that the code of the given time step was used. It returns false when a code
+// of that or a later step was already accepted, so concurrent requests cannot replay a code.
+func (r *UserRepository) UseTOTPStep(ctx context.Context, userID primitive.ObjectID, step int64) (bool, error) {
+	filter := bson.M{
+		"_id":         userID,
+		"mfa_enabled": true,
+		"$or": bson.A{
+			bson.M{"totp_last_step": bson.M{"$lt": step}},
+			bson.M{"totp_last_step": bson.M{"$exists": false}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"totp_last_step": step}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// UseRecoveryCode removes a recovery code hash from the user. It returns false when the code is not
+// one of the user's unused codes.
+func (r *UserRepository) UseRecoveryCode(ctx context.Context, userID primitive.ObjectID, codeHash string) (bool, error) {
+	filter := bson.M{"_id": userID, "mfa_enabled": true, "recovery_codes": codeHash}
+	update := bson.M{
+		"$pull": bson.M{"recovery_codes": codeHash},
+		"$set":  bson.M{"updated_at": time.Now().UTC()},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// IncrementTokenVersion invalidates every access token issued to the user so far
+func (r *UserRepository) IncrementTokenVersion(ctx context.Context, userID primitive.ObjectID) error {
+	filter := bson.M{"_id": userID}
+	update := bson.M{
+		"$inc": bson.M{"token_version": 1},
+		"$set": bson.M{"updated_at": time.Now().UTC()},
 	}
 
 	result, err := r.collection.UpdateOne(ctx, filter, update)
@@ -189,7 +405,8 @@ func (r *UserRepository) List(ctx context.Context, skip, limit int64) ([]*models
 	return users, nil
 }
 
-// Delete deletes a user (soft delete by setting is_active to false)
+// Delete deletes a user (soft delete by setting is_active to false) and invalidates the user's
+// access tokens
 func (r *UserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
 	filter := bson.M{"_id": id}
 	update := bson.M{
@@ -197,6 +414,7 @@ func (r *UserRepository) Delete(ctx context.Context, id primitive.ObjectID) erro
 			"is_active":  false,
 			"updated_at": time.Now().UTC(),
 		},
+		"$inc": bson.M{"token_version": 1},
 	}
 
 	result, err := r.collection.UpdateOne(ctx, filter, update)
@@ -0,0 +1,291 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"mgsearch/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WebhookEventRepository struct {
+	collection *mongo.Collection
+}
+
+func NewWebhookEventRepository(db *mongo.Database) *WebhookEventRepository {
+	return &WebhookEventRepository{collection: db.Collection("webhook_events")}
+}
+
+// RecordDelivery stores the delivery as pending and reports whether it had already been recorded.
+// Records expire through the TTL index on received_at.
+func (r *WebhookEventRepository) RecordDelivery(ctx context.Context, event *models.WebhookEvent) (bool, error) {
+	now := time.Now().UTC()
+	if event.ReceivedAt.IsZero() {
+		event.ReceivedAt = now
+	}
+	if event.Status == "" {
+		event.Status = models.WebhookStatusPending
+	}
+	if event.NextAttemptAt.IsZero() {
+		event.NextAttemptAt = now
+	}
+
+	_, err := r.collection.InsertOne(ctx, event)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// ClaimNext atomically leases the oldest event that is due for processing. Events whose lease
+// expired (e.g. the worker holding them crashed) are claimed again. Returns nil when nothing is due.
+func (r *WebhookEventRepository) ClaimNext(ctx context.Context, lease time.Duration) (*models.WebhookEvent, error) {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"$or": []bson.M{
+			{"status": models.WebhookStatusPending, "next_attempt_at": bson.M{"$lte": now}},
+			{"status": models.WebhookStatusProcessing, "locked_until": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":       models.WebhookStatusProcessing,
+			"locked_until": now.Add(lease),
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "received_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var event models.WebhookEvent
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&event)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &event, nil
+}
+
+// Complete records the final outcome of processing an event.
+func (r *WebhookEventRepository) Complete(ctx context.Context, id, status, lastError string) error {
+	now := time.Now().UTC()
+	update := bson.M{
+		"$set": bson.M{
+			"status":       status,
+			"last_error":   lastError,
+			"processed_at": now,
+		},
+		"$unset": bson.M{"locked_until": ""},
+	}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// Reschedule returns a failed event to the queue for another attempt at nextAttemptAt.
+func (r *WebhookEventRepository) Reschedule(ctx context.Context, id string, nextAttemptAt time.Time, lastError string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"status":          models.WebhookStatusPending,
+			"last_error":      lastError,
+			"next_attempt_at": nextAttemptAt,
+		},
+		"$unset": bson.M{"locked_until": ""},
+	}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// Postpone returns an event to the queue for nextAttemptAt without counting the attempt it was
+// claimed for.
+func (r *WebhookEventRepository) Postpone(ctx context.Context, id string, nextAttemptAt time.Time) error {
+	update := bson.M{
+		"$set": bson.M{
+			"status":          models.WebhookStatusPending,
+			"next_attempt_at": nextAttemptAt,
+		},
+		"$inc":   bson.M{"attempts": -1},
+		"$unset": bson.M{"locked_until": ""},
+	}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// Replay queues a retained event for processing again, regardless of its current status.
+func (r *WebhookEventRepository) Replay(ctx context.Context, id string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"status":          models.WebhookStatusPending,
+			"attempts":        0,
+			"last_error":      "",
+			"next_attempt_at": time.Now().UTC(),
+		},
+		"$unset": bson.M{"locked_until": "", "processed_at": ""},
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("webhook event not found")
+	}
+	return nil
+}
+
+// FindByID returns a retained event including its raw payload.
+func (r *WebhookEventRepository) FindByID(ctx context.Context, id string) (*models.WebhookEvent, error) {
+	var event models.WebhookEvent
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("webhook event not found")
+		}
+		return nil, err
+	}
+	return &event, nil
+}
+
+// List returns the most recent events, optionally filtered by shop and status. Payloads are omitted.
+func (r *WebhookEventRepository) List(ctx context.Context, shopDomain, status string, limit int64) ([]*models.WebhookEvent, error) {
+	filter := bson.M{}
+	if shopDomain != "" {
+		filter["shop_domain"] = shopDomain
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "received_at", Value: -1}}).
+		SetLimit(limit).
+		SetProjection(bson.M{"payload": 0})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []*models.WebhookEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+type DocumentVersionRepository struct {
+	collection *mongo.Collection
+}
+
+func NewDocumentVersionRepository(db *mongo.Database) *DocumentVersionRepository {
+	return &DocumentVersionRepository{collection: db.Collection("document_versions")}
+}
+
+// Advance records updatedAt as the latest version of the document if it is not older than the
+// version already recorded, and leases the document to the caller until Release is called or the
+// lease expires. It returns the lease token, or an empty token when the change is stale and must
+// not be applied. While another caller holds the lease it fails with "document is being processed".
+func (r *DocumentVersionRepository) Advance(ctx context.Context, storeID, documentID string, updatedAt time.Time, deleted bool, lease time.Duration) (string, error) {
+	key := storeID + ":" + documentID
+	// Mongo keeps milliseconds; compare against the value that is actually stored
+	updatedAt = updatedAt.Truncate(time.Millisecond)
+	now := time.Now().UTC()
+	token := primitive.NewObjectID().Hex()
+
+	filter := bson.M{
+		"_id":        key,
+		"updated_at": bson.M{"$lte": updatedAt},
+		"$or": []bson.M{
+			{"locked_until": bson.M{"$exists": false}},
+			{"locked_until": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"store_id":     storeID,
+			"document_id":  documentID,
+			"updated_at":   updatedAt,
+			"deleted":      deleted,
+			"recorded_at":  now,
+			"locked_until": now.Add(lease),
+			"lock_token":   token,
+		},
+	}
+	opts := options.Update().SetUpsert(true)
+
+	// A duplicate key error means the document exists but the filter did not match: it has a newer
+	// version or is leased to another caller. Two first-time writers can race on the insert as well,
+	// so retry once before giving up.
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err := r.collection.UpdateOne(ctx, filter, update, opts)
+		if err == nil {
+			return token, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return "", err
+		}
+
+		var current models.DocumentVersion
+		if err := r.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&current); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			}
+			return "", err
+		}
+		if current.UpdatedAt.After(updatedAt) {
+			return "", nil
+		}
+		if current.LockedUntil != nil && current.LockedUntil.After(now) {
+			return "", errors.New("document is being processed")
+		}
+	}
+	return "", errors.New("document is being processed")
+}
+
+// Release ends the lease taken by Advance. A lease that already expired and was taken over by
+// another caller is left alone.
+func (r *DocumentVersionRepository) Release(ctx context.Context, storeID, documentID, token string) error {
+	filter := bson.M{"_id": storeID + ":" + documentID, "lock_token": token}
+	update := bson.M{"$unset": bson.M{"locked_until": "", "lock_token": ""}}
+	_, err := r.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// RecordedSince returns the IDs of the store's documents whose ID starts with prefix and whose
+// version was recorded at or after since, with the prefix removed.
+func (r *DocumentVersionRepository) RecordedSince(ctx context.Context, storeID, prefix string, since time.Time) ([]string, error) {
+	filter := bson.M{
+		"store_id":    storeID,
+		"document_id": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)},
+		"recorded_at": bson.M{"$gte": since},
+	}
+	opts := options.Find().SetProjection(bson.M{"document_id": 1})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var versions []models.DocumentVersion
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(versions))
+	for _, version := range versions {
+		ids = append(ids, strings.TrimPrefix(version.DocumentID, prefix))
+	}
+	return ids, nil
+}
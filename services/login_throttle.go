@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"mgsearch/models"
+)
+
+const (
+	// After loginDelayAfter recent failures, each further attempt on the account has to wait
+	// loginBaseDelay, doubling with every failure up to loginMaxDelay.
+	loginDelayAfter = 3
+	loginBaseDelay  = time.Second
+	loginMaxDelay   = 30 * time.Second
+)
+
+// LoginAttemptStore persists failed login records shared by all replicas. It is implemented by
+// repositories.LoginAttemptRepository.
+type LoginAttemptStore interface {
+	Find(ctx context.Context, id string) (*models.LoginAttempt, error)
+	RecordFailure(ctx context.Context, id string, now time.Time, window time.Duration, maxFailures int, lockout time.Duration) (*models.LoginAttempt, error)
+	Clear(ctx context.Context, id string) error
+	SetUnlockToken(ctx context.Context, id, tokenHash string) error
+	ConsumeUnlockToken(ctx context.Context, tokenHash string) (*models.LoginAttempt, error)
+}
+
+// LoginPolicy configures LoginThrottle. A zero MaxIPFailures disables IP lockouts.
+type LoginPolicy struct {
+	MaxFailures   int           // Failures within Window that lock an account
+	MaxIPFailures int           // Failures within Window that lock out an IP, across accounts
+	Window        time.Duration // Failures older than this are forgotten
+	Lockout       time.Duration // How long a lock lasts
+}
+
+// LoginCheck is the outcome of LoginThrottle.Check
+type LoginCheck struct {
+	Allowed    bool
+	Locked     bool          // The account or IP is locked, as opposed to waiting out a delay
+	RetryAfter time.Duration // When Allowed is false, how long until the next attempt is accepted
+}
+
+// LoginFailure reports which locks a failed login set. Only the failure that reaches the limit
+// reports it, so lockouts are mailed and audited once.
+type LoginFailure struct {
+	AccountLocked bool
+	IPLocked      bool
+}
+
+// LoginThrottle slows down and locks out repeated failed logins per account and per client IP.
+// Accounts are tracked by normalized email whether or not they exist, so responses do not reveal
+// registered addresses.
+type LoginThrottle struct {
+	store  LoginAttemptStore
+	policy LoginPolicy
+	now    func() time.Time
+}
+
+func NewLoginThrottle(store LoginAttemptStore, policy LoginPolicy) *LoginThrottle {
+	return &LoginThrottle{
+		store:  store,
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+// Check reports whether a login attempt for email from ip may be evaluated now
+func (t *LoginThrottle) Check(ctx context.Context, email, ip string) (LoginCheck, error) {
+	now := t.now().UTC()
+
+	if t.policy.MaxIPFailures > 0 {
+		attempt, err := t.find(ctx, ipAttemptID(ip))
+		if err != nil {
+			return LoginCheck{}, err
+		}
+		if attempt != nil && attempt.IsLocked(now) {
+			return LoginCheck{Locked: true, RetryAfter: attempt.LockedUntil.Sub(now)}, nil
+		}
+	}
+
+	attempt, err := t.find(ctx, accountAttemptID(email))
+	if err != nil {
+		return LoginCheck{}, err
+	}
+	if attempt == nil {
+		return LoginCheck{Allowed: true}, nil
+	}
+	if attempt.IsLocked(now) {
+		return LoginCheck{Locked: true, RetryAfter: attempt.LockedUntil.Sub(now)}, nil
+	}
+	if now.Sub(attempt.LastFailureAt) < t.policy.Window {
+		if next := attempt.LastFailureAt.Add(loginDelay(attempt.Failures)); now.Before(next) {
+			return LoginCheck{RetryAfter: next.Sub(now)}, nil
+		}
+	}
+	return LoginCheck{Allowed: true}, nil
+}
+
+// Failure records a failed login for email from ip
+func (t *LoginThrottle) Failure(ctx context.Context, email, ip string) (LoginFailure, error) {
+	// Mongo stores milliseconds, so truncate to recognize the lock this call sets
+	now := t.now().UTC().Truncate(time.Millisecond)
+
+	var result LoginFailure
+	attempt, err := t.store.RecordFailure(ctx, accountAttemptID(email), now, t.policy.Window, t.policy.MaxFailures, t.policy.Lockout)
+	if err != nil {
+		return result, err
+	}
+	result.AccountLocked = attempt.LockedAt != nil && attempt.LockedAt.Equal(now)
+
+	if t.policy.MaxIPFailures > 0 {
+		attempt, err := t.store.RecordFailure(ctx, ipAttemptID(ip), now, t.policy.Window, t.policy.MaxIPFailures, t.policy.Lockout)
+		if err != nil {
+			return result, err
+		}
+		result.IPLocked = attempt.LockedAt != nil && attempt.LockedAt.Equal(now)
+	}
+	return result, nil
+}
+
+// Success forgets the failed logins of the account. Failures counted for the IP remain, so one
+// valid account does not reset an IP guessing passwords for others.
+func (t *LoginThrottle) Success(ctx context.Context, email string) error {
+	return t.store.Clear(ctx, accountAttemptID(email))
+}
+
+// SetUnlockToken attaches the hash of an unlock token to the account's failed login record
+func (t *LoginThrottle) SetUnlockToken(ctx context.Context, email, tokenHash string) error {
+	return t.store.SetUnlockToken(ctx, accountAttemptID(email), tokenHash)
+}
+
+// Unlock clears the account holding the unlock token and returns its email address
+func (t *LoginThrottle) Unlock(ctx context.Context, tokenHash string) (string, error) {
+	attempt, err := t.store.ConsumeUnlockToken(ctx, tokenHash)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(attempt.ID, "account:"), nil
+}
+
+func (t *LoginThrottle) find(ctx context.Context, id string) (*models.LoginAttempt, error) {
+	attempt, err := t.store.Find(ctx, id)
+	if err != nil {
+		if err.Error() == "login attempt not found" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return attempt, nil
+}
+
+// loginDelay returns how long after its latest failure an account with the given number of recent
+// failures has to wait
+func loginDelay(failures int) time.Duration {
+	if failures < loginDelayAfter {
+		return 0
+	}
+	delay := loginBaseDelay
+	for i := loginDelayAfter; i < failures && delay < loginMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > loginMaxDelay {
+		return loginMaxDelay
+	}
+	return delay
+}
+
+func accountAttemptID(email string) string {
+	return "account:" + email
+}
+
+func ipAttemptID(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mgsearch/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryLoginAttemptStore mirrors the semantics of repositories.LoginAttemptRepository
+type memoryLoginAttemptStore struct {
+	attempts map[string]models.LoginAttempt
+}
+
+func (s *memoryLoginAttemptStore) Find(_ context.Context, id string) (*models.LoginAttempt, error) {
+	attempt, ok := s.attempts[id]
+	if !ok {
+		return nil, errors.New("login attempt not found")
+	}
+	return &attempt, nil
+}
+
+func (s *memoryLoginAttemptStore) RecordFailure(_ context.Context, id string, now time.Time, window time.Duration, maxFailures int, lockout time.Duration) (*models.LoginAttempt, error) {
+	attempt := s.attempts[id]
+	attempt.ID = id
+	if now.Sub(attempt.LastFailureAt) < window {
+		attempt.Failures++
+	} else {
+		attempt.Failures = 1
+	}
+	attempt.LastFailureAt = now
+	if attempt.Failures >= maxFailures && !attempt.IsLocked(now) {
+		lockedUntil := now.Add(lockout)
+		attempt.LockedAt = &now
+		attempt.LockedUntil = &lockedUntil
+	}
+	s.attempts[id] = attempt
+	return &attempt, nil
+}
+
+func (s *memoryLoginAttemptStore) Clear(_ context.Context, id string) error {
+	delete(s.attempts, id)
+	return nil
+}
+
+func (s *memoryLoginAttemptStore) SetUnlockToken(_ context.Context, id, tokenHash string) error {
+	attempt, ok := s.attempts[id]
+	if !ok {
+		return errors.New("login attempt not found")
+	}
+	attempt.UnlockTokenHash = tokenHash
+	s.attempts[id] = attempt
+	return nil
+}
+
+func (s *memoryLoginAttemptStore) ConsumeUnlockToken(_ context.Context, tokenHash string) (*models.LoginAttempt, error) {
+	for id, attempt := range s.attempts {
+		if attempt.UnlockTokenHash == tokenHash {
+			delete(s.attempts, id)
+			return &attempt, nil
+		}
+	}
+	return nil, errors.New("unlock token not found")
+}
+
+func TestLoginThrottle(t *testing.T) {
+	ctx := context.Background()
+	policy := LoginPolicy{MaxFailures: 5, MaxIPFailures: 8, Window: 15 * time.Minute, Lockout: 15 * time.Minute}
+
+	newThrottle := func() (*LoginThrottle, *time.Time) {
+		now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+		throttle := NewLoginThrottle(&memoryLoginAttemptStore{attempts: map[string]models.LoginAttempt{}}, policy)
+		throttle.now = func() time.Time { return now }
+		return throttle, &now
+	}
+
+	t.Run("delays grow and the account locks", func(t *testing.T) {
+		throttle, now := newThrottle()
+		for i := 1; i <= 5; i++ {
+			check, err := throttle.Check(ctx, "jane@example.com", "203.0.113.7")
+			require.NoError(t, err)
+			require.True(t, check.Allowed, "attempt %d", i)
+
+			failure, err := throttle.Failure(ctx, "jane@example.com", "203.0.113.7")
+			require.NoError(t, err)
+			assert.Equal(t, i == 5, failure.AccountLocked, "attempt %d", i)
+			assert.False(t, failure.IPLocked)
+
+			if i < 3 {
+				continue
+			}
+			check, err = throttle.Check(ctx, "jane@example.com", "203.0.113.7")
+			require.NoError(t, err)
+			assert.False(t, check.Allowed)
+			if i < 5 {
+				assert.False(t, check.Locked)
+				assert.Equal(t, loginDelay(i), check.RetryAfter)
+				*now = now.Add(check.RetryAfter)
+			}
+		}
+
+		check, err := throttle.Check(ctx, "jane@example.com", "203.0.113.7")
+		require.NoError(t, err)
+		assert.True(t, check.Locked)
+		assert.Equal(t, policy.Lockout, check.RetryAfter)
+
+		// Other accounts are unaffected
+		check, err = throttle.Check(ctx, "john@example.com", "203.0.113.7")
+		require.NoError(t, err)
+		assert.True(t, check.Allowed)
+
+		*now = now.Add(policy.Lockout)
+		check, err = throttle.Check(ctx, "jane@example.com", "203.0.113.7")
+		require.NoError(t, err)
+		assert.True(t, check.Allowed)
+	})
+
+	t.Run("success and unlock clear the account", func(t *testing.T) {
+		throttle, _ := newThrottle()
+		for i := 0; i < 5; i++ {
+			_, err := throttle.Failure(ctx, "jane@example.com", "203.0.113.7")
+			require.NoError(t, err)
+		}
+		require.NoError(t, throttle.SetUnlockToken(ctx, "jane@example.com", "token-hash"))
+
+		email, err := throttle.Unlock(ctx, "token-hash")
+		require.NoError(t, err)
+		assert.Equal(t, "jane@example.com", email)
+		check, err := throttle.Check(ctx, "jane@example.com", "203.0.113.7")
+		require.NoError(t, err)
+		assert.True(t, check.Allowed)
+
+		_, err = throttle.Unlock(ctx, "token-hash")
+		assert.EqualError(t, err, "unlock token not found")
+
+		_, err = throttle.Failure(ctx, "john@example.com", "203.0.113.7")
+		require.NoError(t, err)
+		require.NoError(t, throttle.Success(ctx, "john@example.com"))
+		_, err = throttle.store.Find(ctx, accountAttemptID("john@example.com"))
+		assert.Error(t, err)
+	})
+
+	t.Run("an IP is locked across accounts", func(t *testing.T) {
+		throttle, _ := newThrottle()
+		var failure LoginFailure
+		for i := 0; i < 8; i++ {
+			var err error
+			failure, err = throttle.Failure(ctx, "user"+string(rune('a'+i))+"@example.com", "203.0.113.7")
+			require.NoError(t, err)
+			assert.False(t, failure.AccountLocked)
+		}
+		assert.True(t, failure.IPLocked)
+
+		check, err := throttle.Check(ctx, "fresh@example.com", "203.0.113.7")
+		require.NoError(t, err)
+		assert.True(t, check.Locked)
+		check, err = throttle.Check(ctx, "fresh@example.com", "198.51.100.1")
+		require.NoError(t, err)
+		assert.True(t, check.Allowed)
+	})
+
+	t.Run("old failures are forgotten", func(t *testing.T) {
+		throttle, now := newThrottle()
+		for i := 0; i < 4; i++ {
+			_, err := throttle.Failure(ctx, "jane@example.com", "203.0.113.7")
+			require.NoError(t, err)
+		}
+		*now = now.Add(policy.Window)
+
+		failure, err := throttle.Failure(ctx, "jane@example.com", "203.0.113.7")
+		require.NoError(t, err)
+		assert.False(t, failure.AccountLocked)
+		check, err := throttle.Check(ctx, "jane@example.com", "203.0.113.7")
+		require.NoError(t, err)
+		assert.True(t, check.Allowed)
+	})
+}
+
+func TestLoginDelay(t *testing.T) {
+	assert.Equal(t, time.Duration(0), loginDelay(2))
+	assert.Equal(t, time.Second, loginDelay(3))
+	assert.Equal(t, 2*time.Second, loginDelay(4))
+	assert.Equal(t, 16*time.Second, loginDelay(7))
+	assert.Equal(t, loginMaxDelay, loginDelay(8))
+	assert.Equal(t, loginMaxDelay, loginDelay(100))
+}
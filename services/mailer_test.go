@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"mgsearch/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatMailMessage(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	raw := string(formatMailMessage("no-reply@example.com", MailMessage{
+		To:      "user@example.com",
+		Subject: "Reset\r\nBcc: attacker@example.com",
+		Body:    "line one\nline two",
+	}, now))
+
+	headers, body, ok := strings.Cut(raw, "\r\n\r\n")
+	require.True(t, ok)
+	assert.Contains(t, headers, "From: no-reply@example.com\r\n")
+	assert.Contains(t, headers, "To: user@example.com\r\n")
+	assert.Contains(t, headers, "Subject: ResetBcc: attacker@example.com\r\n")
+	assert.NotContains(t, headers, "\r\nBcc:")
+	assert.Contains(t, headers, "Date: Thu, 02 Jan 2025 03:04:05 +0000")
+	assert.Equal(t, "line one\r\nline two\r\n", body)
+}
+
+func TestNewMailer(t *testing.T) {
+	mailer, err := NewMailer(&config.Config{})
+	require.NoError(t, err)
+	assert.NoError(t, mailer.Send(context.Background(), MailMessage{To: "user@example.com"}))
+
+	_, err = NewMailer(&config.Config{SMTPHost: "smtp.example.com", SMTPPort: 587})
+	assert.Error(t, err)
+
+	mailer, err = NewMailer(&config.Config{SMTPHost: "smtp.example.com", SMTPPort: 587, SMTPFrom: "no-reply@example.com"})
+	require.NoError(t, err)
+	assert.IsType(t, &SMTPMailer{}, mailer)
+}
+
+func TestMemoryMailer(t *testing.T) {
+	mailer := NewMemoryMailer()
+	require.NoError(t, mailer.Send(context.Background(), MailMessage{To: "a@example.com"}))
+	require.NoError(t, mailer.Send(context.Background(), MailMessage{To: "b@example.com"}))
+
+	messages := mailer.Messages()
+	require.Len(t, messages, 2)
+	assert.Equal(t, "a@example.com", messages[0].To)
+	assert.Equal(t, "b@example.com", messages[1].To)
+}
@@ -14,6 +14,9 @@ import (
 	meilisearch "github.com/meilisearch/meilisearch-go"
 )
 
+// documentBatchSize bounds the number of documents sent or listed per Meilisearch request.
+const documentBatchSize = 1000
+
 type MeilisearchService struct {
 	client     meilisearch.ServiceManager
 	baseURL    string
@@ -23,15 +26,21 @@ type MeilisearchService struct {
 
 // NewMeilisearchService creates a new Meilisearch service instance backed by the official SDK
 func NewMeilisearchService(cfg *config.Config) *MeilisearchService {
+	return NewMeilisearchServiceWithCredentials(cfg.MeilisearchURL, cfg.MeilisearchAPIKey)
+}
+
+// NewMeilisearchServiceWithCredentials creates a Meilisearch service for an explicit instance,
+// used for stores hosted on their own Meilisearch server
+func NewMeilisearchServiceWithCredentials(url, apiKey string) *MeilisearchService {
 	client := meilisearch.New(
-		cfg.MeilisearchURL,
-		meilisearch.WithAPIKey(cfg.MeilisearchAPIKey),
+		url,
+		meilisearch.WithAPIKey(apiKey),
 	)
 
 	return &MeilisearchService{
 		client:     client,
-		baseURL:    cfg.MeilisearchURL,
-		apiKey:     cfg.MeilisearchAPIKey,
+		baseURL:    url,
+		apiKey:     apiKey,
 		httpClient: &http.Client{},
 	}
 }
@@ -87,6 +96,30 @@ func (s *MeilisearchService) IndexDocument(indexName string, document models.Doc
 	return &response, nil
 }
 
+// IndexDocuments adds or replaces documents in batches in the specified index.
+func (s *MeilisearchService) IndexDocuments(indexName string, documents []models.Document) error {
+	if len(documents) == 0 {
+		return nil
+	}
+	if _, err := s.client.Index(indexName).AddDocumentsInBatches(documents, documentBatchSize, nil); err != nil {
+		return fmt.Errorf("meilisearch indexing failed: %w", err)
+	}
+	return nil
+}
+
+// GetDocument fetches a single document by identifier.
+func (s *MeilisearchService) GetDocument(indexName, documentID string) (models.Document, error) {
+	var document models.Document
+	if err := s.client.Index(indexName).GetDocument(documentID, nil, &document); err != nil {
+		var meiliErr *meilisearch.Error
+		if errors.As(err, &meiliErr) && meiliErr.StatusCode == http.StatusNotFound {
+			return nil, errors.New("document not found")
+		}
+		return nil, fmt.Errorf("meilisearch get document failed: %w", err)
+	}
+	return document, nil
+}
+
 // DeleteDocument removes a single document by identifier.
 func (s *MeilisearchService) DeleteDocument(indexName, documentID string) error {
 	if indexName == "" || documentID == "" {
@@ -97,6 +130,299 @@ func (s *MeilisearchService) DeleteDocument(indexName, documentID string) error
 	return err
 }
 
+// DeleteDocuments removes documents by identifier.
+func (s *MeilisearchService) DeleteDocuments(indexName string, documentIDs []string) error {
+	if len(documentIDs) == 0 {
+		return nil
+	}
+	if _, err := s.client.Index(indexName).DeleteDocuments(documentIDs); err != nil {
+		return fmt.Errorf("meilisearch delete documents failed: %w", err)
+	}
+	return nil
+}
+
+// DocumentIDs lists the identifiers of every document stored in the index.
+func (s *MeilisearchService) DocumentIDs(indexName string) ([]string, error) {
+	ids := []string{}
+	for offset := int64(0); ; offset += documentBatchSize {
+		var result meilisearch.DocumentsResult
+		err := s.client.Index(indexName).GetDocuments(&meilisearch.DocumentsQuery{
+			Fields: []string{"id"},
+			Offset: offset,
+			Limit:  documentBatchSize,
+		}, &result)
+		if err != nil {
+			return nil, fmt.Errorf("meilisearch get documents failed: %w", err)
+		}
+
+		for _, hit := range result.Results {
+			var id interface{}
+			if raw, ok := hit["id"]; ok {
+				if err := json.Unmarshal(raw, &id); err != nil {
+					continue
+				}
+			}
+			switch value := id.(type) {
+			case float64:
+				ids = append(ids, fmt.Sprintf("%.0f", value))
+			case string:
+				ids = append(ids, value)
+			}
+		}
+		if int64(len(result.Results)) < documentBatchSize {
+			return ids, nil
+		}
+	}
+}
+
+// ProductDocuments returns up to limit product documents of the index, starting at offset.
+func (s *MeilisearchService) ProductDocuments(indexName string, offset, limit int64) ([]models.ShopifyProductDocument, error) {
+	var result meilisearch.DocumentsResult
+	err := s.client.Index(indexName).GetDocuments(&meilisearch.DocumentsQuery{
+		Offset: offset,
+		Limit:  limit,
+	}, &result)
+	if err != nil {
+		return nil, fmt.Errorf("meilisearch get documents failed: %w", err)
+	}
+
+	products := make([]models.ShopifyProductDocument, 0, len(result.Results))
+	for _, hit := range result.Results {
+		var product models.ShopifyProductDocument
+		if err := hit.DecodeInto(&product); err != nil {
+			return nil, fmt.Errorf("failed to decode product document: %w", err)
+		}
+		products = append(products, product)
+	}
+	return products, nil
+}
+
+// ReplaceDocuments makes the index hold exactly the given documents: they are added or replaced,
+// then every other document is deleted except those listed in keepIDs, which are left as they are.
+func (s *MeilisearchService) ReplaceDocuments(indexName string, documents []models.Document, keepIDs []string) error {
+	if err := s.IndexDocuments(indexName, documents); err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool, len(documents)+len(keepIDs))
+	for _, document := range documents {
+		keep[fmt.Sprintf("%v", document["id"])] = true
+	}
+	for _, id := range keepIDs {
+		keep[id] = true
+	}
+
+	existing, err := s.DocumentIDs(indexName)
+	if err != nil {
+		return err
+	}
+	stale := []string{}
+	for _, id := range existing {
+		if !keep[id] {
+			stale = append(stale, id)
+		}
+	}
+	return s.DeleteDocuments(indexName, stale)
+}
+
+// UpdateDocuments partially updates documents: only the fields present in each document are
+// replaced. Documents that do not exist yet are created, so callers should only send updates for
+// documents known to be indexed.
+func (s *MeilisearchService) UpdateDocuments(indexName string, documents []models.Document) error {
+	if len(documents) == 0 {
+		return nil
+	}
+	index := s.client.Index(indexName)
+	if _, err := index.UpdateDocuments(documents, nil); err != nil {
+		return fmt.Errorf("meilisearch partial update failed: %w", err)
+	}
+	return nil
+}
+
+// ExistingDocumentIDs returns the subset of ids that are currently stored in the index.
+func (s *MeilisearchService) ExistingDocumentIDs(indexName string, ids []string) (map[string]bool, error) {
+	existing := make(map[string]bool, len(ids))
+	if len(ids) == 0 {
+		return existing, nil
+	}
+
+	var result meilisearch.DocumentsResult
+	err := s.client.Index(indexName).GetDocuments(&meilisearch.DocumentsQuery{
+		Ids:    ids,
+		Fields: []string{"id"},
+		Limit:  int64(len(ids)),
+	}, &result)
+	if err != nil {
+		return nil, fmt.Errorf("meilisearch get documents failed: %w", err)
+	}
+
+	for _, hit := range result.Results {
+		var id interface{}
+		if raw, ok := hit["id"]; ok {
+			if err := json.Unmarshal(raw, &id); err != nil {
+				continue
+			}
+		}
+		switch value := id.(type) {
+		case float64:
+			existing[fmt.Sprintf("%.0f", value)] = true
+		case string:
+			existing[value] = true
+		}
+	}
+	return existing, nil
+}
+
+// DocumentCount returns the number of documents stored in the index.
+func (s *MeilisearchService) DocumentCount(indexName string) (int64, error) {
+	stats, err := s.client.Index(indexName).GetStats()
+	if err != nil {
+		return 0, fmt.Errorf("meilisearch index stats failed: %w", err)
+	}
+	return stats.NumberOfDocuments, nil
+}
+
+// Attributes storefront search relies on in product and content indexes.
+var (
+	productFilterableAttributes = []string{
+		"document_type",
+		"in_stock",
+		"collections",
+		"collection_ids",
+		"vendor",
+		"product_type",
+		"tags",
+		"price_min",
+		"price_max",
+		"metafields",
+	}
+	productSortableAttributes = []string{
+		"in_stock",
+		"price_min",
+		"price_max",
+		"created_at",
+		"published_at",
+	}
+	contentSearchableAttributes = []string{"title", "summary", "body", "tags", "author", "blog_title"}
+	contentFilterableAttributes = []string{"document_type", "blog_handle", "tags"}
+	contentSortableAttributes   = []string{"published_at", "updated_at"}
+)
+
+// ConfigureProductIndex makes sure Shopify product indexes have the settings storefront search relies
+// on: stock, collection and metafield filters, and sorting so out-of-stock products can be demoted
+// with sort=["in_stock:desc"] without losing relevance ordering. Attributes the merchant configured
+// on the index are kept.
+func (s *MeilisearchService) ConfigureProductIndex(indexUID string) error {
+	return s.ensureIndexAttributes(indexUID, nil, productFilterableAttributes, productSortableAttributes)
+}
+
+// ConfigureContentIndex makes sure collection, page and article indexes have the settings storefront
+// search relies on. Attributes the merchant configured on the index are kept.
+func (s *MeilisearchService) ConfigureContentIndex(indexUID string) error {
+	return s.ensureIndexAttributes(indexUID, contentSearchableAttributes, contentFilterableAttributes, contentSortableAttributes)
+}
+
+// ensureIndexAttributes adds the given attributes to the index's current settings, updating only the
+// settings that are missing some of them since every settings change makes Meilisearch reindex.
+// Searchable attributes are only replaced while the index still searches every attribute ("*");
+// otherwise missing ones are appended so the configured ranking order is kept. An index that does not
+// exist yet has no settings; updating them creates it.
+func (s *MeilisearchService) ensureIndexAttributes(indexUID string, searchable, filterable, sortable []string) error {
+	if indexUID == "" {
+		return fmt.Errorf("index uid is required")
+	}
+	index := s.client.Index(indexUID)
+
+	if len(searchable) > 0 {
+		current, err := index.GetSearchableAttributes()
+		if err != nil && !IsIndexNotFound(err) {
+			return fmt.Errorf("meilisearch get settings failed: %w", err)
+		}
+		var attributes []string
+		if current != nil && !(len(*current) == 1 && (*current)[0] == "*") {
+			attributes = *current
+		}
+		if merged, changed := appendMissing(attributes, searchable); changed {
+			if _, err := index.UpdateSearchableAttributes(&merged); err != nil {
+				return fmt.Errorf("meilisearch update settings failed: %w", err)
+			}
+		}
+	}
+
+	currentFilterable, err := index.GetFilterableAttributes()
+	if err != nil && !IsIndexNotFound(err) {
+		return fmt.Errorf("meilisearch get settings failed: %w", err)
+	}
+	if currentFilterable == nil {
+		currentFilterable = &[]interface{}{}
+	}
+	if merged, changed := appendMissingFilterable(*currentFilterable, filterable); changed {
+		if _, err := index.UpdateFilterableAttributes(&merged); err != nil {
+			return fmt.Errorf("meilisearch update settings failed: %w", err)
+		}
+	}
+
+	currentSortable, err := index.GetSortableAttributes()
+	if err != nil && !IsIndexNotFound(err) {
+		return fmt.Errorf("meilisearch get settings failed: %w", err)
+	}
+	if currentSortable == nil {
+		currentSortable = &[]string{}
+	}
+	if merged, changed := appendMissing(*currentSortable, sortable); changed {
+		if _, err := index.UpdateSortableAttributes(&merged); err != nil {
+			return fmt.Errorf("meilisearch update settings failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// appendMissing returns current with the required attributes it lacks appended, and whether any were.
+func appendMissing(current, required []string) ([]string, bool) {
+	present := make(map[string]bool, len(current))
+	for _, attribute := range current {
+		present[attribute] = true
+	}
+
+	merged := append([]string{}, current...)
+	for _, attribute := range required {
+		if !present[attribute] {
+			merged = append(merged, attribute)
+			present[attribute] = true
+		}
+	}
+	return merged, len(merged) > len(current)
+}
+
+// appendMissingFilterable is appendMissing for filterable attributes, which Meilisearch also accepts
+// as objects matching attribute patterns. Attributes named by such objects count as present.
+func appendMissingFilterable(current []interface{}, required []string) ([]interface{}, bool) {
+	present := map[string]bool{}
+	for _, entry := range current {
+		switch value := entry.(type) {
+		case string:
+			present[value] = true
+		case map[string]interface{}:
+			patterns, _ := value["attributePatterns"].([]interface{})
+			for _, pattern := range patterns {
+				if name, ok := pattern.(string); ok {
+					present[name] = true
+				}
+			}
+		}
+	}
+
+	merged := append([]interface{}{}, current...)
+	for _, attribute := range required {
+		if !present[attribute] {
+			merged = append(merged, attribute)
+			present[attribute] = true
+		}
+	}
+	return merged, len(merged) > len(current)
+}
+
 // CreateIndex creates a new index in Meilisearch
 func (s *MeilisearchService) CreateIndex(uid string, primaryKey string) (map[string]interface{}, error) {
 	cfg := &meilisearch.IndexConfig{
@@ -170,6 +496,23 @@ func (s *MeilisearchService) EnsureIndex(indexUID string) error {
 	return err
 }
 
+// DeleteIndex deletes the index along with its documents.
+func (s *MeilisearchService) DeleteIndex(indexUID string) error {
+	if indexUID == "" {
+		return fmt.Errorf("index uid is required")
+	}
+	if _, err := s.client.DeleteIndex(indexUID); err != nil {
+		return fmt.Errorf("meilisearch delete index failed: %w", err)
+	}
+	return nil
+}
+
+// IsIndexNotFound reports whether err was caused by a missing Meilisearch index.
+func IsIndexNotFound(err error) bool {
+	var meiliErr *meilisearch.Error
+	return errors.As(err, &meiliErr) && meiliErr.MeilisearchApiError.Code == "index_not_found"
+}
+
 func toSDKSearchRequest(request *models.SearchRequest) (*meilisearch.SearchRequest, error) {
 	if request == nil {
 		return nil, errors.New("search request cannot be nil")
@@ -289,3 +632,8 @@ func (s *MeilisearchService) GetTask(taskUID string) (*models.TaskResponse, erro
 
 	return &taskResponse, nil
 }
+
+// BaseURL returns the URL of the Meilisearch instance the service talks to
+func (s *MeilisearchService) BaseURL() string {
+	return s.baseURL
+}
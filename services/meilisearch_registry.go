@@ -0,0 +1,90 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"mgsearch/config"
+	"mgsearch/models"
+	"mgsearch/pkg/security"
+)
+
+// MeilisearchRegistry hands out the Meilisearch service a store's data lives on. Stores installed
+// with their own Meilisearch URL or API key get a dedicated client, built on first use and cached
+// until the store's connection settings change; all other stores share the default service.
+type MeilisearchRegistry struct {
+	defaultService *MeilisearchService
+	defaultURL     string
+	defaultAPIKey  string
+	keys           security.KeyProvider
+
+	mu      sync.RWMutex
+	clients map[string]*registryEntry
+}
+
+type registryEntry struct {
+	url          string
+	encryptedKey []byte
+	service      *MeilisearchService
+}
+
+// NewMeilisearchRegistry creates a registry that falls back to defaultService for stores using the
+// globally configured Meilisearch instance.
+func NewMeilisearchRegistry(cfg *config.Config, keys security.KeyProvider, defaultService *MeilisearchService) (*MeilisearchRegistry, error) {
+	if keys == nil {
+		return nil, errors.New("key provider is required")
+	}
+
+	return &MeilisearchRegistry{
+		defaultService: defaultService,
+		defaultURL:     strings.TrimRight(cfg.MeilisearchURL, "/"),
+		defaultAPIKey:  cfg.MeilisearchAPIKey,
+		keys:           keys,
+		clients:        make(map[string]*registryEntry),
+	}, nil
+}
+
+// ForStore returns the Meilisearch service holding the store's index.
+func (r *MeilisearchRegistry) ForStore(store *models.Store) (*MeilisearchService, error) {
+	url := strings.TrimRight(strings.TrimSpace(store.MeilisearchURL), "/")
+	if url == "" {
+		return r.defaultService, nil
+	}
+
+	cacheKey := store.ID.Hex()
+	r.mu.RLock()
+	entry, ok := r.clients[cacheKey]
+	r.mu.RUnlock()
+	if ok && entry.url == url && bytes.Equal(entry.encryptedKey, store.MeilisearchAPIKey) {
+		return entry.service, nil
+	}
+
+	apiKey := ""
+	if len(store.MeilisearchAPIKey) > 0 {
+		// Clients are cached, so this only runs when a store first needs one or its key changes
+		decrypted, err := r.keys.Decrypt(context.Background(), store.ShopDomain, store.MeilisearchAPIKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt meilisearch api key: %w", err)
+		}
+		apiKey = string(decrypted)
+	}
+
+	service := r.defaultService
+	if url != r.defaultURL || apiKey != r.defaultAPIKey {
+		service = NewMeilisearchServiceWithCredentials(url, apiKey)
+	}
+
+	r.mu.Lock()
+	r.clients[cacheKey] = &registryEntry{
+		url:          url,
+		encryptedKey: append([]byte(nil), store.MeilisearchAPIKey...),
+		service:      service,
+	}
+	r.mu.Unlock()
+
+	return service, nil
+}
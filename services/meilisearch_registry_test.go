@@ -0,0 +1,97 @@
+package services
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"mgsearch/config"
+	"mgsearch/models"
+	"mgsearch/pkg/security"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const registryTestKey = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func newTestRegistry(t *testing.T) (*MeilisearchRegistry, *MeilisearchService, []byte) {
+	cfg := &config.Config{
+		MeilisearchURL:    "http://localhost:7700",
+		MeilisearchAPIKey: "global-key",
+		EncryptionKey:     registryTestKey,
+	}
+	defaultService := NewMeilisearchService(cfg)
+	keys, err := security.NewEnvKeyProvider(cfg)
+	require.NoError(t, err)
+	registry, err := NewMeilisearchRegistry(cfg, keys, defaultService)
+	require.NoError(t, err)
+
+	key, err := hex.DecodeString(registryTestKey)
+	require.NoError(t, err)
+	return registry, defaultService, key
+}
+
+func encryptForTest(t *testing.T, key []byte, value string) []byte {
+	encrypted, err := security.EncryptAESGCM(key, []byte(value))
+	require.NoError(t, err)
+	return encrypted
+}
+
+func TestMeilisearchRegistry_DefaultInstance(t *testing.T) {
+	registry, defaultService, key := newTestRegistry(t)
+
+	withoutURL := &models.Store{ID: primitive.NewObjectID()}
+	service, err := registry.ForStore(withoutURL)
+	require.NoError(t, err)
+	assert.Same(t, defaultService, service)
+
+	sameInstance := &models.Store{
+		ID:                primitive.NewObjectID(),
+		MeilisearchURL:    "http://localhost:7700/",
+		MeilisearchAPIKey: encryptForTest(t, key, "global-key"),
+	}
+	service, err = registry.ForStore(sameInstance)
+	require.NoError(t, err)
+	assert.Same(t, defaultService, service)
+}
+
+func TestMeilisearchRegistry_DedicatedInstance(t *testing.T) {
+	registry, defaultService, key := newTestRegistry(t)
+
+	store := &models.Store{
+		ID:                primitive.NewObjectID(),
+		MeilisearchURL:    "https://search.example.com",
+		MeilisearchAPIKey: encryptForTest(t, key, "store-key"),
+	}
+
+	service, err := registry.ForStore(store)
+	require.NoError(t, err)
+	assert.NotSame(t, defaultService, service)
+	assert.Equal(t, "https://search.example.com", service.BaseURL())
+	assert.Equal(t, "store-key", service.apiKey)
+
+	cached, err := registry.ForStore(store)
+	require.NoError(t, err)
+	assert.Same(t, service, cached)
+
+	// Rotating the store's key must not keep serving the old client
+	store.MeilisearchAPIKey = encryptForTest(t, key, "rotated-key")
+	rotated, err := registry.ForStore(store)
+	require.NoError(t, err)
+	assert.NotSame(t, service, rotated)
+	assert.Equal(t, "rotated-key", rotated.apiKey)
+}
+
+func TestMeilisearchRegistry_UndecryptableKey(t *testing.T) {
+	registry, _, _ := newTestRegistry(t)
+
+	store := &models.Store{
+		ID:                primitive.NewObjectID(),
+		MeilisearchURL:    "https://search.example.com",
+		MeilisearchAPIKey: []byte("not-encrypted"),
+	}
+
+	_, err := registry.ForStore(store)
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMeiliSettings serves the attribute settings endpoints of one Meilisearch index and records the
+// settings that were updated. Like Meilisearch, updating the settings of a missing index succeeds.
+type fakeMeiliSettings struct {
+	mu       sync.Mutex
+	settings map[string]interface{}
+	updated  map[string]interface{}
+}
+
+func newFakeMeiliSettings(t *testing.T, uid string, settings map[string]interface{}) (*fakeMeiliSettings, *MeilisearchService) {
+	fake := &fakeMeiliSettings{settings: settings, updated: map[string]interface{}{}}
+	prefix := "/indexes/" + uid + "/settings/"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+
+		name := strings.TrimPrefix(r.URL.Path, prefix)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && fake.settings == nil:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"message":"Index not found.","code":"index_not_found","type":"invalid_request","link":""}`)
+		case r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(fake.settings[name])
+		default:
+			var value interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&value))
+			fake.updated[name] = value
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = io.WriteString(w, `{"taskUid":1,"indexUid":"`+uid+`","status":"enqueued","type":"settingsUpdate"}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return fake, NewMeilisearchServiceWithCredentials(server.URL, "key")
+}
+
+func TestMeilisearchService_ConfigureProductIndexKeepsExistingAttributes(t *testing.T) {
+	fake, meili := newFakeMeiliSettings(t, "products", map[string]interface{}{
+		"filterable-attributes": []interface{}{
+			"color",
+			map[string]interface{}{"attributePatterns": []interface{}{"tags"}, "features": map[string]interface{}{"facetSearch": true}},
+		},
+		"sortable-attributes": []interface{}{"rating"},
+	})
+
+	require.NoError(t, meili.ConfigureProductIndex("products"))
+
+	filterable, _ := fake.updated["filterable-attributes"].([]interface{})
+	require.NotEmpty(t, filterable)
+	assert.Equal(t, "color", filterable[0])
+	assert.IsType(t, map[string]interface{}{}, filterable[1])
+	assert.Contains(t, filterable, "in_stock")
+	assert.NotContains(t, filterable[2:], "tags")
+
+	sortable, _ := fake.updated["sortable-attributes"].([]interface{})
+	require.NotEmpty(t, sortable)
+	assert.Equal(t, "rating", sortable[0])
+	assert.Contains(t, sortable, "price_min")
+}
+
+func TestMeilisearchService_ConfigureProductIndexSkipsConfiguredIndexes(t *testing.T) {
+	filterable := make([]interface{}, 0, len(productFilterableAttributes))
+	for _, attribute := range productFilterableAttributes {
+		filterable = append(filterable, attribute)
+	}
+	sortable := []interface{}{"rating"}
+	for _, attribute := range productSortableAttributes {
+		sortable = append(sortable, attribute)
+	}
+
+	fake, meili := newFakeMeiliSettings(t, "products", map[string]interface{}{
+		"filterable-attributes": filterable,
+		"sortable-attributes":   sortable,
+	})
+
+	require.NoError(t, meili.ConfigureProductIndex("products"))
+	assert.Empty(t, fake.updated)
+}
+
+func TestMeilisearchService_ConfigureContentIndex(t *testing.T) {
+	t.Run("replaces the default searchable attributes", func(t *testing.T) {
+		fake, meili := newFakeMeiliSettings(t, "pages", map[string]interface{}{
+			"searchable-attributes": []interface{}{"*"},
+			"filterable-attributes": []interface{}{},
+			"sortable-attributes":   []interface{}{},
+		})
+
+		require.NoError(t, meili.ConfigureContentIndex("pages"))
+		assert.Len(t, fake.updated["searchable-attributes"], len(contentSearchableAttributes))
+		assert.Equal(t, "title", fake.updated["searchable-attributes"].([]interface{})[0])
+	})
+
+	t.Run("appends to configured searchable attributes", func(t *testing.T) {
+		fake, meili := newFakeMeiliSettings(t, "pages", map[string]interface{}{
+			"searchable-attributes": []interface{}{"body", "title"},
+			"filterable-attributes": []interface{}{},
+			"sortable-attributes":   []interface{}{},
+		})
+
+		require.NoError(t, meili.ConfigureContentIndex("pages"))
+		searchable := fake.updated["searchable-attributes"].([]interface{})
+		assert.Equal(t, []interface{}{"body", "title"}, searchable[:2])
+		assert.Len(t, searchable, len(contentSearchableAttributes))
+	})
+
+	t.Run("index that does not exist yet", func(t *testing.T) {
+		fake, meili := newFakeMeiliSettings(t, "pages", nil)
+
+		require.NoError(t, meili.ConfigureContentIndex("pages"))
+		assert.Len(t, fake.updated["searchable-attributes"], len(contentSearchableAttributes))
+		assert.Len(t, fake.updated["filterable-attributes"], len(contentFilterableAttributes))
+		assert.Len(t, fake.updated["sortable-attributes"], len(contentSortableAttributes))
+	})
+}
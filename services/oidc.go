@@ -0,0 +1,389 @@
+package services
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"mgsearch/config"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ErrSSORejected is returned by OIDCProvider when the provider rejects the authorization code or the
+// ID token fails validation, as opposed to the provider being unreachable.
+var ErrSSORejected = errors.New("single sign-on rejected")
+
+// errUnknownSigningKey is returned for ID tokens signed with a key missing from the provider's JWKS
+var errUnknownSigningKey = errors.New("unknown signing key")
+
+const (
+	// oidcKeyRefreshInterval limits how often ID tokens signed with an unknown key refetch the JWKS
+	oidcKeyRefreshInterval = time.Minute
+	// oidcClockSkew is the clock difference to the provider tolerated for ID token timestamps
+	oidcClockSkew = time.Minute
+	// oidcMaxResponseBytes bounds the provider responses read
+	oidcMaxResponseBytes = 1 << 20
+)
+
+// OIDCIdentity is the user identity asserted by a validated ID token
+type OIDCIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	GivenName     string
+	FamilyName    string
+}
+
+// OIDCProvider signs users in with an OpenID Connect provider using the authorization code flow
+// with PKCE. The discovery document and signing keys are fetched on first use; keys are refetched
+// when the provider starts signing with a new one.
+type OIDCProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       string
+	httpClient   *http.Client
+
+	mu            sync.Mutex
+	metadata      *oidcMetadata
+	keys          map[string]*rsa.PublicKey
+	keysFetchedAt time.Time
+}
+
+// oidcMetadata is the part of the provider's discovery document in use
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcJWKS struct {
+	Keys []struct {
+		KeyType string `json:"kty"`
+		KeyID   string `json:"kid"`
+		Use     string `json:"use"`
+		N       string `json:"n"`
+		E       string `json:"e"`
+	} `json:"keys"`
+}
+
+type oidcTokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type oidcIDTokenClaims struct {
+	Nonce           string   `json:"nonce"`
+	AuthorizedParty string   `json:"azp"`
+	Email           string   `json:"email"`
+	EmailVerified   oidcBool `json:"email_verified"`
+	Name            string   `json:"name"`
+	GivenName       string   `json:"given_name"`
+	FamilyName      string   `json:"family_name"`
+	jwt.RegisteredClaims
+}
+
+// Valid checks the ID token timestamps, tolerating oidcClockSkew
+func (c *oidcIDTokenClaims) Valid() error {
+	now := time.Now()
+	if c.ExpiresAt == nil || now.After(c.ExpiresAt.Add(oidcClockSkew)) {
+		return errors.New("id token is expired")
+	}
+	if c.IssuedAt == nil || now.Add(oidcClockSkew).Before(c.IssuedAt.Time) {
+		return errors.New("id token is issued in the future")
+	}
+	if c.NotBefore != nil && now.Add(oidcClockSkew).Before(c.NotBefore.Time) {
+		return errors.New("id token is not valid yet")
+	}
+	return nil
+}
+
+// oidcBool decodes boolean claims that some providers send as strings
+type oidcBool bool
+
+func (b *oidcBool) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case bool:
+		*b = oidcBool(v)
+	case string:
+		*b = oidcBool(v == "true")
+	}
+	return nil
+}
+
+func NewOIDCProvider(cfg *config.Config) *OIDCProvider {
+	return &OIDCProvider{
+		issuer:       cfg.OIDCIssuerURL,
+		clientID:     cfg.OIDCClientID,
+		clientSecret: cfg.OIDCClientSecret,
+		redirectURL:  cfg.OIDCRedirectURL,
+		scopes:       cfg.OIDCScopes,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Issuer returns the issuer identifier of the provider
+func (p *OIDCProvider) Issuer() string {
+	return p.issuer
+}
+
+// AuthorizationURL returns the provider URL that starts a login. The provider echoes state back to
+// the redirect URL and puts nonce in the ID token; codeChallenge is the PKCE S256 challenge.
+func (p *OIDCProvider) AuthorizationURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	p.mu.Lock()
+	metadata, err := p.discover(ctx)
+	p.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	endpoint, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	query := endpoint.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.clientID)
+	query.Set("redirect_uri", p.redirectURL)
+	query.Set("scope", p.scopes)
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+// Exchange redeems an authorization code with its PKCE verifier and returns the identity of the ID
+// token, which must carry nonce.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error) {
+	p.mu.Lock()
+	metadata, err := p.discover(ctx)
+	p.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.clientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		// client_secret_basic form-encodes the credentials before joining them (RFC 6749 2.3.1)
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body oidcTokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode token response (status %d): %w", resp.StatusCode, err)
+	}
+	if body.Error != "" {
+		if body.ErrorDescription != "" {
+			return nil, fmt.Errorf("%w: %s: %s", ErrSSORejected, body.Error, body.ErrorDescription)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrSSORejected, body.Error)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+	if body.IDToken == "" {
+		return nil, fmt.Errorf("%w: token response has no id token", ErrSSORejected)
+	}
+
+	return p.VerifyIDToken(ctx, body.IDToken, nonce)
+}
+
+// VerifyIDToken validates the signature, issuer, audience, timestamps and nonce of an ID token and
+// returns the identity it asserts
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*OIDCIdentity, error) {
+	claims := &oidcIDTokenClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}))
+
+	var keyErr error
+	_, err := parser.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.signingKey(ctx, kid)
+		if err != nil {
+			keyErr = err
+			return nil, err
+		}
+		return key, nil
+	})
+	if err != nil {
+		// Failing to fetch the keys says nothing about the token
+		if keyErr != nil && !errors.Is(keyErr, errUnknownSigningKey) {
+			return nil, keyErr
+		}
+		return nil, fmt.Errorf("%w: invalid id token: %v", ErrSSORejected, err)
+	}
+
+	switch {
+	case claims.Issuer != p.issuer:
+		return nil, fmt.Errorf("%w: id token issued by %q", ErrSSORejected, claims.Issuer)
+	case !claims.VerifyAudience(p.clientID, true):
+		return nil, fmt.Errorf("%w: id token is for another client", ErrSSORejected)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.clientID:
+		return nil, fmt.Errorf("%w: id token is authorized for another client", ErrSSORejected)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: id token has no subject", ErrSSORejected)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%w: id token nonce does not match", ErrSSORejected)
+	}
+
+	return &OIDCIdentity{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         strings.ToLower(strings.TrimSpace(claims.Email)),
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+		GivenName:     claims.GivenName,
+		FamilyName:    claims.FamilyName,
+	}, nil
+}
+
+// discover returns the provider metadata, fetching it on first use. Callers hold p.mu.
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcMetadata, error) {
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var metadata oidcMetadata
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.issuer, "/")+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, fmt.Errorf("failed to fetch provider metadata: %w", err)
+	}
+	// OpenID Connect Discovery 1.0 section 4.3: the issuer must match exactly
+	if metadata.Issuer != p.issuer {
+		return nil, fmt.Errorf("provider metadata is for issuer %q, expected %q", metadata.Issuer, p.issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("provider metadata lacks the authorization, token or jwks endpoint")
+	}
+
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// signingKey returns the provider key with the key ID. Unknown key IDs refetch the JWKS, at most
+// once per oidcKeyRefreshInterval, since providers rotate their keys.
+func (p *OIDCProvider) signingKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	if p.keys != nil && time.Since(p.keysFetchedAt) < oidcKeyRefreshInterval {
+		return nil, errUnknownSigningKey
+	}
+
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := p.fetchKeys(ctx, metadata.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, errUnknownSigningKey
+}
+
+// lookupKey returns the cached key with the key ID. Tokens without a key ID match a sole key.
+func (p *OIDCProvider) lookupKey(kid string) *rsa.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+// fetchKeys returns the RSA signing keys of the JWKS by key ID. Other keys are skipped.
+func (p *OIDCProvider) fetchKeys(ctx context.Context, jwksURI string) (map[string]*rsa.PublicKey, error) {
+	var jwks oidcJWKS
+	if err := p.getJSON(ctx, jwksURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch provider keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.KeyType != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[jwk.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(v)
+}
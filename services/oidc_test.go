@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"mgsearch/config"
+	"mgsearch/pkg/auth"
+	"mgsearch/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOIDCProvider(t *testing.T) {
+	ctx := context.Background()
+	idp := testhelpers.NewMockOIDCProvider("mgsearch-dashboard")
+	defer idp.Close()
+
+	newProvider := func() *OIDCProvider {
+		return NewOIDCProvider(&config.Config{
+			OIDCIssuerURL:   idp.Issuer(),
+			OIDCClientID:    "mgsearch-dashboard",
+			OIDCRedirectURL: "https://dashboard.example.com/sso/callback",
+			OIDCScopes:      "openid email profile",
+		})
+	}
+	identity := testhelpers.MockOIDCIdentity{
+		Subject:       "user-123",
+		Email:         "Jane@Example.com",
+		EmailVerified: true,
+		GivenName:     "Jane",
+		FamilyName:    "Doe",
+	}
+	login := func(provider *OIDCProvider, identity testhelpers.MockOIDCIdentity) (code, verifier string) {
+		verifier, _, err := auth.GenerateOpaqueToken()
+		require.NoError(t, err)
+		authURL, err := provider.AuthorizationURL(ctx, "state-1", "nonce-1", auth.PKCEChallenge(verifier))
+		require.NoError(t, err)
+		code, state, err := idp.Authorize(authURL, identity)
+		require.NoError(t, err)
+		require.Equal(t, "state-1", state)
+		return code, verifier
+	}
+
+	t.Run("authorization url", func(t *testing.T) {
+		authURL, err := newProvider().AuthorizationURL(ctx, "state-1", "nonce-1", "challenge")
+		require.NoError(t, err)
+		parsed, err := url.Parse(authURL)
+		require.NoError(t, err)
+		assert.Equal(t, idp.Issuer()+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+		query := parsed.Query()
+		assert.Equal(t, "code", query.Get("response_type"))
+		assert.Equal(t, "mgsearch-dashboard", query.Get("client_id"))
+		assert.Equal(t, "https://dashboard.example.com/sso/callback", query.Get("redirect_uri"))
+		assert.Equal(t, "openid email profile", query.Get("scope"))
+		assert.Equal(t, "nonce-1", query.Get("nonce"))
+		assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	})
+
+	t.Run("code exchange", func(t *testing.T) {
+		provider := newProvider()
+		code, verifier := login(provider, identity)
+
+		result, err := provider.Exchange(ctx, code, verifier, "nonce-1")
+		require.NoError(t, err)
+		assert.Equal(t, idp.Issuer(), result.Issuer)
+		assert.Equal(t, "user-123", result.Subject)
+		assert.Equal(t, "jane@example.com", result.Email)
+		assert.True(t, result.EmailVerified)
+		assert.Equal(t, "Jane", result.GivenName)
+
+		// Codes work once
+		_, err = provider.Exchange(ctx, code, verifier, "nonce-1")
+		assert.ErrorIs(t, err, ErrSSORejected)
+	})
+
+	t.Run("wrong code verifier", func(t *testing.T) {
+		provider := newProvider()
+		code, _ := login(provider, identity)
+		_, err := provider.Exchange(ctx, code, "another-verifier", "nonce-1")
+		assert.ErrorIs(t, err, ErrSSORejected)
+	})
+
+	t.Run("wrong nonce", func(t *testing.T) {
+		provider := newProvider()
+		code, verifier := login(provider, identity)
+		_, err := provider.Exchange(ctx, code, verifier, "nonce-2")
+		assert.ErrorIs(t, err, ErrSSORejected)
+	})
+
+	t.Run("invalid id tokens", func(t *testing.T) {
+		provider := newProvider()
+		cases := map[string]map[string]interface{}{
+			"other audience":       {"aud": "another-client"},
+			"other issuer":         {"iss": "https://evil.example.com"},
+			"expired":              {"exp": time.Now().Add(-5 * time.Minute).Unix()},
+			"issued in the future": {"iat": time.Now().Add(5 * time.Minute).Unix()},
+			"no subject":           {"sub": ""},
+			"other azp":            {"aud": []string{"mgsearch-dashboard", "other"}, "azp": "other"},
+		}
+		for name, overrides := range cases {
+			claims := idp.IDTokenClaims(testhelpers.MockOIDCIdentity{Subject: "user-123", Claims: overrides}, "nonce-1")
+			_, err := provider.VerifyIDToken(ctx, idp.SignIDToken(claims), "nonce-1")
+			assert.ErrorIs(t, err, ErrSSORejected, name)
+		}
+
+		// Tokens signed with a key the provider never published
+		other := testhelpers.NewMockOIDCProvider("mgsearch-dashboard")
+		defer other.Close()
+		claims := idp.IDTokenClaims(identity, "nonce-1")
+		_, err := provider.VerifyIDToken(ctx, other.SignIDToken(claims), "nonce-1")
+		assert.ErrorIs(t, err, ErrSSORejected)
+
+		// Several audiences are fine when the token is authorized for this client
+		claims = idp.IDTokenClaims(testhelpers.MockOIDCIdentity{Subject: "user-123", Claims: map[string]interface{}{
+			"aud": []string{"mgsearch-dashboard", "other"},
+			"azp": "mgsearch-dashboard",
+		}}, "nonce-1")
+		_, err = provider.VerifyIDToken(ctx, idp.SignIDToken(claims), "nonce-1")
+		assert.NoError(t, err)
+
+		// Some providers send email_verified as a string
+		claims = idp.IDTokenClaims(testhelpers.MockOIDCIdentity{Subject: "user-123", Claims: map[string]interface{}{"email_verified": "true"}}, "nonce-1")
+		result, err := provider.VerifyIDToken(ctx, idp.SignIDToken(claims), "nonce-1")
+		require.NoError(t, err)
+		assert.True(t, result.EmailVerified)
+	})
+
+	t.Run("rotated keys are refetched", func(t *testing.T) {
+		provider := newProvider()
+		_, err := provider.VerifyIDToken(ctx, idp.SignIDToken(idp.IDTokenClaims(identity, "nonce-1")), "nonce-1")
+		require.NoError(t, err)
+
+		idp.RotateKey()
+		rotated := idp.SignIDToken(idp.IDTokenClaims(identity, "nonce-1"))
+		// Within the refresh interval unknown keys do not refetch the JWKS
+		_, err = provider.VerifyIDToken(ctx, rotated, "nonce-1")
+		assert.ErrorIs(t, err, ErrSSORejected)
+
+		provider.keysFetchedAt = time.Now().Add(-oidcKeyRefreshInterval)
+		_, err = provider.VerifyIDToken(ctx, rotated, "nonce-1")
+		assert.NoError(t, err)
+	})
+
+	t.Run("unreachable provider", func(t *testing.T) {
+		down := httptest.NewServer(http.NotFoundHandler())
+		down.Close()
+		provider := NewOIDCProvider(&config.Config{OIDCIssuerURL: down.URL, OIDCClientID: "mgsearch-dashboard"})
+
+		_, err := provider.AuthorizationURL(ctx, "state-1", "nonce-1", "challenge")
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, ErrSSORejected))
+	})
+
+	t.Run("issuer mismatch", func(t *testing.T) {
+		provider := NewOIDCProvider(&config.Config{OIDCIssuerURL: idp.Issuer() + "/", OIDCClientID: "mgsearch-dashboard"})
+		_, err := provider.AuthorizationURL(ctx, "state-1", "nonce-1", "challenge")
+		assert.ErrorContains(t, err, "provider metadata is for issuer")
+	})
+}
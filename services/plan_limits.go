@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"mgsearch/models"
+)
+
+var (
+	// ErrDocumentLimitReached signals that indexing documents would take a store past its plan.
+	ErrDocumentLimitReached = errors.New("plan document limit reached")
+	// ErrSearchLimitReached signals that the store used up the searches of its plan this month.
+	ErrSearchLimitReached = errors.New("monthly search limit reached")
+)
+
+// SearchUsageCounter counts searches per store and billing period. It is implemented by
+// repositories.UsageRepository.
+type SearchUsageCounter interface {
+	IncrementSearches(ctx context.Context, storeID string) (int64, error)
+}
+
+// PlanLimits enforces the document and monthly search allowances of a store's plan. Every path that
+// writes to or searches a store's indexes goes through it, so webhooks, syncs, the App Proxy and
+// the v1 API cannot be used to get around the plan.
+type PlanLimits struct {
+	usage SearchUsageCounter
+}
+
+func NewPlanLimits(usage SearchUsageCounter) *PlanLimits {
+	return &PlanLimits{usage: usage}
+}
+
+// CountSearch records one search against the store's monthly allowance and returns
+// ErrSearchLimitReached once the allowance is used up.
+func (l *PlanLimits) CountSearch(ctx context.Context, store *models.Store) error {
+	searches, err := l.usage.IncrementSearches(ctx, store.ID.Hex())
+	if err != nil {
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+	if limit := store.Plan().MonthlySearchLimit; limit > 0 && searches > limit {
+		return ErrSearchLimitReached
+	}
+	return nil
+}
+
+// CheckDocuments returns ErrDocumentLimitReached when adding the documents to the store's index uid
+// would leave the store with more documents than its plan allows. Documents already in the index
+// are updates and do not count. Product and content indexes count towards the limit; locale
+// indexes mirror the product index and do not.
+func (l *PlanLimits) CheckDocuments(store *models.Store, meili *MeilisearchService, uid string, documentIDs []string) error {
+	limit := store.Plan().DocumentLimit
+	if limit <= 0 {
+		return nil
+	}
+
+	total, err := storeDocumentCount(store, meili)
+	if err != nil {
+		return err
+	}
+
+	ids := uniqueStrings(documentIDs)
+	existing, err := meili.ExistingDocumentIDs(uid, ids)
+	if err != nil && !IsIndexNotFound(err) {
+		return err
+	}
+	for _, id := range ids {
+		if !existing[id] {
+			total++
+		}
+	}
+
+	if total > limit {
+		return ErrDocumentLimitReached
+	}
+	return nil
+}
+
+// CheckReplace returns ErrDocumentLimitReached when replacing the contents of the given indexes with
+// the given numbers of documents would leave the store with more documents than its plan allows.
+func (l *PlanLimits) CheckReplace(store *models.Store, meili *MeilisearchService, documentCounts map[string]int) error {
+	limit := store.Plan().DocumentLimit
+	if limit <= 0 {
+		return nil
+	}
+
+	total, err := storeDocumentCount(store, meili)
+	if err != nil {
+		return err
+	}
+	for uid, count := range documentCounts {
+		current, err := indexDocumentCount(meili, uid)
+		if err != nil {
+			return err
+		}
+		total += int64(count) - current
+	}
+
+	if total > limit {
+		return ErrDocumentLimitReached
+	}
+	return nil
+}
+
+// storeDocumentCount returns the number of documents in the store's product and content indexes.
+func storeDocumentCount(store *models.Store, meili *MeilisearchService) (int64, error) {
+	uids := []string{store.IndexUID()}
+	for _, documentType := range models.ContentDocumentTypes {
+		uids = append(uids, store.ContentIndexUID(documentType))
+	}
+
+	var total int64
+	for _, uid := range uids {
+		count, err := indexDocumentCount(meili, uid)
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// indexDocumentCount is DocumentCount with indexes that do not exist yet counting as empty.
+func indexDocumentCount(meili *MeilisearchService, uid string) (int64, error) {
+	count, err := meili.DocumentCount(uid)
+	if err != nil {
+		if IsIndexNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return count, nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		unique = append(unique, value)
+	}
+	return unique
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"mgsearch/models"
+	"mgsearch/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fakeSearchUsage struct {
+	searches int64
+	err      error
+}
+
+func (f *fakeSearchUsage) IncrementSearches(ctx context.Context, storeID string) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.searches++
+	return f.searches, nil
+}
+
+// newLimitedStore returns a free plan store whose product and page indexes hold the plan's
+// document limit between them.
+func newLimitedStore(t *testing.T) (*models.Store, *MeilisearchService) {
+	mock := testhelpers.NewMockMeilisearch()
+	t.Cleanup(mock.Close)
+
+	store := &models.Store{
+		ID:                  primitive.NewObjectID(),
+		PlanLevel:           models.PlanFree,
+		MeilisearchIndexUID: "limits_all_products",
+	}
+	limit := store.Plan().DocumentLimit
+
+	products := make([]models.Document, 0, limit-1)
+	for i := int64(1); i < limit; i++ {
+		products = append(products, models.Document{"id": i})
+	}
+	mock.AddDocuments(store.IndexUID(), products...)
+	mock.AddDocuments(store.ContentIndexUID(models.DocumentTypePage), models.Document{"id": 1})
+
+	return store, NewMeilisearchServiceWithCredentials(mock.URL(), "key")
+}
+
+func TestPlanLimits_CheckDocuments(t *testing.T) {
+	store, meili := newLimitedStore(t)
+	limits := NewPlanLimits(&fakeSearchUsage{})
+	uid := store.IndexUID()
+
+	assert.NoError(t, limits.CheckDocuments(store, meili, uid, []string{"1", "2"}), "updates are accepted at the limit")
+	assert.ErrorIs(t, limits.CheckDocuments(store, meili, uid, []string{"1", "100000"}), ErrDocumentLimitReached)
+	assert.ErrorIs(t, limits.CheckDocuments(store, meili, store.ContentIndexUID(models.DocumentTypeArticle), []string{"1"}), ErrDocumentLimitReached,
+		"content documents count towards the same limit")
+
+	store.PlanLevel = models.PlanBasic
+	assert.NoError(t, limits.CheckDocuments(store, meili, uid, []string{"100000"}))
+}
+
+func TestPlanLimits_CheckReplace(t *testing.T) {
+	store, meili := newLimitedStore(t)
+	limits := NewPlanLimits(&fakeSearchUsage{})
+
+	pages := store.ContentIndexUID(models.DocumentTypePage)
+	articles := store.ContentIndexUID(models.DocumentTypeArticle)
+
+	assert.NoError(t, limits.CheckReplace(store, meili, map[string]int{pages: 1, articles: 0}))
+	assert.NoError(t, limits.CheckReplace(store, meili, map[string]int{pages: 0, articles: 1}))
+	assert.ErrorIs(t, limits.CheckReplace(store, meili, map[string]int{pages: 1, articles: 1}), ErrDocumentLimitReached)
+}
+
+func TestPlanLimits_CountSearch(t *testing.T) {
+	store := &models.Store{ID: primitive.NewObjectID(), PlanLevel: models.PlanFree}
+	limit := store.Plan().MonthlySearchLimit
+
+	usage := &fakeSearchUsage{searches: limit - 1}
+	limits := NewPlanLimits(usage)
+	require.NoError(t, limits.CountSearch(context.Background(), store))
+	assert.ErrorIs(t, limits.CountSearch(context.Background(), store), ErrSearchLimitReached)
+
+	usage.err = errors.New("database unavailable")
+	err := limits.CountSearch(context.Background(), store)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrSearchLimitReached)
+}
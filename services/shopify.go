@@ -16,14 +16,19 @@ import (
 	"time"
 
 	"mgsearch/config"
+	"mgsearch/models"
 )
 
+// adminAPIVersion is the Shopify Admin API version used for REST and GraphQL calls.
+const adminAPIVersion = "2024-10"
+
 type ShopifyService struct {
 	apiKey     string
 	apiSecret  string
 	appURL     string
 	scopes     string
 	httpClient *http.Client
+	admin      *ShopifyAdminClient
 }
 
 type accessTokenResponse struct {
@@ -32,17 +37,26 @@ type accessTokenResponse struct {
 }
 
 func NewShopifyService(cfg *config.Config) *ShopifyService {
+	httpClient := &http.Client{
+		Timeout: 15 * time.Second,
+	}
+
 	return &ShopifyService{
-		apiKey:    cfg.ShopifyAPIKey,
-		apiSecret: cfg.ShopifyAPISecret,
-		appURL:    cfg.ShopifyAppURL,
-		scopes:    cfg.ShopifyScopes,
-		httpClient: &http.Client{
-			Timeout: 15 * time.Second,
-		},
+		apiKey:     cfg.ShopifyAPIKey,
+		apiSecret:  cfg.ShopifyAPISecret,
+		appURL:     cfg.ShopifyAppURL,
+		scopes:     cfg.ShopifyScopes,
+		httpClient: httpClient,
+		admin:      NewShopifyAdminClient(httpClient, adminAPIVersion),
 	}
 }
 
+// SetBaseURL sends Admin API and OAuth token requests to baseURL instead of the shop's domain. Tests
+// use it to talk to a fake Shopify server.
+func (s *ShopifyService) SetBaseURL(baseURL string) {
+	s.admin.baseURL = strings.TrimRight(baseURL, "/")
+}
+
 func (s *ShopifyService) BuildInstallURL(shop string, state string, redirectURI string) (string, error) {
 	if shop == "" {
 		return "", fmt.Errorf("shop domain is required")
@@ -58,8 +72,10 @@ func (s *ShopifyService) BuildInstallURL(shop string, state string, redirectURI
 	return fmt.Sprintf("https://%s/admin/oauth/authorize?%s", shop, query.Encode()), nil
 }
 
-func (s *ShopifyService) ExchangeAccessToken(ctx context.Context, shop string, code string) (string, error) {
-	endpoint := fmt.Sprintf("https://%s/admin/oauth/access_token", shop)
+// ExchangeAccessToken trades an OAuth authorization code for an access token and returns the
+// token together with the scopes Shopify granted.
+func (s *ShopifyService) ExchangeAccessToken(ctx context.Context, shop string, code string) (string, string, error) {
+	endpoint := s.admin.shopURL(shop) + "/admin/oauth/access_token"
 
 	body, err := json.Marshal(map[string]string{
 		"client_id":     s.apiKey,
@@ -67,31 +83,165 @@ func (s *ShopifyService) ExchangeAccessToken(ctx context.Context, shop string, c
 		"code":          code,
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal token request: %w", err)
+		return "", "", fmt.Errorf("failed to marshal token request: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(body))
 	if err != nil {
-		return "", fmt.Errorf("failed to create token request: %w", err)
+		return "", "", fmt.Errorf("failed to create token request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("token request failed: %w", err)
+		return "", "", fmt.Errorf("token request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("token exchange failed with status %d", resp.StatusCode)
+		return "", "", fmt.Errorf("token exchange failed with status %d", resp.StatusCode)
 	}
 
 	var tokenResp accessTokenResponse
 	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return "", fmt.Errorf("failed to decode token response: %w", err)
+		return "", "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	return tokenResp.AccessToken, tokenResp.Scope, nil
+}
+
+// Token types that can be requested from Shopify's token exchange.
+const (
+	OfflineAccessToken = "urn:shopify:params:oauth:token-type:offline-access-token"
+	OnlineAccessToken  = "urn:shopify:params:oauth:token-type:online-access-token"
+)
+
+// TokenExchangeResult is the access token Shopify issues in exchange for a session token.
+// Online tokens expire and are bound to the staff member in AssociatedUser.
+type TokenExchangeResult struct {
+	AccessToken         string                 `json:"access_token"`
+	Scope               string                 `json:"scope"`
+	ExpiresIn           int                    `json:"expires_in,omitempty"`
+	AssociatedUserScope string                 `json:"associated_user_scope,omitempty"`
+	AssociatedUser      *ShopifyAssociatedUser `json:"associated_user,omitempty"`
+}
+
+// ShopifyAssociatedUser is the staff member an online access token acts for.
+type ShopifyAssociatedUser struct {
+	ID            int64  `json:"id"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	AccountOwner  bool   `json:"account_owner"`
+	Locale        string `json:"locale"`
+	Collaborator  bool   `json:"collaborator"`
+}
+
+// ExchangeSessionToken trades an App Bridge session token for an online or offline access token
+// (requestedTokenType is OnlineAccessToken or OfflineAccessToken), replacing the redirect OAuth
+// flow for embedded apps.
+func (s *ShopifyService) ExchangeSessionToken(ctx context.Context, shop, sessionToken, requestedTokenType string) (*TokenExchangeResult, error) {
+	if requestedTokenType != OnlineAccessToken && requestedTokenType != OfflineAccessToken {
+		return nil, fmt.Errorf("unsupported token type %q", requestedTokenType)
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"client_id":            s.apiKey,
+		"client_secret":        s.apiSecret,
+		"grant_type":           "urn:ietf:params:oauth:grant-type:token-exchange",
+		"subject_token":        sessionToken,
+		"subject_token_type":   "urn:ietf:params:oauth:token-type:id_token",
+		"requested_token_type": requestedTokenType,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal token exchange request: %w", err)
+	}
+
+	endpoint := s.admin.shopURL(shop) + "/admin/oauth/access_token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token exchange request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token exchange request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token exchange failed with status %d", resp.StatusCode)
+	}
+
+	var result TokenExchangeResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode token exchange response: %w", err)
+	}
+	if result.AccessToken == "" {
+		return nil, fmt.Errorf("token exchange returned no access token")
+	}
+
+	return &result, nil
+}
+
+// RequiredScopes returns the access scopes the app is configured to request.
+func (s *ShopifyService) RequiredScopes() []string {
+	return ParseScopes(s.scopes)
+}
+
+// ListAccessScopes returns the scopes granted to an access token.
+func (s *ShopifyService) ListAccessScopes(ctx context.Context, shop, accessToken string) ([]string, error) {
+	var response struct {
+		AccessScopes []struct {
+			Handle string `json:"handle"`
+		} `json:"access_scopes"`
+	}
+
+	endpoint := s.admin.shopURL(shop) + "/admin/oauth/access_scopes.json"
+	if _, err := s.admin.REST(ctx, shop, accessToken, http.MethodGet, endpoint, nil, &response); err != nil {
+		return nil, err
+	}
+
+	scopes := make([]string, 0, len(response.AccessScopes))
+	for _, scope := range response.AccessScopes {
+		scopes = append(scopes, scope.Handle)
+	}
+	return scopes, nil
+}
+
+// ParseScopes splits a comma separated scope string as returned by Shopify.
+func ParseScopes(scope string) []string {
+	scopes := []string{}
+	for _, value := range strings.Split(scope, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			scopes = append(scopes, value)
+		}
+	}
+	return scopes
+}
+
+// MissingScopes returns the required scopes not covered by the granted ones. Shopify omits read_X
+// from granted scopes when write_X is granted, since write access implies read access.
+func MissingScopes(granted, required []string) []string {
+	grantedSet := make(map[string]bool, len(granted))
+	for _, scope := range granted {
+		grantedSet[scope] = true
 	}
 
-	return tokenResp.AccessToken, nil
+	missing := []string{}
+	for _, scope := range required {
+		if grantedSet[scope] {
+			continue
+		}
+		if strings.HasPrefix(scope, "read_") && grantedSet["write_"+strings.TrimPrefix(scope, "read_")] {
+			continue
+		}
+		missing = append(missing, scope)
+	}
+	return missing
 }
 
 // ValidateHMAC validates the HMAC parameter on OAuth callbacks.
@@ -120,6 +270,35 @@ func (s *ShopifyService) ValidateHMAC(values url.Values) bool {
 	return hmac.Equal([]byte(hmacValue), []byte(computed))
 }
 
+// ValidateAppProxySignature validates the signature Shopify adds to App Proxy requests. Unlike OAuth
+// callbacks, the message is every other parameter as key=value sorted by key and concatenated
+// without separators, with repeated values joined by commas.
+func (s *ShopifyService) ValidateAppProxySignature(values url.Values) bool {
+	signature := values.Get("signature")
+	if signature == "" {
+		return false
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if key == "signature" {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var message strings.Builder
+	for _, key := range keys {
+		message.WriteString(key)
+		message.WriteString("=")
+		message.WriteString(strings.Join(values[key], ","))
+	}
+
+	computed := computeHexHMAC([]byte(message.String()), s.apiSecret)
+	return hmac.Equal([]byte(signature), []byte(computed))
+}
+
 // VerifyWebhookSignature ensures the webhook HMAC matches the body payload.
 func (s *ShopifyService) VerifyWebhookSignature(signature string, body []byte) bool {
 	if signature == "" {
@@ -136,3 +315,49 @@ func computeHexHMAC(message []byte, secret string) string {
 	mac.Write(message)
 	return hex.EncodeToString(mac.Sum(nil))
 }
+
+// ListCollectionProductIDs returns the IDs of all products in a custom or smart collection.
+func (s *ShopifyService) ListCollectionProductIDs(ctx context.Context, shop, accessToken string, collectionID int64) ([]int64, error) {
+	path := fmt.Sprintf("collections/%d/products.json?limit=250&fields=id", collectionID)
+
+	productIDs := []int64{}
+	for path != "" {
+		var page struct {
+			Products []struct {
+				ID int64 `json:"id"`
+			} `json:"products"`
+		}
+
+		next, err := s.admin.REST(ctx, shop, accessToken, http.MethodGet, path, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, product := range page.Products {
+			productIDs = append(productIDs, product.ID)
+		}
+		path = next
+	}
+
+	return productIDs, nil
+}
+
+// ListInventoryLevels returns the levels of an inventory item at every location stocking it.
+func (s *ShopifyService) ListInventoryLevels(ctx context.Context, shop, accessToken string, inventoryItemID int64) ([]models.ShopifyInventoryLevel, error) {
+	path := fmt.Sprintf("inventory_levels.json?limit=250&inventory_item_ids=%d", inventoryItemID)
+
+	levels := []models.ShopifyInventoryLevel{}
+	for path != "" {
+		var page struct {
+			InventoryLevels []models.ShopifyInventoryLevel `json:"inventory_levels"`
+		}
+
+		next, err := s.admin.REST(ctx, shop, accessToken, http.MethodGet, path, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		levels = append(levels, page.InventoryLevels...)
+		path = next
+	}
+
+	return levels, nil
+}
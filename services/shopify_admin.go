@@ -0,0 +1,401 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// restLeakRate is the rate, in requests per second, at which Shopify drains the REST bucket of
+	// a standard plan shop. Plus shops drain faster; the client simply waits a little longer there.
+	restLeakRate = 2.0
+	// restHeadroom is the number of bucket slots left free for other clients of the same shop.
+	restHeadroom = 2
+	// defaultQueryCost is assumed for a GraphQL query before Shopify has reported its actual cost.
+	defaultQueryCost = 50
+	// defaultRetryAfter is used when a 429 response carries no Retry-After header.
+	defaultRetryAfter = 2 * time.Second
+	// maxAdminRetries bounds the number of throttled attempts of a single request.
+	maxAdminRetries = 5
+)
+
+var linkNextPattern = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// ShopifyAPIError is returned for Admin API responses with an unexpected status code.
+type ShopifyAPIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ShopifyAPIError) Error() string {
+	return fmt.Sprintf("shopify admin request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// ShopifyGraphQLError carries the errors returned in a GraphQL response body.
+type ShopifyGraphQLError struct {
+	Messages []string
+}
+
+func (e *ShopifyGraphQLError) Error() string {
+	return "shopify graphql error: " + strings.Join(e.Messages, "; ")
+}
+
+// ShopifyAdminClient calls the Shopify Admin REST and GraphQL APIs while staying within each
+// shop's rate limits. It tracks the REST leaky bucket from X-Shopify-Shop-Api-Call-Limit and the
+// GraphQL cost bucket from the response's cost extension, waits before a request would overflow
+// them, and retries throttled requests honouring Retry-After.
+type ShopifyAdminClient struct {
+	httpClient   *http.Client
+	apiVersion   string
+	baseURL      string
+	restLeakRate float64
+	sleep        func(ctx context.Context, d time.Duration) error
+	now          func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*shopBuckets
+}
+
+// shopBuckets is the last known rate-limit state of a shop.
+type shopBuckets struct {
+	mu sync.Mutex
+
+	restUsed       float64
+	restLimit      float64
+	restObservedAt time.Time
+
+	graphqlAvailable   float64
+	graphqlMaximum     float64
+	graphqlRestoreRate float64
+	graphqlObservedAt  time.Time
+	graphqlLastCost    float64
+}
+
+func NewShopifyAdminClient(httpClient *http.Client, apiVersion string) *ShopifyAdminClient {
+	return &ShopifyAdminClient{
+		httpClient:   httpClient,
+		apiVersion:   apiVersion,
+		restLeakRate: restLeakRate,
+		sleep:        sleepContext,
+		now:          time.Now,
+		buckets:      make(map[string]*shopBuckets),
+	}
+}
+
+// REST performs an Admin REST request. path is relative to the versioned Admin API root
+// (e.g. "products.json?limit=250") or an absolute URL taken from a previous page link. The response
+// body is decoded into out when it is not nil, and the URL of the next page is returned, if any.
+func (c *ShopifyAdminClient) REST(ctx context.Context, shop, accessToken, method, path string, body, out interface{}) (string, error) {
+	endpoint := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		endpoint = fmt.Sprintf("%s/admin/api/%s/%s", c.shopURL(shop), c.apiVersion, strings.TrimPrefix(path, "/"))
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return "", fmt.Errorf("failed to marshal admin request: %w", err)
+		}
+	}
+
+	buckets := c.bucketsFor(shop)
+	for attempt := 0; ; attempt++ {
+		if err := c.sleep(ctx, buckets.restWait(c.now(), c.restLeakRate)); err != nil {
+			return "", err
+		}
+
+		resp, respBody, err := c.send(ctx, method, endpoint, accessToken, payload)
+		if err != nil {
+			return "", err
+		}
+		buckets.observeREST(resp.Header.Get("X-Shopify-Shop-Api-Call-Limit"), c.now())
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			if attempt >= maxAdminRetries {
+				return "", &ShopifyAPIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+			}
+			if err := c.sleep(ctx, retryAfter(resp.Header.Get("Retry-After"))); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return "", &ShopifyAPIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+		}
+
+		if out != nil && len(respBody) > 0 {
+			if err := json.Unmarshal(respBody, out); err != nil {
+				return "", fmt.Errorf("failed to decode admin response: %w", err)
+			}
+		}
+
+		if match := linkNextPattern.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+			return match[1], nil
+		}
+		return "", nil
+	}
+}
+
+// GraphQL performs an Admin GraphQL query and decodes its data into out.
+func (c *ShopifyAdminClient) GraphQL(ctx context.Context, shop, accessToken, query string, variables map[string]interface{}, out interface{}) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal graphql request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/admin/api/%s/graphql.json", c.shopURL(shop), c.apiVersion)
+	buckets := c.bucketsFor(shop)
+	for attempt := 0; ; attempt++ {
+		if err := c.sleep(ctx, buckets.graphqlWait(c.now())); err != nil {
+			return err
+		}
+
+		resp, respBody, err := c.send(ctx, http.MethodPost, endpoint, accessToken, payload)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			if attempt >= maxAdminRetries {
+				return &ShopifyAPIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+			}
+			if err := c.sleep(ctx, retryAfter(resp.Header.Get("Retry-After"))); err != nil {
+				return err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return &ShopifyAPIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+		}
+
+		var result graphqlResponse
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			return fmt.Errorf("failed to decode graphql response: %w", err)
+		}
+		buckets.observeGraphQL(result.Extensions.Cost, c.now())
+
+		if len(result.Errors) > 0 {
+			// Throttled queries are reported in the body with a 200 status
+			if result.throttled() && attempt < maxAdminRetries {
+				continue
+			}
+			messages := make([]string, 0, len(result.Errors))
+			for _, graphqlErr := range result.Errors {
+				messages = append(messages, graphqlErr.Message)
+			}
+			return &ShopifyGraphQLError{Messages: messages}
+		}
+
+		if out != nil {
+			if err := json.Unmarshal(result.Data, out); err != nil {
+				return fmt.Errorf("failed to decode graphql data: %w", err)
+			}
+		}
+		return nil
+	}
+}
+
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string `json:"message"`
+		Extensions struct {
+			Code string `json:"code"`
+		} `json:"extensions"`
+	} `json:"errors"`
+	Extensions struct {
+		Cost *graphqlCost `json:"cost"`
+	} `json:"extensions"`
+}
+
+type graphqlCost struct {
+	RequestedQueryCost float64 `json:"requestedQueryCost"`
+	ActualQueryCost    float64 `json:"actualQueryCost"`
+	ThrottleStatus     struct {
+		MaximumAvailable   float64 `json:"maximumAvailable"`
+		CurrentlyAvailable float64 `json:"currentlyAvailable"`
+		RestoreRate        float64 `json:"restoreRate"`
+	} `json:"throttleStatus"`
+}
+
+func (r *graphqlResponse) throttled() bool {
+	for _, graphqlErr := range r.Errors {
+		if graphqlErr.Extensions.Code == "THROTTLED" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ShopifyAdminClient) send(ctx context.Context, method, endpoint, accessToken string, payload []byte) (*http.Response, []byte, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create admin request: %w", err)
+	}
+	req.Header.Set("X-Shopify-Access-Token", accessToken)
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("admin request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read admin response: %w", err)
+	}
+	return resp, body, nil
+}
+
+func (c *ShopifyAdminClient) shopURL(shop string) string {
+	if c.baseURL != "" {
+		return c.baseURL
+	}
+	return "https://" + shop
+}
+
+func (c *ShopifyAdminClient) bucketsFor(shop string) *shopBuckets {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	buckets, ok := c.buckets[shop]
+	if !ok {
+		buckets = &shopBuckets{}
+		c.buckets[shop] = buckets
+	}
+	return buckets
+}
+
+// restWait returns how long to wait so that the next REST call leaves restHeadroom free slots.
+// The reserved slot is counted immediately so concurrent callers queue behind each other.
+func (b *shopBuckets) restWait(now time.Time, leakRate float64) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.restLimit == 0 {
+		return 0
+	}
+
+	used := math.Max(0, b.restUsed-now.Sub(b.restObservedAt).Seconds()*leakRate)
+	threshold := b.restLimit - restHeadroom
+	var wait time.Duration
+	if used >= threshold {
+		wait = time.Duration((used - threshold + 1) / leakRate * float64(time.Second))
+	}
+
+	b.restUsed = used + 1
+	b.restObservedAt = now
+	return wait
+}
+
+func (b *shopBuckets) observeREST(header string, now time.Time) {
+	parts := strings.SplitN(header, "/", 2)
+	if len(parts) != 2 {
+		return
+	}
+	used, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return
+	}
+	limit, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil || limit <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	b.restUsed = used
+	b.restLimit = limit
+	b.restObservedAt = now
+	b.mu.Unlock()
+}
+
+// graphqlWait returns how long to wait until the cost bucket can afford the query, based on the
+// cost of the previous query.
+func (b *shopBuckets) graphqlWait(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.graphqlMaximum == 0 || b.graphqlRestoreRate == 0 {
+		return 0
+	}
+
+	cost := b.graphqlLastCost
+	if cost == 0 {
+		cost = defaultQueryCost
+	}
+	available := math.Min(b.graphqlMaximum, b.graphqlAvailable+now.Sub(b.graphqlObservedAt).Seconds()*b.graphqlRestoreRate)
+
+	var wait time.Duration
+	if available < cost {
+		wait = time.Duration((cost - available) / b.graphqlRestoreRate * float64(time.Second))
+		available = cost
+	}
+
+	b.graphqlAvailable = available - cost
+	b.graphqlObservedAt = now
+	return wait
+}
+
+func (b *shopBuckets) observeGraphQL(cost *graphqlCost, now time.Time) {
+	if cost == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.graphqlAvailable = cost.ThrottleStatus.CurrentlyAvailable
+	b.graphqlMaximum = cost.ThrottleStatus.MaximumAvailable
+	b.graphqlRestoreRate = cost.ThrottleStatus.RestoreRate
+	b.graphqlObservedAt = now
+	if cost.RequestedQueryCost > 0 {
+		b.graphqlLastCost = cost.RequestedQueryCost
+	}
+}
+
+func retryAfter(header string) time.Duration {
+	if seconds, err := strconv.ParseFloat(strings.TrimSpace(header), 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return defaultRetryAfter
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"mgsearch/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeAdminClient points an admin client at a local fake Shopify server and records the waits
+// it would have slept instead of sleeping.
+func newFakeAdminClient(t *testing.T, handler http.HandlerFunc) (*ShopifyAdminClient, *[]time.Duration) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	var mu sync.Mutex
+	waits := []time.Duration{}
+
+	client := NewShopifyAdminClient(server.Client(), adminAPIVersion)
+	client.baseURL = server.URL
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	client.now = func() time.Time { return now }
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		if d > 0 {
+			mu.Lock()
+			waits = append(waits, d)
+			mu.Unlock()
+		}
+		return ctx.Err()
+	}
+	return client, &waits
+}
+
+func TestShopifyAdminClient_RESTPaginationAndHeaders(t *testing.T) {
+	var serverURL string
+	client, _ := newFakeAdminClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "shpat_token", r.Header.Get("X-Shopify-Access-Token"))
+		assert.Equal(t, "/admin/api/"+adminAPIVersion+"/products.json", r.URL.Path)
+
+		w.Header().Set("X-Shopify-Shop-Api-Call-Limit", "1/40")
+		if r.URL.Query().Get("page_info") == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/admin/api/%s/products.json?page_info=abc>; rel="next"`, serverURL, adminAPIVersion))
+			fmt.Fprint(w, `{"products":[{"id":1}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"products":[{"id":2}]}`)
+	})
+	serverURL = client.baseURL
+
+	var page struct {
+		Products []struct {
+			ID int64 `json:"id"`
+		} `json:"products"`
+	}
+	next, err := client.REST(context.Background(), "demo.myshopify.com", "shpat_token", http.MethodGet, "products.json", nil, &page)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), page.Products[0].ID)
+	require.NotEmpty(t, next)
+
+	next, err = client.REST(context.Background(), "demo.myshopify.com", "shpat_token", http.MethodGet, next, nil, &page)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), page.Products[0].ID)
+	assert.Empty(t, next)
+}
+
+func TestShopifyAdminClient_RetriesTooManyRequests(t *testing.T) {
+	calls := 0
+	client, waits := newFakeAdminClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "1.5")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	})
+
+	_, err := client.REST(context.Background(), "demo.myshopify.com", "token", http.MethodGet, "shop.json", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, []time.Duration{1500 * time.Millisecond}, *waits)
+}
+
+func TestShopifyAdminClient_GivesUpAfterMaxRetries(t *testing.T) {
+	client, _ := newFakeAdminClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	_, err := client.REST(context.Background(), "demo.myshopify.com", "token", http.MethodGet, "shop.json", nil, nil)
+	var apiErr *ShopifyAPIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+}
+
+func TestShopifyAdminClient_ThrottlesFullRESTBucketPerShop(t *testing.T) {
+	client, waits := newFakeAdminClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Shopify-Shop-Api-Call-Limit", "39/40")
+		fmt.Fprint(w, `{}`)
+	})
+	ctx := context.Background()
+
+	_, err := client.REST(ctx, "busy.myshopify.com", "token", http.MethodGet, "shop.json", nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, *waits)
+
+	// The bucket of busy.myshopify.com is nearly full, the next call must wait for it to leak
+	_, err = client.REST(ctx, "busy.myshopify.com", "token", http.MethodGet, "shop.json", nil, nil)
+	require.NoError(t, err)
+	require.Len(t, *waits, 1)
+	assert.Equal(t, time.Second, (*waits)[0])
+
+	// Other shops have their own bucket
+	_, err = client.REST(ctx, "quiet.myshopify.com", "token", http.MethodGet, "shop.json", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, *waits, 1)
+}
+
+func TestShopifyAdminClient_GraphQLCostThrottling(t *testing.T) {
+	calls := 0
+	client, waits := newFakeAdminClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal(t, "/admin/api/"+adminAPIVersion+"/graphql.json", r.URL.Path)
+		if calls == 2 {
+			fmt.Fprint(w, `{"errors":[{"message":"Throttled","extensions":{"code":"THROTTLED"}}],"extensions":{"cost":{"requestedQueryCost":100,"throttleStatus":{"maximumAvailable":1000,"currentlyAvailable":20,"restoreRate":50}}}}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"shop":{"name":"Demo"}},"extensions":{"cost":{"requestedQueryCost":100,"actualQueryCost":100,"throttleStatus":{"maximumAvailable":1000,"currentlyAvailable":900,"restoreRate":50}}}}`)
+	})
+	ctx := context.Background()
+
+	var data struct {
+		Shop struct {
+			Name string `json:"name"`
+		} `json:"shop"`
+	}
+	require.NoError(t, client.GraphQL(ctx, "demo.myshopify.com", "token", `{ shop { name } }`, nil, &data))
+	assert.Equal(t, "Demo", data.Shop.Name)
+	assert.Empty(t, *waits)
+
+	// The second call is throttled in the body; the client waits for 80 points at 50 per second
+	require.NoError(t, client.GraphQL(ctx, "demo.myshopify.com", "token", `{ shop { name } }`, nil, &data))
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []time.Duration{1600 * time.Millisecond}, *waits)
+}
+
+func TestShopifyAdminClient_GraphQLErrors(t *testing.T) {
+	client, _ := newFakeAdminClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"errors":[{"message":"Field 'nope' doesn't exist on type 'Shop'"}]}`)
+	})
+
+	err := client.GraphQL(context.Background(), "demo.myshopify.com", "token", `{ shop { nope } }`, nil, nil)
+	var graphqlErr *ShopifyGraphQLError
+	require.ErrorAs(t, err, &graphqlErr)
+	assert.Contains(t, graphqlErr.Messages[0], "nope")
+}
+
+func TestShopifyService_ExchangeSessionToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/admin/oauth/access_token", r.URL.Path)
+
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:token-exchange", body["grant_type"])
+		assert.Equal(t, "session-token", body["subject_token"])
+		assert.Equal(t, OfflineAccessToken, body["requested_token_type"])
+		assert.Equal(t, "app-secret", body["client_secret"])
+
+		fmt.Fprint(w, `{"access_token":"shpat_offline","scope":"read_products"}`)
+	}))
+	defer server.Close()
+
+	service := NewShopifyService(&config.Config{ShopifyAPIKey: "app-key", ShopifyAPISecret: "app-secret"})
+	service.admin.baseURL = server.URL
+
+	result, err := service.ExchangeSessionToken(context.Background(), "demo.myshopify.com", "session-token", OfflineAccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "shpat_offline", result.AccessToken)
+	assert.Equal(t, "read_products", result.Scope)
+
+	_, err = service.ExchangeSessionToken(context.Background(), "demo.myshopify.com", "session-token", "bogus")
+	assert.Error(t, err)
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"mgsearch/models"
+)
+
+// AppSubscription is a Shopify recurring application charge as returned by the Billing API.
+type AppSubscription struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Test   bool   `json:"test"`
+}
+
+const appSubscriptionCreateMutation = `mutation appSubscriptionCreate($name: String!, $returnUrl: URL!, $trialDays: Int, $test: Boolean, $lineItems: [AppSubscriptionLineItemInput!]!) {
+  appSubscriptionCreate(name: $name, returnUrl: $returnUrl, trialDays: $trialDays, test: $test, lineItems: $lineItems) {
+    confirmationUrl
+    appSubscription { id name status test }
+    userErrors { field message }
+  }
+}`
+
+const appSubscriptionQuery = `query appSubscription($id: ID!) {
+  node(id: $id) {
+    ... on AppSubscription { id name status test }
+  }
+}`
+
+const appSubscriptionCancelMutation = `mutation appSubscriptionCancel($id: ID!) {
+  appSubscriptionCancel(id: $id) {
+    appSubscription { id name status test }
+    userErrors { field message }
+  }
+}`
+
+type billingUserError struct {
+	Field   []string `json:"field"`
+	Message string   `json:"message"`
+}
+
+func userErrorsToError(operation string, userErrors []billingUserError) error {
+	if len(userErrors) == 0 {
+		return nil
+	}
+	messages := make([]string, 0, len(userErrors))
+	for _, userErr := range userErrors {
+		messages = append(messages, userErr.Message)
+	}
+	return fmt.Errorf("%s failed: %s", operation, strings.Join(messages, "; "))
+}
+
+// CreateRecurringCharge creates a monthly app subscription for the plan and returns the URL the
+// merchant must visit to approve it. Shopify sends the merchant back to returnURL afterwards.
+func (s *ShopifyService) CreateRecurringCharge(ctx context.Context, shop, accessToken string, plan models.Plan, returnURL string, test bool) (string, *AppSubscription, error) {
+	variables := map[string]interface{}{
+		"name":      plan.Name,
+		"returnUrl": returnURL,
+		"trialDays": plan.TrialDays,
+		"test":      test,
+		"lineItems": []interface{}{
+			map[string]interface{}{
+				"plan": map[string]interface{}{
+					"appRecurringPricingDetails": map[string]interface{}{
+						"price": map[string]interface{}{
+							"amount":       plan.Price,
+							"currencyCode": plan.CurrencyCode,
+						},
+						"interval": "EVERY_30_DAYS",
+					},
+				},
+			},
+		},
+	}
+
+	var data struct {
+		AppSubscriptionCreate struct {
+			ConfirmationURL string             `json:"confirmationUrl"`
+			AppSubscription *AppSubscription   `json:"appSubscription"`
+			UserErrors      []billingUserError `json:"userErrors"`
+		} `json:"appSubscriptionCreate"`
+	}
+	if err := s.admin.GraphQL(ctx, shop, accessToken, appSubscriptionCreateMutation, variables, &data); err != nil {
+		return "", nil, err
+	}
+
+	result := data.AppSubscriptionCreate
+	if err := userErrorsToError("appSubscriptionCreate", result.UserErrors); err != nil {
+		return "", nil, err
+	}
+	if result.AppSubscription == nil || result.ConfirmationURL == "" {
+		return "", nil, fmt.Errorf("appSubscriptionCreate returned no subscription")
+	}
+
+	return result.ConfirmationURL, result.AppSubscription, nil
+}
+
+// GetSubscription fetches an app subscription by GraphQL ID.
+func (s *ShopifyService) GetSubscription(ctx context.Context, shop, accessToken, subscriptionID string) (*AppSubscription, error) {
+	var data struct {
+		Node *AppSubscription `json:"node"`
+	}
+	if err := s.admin.GraphQL(ctx, shop, accessToken, appSubscriptionQuery, map[string]interface{}{"id": subscriptionID}, &data); err != nil {
+		return nil, err
+	}
+	if data.Node == nil || data.Node.ID == "" {
+		return nil, fmt.Errorf("subscription not found")
+	}
+	return data.Node, nil
+}
+
+// CancelSubscription cancels an active app subscription.
+func (s *ShopifyService) CancelSubscription(ctx context.Context, shop, accessToken, subscriptionID string) error {
+	var data struct {
+		AppSubscriptionCancel struct {
+			UserErrors []billingUserError `json:"userErrors"`
+		} `json:"appSubscriptionCancel"`
+	}
+	if err := s.admin.GraphQL(ctx, shop, accessToken, appSubscriptionCancelMutation, map[string]interface{}{"id": subscriptionID}, &data); err != nil {
+		return err
+	}
+	return userErrorsToError("appSubscriptionCancel", data.AppSubscriptionCancel.UserErrors)
+}
+
+// AppSubscriptionGID converts the numeric charge_id Shopify appends to the return URL into the
+// subscription's GraphQL ID.
+func AppSubscriptionGID(chargeID string) string {
+	if strings.HasPrefix(chargeID, "gid://") {
+		return chargeID
+	}
+	return "gid://shopify/AppSubscription/" + chargeID
+}
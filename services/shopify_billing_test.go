@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"mgsearch/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShopifyService_CreateRecurringCharge(t *testing.T) {
+	admin, _ := newFakeAdminClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.Contains(t, request.Query, "appSubscriptionCreate")
+		assert.Equal(t, "Pro", request.Variables["name"])
+		assert.Equal(t, true, request.Variables["test"])
+		assert.Equal(t, "https://app.example.com/api/billing/callback?shop=demo.myshopify.com", request.Variables["returnUrl"])
+
+		fmt.Fprint(w, `{"data":{"appSubscriptionCreate":{"confirmationUrl":"https://demo.myshopify.com/admin/charges/confirm","appSubscription":{"id":"gid://shopify/AppSubscription/42","name":"Pro","status":"PENDING","test":true},"userErrors":[]}}}`)
+	})
+	service := &ShopifyService{admin: admin}
+
+	plan, ok := models.PlanByLevel(models.PlanPro)
+	require.True(t, ok)
+
+	confirmationURL, subscription, err := service.CreateRecurringCharge(context.Background(), "demo.myshopify.com", "shpat_token", plan, "https://app.example.com/api/billing/callback?shop=demo.myshopify.com", true)
+	require.NoError(t, err)
+	assert.Equal(t, "https://demo.myshopify.com/admin/charges/confirm", confirmationURL)
+	assert.Equal(t, "gid://shopify/AppSubscription/42", subscription.ID)
+	assert.Equal(t, models.SubscriptionStatusPending, subscription.Status)
+}
+
+func TestShopifyService_CreateRecurringChargeUserErrors(t *testing.T) {
+	admin, _ := newFakeAdminClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":{"appSubscriptionCreate":{"confirmationUrl":null,"appSubscription":null,"userErrors":[{"field":["returnUrl"],"message":"Return url is invalid"}]}}}`)
+	})
+	service := &ShopifyService{admin: admin}
+
+	plan, _ := models.PlanByLevel(models.PlanBasic)
+	_, _, err := service.CreateRecurringCharge(context.Background(), "demo.myshopify.com", "shpat_token", plan, "not-a-url", false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Return url is invalid")
+}
+
+func TestShopifyService_GetSubscription(t *testing.T) {
+	admin, _ := newFakeAdminClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Variables map[string]interface{} `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.Equal(t, "gid://shopify/AppSubscription/42", request.Variables["id"])
+		fmt.Fprint(w, `{"data":{"node":{"id":"gid://shopify/AppSubscription/42","name":"Pro","status":"ACTIVE","test":false}}}`)
+	})
+	service := &ShopifyService{admin: admin}
+
+	subscription, err := service.GetSubscription(context.Background(), "demo.myshopify.com", "shpat_token", AppSubscriptionGID("42"))
+	require.NoError(t, err)
+	assert.Equal(t, models.SubscriptionStatusActive, subscription.Status)
+	assert.Equal(t, "gid://shopify/AppSubscription/42", AppSubscriptionGID("gid://shopify/AppSubscription/42"))
+}
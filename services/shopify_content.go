@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"mgsearch/models"
+)
+
+// ListCollections returns every custom and smart collection of the shop.
+func (s *ShopifyService) ListCollections(ctx context.Context, shop, accessToken string) ([]models.ShopifyCollection, error) {
+	collections := []models.ShopifyCollection{}
+	for _, resource := range []string{"custom_collections", "smart_collections"} {
+		err := s.listAll(ctx, shop, accessToken, resource+".json?limit=250", resource, func(raw json.RawMessage) error {
+			var page []models.ShopifyCollection
+			if err := json.Unmarshal(raw, &page); err != nil {
+				return err
+			}
+			collections = append(collections, page...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return collections, nil
+}
+
+// ListPages returns every online store page of the shop.
+func (s *ShopifyService) ListPages(ctx context.Context, shop, accessToken string) ([]models.ShopifyPage, error) {
+	pages := []models.ShopifyPage{}
+	err := s.listAll(ctx, shop, accessToken, "pages.json?limit=250", "pages", func(raw json.RawMessage) error {
+		var page []models.ShopifyPage
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return err
+		}
+		pages = append(pages, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// ListBlogs returns every blog of the shop.
+func (s *ShopifyService) ListBlogs(ctx context.Context, shop, accessToken string) ([]models.ShopifyBlog, error) {
+	blogs := []models.ShopifyBlog{}
+	err := s.listAll(ctx, shop, accessToken, "blogs.json?limit=250", "blogs", func(raw json.RawMessage) error {
+		var page []models.ShopifyBlog
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return err
+		}
+		blogs = append(blogs, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return blogs, nil
+}
+
+// ListArticles returns every article of a blog.
+func (s *ShopifyService) ListArticles(ctx context.Context, shop, accessToken string, blogID int64) ([]models.ShopifyArticle, error) {
+	articles := []models.ShopifyArticle{}
+	path := fmt.Sprintf("blogs/%d/articles.json?limit=250", blogID)
+	err := s.listAll(ctx, shop, accessToken, path, "articles", func(raw json.RawMessage) error {
+		var page []models.ShopifyArticle
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return err
+		}
+		articles = append(articles, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return articles, nil
+}
+
+// listAll follows Link-header pagination and hands the named top-level field of each page to fn.
+func (s *ShopifyService) listAll(ctx context.Context, shop, accessToken, path, field string, fn func(json.RawMessage) error) error {
+	for path != "" {
+		var page map[string]json.RawMessage
+		next, err := s.admin.REST(ctx, shop, accessToken, http.MethodGet, path, nil, &page)
+		if err != nil {
+			return err
+		}
+		if raw, ok := page[field]; ok {
+			if err := fn(raw); err != nil {
+				return fmt.Errorf("failed to decode %s: %w", field, err)
+			}
+		}
+		path = next
+	}
+	return nil
+}
+
+// NewCollectionDocument maps a collection to its search document.
+func NewCollectionDocument(store *models.Store, collection *models.ShopifyCollection) *models.ShopifyContentDocument {
+	doc := newContentDocument(store, models.DocumentTypeCollection, collection.ID, collection.Title, collection.Handle, collection.BodyHTML, collection.PublishedAt, collection.UpdatedAt)
+	if collection.Handle != "" {
+		doc.URL = fmt.Sprintf("https://%s/collections/%s", store.ShopDomain, collection.Handle)
+	}
+	if collection.Image != nil {
+		doc.ImageURL = collection.Image.Src
+	}
+	return doc
+}
+
+// NewPageDocument maps an online store page to its search document.
+func NewPageDocument(store *models.Store, page *models.ShopifyPage) *models.ShopifyContentDocument {
+	doc := newContentDocument(store, models.DocumentTypePage, page.ID, page.Title, page.Handle, page.BodyHTML, page.PublishedAt, page.UpdatedAt)
+	doc.Author = page.Author
+	if page.Handle != "" {
+		doc.URL = fmt.Sprintf("https://%s/pages/%s", store.ShopDomain, page.Handle)
+	}
+	return doc
+}
+
+// NewArticleDocument maps a blog article to its search document.
+func NewArticleDocument(store *models.Store, blog *models.ShopifyBlog, article *models.ShopifyArticle) *models.ShopifyContentDocument {
+	doc := newContentDocument(store, models.DocumentTypeArticle, article.ID, article.Title, article.Handle, article.BodyHTML, article.PublishedAt, article.UpdatedAt)
+	doc.Summary = StripHTML(article.SummaryHTML)
+	doc.Author = article.Author
+	doc.Tags = splitTags(article.Tags)
+	doc.BlogHandle = blog.Handle
+	doc.BlogTitle = blog.Title
+	if blog.Handle != "" && article.Handle != "" {
+		doc.URL = fmt.Sprintf("https://%s/blogs/%s/%s", store.ShopDomain, blog.Handle, article.Handle)
+	}
+	if article.Image != nil {
+		doc.ImageURL = article.Image.Src
+	}
+	return doc
+}
+
+func newContentDocument(store *models.Store, documentType string, id int64, title, handle, bodyHTML string, publishedAt *string, updatedAt string) *models.ShopifyContentDocument {
+	doc := &models.ShopifyContentDocument{
+		ID:           id,
+		StoreID:      store.ID.Hex(),
+		ShopDomain:   store.ShopDomain,
+		DocumentType: documentType,
+		Title:        strings.TrimSpace(title),
+		Handle:       handle,
+		Body:         StripHTML(bodyHTML),
+		UpdatedAt:    updatedAt,
+	}
+	if publishedAt != nil {
+		doc.PublishedAt = *publishedAt
+	}
+	return doc
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"mgsearch/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestShopifyService_ListCollections(t *testing.T) {
+	var serverURL string
+	admin, _ := newFakeAdminClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/admin/api/"+adminAPIVersion+"/custom_collections.json" && r.URL.Query().Get("page_info") == "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/admin/api/%s/custom_collections.json?limit=250&page_info=next>; rel="next"`, serverURL, adminAPIVersion))
+			fmt.Fprint(w, `{"custom_collections":[{"id":1,"handle":"summer","title":"Summer","published_at":"2024-01-01T00:00:00Z"}]}`)
+		case r.URL.Path == "/admin/api/"+adminAPIVersion+"/custom_collections.json":
+			fmt.Fprint(w, `{"custom_collections":[{"id":2,"handle":"hidden","title":"Hidden","published_at":null}]}`)
+		case r.URL.Path == "/admin/api/"+adminAPIVersion+"/smart_collections.json":
+			fmt.Fprint(w, `{"smart_collections":[{"id":3,"handle":"sale","title":"Sale","published_at":"2024-01-01T00:00:00Z"}]}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL.String())
+		}
+	})
+	serverURL = admin.baseURL
+	service := &ShopifyService{admin: admin}
+
+	collections, err := service.ListCollections(context.Background(), "demo.myshopify.com", "shpat_token")
+	require.NoError(t, err)
+	require.Len(t, collections, 3)
+	assert.True(t, collections[0].IsPublished())
+	assert.False(t, collections[1].IsPublished())
+	assert.Equal(t, "sale", collections[2].Handle)
+}
+
+func TestNewContentDocuments(t *testing.T) {
+	store := &models.Store{ID: primitive.NewObjectID(), ShopDomain: "demo.myshopify.com", ProductIndexUID: "demo_all_products"}
+	published := "2024-01-01T00:00:00Z"
+
+	page := NewPageDocument(store, &models.ShopifyPage{ID: 7, Title: " Shipping ", Handle: "shipping", BodyHTML: "<p>We ship <b>worldwide</b></p>", PublishedAt: &published})
+	assert.Equal(t, models.DocumentTypePage, page.DocumentType)
+	assert.Equal(t, "Shipping", page.Title)
+	assert.Equal(t, "We ship worldwide", page.Body)
+	assert.Equal(t, "https://demo.myshopify.com/pages/shipping", page.URL)
+
+	blog := &models.ShopifyBlog{ID: 1, Handle: "news", Title: "News"}
+	article := NewArticleDocument(store, blog, &models.ShopifyArticle{ID: 9, Title: "Launch", Handle: "launch", Tags: "press, launch", Image: &models.ShopifyImage{Src: "https://cdn.shopify.com/launch.jpg"}})
+	assert.Equal(t, models.DocumentTypeArticle, article.DocumentType)
+	assert.Equal(t, "https://demo.myshopify.com/blogs/news/launch", article.URL)
+	assert.Equal(t, []string{"press", "launch"}, article.Tags)
+	assert.Equal(t, "news", article.BlogHandle)
+
+	collection := NewCollectionDocument(store, &models.ShopifyCollection{ID: 3, Handle: "sale", Title: "Sale"})
+	assert.Equal(t, "https://demo.myshopify.com/collections/sale", collection.URL)
+
+	assert.Equal(t, "demo_all_collections", store.ContentIndexUID(models.DocumentTypeCollection))
+	assert.Equal(t, "demo_all_articles", store.ContentIndexUID(models.DocumentTypeArticle))
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mgsearch/models"
+)
+
+// metafieldPageSize is the number of product metafields fetched per product; Shopify caps
+// connections at 250 nodes.
+const metafieldPageSize = 250
+
+// GetProductLocalization fetches the product's metafields in the given namespaces and its
+// translations for each locale in a single GraphQL request. Either list may be empty.
+func (s *ShopifyService) GetProductLocalization(ctx context.Context, shop, accessToken string, productID int64, namespaces, locales []string) (*models.ShopifyProductLocalization, error) {
+	localization := &models.ShopifyProductLocalization{Translations: map[string][]models.ShopifyTranslation{}}
+	if len(namespaces) == 0 && len(locales) == 0 {
+		return localization, nil
+	}
+
+	query, variables := productLocalizationQuery(productID, len(namespaces) > 0, locales)
+
+	var data struct {
+		Product map[string]json.RawMessage `json:"product"`
+	}
+	if err := s.admin.GraphQL(ctx, shop, accessToken, query, variables, &data); err != nil {
+		return nil, err
+	}
+	if data.Product == nil {
+		return nil, fmt.Errorf("product not found")
+	}
+
+	if raw, ok := data.Product["metafields"]; ok {
+		var metafields struct {
+			Nodes []models.ShopifyMetafield `json:"nodes"`
+		}
+		if err := json.Unmarshal(raw, &metafields); err != nil {
+			return nil, fmt.Errorf("failed to decode metafields: %w", err)
+		}
+		wanted := make(map[string]bool, len(namespaces))
+		for _, namespace := range namespaces {
+			wanted[namespace] = true
+		}
+		for _, metafield := range metafields.Nodes {
+			if wanted[metafield.Namespace] {
+				localization.Metafields = append(localization.Metafields, metafield)
+			}
+		}
+	}
+
+	for i, locale := range locales {
+		raw, ok := data.Product[fmt.Sprintf("translations%d", i)]
+		if !ok {
+			continue
+		}
+		var translations []models.ShopifyTranslation
+		if err := json.Unmarshal(raw, &translations); err != nil {
+			return nil, fmt.Errorf("failed to decode %s translations: %w", locale, err)
+		}
+		localization.Translations[locale] = translations
+	}
+
+	return localization, nil
+}
+
+// productLocalizationQuery builds the product query with one aliased translations field per
+// locale, since a single translations field only accepts one locale.
+func productLocalizationQuery(productID int64, withMetafields bool, locales []string) (string, map[string]interface{}) {
+	variables := map[string]interface{}{"id": fmt.Sprintf("gid://shopify/Product/%d", productID)}
+	params := []string{"$id: ID!"}
+	var fields []string
+
+	if withMetafields {
+		fields = append(fields, fmt.Sprintf("metafields(first: %d) { nodes { namespace key value type } }", metafieldPageSize))
+	}
+	for i, locale := range locales {
+		name := fmt.Sprintf("locale%d", i)
+		variables[name] = locale
+		params = append(params, fmt.Sprintf("$%s: String!", name))
+		fields = append(fields, fmt.Sprintf("translations%d: translations(locale: $%s) { key value }", i, name))
+	}
+
+	query := fmt.Sprintf("query productLocalization(%s) {\n  product(id: $id) {\n    %s\n  }\n}", strings.Join(params, ", "), strings.Join(fields, "\n    "))
+	return query, variables
+}
+
+// ApplyMetafields adds the metafields to the document as metafields.<namespace>.<key>, decoding
+// numeric, boolean, list and JSON values so they can be filtered on.
+func ApplyMetafields(doc *models.ShopifyProductDocument, metafields []models.ShopifyMetafield) {
+	if len(metafields) == 0 {
+		return
+	}
+	if doc.Metafields == nil {
+		doc.Metafields = map[string]map[string]interface{}{}
+	}
+	for _, metafield := range metafields {
+		if doc.Metafields[metafield.Namespace] == nil {
+			doc.Metafields[metafield.Namespace] = map[string]interface{}{}
+		}
+		doc.Metafields[metafield.Namespace][metafield.Key] = metafieldValue(metafield)
+	}
+}
+
+func metafieldValue(metafield models.ShopifyMetafield) interface{} {
+	switch {
+	case metafield.Type == "number_integer", metafield.Type == "number_decimal":
+		if number, err := strconv.ParseFloat(metafield.Value, 64); err == nil {
+			return number
+		}
+	case metafield.Type == "boolean":
+		if value, err := strconv.ParseBool(metafield.Value); err == nil {
+			return value
+		}
+	case metafield.Type == "json", strings.HasPrefix(metafield.Type, "list."):
+		var value interface{}
+		if err := json.Unmarshal([]byte(metafield.Value), &value); err == nil {
+			return value
+		}
+	}
+	return metafield.Value
+}
+
+// NewShopifyProductTranslation maps Shopify translatable content keys onto document fields.
+// It reports false when the locale has no translated field the index uses.
+func NewShopifyProductTranslation(translations []models.ShopifyTranslation) (models.ShopifyProductTranslation, bool) {
+	var translation models.ShopifyProductTranslation
+	found := false
+	for _, field := range translations {
+		if strings.TrimSpace(field.Value) == "" {
+			continue
+		}
+		switch field.Key {
+		case "title":
+			translation.Title = strings.TrimSpace(field.Value)
+		case "handle":
+			translation.Handle = field.Value
+		case "body_html":
+			translation.Description = StripHTML(field.Value)
+		case "product_type":
+			translation.ProductType = field.Value
+		default:
+			continue
+		}
+		found = true
+	}
+	return translation, found
+}
+
+// ApplyTranslations stores each locale's translation on the document under translations.<locale>.
+func ApplyTranslations(doc *models.ShopifyProductDocument, translations map[string][]models.ShopifyTranslation) {
+	for locale, fields := range translations {
+		translation, ok := NewShopifyProductTranslation(fields)
+		if !ok {
+			continue
+		}
+		if doc.Translations == nil {
+			doc.Translations = map[string]models.ShopifyProductTranslation{}
+		}
+		doc.Translations[locale] = translation
+	}
+}
+
+// LocalizedProductDocument returns a copy of the document with translated fields in place of the
+// originals, for per-locale indexes. Untranslated fields keep the shop's default language and the
+// URL points at the locale's storefront path.
+func LocalizedProductDocument(store *models.Store, doc *models.ShopifyProductDocument, locale string, fields []models.ShopifyTranslation) *models.ShopifyProductDocument {
+	localized := *doc
+	localized.Locale = locale
+	localized.Translations = nil
+
+	translation, _ := NewShopifyProductTranslation(fields)
+	if translation.Title != "" {
+		localized.Title = translation.Title
+	}
+	if translation.Handle != "" {
+		localized.Handle = translation.Handle
+	}
+	if translation.Description != "" {
+		localized.Description = translation.Description
+	}
+	if translation.ProductType != "" {
+		localized.ProductType = translation.ProductType
+	}
+	if localized.Handle != "" {
+		localized.URL = fmt.Sprintf("https://%s/%s/products/%s", store.ShopDomain, strings.ToLower(locale), localized.Handle)
+	}
+	return &localized
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"mgsearch/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestShopifyService_GetProductLocalization(t *testing.T) {
+	admin, _ := newFakeAdminClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.Contains(t, request.Query, "translations0: translations(locale: $locale0)")
+		assert.Contains(t, request.Query, "translations1: translations(locale: $locale1)")
+		assert.Equal(t, "gid://shopify/Product/42", request.Variables["id"])
+		assert.Equal(t, "fr", request.Variables["locale0"])
+		assert.Equal(t, "de", request.Variables["locale1"])
+
+		fmt.Fprint(w, `{"data":{"product":{
+			"metafields":{"nodes":[
+				{"namespace":"custom","key":"material","value":"Cotton","type":"single_line_text_field"},
+				{"namespace":"internal","key":"cost","value":"3.50","type":"number_decimal"}
+			]},
+			"translations0":[{"key":"title","value":"Chemise"},{"key":"body_html","value":"<p>En coton</p>"}],
+			"translations1":[]
+		}}}`)
+	})
+	service := &ShopifyService{admin: admin}
+
+	localization, err := service.GetProductLocalization(context.Background(), "demo.myshopify.com", "shpat_token", 42, []string{"custom"}, []string{"fr", "de"})
+	require.NoError(t, err)
+	require.Len(t, localization.Metafields, 1)
+	assert.Equal(t, "material", localization.Metafields[0].Key)
+	assert.Len(t, localization.Translations["fr"], 2)
+	assert.Empty(t, localization.Translations["de"])
+}
+
+func TestApplyMetafieldsAndTranslations(t *testing.T) {
+	store := &models.Store{ID: primitive.NewObjectID(), ShopDomain: "demo.myshopify.com", ProductIndexUID: "demo_all_products"}
+	doc := &models.ShopifyProductDocument{ID: 1, Title: "Shirt", Handle: "shirt", ProductType: "Tops"}
+
+	ApplyMetafields(doc, []models.ShopifyMetafield{
+		{Namespace: "custom", Key: "material", Value: "Cotton", Type: "single_line_text_field"},
+		{Namespace: "custom", Key: "weight", Value: "120", Type: "number_integer"},
+		{Namespace: "custom", Key: "organic", Value: "true", Type: "boolean"},
+		{Namespace: "custom", Key: "colors", Value: `["red","blue"]`, Type: "list.single_line_text_field"},
+	})
+	assert.Equal(t, "Cotton", doc.Metafields["custom"]["material"])
+	assert.Equal(t, 120.0, doc.Metafields["custom"]["weight"])
+	assert.Equal(t, true, doc.Metafields["custom"]["organic"])
+	assert.Equal(t, []interface{}{"red", "blue"}, doc.Metafields["custom"]["colors"])
+
+	translations := map[string][]models.ShopifyTranslation{
+		"fr": {{Key: "title", Value: "Chemise"}, {Key: "handle", Value: "chemise"}, {Key: "meta_title", Value: "ignored"}},
+		"de": {{Key: "meta_title", Value: "ignored"}},
+	}
+	ApplyTranslations(doc, translations)
+	assert.Equal(t, map[string]models.ShopifyProductTranslation{"fr": {Title: "Chemise", Handle: "chemise"}}, doc.Translations)
+
+	localized := LocalizedProductDocument(store, doc, "fr", translations["fr"])
+	assert.Equal(t, "Chemise", localized.Title)
+	assert.Equal(t, "Tops", localized.ProductType)
+	assert.Equal(t, "fr", localized.Locale)
+	assert.Nil(t, localized.Translations)
+	assert.Equal(t, "https://demo.myshopify.com/fr/products/chemise", localized.URL)
+	assert.Equal(t, "Shirt", doc.Title)
+}
+
+func TestStore_LocaleIndexUIDs(t *testing.T) {
+	store := &models.Store{
+		ProductIndexUID: "demo_all_products",
+		Indexing:        models.StoreIndexing{Locales: []string{"fr", "pt-BR"}, LocaleMode: models.LocaleModeFields},
+	}
+	assert.Empty(t, store.LocaleIndexUIDs())
+	assert.Equal(t, "demo_all_products", store.SearchIndexUID("fr"))
+
+	store.Indexing.LocaleMode = models.LocaleModeIndexes
+	assert.Equal(t, map[string]string{"fr": "demo_all_products_fr", "pt-BR": "demo_all_products_pt_br"}, store.LocaleIndexUIDs())
+	assert.Equal(t, "demo_all_products_pt_br", store.SearchIndexUID("pt-br"))
+	assert.Equal(t, "demo_all_products", store.SearchIndexUID("de"))
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mgsearch/models"
+)
+
+var (
+	htmlBlockTagPattern = regexp.MustCompile(`(?i)<\s*(br|/p|/div|/li|/h[1-6]|/tr)\s*/?>`)
+	htmlTagPattern      = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlScriptPattern   = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)>`)
+	whitespacePattern   = regexp.MustCompile(`\s+`)
+)
+
+// ParseShopifyProduct decodes a Shopify product payload (webhook body or Admin API object).
+func ParseShopifyProduct(payload []byte) (*models.ShopifyProduct, error) {
+	var product models.ShopifyProduct
+	if err := json.Unmarshal(payload, &product); err != nil {
+		return nil, fmt.Errorf("failed to decode product payload: %w", err)
+	}
+	if product.ID == 0 {
+		return nil, fmt.Errorf("product id missing")
+	}
+	return &product, nil
+}
+
+// NewShopifyProductDocument flattens a Shopify product into the search document stored for the store.
+// Callers are expected to check product.IsPublished() first; unpublished products should be removed
+// from the index rather than mapped.
+func NewShopifyProductDocument(store *models.Store, product *models.ShopifyProduct) *models.ShopifyProductDocument {
+	doc := &models.ShopifyProductDocument{
+		ID:            product.ID,
+		StoreID:       store.ID.Hex(),
+		ShopDomain:    store.ShopDomain,
+		DocumentType:  store.DocumentType(),
+		Title:         strings.TrimSpace(product.Title),
+		Handle:        product.Handle,
+		Description:   StripHTML(product.BodyHTML),
+		Vendor:        product.Vendor,
+		ProductType:   product.ProductType,
+		Tags:          splitTags(product.Tags),
+		Options:       []models.ShopifyProductOption{},
+		SKUs:          []string{},
+		ImageURLs:     []string{},
+		Collections:   []string{},
+		CollectionIDs: []int64{},
+		VariantsCount: len(product.Variants),
+		CreatedAt:     product.CreatedAt,
+		UpdatedAt:     product.UpdatedAt,
+	}
+
+	if product.Handle != "" {
+		doc.URL = fmt.Sprintf("https://%s/products/%s", store.ShopDomain, product.Handle)
+	}
+	if product.PublishedAt != nil {
+		doc.PublishedAt = *product.PublishedAt
+	}
+
+	for _, option := range product.Options {
+		// Shopify reports a single "Title" option with the value "Default Title" for products without variants
+		if option.Name == "Title" && len(option.Values) == 1 && option.Values[0] == "Default Title" {
+			continue
+		}
+		doc.Options = append(doc.Options, option)
+	}
+
+	pricesSet := false
+	for _, variant := range product.Variants {
+		if sku := strings.TrimSpace(variant.SKU); sku != "" {
+			doc.SKUs = append(doc.SKUs, sku)
+		}
+
+		if price, ok := parsePrice(variant.Price); ok {
+			if !pricesSet || price < doc.PriceMin {
+				doc.PriceMin = price
+			}
+			if !pricesSet || price > doc.PriceMax {
+				doc.PriceMax = price
+			}
+			pricesSet = true
+		}
+
+		if variant.CompareAtPrice != nil {
+			if compareAt, ok := parsePrice(*variant.CompareAtPrice); ok && compareAt > 0 {
+				if doc.CompareAtPriceMin == 0 || compareAt < doc.CompareAtPriceMin {
+					doc.CompareAtPriceMin = compareAt
+				}
+				if compareAt > doc.CompareAtPriceMax {
+					doc.CompareAtPriceMax = compareAt
+				}
+			}
+		}
+
+		if variantAvailable(variant) {
+			doc.InStock = true
+		}
+	}
+
+	if product.Image != nil && product.Image.Src != "" {
+		doc.ImageURL = product.Image.Src
+	}
+	for _, image := range product.Images {
+		if image.Src == "" {
+			continue
+		}
+		doc.ImageURLs = append(doc.ImageURLs, image.Src)
+	}
+	if doc.ImageURL == "" && len(doc.ImageURLs) > 0 {
+		doc.ImageURL = doc.ImageURLs[0]
+	}
+
+	return doc
+}
+
+// StripHTML removes markup from Shopify rich text fields and collapses whitespace.
+func StripHTML(input string) string {
+	if input == "" {
+		return ""
+	}
+	text := htmlScriptPattern.ReplaceAllString(input, " ")
+	text = htmlBlockTagPattern.ReplaceAllString(text, " ")
+	text = htmlTagPattern.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = whitespacePattern.ReplaceAllString(text, " ")
+	return strings.TrimSpace(text)
+}
+
+// variantAvailable mirrors Shopify's storefront availability rules: untracked inventory or
+// overselling always counts as available, otherwise stock must be positive.
+func variantAvailable(variant models.ShopifyVariant) bool {
+	if variant.InventoryManagement == nil || *variant.InventoryManagement == "" {
+		return true
+	}
+	if strings.EqualFold(variant.InventoryPolicy, "continue") {
+		return true
+	}
+	return variant.InventoryQuantity > 0
+}
+
+func splitTags(tags string) []string {
+	result := []string{}
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+func parsePrice(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	price, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return price, true
+}
+
+// ParseShopifyProductListing decodes a product_listings/* payload into a product. Listings are by
+// definition published to the app's sales channel, so the product is marked as published.
+func ParseShopifyProductListing(payload []byte) (*models.ShopifyProduct, error) {
+	var listing models.ShopifyProductListing
+	if err := json.Unmarshal(payload, &listing); err != nil {
+		return nil, fmt.Errorf("failed to decode product listing payload: %w", err)
+	}
+
+	product := listing.ProductListing.ShopifyProduct
+	if product.ID == 0 {
+		product.ID = listing.ProductListing.ProductID
+	}
+	if product.ID == 0 {
+		return nil, fmt.Errorf("product id missing")
+	}
+	if product.PublishedAt == nil || *product.PublishedAt == "" {
+		publishedAt := product.UpdatedAt
+		product.PublishedAt = &publishedAt
+	}
+	return &product, nil
+}
+
+// InventoryItemsFromProduct extracts the inventory item of every variant of the product.
+func InventoryItemsFromProduct(storeID string, product *models.ShopifyProduct) []models.InventoryItem {
+	items := make([]models.InventoryItem, 0, len(product.Variants))
+	for _, variant := range product.Variants {
+		if variant.InventoryItemID == 0 {
+			continue
+		}
+		items = append(items, models.InventoryItem{
+			StoreID:         storeID,
+			InventoryItemID: variant.InventoryItemID,
+			ProductID:       product.ID,
+			VariantID:       variant.ID,
+			Tracked:         variant.InventoryManagement != nil && *variant.InventoryManagement != "",
+			ContinueSelling: strings.EqualFold(variant.InventoryPolicy, "continue"),
+			Quantity:        variant.InventoryQuantity,
+		})
+	}
+	return items
+}
+
+// ProductInStock decides whether a product is sellable from its inventory items. Items with
+// per-location levels use the sum of the levels at active locations; items without levels fall
+// back to the total quantity last reported on the variant.
+func ProductInStock(items []models.InventoryItem, levels []models.InventoryLevel, inactiveLocations map[int64]bool) bool {
+	levelsByItem := make(map[int64][]models.InventoryLevel)
+	for _, level := range levels {
+		levelsByItem[level.InventoryItemID] = append(levelsByItem[level.InventoryItemID], level)
+	}
+
+	for _, item := range items {
+		if !item.Tracked || item.ContinueSelling {
+			return true
+		}
+
+		quantity := item.Quantity
+		if itemLevels, ok := levelsByItem[item.InventoryItemID]; ok {
+			quantity = 0
+			for _, level := range itemLevels {
+				if !inactiveLocations[level.LocationID] {
+					quantity += level.Available
+				}
+			}
+		}
+		if quantity > 0 {
+			return true
+		}
+	}
+	return false
+}
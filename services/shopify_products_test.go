@@ -0,0 +1,166 @@
+package services
+
+import (
+	"testing"
+
+	"mgsearch/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const sampleProductPayload = `{
+	"id": 632910392,
+	"title": "IPod Nano - 8GB",
+	"body_html": "<p>It's the <strong>small</strong> iPod &amp; more.</p><script>alert(1)</script><p>Second paragraph</p>",
+	"vendor": "Apple",
+	"product_type": "Cult Products",
+	"handle": "ipod-nano",
+	"status": "active",
+	"tags": "Emotive, Flash Memory, MP3,  ",
+	"published_at": "2024-01-02T10:00:00-05:00",
+	"created_at": "2024-01-01T10:00:00-05:00",
+	"updated_at": "2024-01-03T10:00:00-05:00",
+	"admin_graphql_api_id": "gid://shopify/Product/632910392",
+	"variants": [
+		{"id": 1, "title": "Pink", "price": "199.00", "compare_at_price": "249.00", "sku": "IPOD2008PINK", "inventory_quantity": 0, "inventory_policy": "deny", "inventory_management": "shopify"},
+		{"id": 2, "title": "Black", "price": "179.50", "compare_at_price": null, "sku": "IPOD2008BLACK", "inventory_quantity": 5, "inventory_policy": "deny", "inventory_management": "shopify"}
+	],
+	"options": [{"name": "Color", "values": ["Pink", "Black"]}],
+	"images": [{"id": 10, "src": "https://cdn.shopify.com/a.jpg"}, {"id": 11, "src": "https://cdn.shopify.com/b.jpg"}],
+	"image": {"id": 11, "src": "https://cdn.shopify.com/b.jpg"}
+}`
+
+func TestNewShopifyProductDocument(t *testing.T) {
+	store := &models.Store{ID: primitive.NewObjectID(), ShopDomain: "demo.myshopify.com"}
+
+	product, err := ParseShopifyProduct([]byte(sampleProductPayload))
+	require.NoError(t, err)
+	require.True(t, product.IsPublished())
+
+	doc := NewShopifyProductDocument(store, product)
+
+	assert.Equal(t, int64(632910392), doc.ID)
+	assert.Equal(t, store.ID.Hex(), doc.StoreID)
+	assert.Equal(t, "product", doc.DocumentType)
+	assert.Equal(t, "https://demo.myshopify.com/products/ipod-nano", doc.URL)
+	assert.Equal(t, "It's the small iPod & more. Second paragraph", doc.Description)
+	assert.Equal(t, []string{"Emotive", "Flash Memory", "MP3"}, doc.Tags)
+	assert.Equal(t, []string{"IPOD2008PINK", "IPOD2008BLACK"}, doc.SKUs)
+	assert.Equal(t, 179.5, doc.PriceMin)
+	assert.Equal(t, 199.0, doc.PriceMax)
+	assert.Equal(t, 249.0, doc.CompareAtPriceMin)
+	assert.True(t, doc.InStock)
+	assert.Equal(t, 2, doc.VariantsCount)
+	assert.Equal(t, "https://cdn.shopify.com/b.jpg", doc.ImageURL)
+	assert.Len(t, doc.ImageURLs, 2)
+
+	document, err := doc.ToDocument()
+	require.NoError(t, err)
+	assert.NotContains(t, document, "body_html")
+	assert.NotContains(t, document, "variants")
+	assert.NotContains(t, document, "admin_graphql_api_id")
+}
+
+func TestShopifyProduct_IsPublished(t *testing.T) {
+	published := "2024-01-02T10:00:00Z"
+
+	tests := []struct {
+		name    string
+		product models.ShopifyProduct
+		want    bool
+	}{
+		{name: "active and published", product: models.ShopifyProduct{Status: "active", PublishedAt: &published}, want: true},
+		{name: "draft", product: models.ShopifyProduct{Status: "draft", PublishedAt: &published}, want: false},
+		{name: "archived", product: models.ShopifyProduct{Status: "archived", PublishedAt: &published}, want: false},
+		{name: "active but unpublished", product: models.ShopifyProduct{Status: "active"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.product.IsPublished())
+		})
+	}
+}
+
+func TestParseShopifyProduct_MissingID(t *testing.T) {
+	_, err := ParseShopifyProduct([]byte(`{"title": "Product without ID"}`))
+	assert.Error(t, err)
+}
+
+func TestNewShopifyProductDocument_OutOfStock(t *testing.T) {
+	store := &models.Store{ID: primitive.NewObjectID(), ShopDomain: "demo.myshopify.com"}
+	tracked := "shopify"
+
+	product := &models.ShopifyProduct{
+		ID: 1,
+		Variants: []models.ShopifyVariant{
+			{Price: "10.00", InventoryManagement: &tracked, InventoryPolicy: "deny", InventoryQuantity: 0},
+		},
+		Options: []models.ShopifyProductOption{{Name: "Title", Values: []string{"Default Title"}}},
+	}
+
+	doc := NewShopifyProductDocument(store, product)
+	assert.False(t, doc.InStock)
+	assert.Empty(t, doc.Options)
+	assert.Empty(t, doc.URL)
+}
+
+func TestParseShopifyProductListing(t *testing.T) {
+	payload := `{"product_listing": {"product_id": 921728736, "title": "IPod Touch 8GB", "handle": "ipod-touch", "updated_at": "2024-02-01T10:00:00Z", "variants": [{"id": 5, "price": "199.00", "inventory_item_id": 50}]}}`
+
+	product, err := ParseShopifyProductListing([]byte(payload))
+	require.NoError(t, err)
+	assert.Equal(t, int64(921728736), product.ID)
+	assert.Equal(t, "ipod-touch", product.Handle)
+	assert.True(t, product.IsPublished())
+
+	items := InventoryItemsFromProduct("store-1", product)
+	require.Len(t, items, 1)
+	assert.Equal(t, int64(50), items[0].InventoryItemID)
+	assert.Equal(t, int64(921728736), items[0].ProductID)
+	assert.False(t, items[0].Tracked)
+}
+
+func TestProductInStock(t *testing.T) {
+	tracked := models.InventoryItem{InventoryItemID: 1, Tracked: true, Quantity: 3}
+
+	tests := []struct {
+		name     string
+		items    []models.InventoryItem
+		levels   []models.InventoryLevel
+		inactive map[int64]bool
+		want     bool
+	}{
+		{name: "no items", want: false},
+		{name: "untracked", items: []models.InventoryItem{{InventoryItemID: 1}}, want: true},
+		{name: "continue selling", items: []models.InventoryItem{{InventoryItemID: 1, Tracked: true, ContinueSelling: true}}, want: true},
+		{name: "variant quantity without levels", items: []models.InventoryItem{tracked}, want: true},
+		{
+			name:   "levels override variant quantity",
+			items:  []models.InventoryItem{tracked},
+			levels: []models.InventoryLevel{{InventoryItemID: 1, LocationID: 10, Available: 0}},
+			want:   false,
+		},
+		{
+			name:     "stock only at inactive location",
+			items:    []models.InventoryItem{tracked},
+			levels:   []models.InventoryLevel{{InventoryItemID: 1, LocationID: 10, Available: 4}, {InventoryItemID: 1, LocationID: 11, Available: 0}},
+			inactive: map[int64]bool{10: true},
+			want:     false,
+		},
+		{
+			name:   "stock at active location",
+			items:  []models.InventoryItem{tracked},
+			levels: []models.InventoryLevel{{InventoryItemID: 1, LocationID: 10, Available: -2}, {InventoryItemID: 1, LocationID: 11, Available: 5}},
+			want:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ProductInStock(tt.items, tt.levels, tt.inactive))
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"mgsearch/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingScopes(t *testing.T) {
+	required := ParseScopes("read_products, write_webhooks,read_inventory,,read_locales")
+
+	assert.Equal(t, []string{"read_products", "write_webhooks", "read_inventory", "read_locales"}, required)
+	assert.Empty(t, MissingScopes([]string{"write_products", "write_webhooks", "read_inventory", "read_locales"}, required))
+	assert.Equal(t, []string{"read_locales"}, MissingScopes([]string{"read_products", "write_webhooks", "read_inventory"}, required))
+	assert.Equal(t, required, MissingScopes(nil, required))
+	// Read access does not imply write access
+	assert.Equal(t, []string{"write_webhooks"}, MissingScopes([]string{"read_products", "read_webhooks", "read_inventory", "read_locales"}, required))
+}
+
+func TestShopifyService_ListAccessScopes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/admin/oauth/access_scopes.json", r.URL.Path)
+		assert.Equal(t, "shpat_token", r.Header.Get("X-Shopify-Access-Token"))
+		fmt.Fprint(w, `{"access_scopes":[{"handle":"read_products"},{"handle":"write_webhooks"}]}`)
+	}))
+	defer server.Close()
+
+	service := NewShopifyService(&config.Config{ShopifyScopes: "read_products,read_inventory"})
+	service.admin.baseURL = server.URL
+
+	scopes, err := service.ListAccessScopes(context.Background(), "demo.myshopify.com", "shpat_token")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"read_products", "write_webhooks"}, scopes)
+	assert.Equal(t, []string{"read_inventory"}, MissingScopes(scopes, service.RequiredScopes()))
+}
+
+func TestShopifyService_ValidateAppProxySignature(t *testing.T) {
+	service := NewShopifyService(&config.Config{ShopifyAPISecret: "hush"})
+
+	// Repeated values are joined with commas and pairs are concatenated without separators
+	values := url.Values{
+		"extra":                 {"1", "2"},
+		"logged_in_customer_id": {""},
+		"path_prefix":           {"/apps/awesome_reviews"},
+		"shop":                  {"shop-name.myshopify.com"},
+		"timestamp":             {"1317327555"},
+		"signature":             {"e072b6d7e6622d85912a5214b860d3100dc1e73d9bc29f43796ac8c9ff8093cb"},
+	}
+	assert.True(t, service.ValidateAppProxySignature(values))
+
+	values.Set("shop", "other-shop.myshopify.com")
+	assert.False(t, service.ValidateAppProxySignature(values))
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"mgsearch/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrTokenRevoked is returned by TokenRevocationService.CheckToken for tokens that must no longer be
+// accepted.
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// maxTokenCacheEntries bounds each of the revocation caches; expired entries are pruned when it is
+// reached.
+const maxTokenCacheEntries = 10000
+
+// UserTokenStore loads users and bumps their token version. It is implemented by
+// repositories.UserRepository.
+type UserTokenStore interface {
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	IncrementTokenVersion(ctx context.Context, userID primitive.ObjectID) error
+}
+
+// RevokedTokenStore persists the access token denylist. It is implemented by
+// repositories.RevokedTokenRepository.
+type RevokedTokenStore interface {
+	Revoke(ctx context.Context, tokenID string, userID primitive.ObjectID, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+}
+
+// TokenRevocationService decides whether a user access token is still valid. A token is rejected
+// when the user is inactive, when it was issued before the user's token version was bumped
+// (password change, deactivation, "log out everywhere"), or when its jti is on the denylist.
+// Lookups are cached for cacheTTL, so a revocation made on another instance takes up to that long to
+// apply here; revocations made through this service apply immediately.
+type TokenRevocationService struct {
+	users    UserTokenStore
+	revoked  RevokedTokenStore
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mu          sync.Mutex
+	userStates  map[string]cachedUserTokens
+	tokenStates map[string]cachedTokenState
+}
+
+type cachedUserTokens struct {
+	version  int
+	active   bool
+	loadedAt time.Time
+}
+
+type cachedTokenState struct {
+	revoked  bool
+	loadedAt time.Time
+}
+
+func NewTokenRevocationService(users UserTokenStore, revoked RevokedTokenStore, cacheTTL time.Duration) *TokenRevocationService {
+	return &TokenRevocationService{
+		users:       users,
+		revoked:     revoked,
+		cacheTTL:    cacheTTL,
+		now:         time.Now,
+		userStates:  make(map[string]cachedUserTokens),
+		tokenStates: make(map[string]cachedTokenState),
+	}
+}
+
+// CheckToken returns ErrTokenRevoked when a token of userID issued at tokenVersion with ID tokenID
+// must be rejected. Tokens without an ID predate the denylist and are only checked by version.
+func (s *TokenRevocationService) CheckToken(ctx context.Context, userID string, tokenVersion int, tokenID string) error {
+	state, err := s.userState(ctx, userID)
+	if err != nil {
+		return err
+	}
+	// Tokens issued after a bump that this instance has not seen yet carry a higher version
+	if !state.active || tokenVersion < state.version {
+		return ErrTokenRevoked
+	}
+
+	if tokenID == "" {
+		return nil
+	}
+	revoked, err := s.tokenRevoked(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// RevokeToken denylists a single access token until it expires.
+func (s *TokenRevocationService) RevokeToken(ctx context.Context, userID primitive.ObjectID, tokenID string, expiresAt time.Time) error {
+	if err := s.revoked.Revoke(ctx, tokenID, userID, expiresAt); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.tokenStates[tokenID] = cachedTokenState{revoked: true, loadedAt: s.now()}
+	s.mu.Unlock()
+	return nil
+}
+
+// RevokeAllTokens invalidates every access token issued to the user so far.
+func (s *TokenRevocationService) RevokeAllTokens(ctx context.Context, userID primitive.ObjectID) error {
+	if err := s.users.IncrementTokenVersion(ctx, userID); err != nil {
+		return err
+	}
+	s.Forget(userID)
+	return nil
+}
+
+// Forget drops the cached state of the user, so a token version bumped or deactivation made
+// directly through the user repository applies to the next request.
+func (s *TokenRevocationService) Forget(userID primitive.ObjectID) {
+	s.mu.Lock()
+	delete(s.userStates, userID.Hex())
+	s.mu.Unlock()
+}
+
+func (s *TokenRevocationService) userState(ctx context.Context, userID string) (cachedUserTokens, error) {
+	now := s.now()
+	s.mu.Lock()
+	state, ok := s.userStates[userID]
+	s.mu.Unlock()
+	if ok && now.Sub(state.loadedAt) < s.cacheTTL {
+		return state, nil
+	}
+
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return cachedUserTokens{}, ErrTokenRevoked
+	}
+	user, err := s.users.FindByID(ctx, id)
+	if err != nil {
+		if err.Error() == "user not found" {
+			return cachedUserTokens{}, ErrTokenRevoked
+		}
+		return cachedUserTokens{}, err
+	}
+
+	state = cachedUserTokens{version: user.TokenVersion, active: user.IsActive, loadedAt: now}
+	s.mu.Lock()
+	if len(s.userStates) >= maxTokenCacheEntries {
+		for key, entry := range s.userStates {
+			if now.Sub(entry.loadedAt) >= s.cacheTTL {
+				delete(s.userStates, key)
+			}
+		}
+	}
+	s.userStates[userID] = state
+	s.mu.Unlock()
+	return state, nil
+}
+
+func (s *TokenRevocationService) tokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	now := s.now()
+	s.mu.Lock()
+	state, ok := s.tokenStates[tokenID]
+	s.mu.Unlock()
+	// Revocations are permanent, so a revoked entry never needs reloading
+	if ok && (state.revoked || now.Sub(state.loadedAt) < s.cacheTTL) {
+		return state.revoked, nil
+	}
+
+	revoked, err := s.revoked.IsRevoked(ctx, tokenID)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	if len(s.tokenStates) >= maxTokenCacheEntries {
+		for key, entry := range s.tokenStates {
+			if now.Sub(entry.loadedAt) >= s.cacheTTL {
+				delete(s.tokenStates, key)
+			}
+		}
+	}
+	s.tokenStates[tokenID] = cachedTokenState{revoked: revoked, loadedAt: now}
+	s.mu.Unlock()
+	return revoked, nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mgsearch/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryUserTokenStore struct {
+	users   map[primitive.ObjectID]*models.User
+	lookups int
+}
+
+func (s *memoryUserTokenStore) FindByID(_ context.Context, id primitive.ObjectID) (*models.User, error) {
+	s.lookups++
+	user, ok := s.users[id]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (s *memoryUserTokenStore) IncrementTokenVersion(_ context.Context, id primitive.ObjectID) error {
+	user, ok := s.users[id]
+	if !ok {
+		return errors.New("user not found")
+	}
+	user.TokenVersion++
+	return nil
+}
+
+type memoryRevokedTokenStore struct {
+	revoked map[string]time.Time
+	lookups int
+}
+
+func (s *memoryRevokedTokenStore) Revoke(_ context.Context, tokenID string, _ primitive.ObjectID, expiresAt time.Time) error {
+	s.revoked[tokenID] = expiresAt
+	return nil
+}
+
+func (s *memoryRevokedTokenStore) IsRevoked(_ context.Context, tokenID string) (bool, error) {
+	s.lookups++
+	_, ok := s.revoked[tokenID]
+	return ok, nil
+}
+
+func TestTokenRevocationService(t *testing.T) {
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+	users := &memoryUserTokenStore{users: map[primitive.ObjectID]*models.User{
+		userID: {ID: userID, IsActive: true, TokenVersion: 2},
+	}}
+	revoked := &memoryRevokedTokenStore{revoked: map[string]time.Time{}}
+
+	now := time.Now()
+	service := NewTokenRevocationService(users, revoked, time.Minute)
+	service.now = func() time.Time { return now }
+
+	require.NoError(t, service.CheckToken(ctx, userID.Hex(), 2, "jti-1"))
+	assert.ErrorIs(t, service.CheckToken(ctx, userID.Hex(), 1, "jti-1"), ErrTokenRevoked)
+	// Tokens issued after a bump another instance made are accepted before the cache expires
+	require.NoError(t, service.CheckToken(ctx, userID.Hex(), 3, "jti-1"))
+	assert.ErrorIs(t, service.CheckToken(ctx, primitive.NewObjectID().Hex(), 0, ""), ErrTokenRevoked)
+	assert.ErrorIs(t, service.CheckToken(ctx, "not-an-id", 0, ""), ErrTokenRevoked)
+
+	t.Run("lookups are cached", func(t *testing.T) {
+		userLookups, tokenLookups := users.lookups, revoked.lookups
+		require.NoError(t, service.CheckToken(ctx, userID.Hex(), 2, "jti-1"))
+		assert.Equal(t, userLookups, users.lookups)
+		assert.Equal(t, tokenLookups, revoked.lookups)
+
+		now = now.Add(2 * time.Minute)
+		require.NoError(t, service.CheckToken(ctx, userID.Hex(), 2, "jti-1"))
+		assert.Equal(t, userLookups+1, users.lookups)
+		assert.Equal(t, tokenLookups+1, revoked.lookups)
+	})
+
+	t.Run("single token revocation", func(t *testing.T) {
+		require.NoError(t, service.RevokeToken(ctx, userID, "jti-1", now.Add(time.Hour)))
+		assert.ErrorIs(t, service.CheckToken(ctx, userID.Hex(), 2, "jti-1"), ErrTokenRevoked)
+		require.NoError(t, service.CheckToken(ctx, userID.Hex(), 2, "jti-2"))
+	})
+
+	t.Run("revoking all tokens bumps the version", func(t *testing.T) {
+		require.NoError(t, service.RevokeAllTokens(ctx, userID))
+		assert.ErrorIs(t, service.CheckToken(ctx, userID.Hex(), 2, "jti-2"), ErrTokenRevoked)
+		require.NoError(t, service.CheckToken(ctx, userID.Hex(), 3, "jti-3"))
+	})
+
+	t.Run("inactive users are rejected once forgotten", func(t *testing.T) {
+		users.users[userID].IsActive = false
+		require.NoError(t, service.CheckToken(ctx, userID.Hex(), 3, "jti-3"))
+
+		service.Forget(userID)
+		assert.ErrorIs(t, service.CheckToken(ctx, userID.Hex(), 3, "jti-3"), ErrTokenRevoked)
+	})
+}
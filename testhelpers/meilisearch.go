@@ -0,0 +1,274 @@
+package testhelpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+
+	"mgsearch/models"
+)
+
+// MockMeilisearch is an in-memory Meilisearch for tests. It serves the index, settings and document
+// endpoints the services package uses and applies every write immediately, so tests can inspect
+// the indexed documents right after a call returns.
+type MockMeilisearch struct {
+	Server *httptest.Server
+
+	mu      sync.Mutex
+	indexes map[string]map[string]models.Document
+	tasks   int
+}
+
+// NewMockMeilisearch starts an empty Meilisearch. Close it when done.
+func NewMockMeilisearch() *MockMeilisearch {
+	m := &MockMeilisearch{indexes: make(map[string]map[string]models.Document)}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.serve))
+	return m
+}
+
+// URL returns the address to configure as the Meilisearch URL
+func (m *MockMeilisearch) URL() string {
+	return m.Server.URL
+}
+
+func (m *MockMeilisearch) Close() {
+	m.Server.Close()
+}
+
+// AddDocuments stores documents in the index as if they had been indexed earlier
+func (m *MockMeilisearch) AddDocuments(uid string, documents ...models.Document) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addDocuments(uid, documents, false)
+}
+
+// Document returns a copy of the document stored under id, or nil when there is none
+func (m *MockMeilisearch) Document(uid, id string) models.Document {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	document, ok := m.indexes[uid][id]
+	if !ok {
+		return nil
+	}
+	copied := make(models.Document, len(document))
+	for key, value := range document {
+		copied[key] = value
+	}
+	return copied
+}
+
+// HasIndex reports whether the index exists
+func (m *MockMeilisearch) HasIndex(uid string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.indexes[uid]
+	return ok
+}
+
+// DocumentIDs returns the IDs of the documents stored in the index
+func (m *MockMeilisearch) DocumentIDs(uid string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]string, 0, len(m.indexes[uid]))
+	for id := range m.indexes[uid] {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (m *MockMeilisearch) serve(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 1 && parts[0] == "indexes" && r.Method == http.MethodPost {
+		var config struct {
+			UID string `json:"uid"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&config)
+		m.index(config.UID)
+		m.writeTask(w, config.UID)
+		return
+	}
+	if len(parts) < 2 || parts[0] != "indexes" {
+		writeMockJSON(w, http.StatusNotFound, map[string]string{"message": "not found", "code": "not_found"})
+		return
+	}
+
+	uid := parts[1]
+	route := strings.Join(parts[2:], "/")
+	switch {
+	case route == "" && r.Method == http.MethodGet:
+		if _, ok := m.indexes[uid]; !ok {
+			m.writeIndexNotFound(w, uid)
+			return
+		}
+		writeMockJSON(w, http.StatusOK, map[string]interface{}{"uid": uid, "primaryKey": "id"})
+	case route == "" && r.Method == http.MethodDelete:
+		delete(m.indexes, uid)
+		m.writeTask(w, uid)
+	case strings.HasPrefix(route, "settings"):
+		if r.Method == http.MethodGet {
+			if _, ok := m.indexes[uid]; !ok {
+				m.writeIndexNotFound(w, uid)
+				return
+			}
+			if route == "settings/searchable-attributes" {
+				writeMockJSON(w, http.StatusOK, []string{"*"})
+				return
+			}
+			writeMockJSON(w, http.StatusOK, []string{})
+			return
+		}
+		// Updating the settings of a missing index creates it
+		m.index(uid)
+		m.writeTask(w, uid)
+	case route == "stats" && r.Method == http.MethodGet:
+		if _, ok := m.indexes[uid]; !ok {
+			m.writeIndexNotFound(w, uid)
+			return
+		}
+		writeMockJSON(w, http.StatusOK, map[string]interface{}{"numberOfDocuments": len(m.indexes[uid])})
+	case route == "documents" && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+		documents, err := decodeMockDocuments(r)
+		if err != nil {
+			writeMockJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error(), "code": "bad_request"})
+			return
+		}
+		// POST replaces documents, PUT merges the given fields into them
+		m.addDocuments(uid, documents, r.Method == http.MethodPut)
+		m.writeTask(w, uid)
+	case route == "documents/fetch" && r.Method == http.MethodPost:
+		m.fetchDocuments(w, r, uid)
+	case route == "documents/delete-batch" && r.Method == http.MethodPost:
+		var ids []interface{}
+		_ = json.NewDecoder(r.Body).Decode(&ids)
+		for _, id := range ids {
+			delete(m.index(uid), fmt.Sprintf("%v", id))
+		}
+		m.writeTask(w, uid)
+	case strings.HasPrefix(route, "documents/") && r.Method == http.MethodDelete:
+		delete(m.index(uid), strings.TrimPrefix(route, "documents/"))
+		m.writeTask(w, uid)
+	case strings.HasPrefix(route, "documents/") && r.Method == http.MethodGet:
+		document, ok := m.indexes[uid][strings.TrimPrefix(route, "documents/")]
+		if !ok {
+			writeMockJSON(w, http.StatusNotFound, map[string]string{"message": "Document not found.", "code": "document_not_found", "type": "invalid_request"})
+			return
+		}
+		writeMockJSON(w, http.StatusOK, document)
+	default:
+		writeMockJSON(w, http.StatusNotFound, map[string]string{"message": "not found", "code": "not_found"})
+	}
+}
+
+func (m *MockMeilisearch) fetchDocuments(w http.ResponseWriter, r *http.Request, uid string) {
+	var query struct {
+		IDs    []string `json:"ids"`
+		Offset int      `json:"offset"`
+		Limit  int      `json:"limit"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&query)
+
+	index, ok := m.indexes[uid]
+	if !ok {
+		m.writeIndexNotFound(w, uid)
+		return
+	}
+
+	results := []models.Document{}
+	if query.IDs != nil {
+		for _, id := range query.IDs {
+			if document, ok := index[id]; ok {
+				results = append(results, document)
+			}
+		}
+	} else {
+		// Keep a stable order so documents can be paged through
+		ids := make([]string, 0, len(index))
+		for id := range index {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			results = append(results, index[id])
+		}
+	}
+	total := len(results)
+
+	if query.Offset > len(results) {
+		query.Offset = len(results)
+	}
+	results = results[query.Offset:]
+	if query.Limit > 0 && query.Limit < len(results) {
+		results = results[:query.Limit]
+	}
+
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{
+		"results": results,
+		"offset":  query.Offset,
+		"limit":   query.Limit,
+		"total":   total,
+	})
+}
+
+func (m *MockMeilisearch) addDocuments(uid string, documents []models.Document, merge bool) {
+	index := m.index(uid)
+	for _, document := range documents {
+		id := fmt.Sprintf("%v", document["id"])
+		stored, ok := index[id]
+		if !merge || !ok {
+			stored = models.Document{}
+		}
+		for key, value := range document {
+			stored[key] = value
+		}
+		index[id] = stored
+	}
+}
+
+func (m *MockMeilisearch) index(uid string) map[string]models.Document {
+	index, ok := m.indexes[uid]
+	if !ok {
+		index = make(map[string]models.Document)
+		m.indexes[uid] = index
+	}
+	return index
+}
+
+func (m *MockMeilisearch) writeTask(w http.ResponseWriter, uid string) {
+	m.tasks++
+	writeMockJSON(w, http.StatusAccepted, map[string]interface{}{
+		"taskUid":  m.tasks,
+		"indexUid": uid,
+		"status":   "enqueued",
+	})
+}
+
+func (m *MockMeilisearch) writeIndexNotFound(w http.ResponseWriter, uid string) {
+	writeMockJSON(w, http.StatusNotFound, map[string]string{
+		"message": fmt.Sprintf("Index `%s` not found.", uid),
+		"code":    "index_not_found",
+		"type":    "invalid_request",
+	})
+}
+
+// decodeMockDocuments reads a JSON array of documents, keeping numbers exact so large Shopify IDs
+// match the IDs the services package formats.
+func decodeMockDocuments(r *http.Request) ([]models.Document, error) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+
+	var documents []models.Document
+	if err := decoder.Decode(&documents); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
@@ -0,0 +1,231 @@
+package testhelpers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"mgsearch/pkg/auth"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// MockOIDCProvider is a local OpenID Connect provider for tests. It serves the discovery document,
+// the JWKS and the token endpoint; Authorize stands in for the user signing in at the provider.
+type MockOIDCProvider struct {
+	Server   *httptest.Server
+	ClientID string
+
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	keyID  string
+	keyNum int
+	grants map[string]mockOIDCGrant
+}
+
+// MockOIDCIdentity is the user signing in at the mock provider. Claims are added to the ID token,
+// replacing the standard claims of the same name.
+type MockOIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Claims        map[string]interface{}
+}
+
+type mockOIDCGrant struct {
+	identity      MockOIDCIdentity
+	nonce         string
+	redirectURI   string
+	codeChallenge string
+}
+
+// NewMockOIDCProvider starts a provider that issues ID tokens to clientID. Close it when done.
+func NewMockOIDCProvider(clientID string) *MockOIDCProvider {
+	m := &MockOIDCProvider{
+		ClientID: clientID,
+		grants:   make(map[string]mockOIDCGrant),
+	}
+	m.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.serveDiscovery)
+	mux.HandleFunc("/jwks", m.serveJWKS)
+	mux.HandleFunc("/token", m.serveToken)
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+// Issuer returns the issuer identifier of the provider
+func (m *MockOIDCProvider) Issuer() string {
+	return m.Server.URL
+}
+
+func (m *MockOIDCProvider) Close() {
+	m.Server.Close()
+}
+
+// RotateKey replaces the signing key with a new one under a new key ID
+func (m *MockOIDCProvider) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprintf("failed to generate oidc signing key: %v", err))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keyNum++
+	m.key = key
+	m.keyID = fmt.Sprintf("key-%d", m.keyNum)
+}
+
+// Authorize signs identity in at the authorization URL the application redirected to, and returns
+// the code and state the provider redirects back with
+func (m *MockOIDCProvider) Authorize(authorizationURL string, identity MockOIDCIdentity) (code, state string, err error) {
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := parsed.Query()
+	switch {
+	case query.Get("response_type") != "code":
+		return "", "", errors.New("response_type must be code")
+	case query.Get("client_id") != m.ClientID:
+		return "", "", errors.New("unknown client_id")
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		return "", "", errors.New("an S256 code challenge is required")
+	}
+
+	code, _, err = auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.grants[code] = mockOIDCGrant{
+		identity:      identity,
+		nonce:         query.Get("nonce"),
+		redirectURI:   query.Get("redirect_uri"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	return code, query.Get("state"), nil
+}
+
+// IDTokenClaims returns the claims of an ID token for identity
+func (m *MockOIDCProvider) IDTokenClaims(identity MockOIDCIdentity, nonce string) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            m.Issuer(),
+		"sub":            identity.Subject,
+		"aud":            m.ClientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          identity.Email,
+		"email_verified": identity.EmailVerified,
+		"given_name":     identity.GivenName,
+		"family_name":    identity.FamilyName,
+	}
+	for name, value := range identity.Claims {
+		claims[name] = value
+	}
+	return claims
+}
+
+// SignIDToken signs claims with the current key of the provider
+func (m *MockOIDCProvider) SignIDToken(claims jwt.MapClaims) string {
+	m.mu.Lock()
+	key, keyID := m.key, m.keyID
+	m.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	signed, err := token.SignedString(key)
+	if err != nil {
+		panic(fmt.Sprintf("failed to sign id token: %v", err))
+	}
+	return signed
+}
+
+func (m *MockOIDCProvider) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                m.Issuer(),
+		"authorization_endpoint":                m.Issuer() + "/authorize",
+		"token_endpoint":                        m.Issuer() + "/token",
+		"jwks_uri":                              m.Issuer() + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (m *MockOIDCProvider) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	key, keyID := m.key.PublicKey, m.keyID
+	m.mu.Unlock()
+
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+}
+
+func (m *MockOIDCProvider) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeMockJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if r.PostForm.Get("client_id") != m.ClientID {
+		writeMockJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	// Codes work once
+	m.mu.Lock()
+	grant, ok := m.grants[r.PostForm.Get("code")]
+	delete(m.grants, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	switch {
+	case !ok:
+		writeMockJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "unknown code"})
+		return
+	case r.PostForm.Get("redirect_uri") != grant.redirectURI:
+		writeMockJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "redirect_uri mismatch"})
+		return
+	case auth.PKCEChallenge(r.PostForm.Get("code_verifier")) != grant.codeChallenge:
+		writeMockJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "code_verifier mismatch"})
+		return
+	}
+
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     m.SignIDToken(m.IDTokenClaims(grant.identity, grant.nonce)),
+	})
+}
+
+func writeMockJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,34 @@
+package testhelpers
+
+import (
+	"fmt"
+	"time"
+
+	"mgsearch/config"
+	"mgsearch/pkg/auth"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ShopifySessionToken returns an App Bridge session token for shop, signed with the app
+// credentials of cfg
+func ShopifySessionToken(cfg *config.Config, shop string) string {
+	now := time.Now()
+	claims := auth.ShopifySessionClaims{
+		Dest: "https://" + shop,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://" + shop + "/admin",
+			Subject:   "42",
+			Audience:  jwt.ClaimStrings{cfg.ShopifyAPIKey},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			NotBefore: jwt.NewNumericDate(now.Add(-time.Second)),
+			IssuedAt:  jwt.NewNumericDate(now.Add(-time.Second)),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(cfg.ShopifyAPISecret))
+	if err != nil {
+		panic(fmt.Sprintf("failed to sign session token: %v", err))
+	}
+	return token
+}
@@ -8,6 +8,7 @@ import (
 
 	"mgsearch/config"
 	"mgsearch/pkg/database"
+	"mgsearch/pkg/security"
 	"mgsearch/repositories"
 
 	"go.mongodb.org/mongo-driver/mongo"
@@ -30,9 +31,40 @@ func TestConfig() *config.Config {
 		EncryptionKey:       "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
 		WebhookSharedSecret: "test-webhook-secret",
 		SessionAPIKey:       "test-session-api-key",
+		KeyRotationOverlap:  24 * time.Hour,
+		AccessTokenTTL:      15 * time.Minute,
+		RefreshTokenTTL:     24 * time.Hour,
+		TokenCacheTTL:       30 * time.Second,
+		PasswordResetTTL:    time.Hour,
+		PasswordResetURL:    "https://dashboard.example.com/reset-password",
+		EmailVerifyTTL:      24 * time.Hour,
+		EmailVerifyURL:      "https://dashboard.example.com/verify-email",
+		InviteTTL:           7 * 24 * time.Hour,
+		InviteURL:           "https://dashboard.example.com/accept-invite",
+		LoginMaxFailures:    10,
+		LoginMaxIPFailures:  100,
+		LoginFailureWindow:  15 * time.Minute,
+		LoginLockout:        15 * time.Minute,
+		LoginUnlockURL:      "https://dashboard.example.com/unlock-account",
+		MFAIssuer:           "MGSearch",
+		MFAChallengeTTL:     5 * time.Minute,
+		OIDCClientID:        "mgsearch-dashboard",
+		OIDCRedirectURL:     "https://dashboard.example.com/sso/callback",
+		OIDCScopes:          "openid email profile",
+		OIDCProvisionUsers:  true,
+		OIDCStateTTL:        10 * time.Minute,
 	}
 }
 
+// TestKeyProvider returns the environment key provider for the test configuration
+func TestKeyProvider(cfg *config.Config) security.KeyProvider {
+	keys, err := security.NewEnvKeyProvider(cfg)
+	if err != nil {
+		panic(fmt.Sprintf("invalid test encryption key: %v", err))
+	}
+	return keys
+}
+
 // SetupTestDatabase creates a test MongoDB database and returns client, database, and cleanup function
 func SetupTestDatabase(ctx context.Context, cfg *config.Config) (*mongo.Client, *mongo.Database, func(), error) {
 	client, err := database.NewClient(ctx, cfg)
@@ -96,7 +128,7 @@ func getEnv(key, defaultValue string) string {
 
 // CleanupTestDatabase drops all collections in the test database
 func CleanupTestDatabase(ctx context.Context, db *mongo.Database) error {
-	collections := []string{"stores", "sessions"}
+	collections := []string{"stores", "sessions", "webhook_events", "document_versions", "shopify_collections", "inventory_items", "inventory_levels", "shopify_locations", "store_usage", "data_keys", "refresh_tokens", "revoked_tokens", "password_reset_tokens", "email_verification_tokens", "client_invites", "login_attempts", "security_events", "mfa_challenges", "sso_logins"}
 	for _, collName := range collections {
 		if err := db.Collection(collName).Drop(ctx); err != nil {
 			// Ignore namespace not found errors
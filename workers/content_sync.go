@@ -0,0 +1,175 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mgsearch/models"
+	"mgsearch/pkg/security"
+	"mgsearch/repositories"
+	"mgsearch/services"
+)
+
+// ContentSyncer copies a store's collections, pages and blog articles into their search indexes.
+// Shopify sends no webhooks for pages and articles, so a full sync is the only way to pick up
+// their changes; collections are additionally kept current by the webhook processor.
+type ContentSyncer struct {
+	versions *repositories.DocumentVersionRepository
+	shopify  *services.ShopifyService
+	meili    *services.MeilisearchRegistry
+	limits   *services.PlanLimits
+	keys     security.KeyProvider
+}
+
+func NewContentSyncer(keys security.KeyProvider, versions *repositories.DocumentVersionRepository, shopify *services.ShopifyService, meili *services.MeilisearchRegistry, limits *services.PlanLimits) (*ContentSyncer, error) {
+	if keys == nil {
+		return nil, errors.New("key provider is required")
+	}
+
+	return &ContentSyncer{versions: versions, shopify: shopify, meili: meili, limits: limits, keys: keys}, nil
+}
+
+// Sync replaces the contents of the store's collection, page and article indexes with the
+// published resources currently in Shopify. It returns the number of documents indexed per type,
+// or services.ErrDocumentLimitReached without touching the indexes when the content does not fit
+// the store's plan.
+func (s *ContentSyncer) Sync(ctx context.Context, store *models.Store) (map[string]int, error) {
+	if store.IndexUID() == "" {
+		return nil, fmt.Errorf("store index not configured")
+	}
+
+	accessToken, err := decryptAccessToken(ctx, s.keys, store)
+	if err != nil {
+		return nil, err
+	}
+	meili, err := s.meili.ForStore(store)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collection webhooks keep being applied while the sync runs; what they change from here on is
+	// newer than the listing
+	started := time.Now().UTC()
+
+	documents := map[string][]models.Document{}
+
+	collections, err := s.shopify.ListCollections(ctx, store.ShopDomain, accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch collections: %w", err)
+	}
+	for i := range collections {
+		if !collections[i].IsPublished() {
+			continue
+		}
+		if err := appendContentDocument(documents, services.NewCollectionDocument(store, &collections[i])); err != nil {
+			return nil, err
+		}
+	}
+
+	pages, err := s.shopify.ListPages(ctx, store.ShopDomain, accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch pages: %w", err)
+	}
+	for i := range pages {
+		if pages[i].PublishedAt == nil || *pages[i].PublishedAt == "" {
+			continue
+		}
+		if err := appendContentDocument(documents, services.NewPageDocument(store, &pages[i])); err != nil {
+			return nil, err
+		}
+	}
+
+	blogs, err := s.shopify.ListBlogs(ctx, store.ShopDomain, accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch blogs: %w", err)
+	}
+	for i := range blogs {
+		articles, err := s.shopify.ListArticles(ctx, store.ShopDomain, accessToken, blogs[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch articles of blog %d: %w", blogs[i].ID, err)
+		}
+		for j := range articles {
+			if articles[j].PublishedAt == nil || *articles[j].PublishedAt == "" {
+				continue
+			}
+			if err := appendContentDocument(documents, services.NewArticleDocument(store, &blogs[i], &articles[j])); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Collections changed by webhooks during the sync are left as the webhooks indexed them, so the
+	// listing can neither bring back an older version nor delete a collection created meanwhile
+	changed, err := s.versions.RecordedSince(ctx, store.ID.Hex(), "collection:", started)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load collection versions: %w", err)
+	}
+	keep := map[string][]string{models.DocumentTypeCollection: changed}
+	documents[models.DocumentTypeCollection] = withoutDocuments(documents[models.DocumentTypeCollection], changed)
+
+	documentCounts := map[string]int{}
+	for _, documentType := range models.ContentDocumentTypes {
+		documentCounts[store.ContentIndexUID(documentType)] = len(documents[documentType]) + len(keep[documentType])
+	}
+	if err := s.limits.CheckReplace(store, meili, documentCounts); err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for _, documentType := range models.ContentDocumentTypes {
+		uid := store.ContentIndexUID(documentType)
+		if err := meili.EnsureIndex(uid); err != nil {
+			return nil, fmt.Errorf("failed to create %s index: %w", documentType, err)
+		}
+		if err := meili.ConfigureContentIndex(uid); err != nil {
+			return nil, err
+		}
+		if err := meili.ReplaceDocuments(uid, documents[documentType], keep[documentType]); err != nil {
+			return nil, fmt.Errorf("failed to index %ss: %w", documentType, err)
+		}
+		counts[documentType] = len(documents[documentType])
+	}
+	return counts, nil
+}
+
+func appendContentDocument(documents map[string][]models.Document, doc *models.ShopifyContentDocument) error {
+	document, err := doc.ToDocument()
+	if err != nil {
+		return err
+	}
+	documents[doc.DocumentType] = append(documents[doc.DocumentType], document)
+	return nil
+}
+
+// withoutDocuments returns the documents whose ID is not listed in ids.
+func withoutDocuments(documents []models.Document, ids []string) []models.Document {
+	if len(ids) == 0 {
+		return documents
+	}
+	skip := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		skip[id] = true
+	}
+
+	kept := make([]models.Document, 0, len(documents))
+	for _, document := range documents {
+		if !skip[fmt.Sprintf("%v", document["id"])] {
+			kept = append(kept, document)
+		}
+	}
+	return kept
+}
+
+// decryptAccessToken returns the store's Shopify Admin API access token.
+func decryptAccessToken(ctx context.Context, keys security.KeyProvider, store *models.Store) (string, error) {
+	if len(store.EncryptedAccessToken) == 0 {
+		return "", fmt.Errorf("store has no access token")
+	}
+	token, err := keys.Decrypt(ctx, store.ShopDomain, store.EncryptedAccessToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt access token: %w", err)
+	}
+	return string(token), nil
+}
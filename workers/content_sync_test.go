@@ -0,0 +1,78 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mgsearch/models"
+	"mgsearch/services"
+	"mgsearch/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentSyncer_KeepsCollectionsChangedDuringSync(t *testing.T) {
+	test := setupProcessorTest(t)
+	ctx := context.Background()
+	storeID := test.store.ID.Hex()
+	collectionUID := test.store.ContentIndexUID(models.DocumentTypeCollection)
+
+	test.meili.AddDocuments(collectionUID,
+		models.Document{"id": 301, "title": "Summer"},
+		models.Document{"id": 399, "title": "Removed"},
+	)
+
+	// Webhooks rename collection 301 and create 302 while Shopify is being listed
+	webhook := func(id int64, title string) {
+		token, err := test.versions.Advance(ctx, storeID, fmt.Sprintf("collection:%d", id), time.Now(), false, time.Minute)
+		require.NoError(t, err)
+		test.meili.AddDocuments(collectionUID, models.Document{"id": id, "title": title})
+		require.NoError(t, test.versions.Release(ctx, storeID, fmt.Sprintf("collection:%d", id), token))
+	}
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := map[string]interface{}{}
+		switch r.URL.Path {
+		case "/admin/api/2024-10/custom_collections.json":
+			webhook(301, "Summer Sale")
+			webhook(302, "Autumn")
+			response["custom_collections"] = []map[string]interface{}{
+				{"id": 301, "title": "Summer", "handle": "summer", "published_at": "2024-01-01T00:00:00Z"},
+			}
+		case "/admin/api/2024-10/smart_collections.json":
+			response["smart_collections"] = []interface{}{}
+		case "/admin/api/2024-10/pages.json":
+			response["pages"] = []interface{}{}
+		case "/admin/api/2024-10/blogs.json":
+			response["blogs"] = []interface{}{}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(admin.Close)
+
+	cfg := testhelpers.TestConfig()
+	cfg.MeilisearchURL = test.meili.URL()
+	shopify := services.NewShopifyService(cfg)
+	shopify.SetBaseURL(admin.URL)
+	keys := testhelpers.TestKeyProvider(cfg)
+	meiliRegistry, err := services.NewMeilisearchRegistry(cfg, keys, services.NewMeilisearchService(cfg))
+	require.NoError(t, err)
+
+	syncer, err := NewContentSyncer(keys, test.versions, shopify, meiliRegistry, test.processor.limits)
+	require.NoError(t, err)
+	_, err = syncer.Sync(ctx, test.store)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Summer Sale", test.meili.Document(collectionUID, "301")["title"], "the listing must not overwrite a newer webhook")
+	assert.NotNil(t, test.meili.Document(collectionUID, "302"), "a collection created during the sync must survive")
+	assert.Nil(t, test.meili.Document(collectionUID, "399"))
+}
@@ -0,0 +1,111 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"mgsearch/models"
+	"mgsearch/pkg/security"
+	"mgsearch/services"
+)
+
+// localizationBatchSize bounds the number of products read and written per Meilisearch call.
+const localizationBatchSize = 250
+
+// LocalizationSyncer applies a store's metafield and translation settings to the products already
+// in its index. Webhooks only localize a product when it changes, so after the settings change the
+// syncer fills new locale indexes and updates or clears the localized fields of every product.
+type LocalizationSyncer struct {
+	shopify *services.ShopifyService
+	meili   *services.MeilisearchRegistry
+	keys    security.KeyProvider
+}
+
+func NewLocalizationSyncer(keys security.KeyProvider, shopify *services.ShopifyService, meili *services.MeilisearchRegistry) (*LocalizationSyncer, error) {
+	if keys == nil {
+		return nil, errors.New("key provider is required")
+	}
+
+	return &LocalizationSyncer{shopify: shopify, meili: meili, keys: keys}, nil
+}
+
+// Sync localizes every product of the store's primary index as configured in store.Indexing: the
+// metafields and translations fields of the primary index are replaced, and each locale index
+// receives the translated products. It returns the number of products synced.
+func (s *LocalizationSyncer) Sync(ctx context.Context, store *models.Store) (int, error) {
+	uid := store.IndexUID()
+	if uid == "" {
+		return 0, fmt.Errorf("store index not configured")
+	}
+
+	meili, err := s.meili.ForStore(store)
+	if err != nil {
+		return 0, err
+	}
+	settings := store.Indexing
+	localeUIDs := store.LocaleIndexUIDs()
+
+	var accessToken string
+	if settings.RequiresLocalization() {
+		if accessToken, err = decryptAccessToken(ctx, s.keys, store); err != nil {
+			return 0, err
+		}
+	}
+
+	synced := 0
+	for offset := int64(0); ; offset += localizationBatchSize {
+		products, err := meili.ProductDocuments(uid, offset, localizationBatchSize)
+		if err != nil {
+			return synced, err
+		}
+
+		updates := make([]models.Document, 0, len(products))
+		localized := map[string][]models.Document{}
+		for i := range products {
+			doc := &products[i]
+			doc.Metafields, doc.Translations = nil, nil
+
+			translations := map[string][]models.ShopifyTranslation{}
+			if settings.RequiresLocalization() {
+				localization, err := s.shopify.GetProductLocalization(ctx, store.ShopDomain, accessToken, doc.ID, settings.MetafieldNamespaces, settings.Locales)
+				if err != nil {
+					return synced, fmt.Errorf("failed to fetch localization of product %d: %w", doc.ID, err)
+				}
+				services.ApplyMetafields(doc, localization.Metafields)
+				translations = localization.Translations
+				if len(localeUIDs) == 0 {
+					services.ApplyTranslations(doc, translations)
+				}
+			}
+
+			// Only the localized fields are written, so webhook updates of the rest of the product survive
+			updates = append(updates, models.Document{
+				"id":           doc.ID,
+				"metafields":   doc.Metafields,
+				"translations": doc.Translations,
+			})
+			for locale, localeUID := range localeUIDs {
+				document, err := services.LocalizedProductDocument(store, doc, locale, translations[locale]).ToDocument()
+				if err != nil {
+					return synced, err
+				}
+				localized[localeUID] = append(localized[localeUID], document)
+			}
+		}
+
+		if err := meili.UpdateDocuments(uid, updates); err != nil {
+			return synced, err
+		}
+		for localeUID, documents := range localized {
+			if err := meili.IndexDocuments(localeUID, documents); err != nil {
+				return synced, fmt.Errorf("failed to index %s: %w", localeUID, err)
+			}
+		}
+
+		synced += len(products)
+		if int64(len(products)) < localizationBatchSize {
+			return synced, nil
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"mgsearch/models"
+	"mgsearch/services"
+	"mgsearch/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLocalizationSyncer_Sync(t *testing.T) {
+	ctx := context.Background()
+	cfg := testhelpers.TestConfig()
+
+	meili := testhelpers.NewMockMeilisearch()
+	t.Cleanup(meili.Close)
+	cfg.MeilisearchURL = meili.URL()
+
+	// Every product has the same metafield and French title
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+			"product": map[string]interface{}{
+				"metafields": map[string]interface{}{"nodes": []map[string]string{
+					{"namespace": "custom", "key": "material", "value": "cotton", "type": "single_line_text_field"},
+				}},
+				"translations0": []map[string]string{{"key": "title", "value": "T-shirt"}},
+			},
+		}})
+	}))
+	t.Cleanup(admin.Close)
+	shopify := services.NewShopifyService(cfg)
+	shopify.SetBaseURL(admin.URL)
+
+	keys := testhelpers.TestKeyProvider(cfg)
+	accessToken, err := keys.Encrypt(ctx, "sync-test.myshopify.com", []byte("shpat_sync_test"))
+	require.NoError(t, err)
+	store := &models.Store{
+		ID:                   primitive.NewObjectID(),
+		ShopDomain:           "sync-test.myshopify.com",
+		EncryptedAccessToken: accessToken,
+		MeilisearchIndexUID:  "sync-test_all_products",
+		Indexing: models.StoreIndexing{
+			MetafieldNamespaces: []string{"custom"},
+			Locales:             []string{"fr"},
+			LocaleMode:          models.LocaleModeIndexes,
+		},
+	}
+	uid := store.IndexUID()
+	localeUID := store.LocaleIndexUID("fr")
+	meili.AddDocuments(uid,
+		models.Document{"id": 101, "title": "Tee", "handle": "tee", "translations": map[string]interface{}{"fr": map[string]interface{}{"title": "Vieux"}}},
+		models.Document{"id": 202, "title": "Cap", "handle": "cap"},
+	)
+
+	meiliRegistry, err := services.NewMeilisearchRegistry(cfg, keys, services.NewMeilisearchService(cfg))
+	require.NoError(t, err)
+	syncer, err := NewLocalizationSyncer(keys, shopify, meiliRegistry)
+	require.NoError(t, err)
+
+	synced, err := syncer.Sync(ctx, store)
+	require.NoError(t, err)
+	assert.Equal(t, 2, synced)
+
+	document := meili.Document(uid, "101")
+	require.NotNil(t, document)
+	assert.Equal(t, "Tee", document["title"])
+	assert.Equal(t, map[string]interface{}{"custom": map[string]interface{}{"material": "cotton"}}, document["metafields"])
+	assert.Nil(t, document["translations"], "translations live in the locale index")
+
+	assert.ElementsMatch(t, []string{"101", "202"}, meili.DocumentIDs(localeUID))
+	localized := meili.Document(localeUID, "202")
+	require.NotNil(t, localized)
+	assert.Equal(t, "T-shirt", localized["title"])
+	assert.Equal(t, "fr", localized["locale"])
+
+	// Moving translations back into fields puts them on the primary documents
+	store.Indexing.LocaleMode = models.LocaleModeFields
+	_, err = syncer.Sync(ctx, store)
+	require.NoError(t, err)
+	translations, _ := meili.Document(uid, "202")["translations"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"title": "T-shirt"}, translations["fr"])
+}
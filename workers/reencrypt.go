@@ -0,0 +1,192 @@
+package workers
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"mgsearch/pkg/security"
+	"mgsearch/repositories"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// reencryptBatchSize is the number of stores or sessions loaded per query while re-encrypting.
+const reencryptBatchSize = 100
+
+// maxReencryptErrors bounds the per-secret errors reported by a re-encryption run.
+const maxReencryptErrors = 50
+
+// Reencryptor migrates stored secrets to the key provider's current key: store access tokens, store
+// Meilisearch API keys and session access tokens. Secrets already sealed with the current key are
+// left untouched, so runs can be repeated until nothing is left to migrate.
+type Reencryptor struct {
+	stores   *repositories.StoreRepository
+	sessions *repositories.SessionRepository
+	keys     security.KeyProvider
+}
+
+// ReencryptResult summarizes a re-encryption run.
+type ReencryptResult struct {
+	DryRun            bool     `json:"dry_run"`
+	DataKeysRewrapped int      `json:"data_keys_rewrapped"` // Envelope encryption only
+	StoresScanned     int      `json:"stores_scanned"`
+	SessionsScanned   int      `json:"sessions_scanned"`
+	SecretsCurrent    int      `json:"secrets_current"`
+	SecretsMigrated   int      `json:"secrets_migrated"`
+	SecretsSkipped    int      `json:"secrets_skipped"` // Changed by another writer during the run
+	SecretsFailed     int      `json:"secrets_failed"`
+	Errors            []string `json:"errors,omitempty"`
+	ErrorsTruncated   bool     `json:"errors_truncated,omitempty"`
+}
+
+func NewReencryptor(keys security.KeyProvider, stores *repositories.StoreRepository, sessions *repositories.SessionRepository) (*Reencryptor, error) {
+	if keys == nil {
+		return nil, errors.New("key provider is required")
+	}
+
+	return &Reencryptor{stores: stores, sessions: sessions, keys: keys}, nil
+}
+
+// Run re-encrypts every secret not yet sealed with the current key. With envelope encryption, data
+// keys wrapped by an older master key are re-wrapped first. With dryRun set, nothing is written and
+// secrets are only counted. Secrets that fail to decrypt are reported and skipped rather than
+// aborting the run.
+func (r *Reencryptor) Run(ctx context.Context, dryRun bool) (*ReencryptResult, error) {
+	result := &ReencryptResult{DryRun: dryRun}
+
+	if rewrapper, ok := r.keys.(security.DataKeyRewrapper); ok && !dryRun {
+		rewrapped, err := rewrapper.RewrapDataKeys(ctx)
+		result.DataKeysRewrapped = rewrapped
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if err := r.reencryptStores(ctx, result); err != nil {
+		return result, err
+	}
+	if err := r.reencryptSessions(ctx, result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func (r *Reencryptor) reencryptStores(ctx context.Context, result *ReencryptResult) error {
+	afterID := primitive.NilObjectID
+	for {
+		stores, err := r.stores.ListBatch(ctx, afterID, reencryptBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list stores: %w", err)
+		}
+		if len(stores) == 0 {
+			return nil
+		}
+
+		for _, store := range stores {
+			result.StoresScanned++
+			secrets := map[string][]byte{
+				"encrypted_access_token": store.EncryptedAccessToken,
+				"meilisearch_api_key":    store.MeilisearchAPIKey,
+			}
+			for field, ciphertext := range secrets {
+				if len(ciphertext) == 0 {
+					continue
+				}
+				label := fmt.Sprintf("store %s %s", store.ShopDomain, field)
+				replacement, ok := r.migrate(ctx, store.ShopDomain, ciphertext, result, label)
+				if !ok || result.DryRun {
+					continue
+				}
+				replaced, err := r.stores.ReplaceEncryptedSecret(ctx, store.ID, field, ciphertext, replacement)
+				r.record(result, replaced, err, label)
+			}
+		}
+		afterID = stores[len(stores)-1].ID
+	}
+}
+
+func (r *Reencryptor) reencryptSessions(ctx context.Context, result *ReencryptResult) error {
+	afterID := ""
+	for {
+		sessions, err := r.sessions.ListBatch(ctx, afterID, reencryptBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(sessions) == 0 {
+			return nil
+		}
+
+		for _, session := range sessions {
+			result.SessionsScanned++
+			if session.AccessToken == "" {
+				continue
+			}
+			label := fmt.Sprintf("session %s access_token", session.ID)
+
+			// Session tokens are stored hex encoded; tokens written before encryption are plaintext
+			var replacement []byte
+			if ciphertext, err := hex.DecodeString(session.AccessToken); err == nil {
+				var ok bool
+				if replacement, ok = r.migrate(ctx, session.Shop, ciphertext, result, label); !ok || result.DryRun {
+					continue
+				}
+			} else if result.DryRun {
+				result.SecretsMigrated++
+				continue
+			} else if replacement, err = r.keys.Encrypt(ctx, session.Shop, []byte(session.AccessToken)); err != nil {
+				r.fail(result, label, err)
+				continue
+			}
+
+			replaced, err := r.sessions.ReplaceAccessToken(ctx, session.ID, session.AccessToken, hex.EncodeToString(replacement))
+			r.record(result, replaced, err, label)
+		}
+		afterID = sessions[len(sessions)-1].ID
+	}
+}
+
+// migrate re-seals ciphertext with the current key. It returns false when the secret is already
+// current or cannot be decrypted; in dry runs it only counts the secret as migrated.
+func (r *Reencryptor) migrate(ctx context.Context, scope string, ciphertext []byte, result *ReencryptResult, label string) ([]byte, bool) {
+	if r.keys.IsCurrent(ctx, scope, ciphertext) {
+		result.SecretsCurrent++
+		return nil, false
+	}
+	plaintext, err := r.keys.Decrypt(ctx, scope, ciphertext)
+	if err != nil {
+		r.fail(result, label, err)
+		return nil, false
+	}
+	if result.DryRun {
+		result.SecretsMigrated++
+		return nil, true
+	}
+	replacement, err := r.keys.Encrypt(ctx, scope, plaintext)
+	if err != nil {
+		r.fail(result, label, err)
+		return nil, false
+	}
+	return replacement, true
+}
+
+func (r *Reencryptor) record(result *ReencryptResult, replaced bool, err error, label string) {
+	switch {
+	case err != nil:
+		r.fail(result, label, err)
+	case replaced:
+		result.SecretsMigrated++
+	default:
+		result.SecretsSkipped++
+	}
+}
+
+func (r *Reencryptor) fail(result *ReencryptResult, label string, err error) {
+	result.SecretsFailed++
+	if len(result.Errors) >= maxReencryptErrors {
+		result.ErrorsTruncated = true
+		return
+	}
+	result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", label, err))
+}
@@ -0,0 +1,807 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"mgsearch/config"
+	"mgsearch/models"
+	"mgsearch/pkg/security"
+	"mgsearch/repositories"
+	"mgsearch/services"
+)
+
+// ErrStaleWebhook signals that a delivery is older than the version already indexed.
+var ErrStaleWebhook = errors.New("stale webhook payload")
+
+// ErrDocumentBusy signals that another worker is applying a change to the same document.
+var ErrDocumentBusy = errors.New("document is being processed by another worker")
+
+const (
+	defaultPollInterval = 2 * time.Second
+	defaultLease        = 2 * time.Minute
+	defaultMaxAttempts  = 5
+	baseRetryDelay      = 10 * time.Second
+)
+
+// supportedTopics lists the Shopify webhook topics the processor knows how to apply.
+var supportedTopics = map[string]bool{
+	"products/create":          true,
+	"products/update":          true,
+	"products/delete":          true,
+	"product_listings/add":     true,
+	"product_listings/update":  true,
+	"product_listings/remove":  true,
+	"collections/create":       true,
+	"collections/update":       true,
+	"collections/delete":       true,
+	"inventory_levels/update":  true,
+	"locations/create":         true,
+	"locations/update":         true,
+	"locations/activate":       true,
+	"locations/deactivate":     true,
+	"locations/delete":         true,
+	"app_subscriptions/update": true,
+}
+
+// refreshBatchSize bounds the number of documents fetched and updated per Meilisearch call.
+const refreshBatchSize = 250
+
+// SupportsTopic reports whether deliveries for the topic should be persisted and processed.
+func SupportsTopic(topic string) bool {
+	return supportedTopics[topic]
+}
+
+// WebhookProcessor applies persisted Shopify webhook deliveries to the search index in the
+// background. Mongo is the queue: workers lease events atomically, so several replicas can run
+// processors against the same database.
+type WebhookProcessor struct {
+	events            *repositories.WebhookEventRepository
+	stores            *repositories.StoreRepository
+	versions          *repositories.DocumentVersionRepository
+	collections       *repositories.ShopifyCollectionRepository
+	inventory         *repositories.InventoryRepository
+	shopify           *services.ShopifyService
+	meili             *services.MeilisearchRegistry
+	limits            *services.PlanLimits
+	keys              security.KeyProvider
+	configuredIndexes sync.Map
+	wake              chan struct{}
+	pollInterval      time.Duration
+	lease             time.Duration
+	maxAttempts       int
+}
+
+// storeIndex is the index a webhook is applied to, on the Meilisearch instance hosting the store,
+// along with the per-locale indexes mirroring it when translations are indexed per locale.
+type storeIndex struct {
+	store      *models.Store
+	uid        string
+	localeUIDs map[string]string
+	meili      *services.MeilisearchService
+}
+
+// uids returns the primary index followed by the locale indexes.
+func (i *storeIndex) uids() []string {
+	uids := []string{i.uid}
+	for _, uid := range i.localeUIDs {
+		uids = append(uids, uid)
+	}
+	return uids
+}
+
+func NewWebhookProcessor(cfg *config.Config, keys security.KeyProvider, events *repositories.WebhookEventRepository, stores *repositories.StoreRepository, versions *repositories.DocumentVersionRepository, collections *repositories.ShopifyCollectionRepository, inventory *repositories.InventoryRepository, shopify *services.ShopifyService, meili *services.MeilisearchRegistry, limits *services.PlanLimits) (*WebhookProcessor, error) {
+	if keys == nil {
+		return nil, errors.New("key provider is required")
+	}
+
+	return &WebhookProcessor{
+		events:       events,
+		stores:       stores,
+		versions:     versions,
+		collections:  collections,
+		inventory:    inventory,
+		shopify:      shopify,
+		meili:        meili,
+		limits:       limits,
+		keys:         keys,
+		wake:         make(chan struct{}, 1),
+		pollInterval: defaultPollInterval,
+		lease:        defaultLease,
+		maxAttempts:  defaultMaxAttempts,
+	}, nil
+}
+
+// Start launches the given number of workers. They stop when ctx is cancelled.
+func (p *WebhookProcessor) Start(ctx context.Context, workers int) {
+	if workers <= 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go p.run(ctx)
+	}
+}
+
+// Notify wakes an idle worker so a newly persisted event is picked up without waiting for the
+// next poll. It never blocks.
+func (p *WebhookProcessor) Notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *WebhookProcessor) run(ctx context.Context) {
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain everything that is due before going back to sleep
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+			processed, err := p.ProcessNext(ctx)
+			if err != nil {
+				log.Printf("webhook worker: %v", err)
+				break
+			}
+			if !processed {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessNext claims and processes a single due event. It reports whether an event was claimed.
+func (p *WebhookProcessor) ProcessNext(ctx context.Context) (bool, error) {
+	event, err := p.events.ClaimNext(ctx, p.lease)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim webhook event: %w", err)
+	}
+	if event == nil {
+		return false, nil
+	}
+
+	// Record the outcome even if the worker is shutting down
+	resultCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = p.Process(ctx, event)
+	switch {
+	case err == nil:
+		return true, p.events.Complete(resultCtx, event.ID, models.WebhookStatusProcessed, "")
+	case errors.Is(err, ErrStaleWebhook):
+		return true, p.events.Complete(resultCtx, event.ID, models.WebhookStatusStale, "")
+	case errors.Is(err, ErrDocumentBusy):
+		// Not a failure: wait for the other worker instead of using up an attempt
+		return true, p.events.Postpone(resultCtx, event.ID, time.Now().UTC().Add(baseRetryDelay))
+	case errors.Is(err, services.ErrDocumentLimitReached):
+		return true, p.events.Complete(resultCtx, event.ID, models.WebhookStatusRejected, err.Error())
+	case event.Attempts >= p.maxAttempts:
+		log.Printf("webhook worker: giving up on %s (%s) after %d attempts: %v", event.ID, event.Topic, event.Attempts, err)
+		return true, p.events.Complete(resultCtx, event.ID, models.WebhookStatusFailed, err.Error())
+	default:
+		delay := baseRetryDelay * time.Duration(1<<uint(event.Attempts-1))
+		return true, p.events.Reschedule(resultCtx, event.ID, time.Now().UTC().Add(delay), err.Error())
+	}
+}
+
+// Process applies a single event to the store's index.
+func (p *WebhookProcessor) Process(ctx context.Context, event *models.WebhookEvent) error {
+	store, err := p.stores.GetByShopDomain(ctx, event.ShopDomain)
+	if err != nil {
+		return fmt.Errorf("failed to load store %s: %w", event.ShopDomain, err)
+	}
+
+	meili, err := p.meili.ForStore(store)
+	if err != nil {
+		return err
+	}
+
+	index := &storeIndex{store: store, uid: store.IndexUID(), localeUIDs: store.LocaleIndexUIDs(), meili: meili}
+	if index.uid == "" {
+		return fmt.Errorf("store index not configured")
+	}
+	for _, uid := range index.uids() {
+		p.ensureIndexSettings(uid, meili.BaseURL(), meili.ConfigureProductIndex)
+	}
+
+	payload := []byte(event.Payload)
+	switch event.Topic {
+	case "products/create", "products/update":
+		product, err := services.ParseShopifyProduct(payload)
+		if err != nil {
+			return err
+		}
+		return p.applyProduct(ctx, index, product)
+	case "products/delete":
+		return p.handleProductDelete(ctx, index, payload, event.DeliveredAt())
+	case "product_listings/add", "product_listings/update":
+		product, err := services.ParseShopifyProductListing(payload)
+		if err != nil {
+			return err
+		}
+		return p.applyProduct(ctx, index, product)
+	case "product_listings/remove":
+		return p.handleProductListingRemove(ctx, index, payload, event.DeliveredAt())
+	case "collections/create", "collections/update":
+		return p.handleCollectionUpsert(ctx, index, payload)
+	case "collections/delete":
+		return p.handleCollectionDelete(ctx, index, payload, event.DeliveredAt())
+	case "inventory_levels/update":
+		return p.handleInventoryLevelUpdate(ctx, index, payload)
+	case "locations/create", "locations/update", "locations/activate", "locations/deactivate":
+		return p.handleLocationUpsert(ctx, index, payload)
+	case "locations/delete":
+		return p.handleLocationDelete(ctx, index, payload)
+	case "app_subscriptions/update":
+		return p.handleSubscriptionUpdate(ctx, store, payload)
+	default:
+		return fmt.Errorf("unsupported webhook topic %q", event.Topic)
+	}
+}
+
+// ensureIndexSettings adds missing index settings once per index and process, so stores installed
+// before these attributes existed pick them up.
+func (p *WebhookProcessor) ensureIndexSettings(uid, baseURL string, configure func(string) error) {
+	key := baseURL + "|" + uid
+	if _, done := p.configuredIndexes.LoadOrStore(key, true); done {
+		return
+	}
+	if err := configure(uid); err != nil {
+		p.configuredIndexes.Delete(key)
+		log.Printf("webhook worker: failed to configure index %s: %v", uid, err)
+	}
+}
+
+// advance claims the document for this worker if the change is not older than the version already
+// applied. Changes without a parseable updated_at are applied unversioned.
+func (p *WebhookProcessor) advance(ctx context.Context, store *models.Store, key, updatedAt string) (func(), error) {
+	parsed, err := time.Parse(time.RFC3339, updatedAt)
+	if err != nil {
+		return func() {}, nil
+	}
+	return p.claim(ctx, store, key, parsed, false)
+}
+
+// claim records version as the document's latest version and leases the document to this worker.
+// The returned release must be called once the change reached the index: until then other workers
+// wait for the document, so an older change can never be written after a newer one.
+func (p *WebhookProcessor) claim(ctx context.Context, store *models.Store, key string, version time.Time, deleted bool) (func(), error) {
+	token, err := p.versions.Advance(ctx, store.ID.Hex(), key, version, deleted, p.lease)
+	if err != nil {
+		if err.Error() == "document is being processed" {
+			return nil, ErrDocumentBusy
+		}
+		return nil, err
+	}
+	if token == "" {
+		return nil, ErrStaleWebhook
+	}
+
+	release := func() {
+		// Release even if the worker is shutting down; the lease would otherwise block the document
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := p.versions.Release(releaseCtx, store.ID.Hex(), key, token); err != nil {
+			log.Printf("webhook worker: failed to release %s of %s: %v", key, store.ShopDomain, err)
+		}
+	}
+	return release, nil
+}
+
+func (p *WebhookProcessor) applyProduct(ctx context.Context, index *storeIndex, product *models.ShopifyProduct) error {
+	release, err := p.advance(ctx, index.store, product.DocumentID(), product.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Variant quantities on the product are the freshest totals; they supersede stored levels
+	items := services.InventoryItemsFromProduct(index.store.ID.Hex(), product)
+	if err := p.inventory.ReplaceProductItems(ctx, index.store.ID.Hex(), product.ID, items); err != nil {
+		return fmt.Errorf("failed to store inventory items: %w", err)
+	}
+
+	// Drafts, archived and unpublished products must disappear from storefront search
+	if !product.IsPublished() {
+		return deleteFromIndexes(index, product.DocumentID())
+	}
+
+	memberships, err := p.collections.FindByProducts(ctx, index.store.ID.Hex(), []int64{product.ID})
+	if err != nil {
+		return fmt.Errorf("failed to load collection memberships: %w", err)
+	}
+
+	if err := p.checkDocumentLimit(index, index.uid, product.DocumentID()); err != nil {
+		return err
+	}
+
+	doc := services.NewShopifyProductDocument(index.store, product)
+	doc.Collections, doc.CollectionIDs = productCollections(memberships, product.ID)
+
+	// Metafields and translations are not part of product payloads and come from the Admin API
+	translations := map[string][]models.ShopifyTranslation{}
+	if settings := index.store.Indexing; settings.RequiresLocalization() {
+		accessToken, err := p.accessToken(ctx, index.store)
+		if err != nil {
+			return err
+		}
+		localization, err := p.shopify.GetProductLocalization(ctx, index.store.ShopDomain, accessToken, product.ID, settings.MetafieldNamespaces, settings.Locales)
+		if err != nil {
+			return fmt.Errorf("failed to fetch product localization: %w", err)
+		}
+		services.ApplyMetafields(doc, localization.Metafields)
+		translations = localization.Translations
+		if len(index.localeUIDs) == 0 {
+			services.ApplyTranslations(doc, translations)
+		}
+	}
+
+	document, err := doc.ToDocument()
+	if err != nil {
+		return err
+	}
+	if _, err := index.meili.IndexDocument(index.uid, document); err != nil {
+		return err
+	}
+
+	for locale, uid := range index.localeUIDs {
+		localized, err := services.LocalizedProductDocument(index.store, doc, locale, translations[locale]).ToDocument()
+		if err != nil {
+			return err
+		}
+		if _, err := index.meili.IndexDocument(uid, localized); err != nil {
+			return fmt.Errorf("failed to index %s translation: %w", locale, err)
+		}
+	}
+	return nil
+}
+
+// deleteFromIndexes removes the document from the primary index and every locale index.
+func deleteFromIndexes(index *storeIndex, documentID string) error {
+	for _, uid := range index.uids() {
+		if err := index.meili.DeleteDocument(uid, documentID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDocumentLimit rejects new documents once the store holds as many documents as its plan
+// allows. Updates to documents already in the index are always accepted.
+func (p *WebhookProcessor) checkDocumentLimit(index *storeIndex, uid, documentID string) error {
+	return p.limits.CheckDocuments(index.store, index.meili, uid, []string{documentID})
+}
+
+func (p *WebhookProcessor) handleProductDelete(ctx context.Context, index *storeIndex, payload []byte, deletedAt time.Time) error {
+	var product struct {
+		ID interface{} `json:"id"`
+	}
+	if err := json.Unmarshal(payload, &product); err != nil {
+		return err
+	}
+
+	if product.ID == nil {
+		return fmt.Errorf("product id missing")
+	}
+
+	idStr := fmt.Sprintf("%v", product.ID)
+	if number, ok := product.ID.(float64); ok {
+		idStr = fmt.Sprintf("%.0f", number)
+		if err := p.inventory.DeleteProductItems(ctx, index.store.ID.Hex(), int64(number)); err != nil {
+			return err
+		}
+	}
+
+	return p.deleteProductDocument(ctx, index, idStr, deletedAt)
+}
+
+func (p *WebhookProcessor) handleProductListingRemove(ctx context.Context, index *storeIndex, payload []byte, deletedAt time.Time) error {
+	var listing struct {
+		ProductListing struct {
+			ProductID int64 `json:"product_id"`
+		} `json:"product_listing"`
+	}
+	if err := json.Unmarshal(payload, &listing); err != nil {
+		return err
+	}
+	if listing.ProductListing.ProductID == 0 {
+		return fmt.Errorf("product id missing")
+	}
+
+	return p.deleteProductDocument(ctx, index, fmt.Sprintf("%d", listing.ProductListing.ProductID), deletedAt)
+}
+
+func (p *WebhookProcessor) deleteProductDocument(ctx context.Context, index *storeIndex, documentID string, deletedAt time.Time) error {
+	// Delete payloads carry no updated_at; stamp the deletion with the time Shopify sent it so that
+	// updates produced before the deletion cannot resurrect the product, while updates sent after it
+	// still apply when the deletion is processed late or retried.
+	release, err := p.claim(ctx, index.store, documentID, deletedAt, true)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return deleteFromIndexes(index, documentID)
+}
+
+func (p *WebhookProcessor) handleCollectionUpsert(ctx context.Context, index *storeIndex, payload []byte) error {
+	var collection models.ShopifyCollection
+	if err := json.Unmarshal(payload, &collection); err != nil {
+		return err
+	}
+	if collection.ID == 0 {
+		return fmt.Errorf("collection id missing")
+	}
+
+	release, err := p.advance(ctx, index.store, fmt.Sprintf("collection:%d", collection.ID), collection.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Collection payloads do not list their products, so memberships come from the Admin API
+	accessToken, err := p.accessToken(ctx, index.store)
+	if err != nil {
+		return err
+	}
+	productIDs, err := p.shopify.ListCollectionProductIDs(ctx, index.store.ShopDomain, accessToken, collection.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch collection products: %w", err)
+	}
+
+	previous, err := p.collections.Upsert(ctx, &models.CollectionMembership{
+		StoreID:      index.store.ID.Hex(),
+		CollectionID: collection.ID,
+		Handle:       collection.Handle,
+		Title:        collection.Title,
+		ProductIDs:   productIDs,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store collection: %w", err)
+	}
+
+	if err := p.applyCollectionDocument(index, &collection); err != nil {
+		return err
+	}
+
+	return p.refreshProducts(ctx, index, append(previous, productIDs...))
+}
+
+// applyCollectionDocument keeps the collection's own search document in the store's collection
+// index in step with the webhook.
+func (p *WebhookProcessor) applyCollectionDocument(index *storeIndex, collection *models.ShopifyCollection) error {
+	uid := index.store.ContentIndexUID(models.DocumentTypeCollection)
+	p.ensureIndexSettings(uid, index.meili.BaseURL(), index.meili.ConfigureContentIndex)
+
+	if !collection.IsPublished() {
+		return index.meili.DeleteDocument(uid, fmt.Sprintf("%d", collection.ID))
+	}
+	if err := p.checkDocumentLimit(index, uid, fmt.Sprintf("%d", collection.ID)); err != nil {
+		return err
+	}
+
+	document, err := services.NewCollectionDocument(index.store, collection).ToDocument()
+	if err != nil {
+		return err
+	}
+	_, err = index.meili.IndexDocument(uid, document)
+	return err
+}
+
+func (p *WebhookProcessor) handleCollectionDelete(ctx context.Context, index *storeIndex, payload []byte, deletedAt time.Time) error {
+	var collection models.ShopifyCollection
+	if err := json.Unmarshal(payload, &collection); err != nil {
+		return err
+	}
+	if collection.ID == 0 {
+		return fmt.Errorf("collection id missing")
+	}
+
+	// Like product deletes, stamp the deletion with the time Shopify sent it so that updates produced
+	// before it, and content syncs listing the collection, cannot bring it back, while a late or
+	// retried delete cannot mask a later create or update
+	release, err := p.claim(ctx, index.store, fmt.Sprintf("collection:%d", collection.ID), deletedAt, true)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	previous, err := p.collections.Delete(ctx, index.store.ID.Hex(), collection.ID)
+	if err != nil {
+		return fmt.Errorf("failed to delete collection: %w", err)
+	}
+
+	uid := index.store.ContentIndexUID(models.DocumentTypeCollection)
+	if err := index.meili.DeleteDocument(uid, fmt.Sprintf("%d", collection.ID)); err != nil {
+		return err
+	}
+
+	return p.refreshProducts(ctx, index, previous)
+}
+
+func (p *WebhookProcessor) handleInventoryLevelUpdate(ctx context.Context, index *storeIndex, payload []byte) error {
+	var level models.ShopifyInventoryLevel
+	if err := json.Unmarshal(payload, &level); err != nil {
+		return err
+	}
+	if level.InventoryItemID == 0 {
+		return fmt.Errorf("inventory item id missing")
+	}
+
+	key := fmt.Sprintf("inventory_level:%d:%d", level.InventoryItemID, level.LocationID)
+	release, err := p.advance(ctx, index.store, key, level.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	item, err := p.inventory.FindItem(ctx, index.store.ID.Hex(), level.InventoryItemID)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		// The item belongs to a product we have not seen yet; its product webhook will carry stock
+		return nil
+	}
+
+	// A level webhook only describes one location; fetch every location so totals stay correct
+	accessToken, err := p.accessToken(ctx, index.store)
+	if err != nil {
+		return err
+	}
+	shopifyLevels, err := p.shopify.ListInventoryLevels(ctx, index.store.ShopDomain, accessToken, level.InventoryItemID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch inventory levels: %w", err)
+	}
+
+	levels := make([]models.InventoryLevel, 0, len(shopifyLevels))
+	for _, shopifyLevel := range shopifyLevels {
+		available := 0
+		if shopifyLevel.Available != nil {
+			available = *shopifyLevel.Available
+		}
+		levels = append(levels, models.InventoryLevel{
+			InventoryItemID: shopifyLevel.InventoryItemID,
+			LocationID:      shopifyLevel.LocationID,
+			Available:       available,
+		})
+	}
+
+	if err := p.inventory.ReplaceItemLevels(ctx, index.store.ID.Hex(), level.InventoryItemID, levels); err != nil {
+		return fmt.Errorf("failed to store inventory levels: %w", err)
+	}
+
+	return p.refreshProducts(ctx, index, []int64{item.ProductID})
+}
+
+func (p *WebhookProcessor) handleLocationUpsert(ctx context.Context, index *storeIndex, payload []byte) error {
+	var location models.ShopifyLocation
+	if err := json.Unmarshal(payload, &location); err != nil {
+		return err
+	}
+	if location.ID == 0 {
+		return fmt.Errorf("location id missing")
+	}
+
+	release, err := p.advance(ctx, index.store, fmt.Sprintf("location:%d", location.ID), location.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := p.inventory.UpsertLocation(ctx, &models.Location{
+		StoreID:    index.store.ID.Hex(),
+		LocationID: location.ID,
+		Name:       location.Name,
+		Active:     location.Active,
+	}); err != nil {
+		return fmt.Errorf("failed to store location: %w", err)
+	}
+
+	productIDs, err := p.inventory.ProductIDsAtLocation(ctx, index.store.ID.Hex(), location.ID)
+	if err != nil {
+		return err
+	}
+	return p.refreshProducts(ctx, index, productIDs)
+}
+
+func (p *WebhookProcessor) handleLocationDelete(ctx context.Context, index *storeIndex, payload []byte) error {
+	var location models.ShopifyLocation
+	if err := json.Unmarshal(payload, &location); err != nil {
+		return err
+	}
+	if location.ID == 0 {
+		return fmt.Errorf("location id missing")
+	}
+
+	productIDs, err := p.inventory.ProductIDsAtLocation(ctx, index.store.ID.Hex(), location.ID)
+	if err != nil {
+		return err
+	}
+	if err := p.inventory.DeleteLocation(ctx, index.store.ID.Hex(), location.ID); err != nil {
+		return fmt.Errorf("failed to delete location: %w", err)
+	}
+	return p.refreshProducts(ctx, index, productIDs)
+}
+
+// handleSubscriptionUpdate mirrors billing changes made outside the app, such as a merchant
+// cancelling the charge or Shopify freezing it, onto the store's plan. Updates for the charge
+// awaiting approval only change the plan once Shopify reports it active.
+func (p *WebhookProcessor) handleSubscriptionUpdate(ctx context.Context, store *models.Store, payload []byte) error {
+	var update struct {
+		AppSubscription struct {
+			ID     string `json:"admin_graphql_api_id"`
+			Status string `json:"status"`
+		} `json:"app_subscription"`
+	}
+	if err := json.Unmarshal(payload, &update); err != nil {
+		return err
+	}
+	status := strings.ToUpper(update.AppSubscription.Status)
+
+	if pending := store.PendingSubscription; pending != nil && pending.ID == update.AppSubscription.ID {
+		record := *pending
+		record.Status = status
+		switch status {
+		case models.SubscriptionStatusActive:
+			now := time.Now().UTC()
+			record.ActivatedAt = &now
+			return p.stores.ActivateSubscription(ctx, store.ID.Hex(), &record)
+		case models.SubscriptionStatusPending:
+			return p.stores.UpdatePendingSubscription(ctx, store.ID.Hex(), &record)
+		default:
+			return p.stores.UpdatePendingSubscription(ctx, store.ID.Hex(), nil)
+		}
+	}
+
+	current := store.Subscription
+	if current == nil || current.ID != update.AppSubscription.ID {
+		// Superseded or unknown charges do not affect the plan
+		return nil
+	}
+
+	record := *current
+	record.Status = status
+	switch record.Status {
+	case models.SubscriptionStatusActive:
+		if store.PlanLevel == record.PlanLevel {
+			return p.stores.UpdateSubscription(ctx, store.ID.Hex(), &record)
+		}
+		// A frozen charge that was paid again restores its plan
+		now := time.Now().UTC()
+		record.ActivatedAt = &now
+		return p.stores.UpdatePlan(ctx, store.ID.Hex(), record.PlanLevel, &record)
+	case models.SubscriptionStatusCancelled, models.SubscriptionStatusExpired, models.SubscriptionStatusDeclined, models.SubscriptionStatusFrozen:
+		if store.PlanLevel != record.PlanLevel {
+			return p.stores.UpdateSubscription(ctx, store.ID.Hex(), &record)
+		}
+		return p.stores.UpdatePlan(ctx, store.ID.Hex(), models.PlanFree, &record)
+	default:
+		return p.stores.UpdateSubscription(ctx, store.ID.Hex(), &record)
+	}
+}
+
+// refreshProducts recomputes collection memberships and in-stock flags for indexed products and
+// applies them as partial document updates. Products that are not in the index are skipped so
+// that unpublished products are not recreated as partial documents.
+func (p *WebhookProcessor) refreshProducts(ctx context.Context, index *storeIndex, productIDs []int64) error {
+	productIDs = uniqueIDs(productIDs)
+	storeID := index.store.ID.Hex()
+
+	for start := 0; start < len(productIDs); start += refreshBatchSize {
+		end := start + refreshBatchSize
+		if end > len(productIDs) {
+			end = len(productIDs)
+		}
+		batch := productIDs[start:end]
+
+		documentIDs := make([]string, len(batch))
+		for i, id := range batch {
+			documentIDs[i] = fmt.Sprintf("%d", id)
+		}
+
+		memberships, err := p.collections.FindByProducts(ctx, storeID, batch)
+		if err != nil {
+			return fmt.Errorf("failed to load collection memberships: %w", err)
+		}
+		items, err := p.inventory.FindItemsByProducts(ctx, storeID, batch)
+		if err != nil {
+			return fmt.Errorf("failed to load inventory items: %w", err)
+		}
+		itemIDs := make([]int64, 0, len(items))
+		itemsByProduct := make(map[int64][]models.InventoryItem)
+		for _, item := range items {
+			itemIDs = append(itemIDs, item.InventoryItemID)
+			itemsByProduct[item.ProductID] = append(itemsByProduct[item.ProductID], item)
+		}
+		levels, err := p.inventory.FindLevelsByItems(ctx, storeID, itemIDs)
+		if err != nil {
+			return fmt.Errorf("failed to load inventory levels: %w", err)
+		}
+		inactive, err := p.inventory.InactiveLocationIDs(ctx, storeID)
+		if err != nil {
+			return fmt.Errorf("failed to load locations: %w", err)
+		}
+
+		updates := make([]models.Document, len(batch))
+		for i, productID := range batch {
+			handles, collectionIDs := productCollections(memberships, productID)
+			updates[i] = models.Document{
+				"id":             productID,
+				"collections":    handles,
+				"collection_ids": collectionIDs,
+			}
+			// Products without known inventory items keep the stock flag computed at indexing time
+			if productItems, ok := itemsByProduct[productID]; ok {
+				updates[i]["in_stock"] = services.ProductInStock(productItems, levels, inactive)
+			}
+		}
+
+		// Locale indexes may lag behind the primary index, so existence is checked per index
+		for _, uid := range index.uids() {
+			existing, err := index.meili.ExistingDocumentIDs(uid, documentIDs)
+			if err != nil {
+				return err
+			}
+			documents := make([]models.Document, 0, len(updates))
+			for i, update := range updates {
+				if existing[documentIDs[i]] {
+					documents = append(documents, update)
+				}
+			}
+			if err := index.meili.UpdateDocuments(uid, documents); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *WebhookProcessor) accessToken(ctx context.Context, store *models.Store) (string, error) {
+	return decryptAccessToken(ctx, p.keys, store)
+}
+
+// productCollections returns the handles and IDs of the collections containing the product.
+func productCollections(memberships []*models.CollectionMembership, productID int64) ([]string, []int64) {
+	handles := []string{}
+	ids := []int64{}
+	for _, membership := range memberships {
+		for _, id := range membership.ProductIDs {
+			if id == productID {
+				handles = append(handles, membership.Handle)
+				ids = append(ids, membership.CollectionID)
+				break
+			}
+		}
+	}
+	return handles, ids
+}
+
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	result := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
+}
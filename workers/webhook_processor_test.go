@@ -0,0 +1,333 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mgsearch/models"
+	"mgsearch/repositories"
+	"mgsearch/services"
+	"mgsearch/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const workerTestShop = "worker-test.myshopify.com"
+
+// processorTest wires a WebhookProcessor to the test database, a mock Meilisearch and a fake
+// Shopify Admin API.
+type processorTest struct {
+	processor   *WebhookProcessor
+	store       *models.Store
+	meili       *testhelpers.MockMeilisearch
+	stores      *repositories.StoreRepository
+	versions    *repositories.DocumentVersionRepository
+	collections *repositories.ShopifyCollectionRepository
+	inventory   *repositories.InventoryRepository
+	// levels are the inventory levels the fake Admin API reports, by inventory item ID
+	levels map[int64][]models.ShopifyInventoryLevel
+}
+
+func setupProcessorTest(t *testing.T) *processorTest {
+	ctx := context.Background()
+	cfg := testhelpers.TestConfig()
+
+	_, db, cleanup, err := testhelpers.SetupTestDatabase(ctx, cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		testhelpers.CleanupTestDatabase(ctx, db)
+		cleanup()
+	})
+
+	test := &processorTest{
+		meili:       testhelpers.NewMockMeilisearch(),
+		stores:      repositories.NewStoreRepository(db),
+		versions:    repositories.NewDocumentVersionRepository(db),
+		collections: repositories.NewShopifyCollectionRepository(db),
+		inventory:   repositories.NewInventoryRepository(db),
+		levels:      map[int64][]models.ShopifyInventoryLevel{},
+	}
+	t.Cleanup(test.meili.Close)
+	cfg.MeilisearchURL = test.meili.URL()
+
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/admin/api/2024-10/inventory_levels.json":
+			var itemID int64
+			fmt.Sscanf(r.URL.Query().Get("inventory_item_ids"), "%d", &itemID)
+			levels := test.levels[itemID]
+			if levels == nil {
+				levels = []models.ShopifyInventoryLevel{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"inventory_levels": levels})
+		case "/admin/api/2024-10/collections/301/products.json":
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"products": []map[string]int64{{"id": 101}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(admin.Close)
+
+	shopify := services.NewShopifyService(cfg)
+	shopify.SetBaseURL(admin.URL)
+
+	keys := testhelpers.TestKeyProvider(cfg)
+	meiliRegistry, err := services.NewMeilisearchRegistry(cfg, keys, services.NewMeilisearchService(cfg))
+	require.NoError(t, err)
+
+	accessToken, err := keys.Encrypt(ctx, workerTestShop, []byte("shpat_worker_test"))
+	require.NoError(t, err)
+	test.store, err = test.stores.CreateOrUpdate(ctx, &models.Store{
+		ShopDomain:           workerTestShop,
+		ShopName:             "Worker Test Store",
+		EncryptedAccessToken: accessToken,
+		ProductIndexUID:      "worker-test_all_products",
+		MeilisearchIndexUID:  "worker-test_all_products",
+		InstalledAt:          time.Now().UTC(),
+	})
+	require.NoError(t, err)
+
+	test.processor, err = NewWebhookProcessor(cfg, keys, repositories.NewWebhookEventRepository(db), test.stores, test.versions, test.collections, test.inventory, shopify, meiliRegistry, services.NewPlanLimits(repositories.NewUsageRepository(db)))
+	require.NoError(t, err)
+	return test
+}
+
+func (p *processorTest) process(t *testing.T, topic string, payload interface{}) error {
+	return p.processTriggeredAt(t, topic, payload, time.Now().UTC())
+}
+
+// processTriggeredAt processes an event Shopify sent at triggeredAt, as happens when a delivery
+// waited in the queue or was retried.
+func (p *processorTest) processTriggeredAt(t *testing.T, topic string, payload interface{}, triggeredAt time.Time) error {
+	raw, err := json.Marshal(payload)
+	require.NoError(t, err)
+	return p.processor.Process(context.Background(), &models.WebhookEvent{
+		ID:          fmt.Sprintf("%s-%d", topic, time.Now().UnixNano()),
+		ShopDomain:  workerTestShop,
+		Topic:       topic,
+		Payload:     string(raw),
+		TriggeredAt: &triggeredAt,
+		ReceivedAt:  time.Now().UTC(),
+	})
+}
+
+func TestWebhookProcessor_InventoryLevelUpdate(t *testing.T) {
+	test := setupProcessorTest(t)
+	ctx := context.Background()
+	storeID := test.store.ID.Hex()
+	uid := test.store.IndexUID()
+
+	// Product 101 is indexed; product 202 was never published so it has no document
+	for productID, itemID := range map[int64]int64{101: 5101, 202: 5202} {
+		require.NoError(t, test.inventory.ReplaceProductItems(ctx, storeID, productID, []models.InventoryItem{
+			{InventoryItemID: itemID, ProductID: productID, Tracked: true},
+		}))
+		available := 4
+		test.levels[itemID] = []models.ShopifyInventoryLevel{{InventoryItemID: itemID, LocationID: 1, Available: &available}}
+	}
+	test.meili.AddDocuments(uid, models.Document{"id": 101, "title": "Tee", "in_stock": false})
+
+	t.Run("unindexed product", func(t *testing.T) {
+		err := test.process(t, "inventory_levels/update", map[string]interface{}{
+			"inventory_item_id": 5202,
+			"location_id":       1,
+			"available":         4,
+			"updated_at":        time.Now().UTC().Format(time.RFC3339),
+		})
+		require.NoError(t, err)
+		assert.Nil(t, test.meili.Document(uid, "202"), "no partial document may be created")
+	})
+
+	t.Run("indexed product", func(t *testing.T) {
+		err := test.process(t, "inventory_levels/update", map[string]interface{}{
+			"inventory_item_id": 5101,
+			"location_id":       1,
+			"available":         4,
+			"updated_at":        time.Now().UTC().Format(time.RFC3339),
+		})
+		require.NoError(t, err)
+
+		document := test.meili.Document(uid, "101")
+		require.NotNil(t, document)
+		assert.Equal(t, true, document["in_stock"])
+		assert.Equal(t, "Tee", document["title"])
+	})
+
+	t.Run("unknown inventory item", func(t *testing.T) {
+		err := test.process(t, "inventory_levels/update", map[string]interface{}{
+			"inventory_item_id": 5303,
+			"location_id":       1,
+			"updated_at":        time.Now().UTC().Format(time.RFC3339),
+		})
+		require.NoError(t, err)
+		assert.Len(t, test.meili.DocumentIDs(uid), 1)
+	})
+}
+
+func TestWebhookProcessor_CollectionDelete(t *testing.T) {
+	test := setupProcessorTest(t)
+	ctx := context.Background()
+	uid := test.store.IndexUID()
+	collectionUID := test.store.ContentIndexUID(models.DocumentTypeCollection)
+
+	_, err := test.collections.Upsert(ctx, &models.CollectionMembership{
+		StoreID:      test.store.ID.Hex(),
+		CollectionID: 301,
+		Handle:       "summer",
+		Title:        "Summer",
+		ProductIDs:   []int64{101, 202},
+	})
+	require.NoError(t, err)
+	test.meili.AddDocuments(uid, models.Document{"id": 101, "title": "Tee", "collections": []string{"summer"}, "collection_ids": []int64{301}})
+	test.meili.AddDocuments(collectionUID, models.Document{"id": 301, "title": "Summer"})
+
+	require.NoError(t, test.process(t, "collections/delete", map[string]interface{}{"id": 301}))
+
+	assert.Nil(t, test.meili.Document(collectionUID, "301"))
+
+	document := test.meili.Document(uid, "101")
+	require.NotNil(t, document)
+	assert.Empty(t, document["collections"])
+	assert.Empty(t, document["collection_ids"])
+	assert.Equal(t, "Tee", document["title"])
+	assert.Nil(t, test.meili.Document(uid, "202"), "no partial document may be created")
+
+	memberships, err := test.collections.FindByProducts(ctx, test.store.ID.Hex(), []int64{101, 202})
+	require.NoError(t, err)
+	assert.Empty(t, memberships)
+}
+
+func TestWebhookProcessor_LateCollectionDelete(t *testing.T) {
+	test := setupProcessorTest(t)
+	collectionUID := test.store.ContentIndexUID(models.DocumentTypeCollection)
+	now := time.Now().UTC()
+
+	// The collection was deleted and recreated; the delete waited in the queue and is processed last
+	require.NoError(t, test.process(t, "collections/create", map[string]interface{}{
+		"id":           301,
+		"handle":       "summer",
+		"title":        "Summer",
+		"published_at": "2024-01-01T00:00:00Z",
+		"updated_at":   now.Add(-time.Minute).Format(time.RFC3339),
+	}))
+	err := test.processTriggeredAt(t, "collections/delete", map[string]interface{}{"id": 301}, now.Add(-2*time.Minute))
+	assert.ErrorIs(t, err, ErrStaleWebhook)
+
+	assert.NotNil(t, test.meili.Document(collectionUID, "301"))
+	memberships, err := test.collections.FindByProducts(context.Background(), test.store.ID.Hex(), []int64{101})
+	require.NoError(t, err)
+	assert.Len(t, memberships, 1)
+}
+
+func TestWebhookProcessor_ProductListingRemove(t *testing.T) {
+	test := setupProcessorTest(t)
+	ctx := context.Background()
+	uid := test.store.IndexUID()
+	localeUID := test.store.LocaleIndexUID("fr")
+
+	require.NoError(t, test.stores.UpdateIndexing(ctx, test.store.ID.Hex(), models.StoreIndexing{
+		Locales:    []string{"fr"},
+		LocaleMode: models.LocaleModeIndexes,
+	}))
+	test.meili.AddDocuments(uid, models.Document{"id": 101, "title": "Tee"})
+	test.meili.AddDocuments(localeUID, models.Document{"id": 101, "title": "T-shirt"})
+
+	require.NoError(t, test.process(t, "product_listings/remove", map[string]interface{}{
+		"product_listing": map[string]interface{}{"product_id": 101},
+	}))
+	assert.Nil(t, test.meili.Document(uid, "101"))
+	assert.Nil(t, test.meili.Document(localeUID, "101"))
+
+	// An update produced before the removal must not bring the product back
+	err := test.process(t, "products/update", map[string]interface{}{
+		"id":           101,
+		"title":        "Tee",
+		"handle":       "tee",
+		"status":       "active",
+		"published_at": "2024-01-01T00:00:00Z",
+		"updated_at":   time.Now().UTC().Add(-time.Minute).Format(time.RFC3339),
+	})
+	assert.ErrorIs(t, err, ErrStaleWebhook)
+	assert.Nil(t, test.meili.Document(uid, "101"))
+}
+
+func TestWebhookProcessor_LateProductDelete(t *testing.T) {
+	test := setupProcessorTest(t)
+	uid := test.store.IndexUID()
+	now := time.Now().UTC()
+
+	product := func(updatedAt time.Time) map[string]interface{} {
+		return map[string]interface{}{
+			"id":           101,
+			"title":        "Tee",
+			"handle":       "tee",
+			"status":       "active",
+			"published_at": "2024-01-01T00:00:00Z",
+			"updated_at":   updatedAt.Format(time.RFC3339),
+		}
+	}
+
+	// The product was deleted and re-listed; the update arrives first and the delete is retried later
+	require.NoError(t, test.process(t, "products/update", product(now.Add(-time.Minute))))
+	err := test.processTriggeredAt(t, "products/delete", map[string]interface{}{"id": 101}, now.Add(-2*time.Minute))
+	assert.ErrorIs(t, err, ErrStaleWebhook)
+	assert.NotNil(t, test.meili.Document(uid, "101"), "a delete sent before the update must not remove the product")
+
+	// A delete that waited in the queue must not mask a listing sent after it
+	require.NoError(t, test.processTriggeredAt(t, "product_listings/remove", map[string]interface{}{
+		"product_listing": map[string]interface{}{"product_id": 202},
+	}, now.Add(-2*time.Minute)))
+	require.NoError(t, test.process(t, "product_listings/add", map[string]interface{}{
+		"product_listing": map[string]interface{}{
+			"product_id":   202,
+			"title":        "Cap",
+			"handle":       "cap",
+			"published_at": "2024-01-01T00:00:00Z",
+			"updated_at":   now.Add(-time.Minute).Format(time.RFC3339),
+		},
+	}))
+	assert.NotNil(t, test.meili.Document(uid, "202"))
+}
+
+func TestWebhookProcessor_DocumentBusy(t *testing.T) {
+	test := setupProcessorTest(t)
+	ctx := context.Background()
+	storeID := test.store.ID.Hex()
+	uid := test.store.IndexUID()
+
+	update := func(updatedAt time.Time) error {
+		return test.process(t, "products/update", map[string]interface{}{
+			"id":           101,
+			"title":        "Tee",
+			"handle":       "tee",
+			"status":       "active",
+			"published_at": "2024-01-01T00:00:00Z",
+			"updated_at":   updatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	// Another worker is applying an older change to the product
+	token, err := test.versions.Advance(ctx, storeID, "101", time.Now().Add(-time.Hour), false, time.Minute)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	assert.ErrorIs(t, update(time.Now()), ErrDocumentBusy)
+	assert.Nil(t, test.meili.Document(uid, "101"))
+
+	require.NoError(t, test.versions.Release(ctx, storeID, "101", token))
+	require.NoError(t, update(time.Now()))
+	assert.NotNil(t, test.meili.Document(uid, "101"))
+
+	// Once the newer change is applied the older one is stale
+	token, err = test.versions.Advance(ctx, storeID, "101", time.Now().Add(-time.Hour), false, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, token)
+}